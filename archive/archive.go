@@ -0,0 +1,379 @@
+// Package archive streams the objects under a prefix into a tar.gz or zip
+// archive and extracts archives back into a prefix, without staging them on
+// local disk. It works on any storage.Store.
+//
+//	w.Header().Set("Content-Type", "application/gzip")
+//	err := archive.Export(ctx, storage.FromGCS(c), "users/42/", w, archive.Options{})
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+// Format is an archive format.
+type Format string
+
+const (
+	TarGz Format = "tar.gz"
+	Zip   Format = "zip"
+)
+
+var (
+	// ErrUnsafePath is returned by Import for an entry that would be written
+	// outside the destination prefix.
+	ErrUnsafePath = errors.New("archive: unsafe entry path")
+	// ErrLimitExceeded is returned by Import when an archive exceeds Limits.
+	ErrLimitExceeded = errors.New("archive: limit exceeded")
+)
+
+// Options configures Export.
+type Options struct {
+	// Format defaults to TarGz.
+	Format Format
+}
+
+// Limits bound what Import extracts. Zero fields use the defaults.
+type Limits struct {
+	// MaxFiles is the number of entries. Defaults to 10000.
+	MaxFiles int
+	// MaxFileSize is the uncompressed size of one entry. Defaults to 1 GiB.
+	MaxFileSize int64
+	// MaxTotalSize is the uncompressed size of all entries. Defaults to 10 GiB.
+	MaxTotalSize int64
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxFiles == 0 {
+		l.MaxFiles = 10000
+	}
+	if l.MaxFileSize == 0 {
+		l.MaxFileSize = 1 << 30
+	}
+	if l.MaxTotalSize == 0 {
+		l.MaxTotalSize = 10 << 30
+	}
+	return l
+}
+
+// Export writes every object under prefix to w as an archive. Entry names are
+// the keys relative to prefix. A prefix is a directory: "users/42" exports
+// "users/42/a.txt" as "a.txt" and leaves out "users/420/".
+func Export(ctx context.Context, src storage.Store, prefix string, w io.Writer, opts Options) error {
+	prefix = dirPrefix(prefix)
+	keys, err := src.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("archive: list %s: %w", prefix, err)
+	}
+
+	switch opts.Format {
+	case TarGz, "":
+		return exportTar(ctx, src, prefix, keys, w)
+	case Zip:
+		return exportZip(ctx, src, prefix, keys, w)
+	}
+	return fmt.Errorf("archive: unknown format %q", opts.Format)
+}
+
+// ExportObject writes the archive of prefix to the object key of dst. The
+// archive is streamed, and the write is aborted if the export fails, so a
+// truncated archive is never left at key.
+func ExportObject(ctx context.Context, src storage.Store, prefix string, dst storage.Store, key string, opts Options) error {
+	contentType := "application/gzip"
+	if opts.Format == Zip {
+		contentType = "application/zip"
+	}
+
+	exportCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	exported := make(chan error, 1)
+	go func() {
+		err := Export(exportCtx, src, prefix, pw, opts)
+		pw.CloseWithError(err)
+		exported <- err
+	}()
+
+	err := dst.Write(ctx, key, pr, &storage.Object{Key: key, ContentType: contentType})
+	pr.CloseWithError(err)
+	if err != nil {
+		cancel()
+		<-exported
+		return err
+	}
+
+	// A Store must fail Write when reading fails, but make sure a store that
+	// committed anyway does not keep the truncated archive.
+	if err := <-exported; err != nil {
+		dst.Delete(ctx, key)
+		return err
+	}
+	return nil
+}
+
+func exportTar(ctx context.Context, src storage.Store, prefix string, keys []string, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") || key == prefix {
+			continue
+		}
+		obj, err := src.Stat(ctx, key)
+		if err != nil {
+			return fmt.Errorf("archive: stat %s: %w", key, err)
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(key, prefix),
+			Size:     obj.Size,
+			Mode:     0644,
+			ModTime:  obj.Updated,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyObject(ctx, src, key, tw, obj.Size); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func exportZip(ctx context.Context, src storage.Store, prefix string, keys []string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") || key == prefix {
+			continue
+		}
+		obj, err := src.Stat(ctx, key)
+		if err != nil {
+			return fmt.Errorf("archive: stat %s: %w", key, err)
+		}
+		hdr := &zip.FileHeader{
+			Name:     strings.TrimPrefix(key, prefix),
+			Method:   zip.Deflate,
+			Modified: obj.Updated,
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyObject(ctx, src, key, fw, obj.Size); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// copyObject copies exactly size bytes of key to w, failing if the object
+// changed size since it was listed.
+func copyObject(ctx context.Context, src storage.Store, key string, w io.Writer, size int64) error {
+	r, err := src.Open(ctx, key)
+	if err != nil {
+		return fmt.Errorf("archive: open %s: %w", key, err)
+	}
+	defer r.Close()
+
+	n, err := io.Copy(w, io.LimitReader(r, size+1))
+	if err != nil {
+		return fmt.Errorf("archive: read %s: %w", key, err)
+	}
+	if n != size {
+		return fmt.Errorf("archive: %s changed size during export", key)
+	}
+	return nil
+}
+
+// Import extracts a tar.gz archive read from r into prefix and returns the
+// keys written. Only regular files are extracted.
+func Import(ctx context.Context, r io.Reader, dst storage.Store, prefix string, limits Limits) ([]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	defer gz.Close()
+
+	ex := newExtractor(dst, prefix, limits)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return ex.keys, nil
+		}
+		if err != nil {
+			return ex.keys, fmt.Errorf("archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := ex.extract(ctx, hdr.Name, hdr.Size, tr); err != nil {
+			return ex.keys, err
+		}
+	}
+}
+
+// ImportZip extracts the zip archive of size bytes in r into prefix and
+// returns the keys written. Zip needs random access to its central
+// directory, so it cannot be read from a stream.
+func ImportZip(ctx context.Context, r io.ReaderAt, size int64, dst storage.Store, prefix string, limits Limits) ([]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+
+	ex := newExtractor(dst, prefix, limits)
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if err := ex.extractZip(ctx, f); err != nil {
+			return ex.keys, err
+		}
+	}
+	return ex.keys, nil
+}
+
+// extractor writes archive entries under a prefix within limits.
+type extractor struct {
+	dst    storage.Store
+	prefix string
+	limits Limits
+	total  int64
+	keys   []string
+}
+
+func newExtractor(dst storage.Store, prefix string, limits Limits) *extractor {
+	return &extractor{dst: dst, prefix: dirPrefix(prefix), limits: limits.withDefaults()}
+}
+
+// dirPrefix returns prefix ending in "/", so it only matches the keys of
+// one directory. The empty prefix, the whole bucket, is kept.
+func dirPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+func (ex *extractor) extractZip(ctx context.Context, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return ex.extract(ctx, f.Name, int64(f.UncompressedSize64), rc)
+}
+
+// extract writes one entry of the declared size. The declared size is
+// checked up front and enforced while reading, since it may lie.
+func (ex *extractor) extract(ctx context.Context, name string, size int64, r io.Reader) error {
+	rel, err := safePath(name)
+	if err != nil {
+		return err
+	}
+	if len(ex.keys) >= ex.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, ex.limits.MaxFiles)
+	}
+	if size > ex.limits.MaxFileSize {
+		return fmt.Errorf("%w: %s is larger than %d bytes", ErrLimitExceeded, name, ex.limits.MaxFileSize)
+	}
+	if ex.total+size > ex.limits.MaxTotalSize {
+		return fmt.Errorf("%w: archive is larger than %d bytes", ErrLimitExceeded, ex.limits.MaxTotalSize)
+	}
+
+	key := ex.prefix + rel
+	lr := &limitedReader{r: r, n: size}
+	obj := &storage.Object{Key: key, Size: size, ContentType: mime.TypeByExtension(path.Ext(rel))}
+	if err := ex.dst.Write(ctx, key, lr, obj); err != nil {
+		if lr.exceeded {
+			return fmt.Errorf("%w: %s is larger than declared", ErrLimitExceeded, name)
+		}
+		return fmt.Errorf("archive: write %s: %w", key, err)
+	}
+
+	ex.total += size
+	ex.keys = append(ex.keys, key)
+	return nil
+}
+
+// safePath returns name as a clean relative path, rejecting absolute paths
+// and paths that escape the destination.
+func safePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) ||
+		(len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	return clean, nil
+}
+
+// limitedReader fails once more than n bytes are read. The excess is
+// detected by the read that reaches n, which then returns no data, so a
+// Store that stops reading at the declared size still sees the error
+// instead of committing the first n bytes.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrLimitExceeded
+	}
+	if l.n <= 0 {
+		if l.more() {
+			return 0, ErrLimitExceeded
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n == 0 && err == nil && l.more() {
+		// Withhold the last bytes too: io.ReadFull drops the error of a
+		// read that completes the buffer.
+		return 0, ErrLimitExceeded
+	}
+	return n, err
+}
+
+// more reports whether r has data past the limit.
+func (l *limitedReader) more() bool {
+	var b [1]byte
+	for {
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			l.exceeded = true
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
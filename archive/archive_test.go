@@ -0,0 +1,235 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{
+		"users/42/a.txt":       "hello",
+		"users/42/docs/b.json": `{"b":1}`,
+		"users/42/empty":       "",
+		"users/43/other.txt":   "not exported",
+	}
+
+	for _, format := range []Format{TarGz, Zip} {
+		t.Run(string(format), func(t *testing.T) {
+			c := fake.New("test")
+			for k, v := range files {
+				if err := c.Put(ctx, k, []byte(v)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store := storage.FromGCS(c)
+
+			if err := ExportObject(ctx, store, "users/42/", store, "exports/42", Options{Format: format}); err != nil {
+				t.Fatalf("ExportObject() error = %v", err)
+			}
+			data, err := c.Get(ctx, "exports/42")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			if format == Zip {
+				keys, err = ImportZip(ctx, bytes.NewReader(data), int64(len(data)), store, "restore/", Limits{})
+			} else {
+				keys, err = Import(ctx, bytes.NewReader(data), store, "restore/", Limits{})
+			}
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+			want := []string{"restore/a.txt", "restore/docs/b.json", "restore/empty"}
+			if !reflect.DeepEqual(keys, want) {
+				t.Errorf("Import() keys = %v, want %v", keys, want)
+			}
+			for _, k := range want {
+				got, err := c.Get(ctx, k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if orig := files["users/42/"+k[len("restore/"):]]; string(got) != orig {
+					t.Errorf("%s = %q, want %q", k, got, orig)
+				}
+			}
+		})
+	}
+}
+
+func TestExport_PrefixWithoutSlash(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New("test")
+	for k, v := range map[string]string{"users/42/a.txt": "a", "users/420/b.txt": "b"} {
+		if err := c.Put(ctx, k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := storage.FromGCS(c)
+
+	var buf bytes.Buffer
+	if err := Export(ctx, store, "users/42", &buf, Options{}); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	keys, err := Import(ctx, &buf, store, "restore", Limits{})
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if want := []string{"restore/a.txt"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Import() keys = %v, want %v", keys, want)
+	}
+}
+
+func tarGz(t *testing.T, entries map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImport_UnsafePath(t *testing.T) {
+	for _, name := range []string{"../escape", "a/../../escape", "/etc/passwd", `..\escape`, "C:/x"} {
+		c := fake.New("test")
+		_, err := Import(context.Background(), bytes.NewReader(tarGz(t, map[string]string{name: "x"})), storage.FromGCS(c), "dst/", Limits{})
+		if !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("Import(%q) error = %v, want %v", name, err, ErrUnsafePath)
+		}
+		if objs := c.Objects(); len(objs) != 0 {
+			t.Errorf("Import(%q) wrote %v", name, objs)
+		}
+	}
+
+	c := fake.New("test")
+	keys, err := Import(context.Background(), bytes.NewReader(tarGz(t, map[string]string{"a/./b/../c": "x"})), storage.FromGCS(c), "dst/", Limits{})
+	if err != nil || !reflect.DeepEqual(keys, []string{"dst/a/c"}) {
+		t.Errorf("Import() = %v, %v, want [dst/a/c]", keys, err)
+	}
+}
+
+func TestImport_Limits(t *testing.T) {
+	data := tarGz(t, map[string]string{"a": "12345", "b": "12345", "c": "12345"})
+	tests := []Limits{
+		{MaxFiles: 2},
+		{MaxFileSize: 4},
+		{MaxTotalSize: 12},
+	}
+	for _, limits := range tests {
+		_, err := Import(context.Background(), bytes.NewReader(data), storage.FromGCS(fake.New("test")), "dst/", limits)
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Import(%+v) error = %v, want %v", limits, err, ErrLimitExceeded)
+		}
+	}
+}
+
+// failingStore fails reading the object at key halfway.
+type failingStore struct {
+	storage.Store
+	key string
+	err error
+}
+
+func (s *failingStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := s.Store.Open(ctx, key)
+	if err != nil || key != s.key {
+		return r, err
+	}
+	return ioutil.NopCloser(io.MultiReader(io.LimitReader(r, 1), errReader{s.err})), nil
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// carelessStore commits whatever it read, even when reading failed.
+type carelessStore struct {
+	storage.Store
+}
+
+func (s *carelessStore) Write(ctx context.Context, key string, r io.Reader, obj *storage.Object) error {
+	b, _ := ioutil.ReadAll(r)
+	return s.Store.Write(ctx, key, bytes.NewReader(b), obj)
+}
+
+func TestExportObject_Abort(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+	dsts := map[string]func(storage.Store) storage.Store{
+		"store":    func(s storage.Store) storage.Store { return s },
+		"careless": func(s storage.Store) storage.Store { return &carelessStore{s} },
+	}
+	for name, dst := range dsts {
+		t.Run(name, func(t *testing.T) {
+			c := fake.New("test")
+			for _, k := range []string{"users/42/a", "users/42/b", "users/42/c"} {
+				if err := c.Put(ctx, k, []byte(strings.Repeat("x", 1024))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store := storage.FromGCS(c)
+			src := &failingStore{Store: store, key: "users/42/b", err: boom}
+
+			if err := ExportObject(ctx, src, "users/42/", dst(store), "exports/42", Options{}); !errors.Is(err, boom) {
+				t.Fatalf("ExportObject() error = %v, want %v", err, boom)
+			}
+			if _, err := c.Get(ctx, "exports/42"); err == nil {
+				t.Error("ExportObject() left a truncated archive behind")
+			}
+		})
+	}
+}
+
+// exactStore commits the declared size of an object without reading past it.
+type exactStore struct {
+	storage.Store
+}
+
+func (s *exactStore) Write(ctx context.Context, key string, r io.Reader, obj *storage.Object) error {
+	b := make([]byte, obj.Size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	return s.Store.Write(ctx, key, bytes.NewReader(b), obj)
+}
+
+func TestExtract_LargerThanDeclared(t *testing.T) {
+	c := fake.New("test")
+	ex := newExtractor(&exactStore{storage.FromGCS(c)}, "dst/", Limits{})
+	err := ex.extract(context.Background(), "a", 5, strings.NewReader("123456"))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("extract() error = %v, want %v", err, ErrLimitExceeded)
+	}
+	if objs := c.Objects(); len(objs) != 0 {
+		t.Errorf("extract() wrote %v", objs)
+	}
+
+	ex = newExtractor(&exactStore{storage.FromGCS(c)}, "dst/", Limits{})
+	if err := ex.extract(context.Background(), "a", 5, strings.NewReader("12345")); err != nil {
+		t.Errorf("extract() error = %v", err)
+	}
+}
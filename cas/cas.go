@@ -0,0 +1,361 @@
+// Package cas is a content-addressable layer over a bucket. Bodies are stored
+// once under their SHA-256 digest and referenced by names, so uploading the
+// same content again only adds a reference.
+//
+//	c := cas.New(cas.FromGCS(client), cas.Options{Prefix: "attachments/"})
+//	digest, err := c.Put(ctx, "users/42/avatar.png", data)
+//
+// The bucket holds three kinds of objects under the prefix:
+//
+//	blobs/<digest>  the content
+//	refs/<digest>   the number of names pointing to the blob
+//	names/<name>    the digest a name points to
+//
+// Blobs whose count drops to zero are removed by GC once they have been
+// unreferenced for Options.GracePeriod.
+package cas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrTooManyAttempts is returned when every attempt to update a name or a
+// reference count lost a race with another writer.
+var ErrTooManyAttempts = errors.New("cas: too many concurrent updates")
+
+// Options configures a CAS.
+type Options struct {
+	// Prefix is prepended to every key.
+	Prefix string
+	// GracePeriod is how long a blob stays unreferenced before GC removes
+	// it. It must be longer than a GC run. Defaults to 1h.
+	GracePeriod time.Duration
+	// MaxAttempts is the number of read-modify-write attempts of an update.
+	// Defaults to 10.
+	MaxAttempts int
+	// RetryInterval is how long an update waits for a running GC to finish
+	// with a blob. Defaults to 100ms.
+	RetryInterval time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = time.Hour
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = 100 * time.Millisecond
+	}
+	return o
+}
+
+// CAS stores content by digest.
+type CAS struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+}
+
+// New returns a CAS keeping its objects in store.
+func New(store Store, opts Options) *CAS {
+	return &CAS{store: store, opts: opts.withDefaults(), now: time.Now}
+}
+
+// Digest returns the hex SHA-256 digest data is stored under.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *CAS) blobKey(digest string) string { return c.opts.Prefix + "blobs/" + digest }
+func (c *CAS) refsKey(digest string) string { return c.opts.Prefix + "refs/" + digest }
+func (c *CAS) nameKey(name string) string   { return c.opts.Prefix + "names/" + name }
+
+// Put points name at data and returns its digest. The body is only uploaded
+// if no blob with the same digest exists. A previous target of name loses
+// one reference.
+func (c *CAS) Put(ctx context.Context, name string, data []byte) (string, error) {
+	digest := Digest(data)
+
+	// Count the reference before touching the blob, so GC cannot collect it
+	// while it is being reused.
+	if err := c.adjust(ctx, digest, 1); err != nil {
+		return "", err
+	}
+
+	old, err := c.put(ctx, name, digest, data)
+	if err != nil {
+		// Best effort: a leaked reference only keeps the blob alive.
+		c.adjust(ctx, digest, -1)
+		return "", err
+	}
+	if old != "" {
+		// Drop the reference of the previous target, or the duplicate one
+		// taken above if name already pointed at this digest.
+		if err := c.adjust(ctx, old, -1); err != nil {
+			return "", err
+		}
+	}
+	return digest, nil
+}
+
+// put uploads the blob if needed and points name at it. It returns the
+// previous target of name.
+func (c *CAS) put(ctx context.Context, name, digest string, data []byte) (string, error) {
+	exists, err := c.store.Exists(ctx, c.blobKey(digest))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		err := c.store.Put(ctx, c.blobKey(digest), data, "")
+		if err != nil && !errors.Is(err, ErrConflict) {
+			return "", fmt.Errorf("cas: upload %s: %w", digest, err)
+		}
+	}
+
+	for attempt := 0; attempt < c.opts.MaxAttempts; attempt++ {
+		old, version, err := c.store.Get(ctx, c.nameKey(name))
+		switch {
+		case errors.Is(err, ErrNotExist):
+			old, version = nil, ""
+		case errors.Is(err, ErrConflict):
+			continue
+		case err != nil:
+			return "", err
+		case string(old) == digest:
+			return digest, nil
+		}
+
+		err = c.store.Put(ctx, c.nameKey(name), []byte(digest), version)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		return string(old), err
+	}
+	return "", ErrTooManyAttempts
+}
+
+// Resolve returns the digest name points to, or ErrNotExist.
+func (c *CAS) Resolve(ctx context.Context, name string) (string, error) {
+	for attempt := 0; attempt < c.opts.MaxAttempts; attempt++ {
+		data, _, err := c.store.Get(ctx, c.nameKey(name))
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		return string(data), err
+	}
+	return "", ErrTooManyAttempts
+}
+
+// Get returns the content name points to, or ErrNotExist.
+func (c *CAS) Get(ctx context.Context, name string) ([]byte, error) {
+	digest, err := c.Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetBlob(ctx, digest)
+}
+
+// GetBlob returns the content stored under digest, or ErrNotExist.
+func (c *CAS) GetBlob(ctx context.Context, digest string) ([]byte, error) {
+	data, _, err := c.store.Get(ctx, c.blobKey(digest))
+	return data, err
+}
+
+// Delete removes name and drops its reference. Deleting a missing name is
+// not an error.
+func (c *CAS) Delete(ctx context.Context, name string) error {
+	for attempt := 0; attempt < c.opts.MaxAttempts; attempt++ {
+		digest, version, err := c.store.Get(ctx, c.nameKey(name))
+		switch {
+		case errors.Is(err, ErrNotExist):
+			return nil
+		case errors.Is(err, ErrConflict):
+			continue
+		case err != nil:
+			return err
+		}
+
+		err = c.store.Delete(ctx, c.nameKey(name), version)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return c.adjust(ctx, string(digest), -1)
+	}
+	return ErrTooManyAttempts
+}
+
+// Refs returns the number of names pointing to digest.
+func (c *CAS) Refs(ctx context.Context, digest string) (int, error) {
+	rc, _, err := c.refs(ctx, digest)
+	return rc.Refs, err
+}
+
+// refCount is the body of a refs object. Collecting marks a blob that GC is
+// removing; updates wait until it is gone.
+type refCount struct {
+	Refs       int       `json:"refs"`
+	Collecting bool      `json:"collecting,omitempty"`
+	Updated    time.Time `json:"updated"`
+}
+
+// refs returns the count of digest and its version, which is empty when the
+// refs object does not exist.
+func (c *CAS) refs(ctx context.Context, digest string) (refCount, string, error) {
+	for attempt := 0; attempt < c.opts.MaxAttempts; attempt++ {
+		data, version, err := c.store.Get(ctx, c.refsKey(digest))
+		switch {
+		case errors.Is(err, ErrNotExist):
+			return refCount{}, "", nil
+		case errors.Is(err, ErrConflict):
+			continue
+		case err != nil:
+			return refCount{}, "", err
+		}
+
+		var rc refCount
+		if err := json.Unmarshal(data, &rc); err != nil {
+			return refCount{}, "", fmt.Errorf("cas: decode refs of %s: %w", digest, err)
+		}
+		return rc, version, nil
+	}
+	return refCount{}, "", ErrTooManyAttempts
+}
+
+// adjust adds delta to the reference count of digest.
+func (c *CAS) adjust(ctx context.Context, digest string, delta int) error {
+	for attempt := 0; attempt < c.opts.MaxAttempts; attempt++ {
+		rc, version, err := c.refs(ctx, digest)
+		if err != nil {
+			return err
+		}
+
+		if rc.Collecting {
+			if delta < 0 {
+				return nil
+			}
+			// Wait for GC to delete the blob and its count. Once the blob is
+			// gone there is nothing left to wait for, and a marker older than
+			// the grace period was left by a GC that died; take over either
+			// way. The conditional write below makes GC keep the new count.
+			exists, err := c.store.Exists(ctx, c.blobKey(digest))
+			if err != nil {
+				return err
+			}
+			if exists && c.now().Sub(rc.Updated) < c.opts.GracePeriod {
+				if err := c.sleep(ctx); err != nil {
+					return err
+				}
+				continue
+			}
+			rc = refCount{}
+		}
+
+		rc.Refs += delta
+		if rc.Refs < 0 {
+			rc.Refs = 0
+		}
+		rc.Updated = c.now()
+		err = c.putRefs(ctx, digest, rc, version)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		return err
+	}
+	return ErrTooManyAttempts
+}
+
+func (c *CAS) putRefs(ctx context.Context, digest string, rc refCount, version string) error {
+	data, err := json.Marshal(rc)
+	if err != nil {
+		return err
+	}
+	return c.store.Put(ctx, c.refsKey(digest), data, version)
+}
+
+func (c *CAS) sleep(ctx context.Context) error {
+	t := time.NewTimer(c.opts.RetryInterval)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// GC removes the blobs that have had no reference for the grace period, along
+// with counts left without a blob, and returns the digests it removed.
+func (c *CAS) GC(ctx context.Context) ([]string, error) {
+	digests := make(map[string]bool)
+	for _, dir := range []string{"blobs/", "refs/"} {
+		keys, err := c.store.List(ctx, c.opts.Prefix+dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			digests[strings.TrimPrefix(key, c.opts.Prefix+dir)] = true
+		}
+	}
+
+	var removed []string
+	for digest := range digests {
+		ok, err := c.collect(ctx, digest)
+		if err != nil {
+			return removed, fmt.Errorf("cas: collect %s: %w", digest, err)
+		}
+		if ok {
+			removed = append(removed, digest)
+		}
+	}
+	return removed, nil
+}
+
+// collect removes digest if it is unreferenced and past the grace period.
+// It first marks the count as collecting with a conditional write, so an
+// update that raced with the check makes it back off, and an update that
+// comes later waits for the blob to be gone and uploads it again. The marker
+// is only removed while no such update has replaced it.
+func (c *CAS) collect(ctx context.Context, digest string) (bool, error) {
+	rc, version, err := c.refs(ctx, digest)
+	if err != nil {
+		return false, err
+	}
+	if rc.Refs > 0 || (version != "" && c.now().Sub(rc.Updated) < c.opts.GracePeriod) {
+		return false, nil
+	}
+
+	err = c.putRefs(ctx, digest, refCount{Collecting: true, Updated: c.now()}, version)
+	if errors.Is(err, ErrConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := c.store.Delete(ctx, c.blobKey(digest), ""); err != nil {
+		return false, err
+	}
+
+	rc, version, err = c.refs(ctx, digest)
+	if err != nil || !rc.Collecting || version == "" {
+		return true, err
+	}
+	err = c.store.Delete(ctx, c.refsKey(digest), version)
+	if errors.Is(err, ErrConflict) {
+		return true, nil
+	}
+	return true, err
+}
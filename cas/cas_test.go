@@ -0,0 +1,210 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func newStore(b storagetest.Backend) Store {
+	if b.GCS != nil {
+		return FromGCS(b.GCS)
+	}
+	return FromS3(b.S3)
+}
+
+func TestCAS(t *testing.T) {
+	storagetest.RunBackends(t, func(t *testing.T, b storagetest.Backend) {
+		store := newStore(b)
+		ctx := context.Background()
+		clk := storagetest.NewClock(time.Now())
+		c := New(store, Options{Prefix: "cas/", GracePeriod: time.Hour})
+		c.now = clk.Now
+
+		refs := func(digest string, want int) {
+			t.Helper()
+			n, err := c.Refs(ctx, digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != want {
+				t.Errorf("Refs(%s) = %d, want %d", digest[:8], n, want)
+			}
+		}
+		blobs := func(want ...string) {
+			t.Helper()
+			keys, err := store.List(ctx, "cas/blobs/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, k := range keys {
+				got = append(got, k[len("cas/blobs/"):])
+			}
+			if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+				t.Errorf("blobs = %v, want %v", got, want)
+			}
+		}
+
+		d1, err := c.Put(ctx, "a", []byte("hello"))
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		if d1 != Digest([]byte("hello")) {
+			t.Errorf("Put() = %s, want %s", d1, Digest([]byte("hello")))
+		}
+		if _, err := c.Put(ctx, "b", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Put(ctx, "b", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		blobs(d1)
+		refs(d1, 2)
+
+		got, err := c.Get(ctx, "b")
+		if err != nil || string(got) != "hello" {
+			t.Errorf("Get() = %q, %v, want %q", got, err, "hello")
+		}
+
+		// Repointing a name moves its reference.
+		d2, err := c.Put(ctx, "b", []byte("world"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs(d1, 1)
+		refs(d2, 1)
+
+		if err := c.Delete(ctx, "a"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if err := c.Delete(ctx, "a"); err != nil {
+			t.Errorf("Delete() of missing name error = %v", err)
+		}
+		if _, err := c.Get(ctx, "a"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotExist)
+		}
+		refs(d1, 0)
+
+		// Unreferenced blobs survive the grace period.
+		removed, err := c.GC(ctx)
+		if err != nil || len(removed) != 0 {
+			t.Errorf("GC() = %v, %v, want nothing removed", removed, err)
+		}
+		clk.Advance(2 * time.Hour)
+		removed, err = c.GC(ctx)
+		if err != nil || !reflect.DeepEqual(removed, []string{d1}) {
+			t.Errorf("GC() = %v, %v, want [%s]", removed, err, d1)
+		}
+		blobs(d2)
+		if _, err := c.GetBlob(ctx, d1); !errors.Is(err, ErrNotExist) {
+			t.Errorf("GetBlob() after GC() error = %v, want %v", err, ErrNotExist)
+		}
+
+		// A GC that died after marking the blob leaves a stale marker;
+		// the next Put takes over and uploads the content again.
+		if err := c.putRefs(ctx, d1, refCount{Collecting: true, Updated: clk.Now()}, ""); err != nil {
+			t.Fatal(err)
+		}
+		clk.Advance(2 * time.Hour)
+		if _, err := c.Put(ctx, "a", []byte("hello")); err != nil {
+			t.Fatalf("Put() over stale marker error = %v", err)
+		}
+		refs(d1, 1)
+		if got, err := c.Get(ctx, "a"); err != nil || string(got) != "hello" {
+			t.Errorf("Get() = %q, %v, want %q", got, err, "hello")
+		}
+	})
+}
+
+func TestCAS_WaitsForGC(t *testing.T) {
+	ctx := context.Background()
+	store := FromGCS(fake.New("test"))
+	c := New(store, Options{MaxAttempts: 3, RetryInterval: time.Millisecond})
+
+	digest := Digest([]byte("x"))
+	if err := store.Put(ctx, c.blobKey(digest), []byte("x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.putRefs(ctx, digest, refCount{Collecting: true, Updated: time.Now()}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Put(ctx, "a", []byte("x")); err != ErrTooManyAttempts {
+		t.Errorf("Put() while collecting error = %v, want %v", err, ErrTooManyAttempts)
+	}
+}
+
+func TestCAS_ReclaimsCollectedBlob(t *testing.T) {
+	ctx := context.Background()
+	store := FromGCS(fake.New("test"))
+	c := New(store, Options{MaxAttempts: 3, RetryInterval: time.Millisecond})
+
+	// A GC died after deleting the blob, leaving a fresh marker behind.
+	digest := Digest([]byte("x"))
+	if err := c.putRefs(ctx, digest, refCount{Collecting: true, Updated: time.Now()}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Put(ctx, "a", []byte("x")); err != nil {
+		t.Fatalf("Put() over a collected blob error = %v", err)
+	}
+	if n, err := c.Refs(ctx, digest); err != nil || n != 1 {
+		t.Errorf("Refs() = %d, %v, want 1", n, err)
+	}
+	if got, err := c.Get(ctx, "a"); err != nil || string(got) != "x" {
+		t.Errorf("Get() = %q, %v, want %q", got, err, "x")
+	}
+}
+
+// afterDelete runs hook once after the first Delete of key.
+type afterDelete struct {
+	Store
+	key  string
+	hook func()
+}
+
+func (s *afterDelete) Delete(ctx context.Context, key, version string) error {
+	err := s.Store.Delete(ctx, key, version)
+	if key == s.key && s.hook != nil {
+		hook := s.hook
+		s.hook = nil
+		hook()
+	}
+	return err
+}
+
+func TestCAS_GCKeepsReclaimedCount(t *testing.T) {
+	ctx := context.Background()
+	clk := storagetest.NewClock(time.Now())
+	store := &afterDelete{Store: FromGCS(fake.New("test"))}
+	c := New(store, Options{GracePeriod: time.Hour})
+	c.now = clk.Now
+
+	digest := Digest([]byte("x"))
+	if err := c.store.Put(ctx, c.blobKey(digest), []byte("x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(2 * time.Hour)
+
+	// A Put runs between GC deleting the blob and removing its marker.
+	store.key = c.blobKey(digest)
+	store.hook = func() {
+		if _, err := c.Put(ctx, "a", []byte("x")); err != nil {
+			t.Errorf("Put() during GC error = %v", err)
+		}
+	}
+	if removed, err := c.GC(ctx); err != nil || len(removed) != 1 {
+		t.Fatalf("GC() = %v, %v, want the blob removed", removed, err)
+	}
+
+	if n, err := c.Refs(ctx, digest); err != nil || n != 1 {
+		t.Errorf("Refs() after GC() = %d, %v, want 1", n, err)
+	}
+	if got, err := c.Get(ctx, "a"); err != nil || string(got) != "x" {
+		t.Errorf("Get() = %q, %v, want %q", got, err, "x")
+	}
+}
@@ -0,0 +1,75 @@
+package cas
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/internal/versioned"
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+var (
+	// ErrNotExist is returned when a name, blob or reference count does not exist.
+	ErrNotExist = versioned.ErrNotExist
+	// ErrConflict is returned by a Store when a write or delete loses a race
+	// with another writer.
+	ErrConflict = versioned.ErrConflict
+)
+
+// Store holds the blobs, names and reference counts of a CAS. A version
+// identifies one write of an object, such as a GCS generation or an S3 ETag.
+type Store interface {
+	// Get returns the body and version of key, or ErrNotExist.
+	Get(ctx context.Context, key string) ([]byte, string, error)
+	// Exists reports whether key exists.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Put writes data to key only if its version is still version, or only
+	// if key does not exist when version is empty. It returns ErrConflict
+	// otherwise.
+	Put(ctx context.Context, key string, data []byte, version string) error
+	// Delete removes key only if its version is still version, or returns
+	// ErrConflict. An empty version deletes unconditionally and does not
+	// fail for a missing key.
+	Delete(ctx context.Context, key, version string) error
+	// List returns the keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+type store struct {
+	v versioned.Store
+}
+
+// FromGCS stores a CAS in a GCS bucket.
+func FromGCS(c gcs.Client) Store {
+	return &store{v: versioned.FromGCS(c)}
+}
+
+// FromS3 stores a CAS in an S3 bucket.
+func FromS3(i *s3.Interactor) Store {
+	return &store{v: versioned.FromS3(i)}
+}
+
+func (s *store) Get(ctx context.Context, key string) ([]byte, string, error) {
+	return s.v.Get(ctx, key)
+}
+
+func (s *store) Exists(ctx context.Context, key string) (bool, error) {
+	_, _, err := s.v.StatVersion(ctx, key)
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *store) Put(ctx context.Context, key string, data []byte, version string) error {
+	return s.v.Put(ctx, key, data, version, nil)
+}
+
+func (s *store) Delete(ctx context.Context, key, version string) error {
+	return s.v.DeleteVersion(ctx, key, version)
+}
+
+func (s *store) List(ctx context.Context, prefix string) ([]string, error) {
+	return s.v.List(ctx, prefix)
+}
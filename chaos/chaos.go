@@ -0,0 +1,177 @@
+// Package chaos decorates storage clients with injected latency and faults,
+// so retry and fallback paths can be exercised before production does it.
+//
+//	c = chaos.GCS(c, chaos.Options{Seed: 1, Rules: []chaos.Rule{
+//		{Methods: []string{"Get"}, Key: "logs/*", Rate: 0.2, Fault: chaos.Unavailable},
+//		{Rate: chaos.Always, Latency: 50 * time.Millisecond, Jitter: 50 * time.Millisecond},
+//	}})
+package chaos
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+)
+
+// Fault is the kind of failure a Rule injects.
+type Fault string
+
+const (
+	// NoFault only injects the latency of the rule.
+	NoFault Fault = ""
+	// NotFound fails the call as if the object did not exist.
+	NotFound Fault = "not_found"
+	// Unavailable fails the call with a 503 response.
+	Unavailable Fault = "unavailable"
+	// Throttled fails the call with a rate limiting response.
+	Throttled Fault = "throttled"
+	// TruncatedBody cuts a download off halfway with io.ErrUnexpectedEOF.
+	// It only applies to methods that return object data.
+	TruncatedBody Fault = "truncated_body"
+	// PartialWrite stores the first half of an upload and then fails it
+	// with a 503 response. It only applies to methods that upload object data.
+	PartialWrite Fault = "partial_write"
+)
+
+// Rule injects latency and a fault into matching calls.
+type Rule struct {
+	// Methods restricts the rule to these client methods, e.g. "Put" or
+	// "GetObject"; empty matches every method.
+	Methods []string
+	// Key restricts the rule to object keys matching this path.Match
+	// pattern; empty matches every key. Listing methods match their prefix.
+	Key string
+	// Rate is the probability that a matching call is affected. The zero
+	// value disables the rule; use Always to affect every matching call.
+	Rate float64
+	// Latency delays an affected call, plus a random duration up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Fault is the failure injected into an affected call.
+	Fault Fault
+	// Err, when set, is returned instead of the error of Fault.
+	Err error
+}
+
+// Always is the Rate of a rule that affects every matching call.
+const Always = 1.0
+
+// Options configures the decorators.
+type Options struct {
+	// Seed seeds the random source, making a run reproducible.
+	Seed int64
+	// Rules are evaluated in order; the first rule that affects a call wins.
+	Rules []Rule
+}
+
+// injector decides which rule, if any, affects a call.
+type injector struct {
+	mu    sync.Mutex
+	rng   *rand.Rand
+	rules []Rule
+}
+
+func newInjector(opts Options) *injector {
+	return &injector{rng: rand.New(rand.NewSource(opts.Seed)), rules: opts.Rules}
+}
+
+// inject waits out the latency of the first rule affecting method on key and
+// returns it. body reports which body faults the method supports.
+// It returns nil when no rule affects the call, and ctx.Err() when ctx is
+// done while waiting.
+func (in *injector) inject(ctx context.Context, method, key string, body Fault) (*Rule, error) {
+	r, delay := in.pick(method, key, body)
+	if r == nil {
+		return nil, nil
+	}
+
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+	return r, nil
+}
+
+func (in *injector) pick(method, key string, body Fault) (*Rule, time.Duration) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	for i := range in.rules {
+		r := &in.rules[i]
+		if !r.matches(method, key, body) {
+			continue
+		}
+		if r.Rate < Always && in.rng.Float64() >= r.Rate {
+			continue
+		}
+		delay := r.Latency
+		if r.Jitter > 0 {
+			delay += time.Duration(in.rng.Int63n(int64(r.Jitter)))
+		}
+		return r, delay
+	}
+	return nil, 0
+}
+
+func (r *Rule) matches(method, key string, body Fault) bool {
+	if (r.Fault == TruncatedBody || r.Fault == PartialWrite) && r.Fault != body {
+		return false
+	}
+	if len(r.Methods) > 0 {
+		found := false
+		for _, m := range r.Methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Key != "" {
+		if ok, _ := path.Match(r.Key, key); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// fails reports whether r, which may be nil, fails the call it affects.
+func (r *Rule) fails() bool {
+	return r != nil && (r.Fault != NoFault || r.Err != nil)
+}
+
+// truncatedReader returns io.ErrUnexpectedEOF once limit bytes have been read.
+type truncatedReader struct {
+	io.ReadCloser
+	limit int64
+}
+
+func (r *truncatedReader) Read(p []byte) (int, error) {
+	if r.limit <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > r.limit {
+		p = p[:r.limit]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.limit -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// truncate cuts r off at half of size bytes.
+func truncate(r io.ReadCloser, size int64) io.ReadCloser {
+	return &truncatedReader{ReadCloser: r, limit: size / 2}
+}
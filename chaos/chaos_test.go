@@ -0,0 +1,164 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/s3test"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func TestGCS_Conformance(t *testing.T) {
+	storagetest.TestGCSClient(t, func(t *testing.T) gcs.Client {
+		return GCS(fake.New("test"), Options{Rules: []Rule{{Rate: Always, Latency: time.Microsecond}}})
+	})
+}
+
+func TestGCS_Faults(t *testing.T) {
+	ctx := context.Background()
+	next := fake.New("test")
+	boom := errors.New("boom")
+	c := GCS(next, Options{Rules: []Rule{
+		{Rate: Always, Key: "missing/*", Fault: NotFound},
+		{Rate: Always, Methods: []string{"Attrs"}, Fault: Throttled},
+		{Rate: Always, Methods: []string{"Delete"}, Err: boom},
+		{Rate: Always, Key: "partial", Fault: PartialWrite},
+		{Rate: Always, Key: "partial", Fault: TruncatedBody},
+	}})
+
+	if _, err := c.Get(ctx, "missing/a"); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Errorf("Get() err = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+	var apiErr *googleapi.Error
+	if _, err := c.Attrs(ctx, "a"); !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		t.Errorf("Attrs() err = %v, want 429", err)
+	}
+	if err := c.Delete(ctx, "a"); err != boom {
+		t.Errorf("Delete() err = %v, want %v", err, boom)
+	}
+
+	if err := c.Put(ctx, "partial", []byte("abcd")); !errors.As(err, &apiErr) || apiErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Put() err = %v, want 503", err)
+	}
+	if b, err := next.Get(ctx, "partial"); err != nil || string(b) != "ab" {
+		t.Errorf("stored %q, %v, want %q", b, err, "ab")
+	}
+
+	if err := next.Put(ctx, "partial", []byte("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewReader(ctx, "partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != io.ErrUnexpectedEOF || string(b) != "ab" {
+		t.Errorf("NewReader() read %q, %v, want %q, %v", b, err, "ab", io.ErrUnexpectedEOF)
+	}
+}
+
+func TestGCS_Seed(t *testing.T) {
+	run := func() []bool {
+		ctx := context.Background()
+		c := GCS(fake.New("test"), Options{Seed: 42, Rules: []Rule{{Rate: 0.5, Fault: Unavailable}}})
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			failed = append(failed, c.Put(ctx, "a", []byte("1")) != nil)
+		}
+		return failed
+	}
+
+	first := run()
+	if second := run(); !reflect.DeepEqual(first, second) {
+		t.Errorf("runs with the same seed differ: %v, %v", first, second)
+	}
+	n := 0
+	for _, f := range first {
+		if f {
+			n++
+		}
+	}
+	if n == 0 || n == len(first) {
+		t.Errorf("%d of %d calls failed, want some", n, len(first))
+	}
+}
+
+func TestGCS_ZeroRate(t *testing.T) {
+	ctx := context.Background()
+	c := GCS(fake.New("test"), Options{Rules: []Rule{{Fault: Unavailable}}})
+	for i := 0; i < 20; i++ {
+		if err := c.Put(ctx, "a", []byte("1")); err != nil {
+			t.Fatalf("Put() err = %v, want a rule with zero Rate to be disabled", err)
+		}
+	}
+}
+
+func TestGCS_LatencyCanceled(t *testing.T) {
+	c := GCS(fake.New("test"), Options{Rules: []Rule{{Rate: Always, Latency: time.Hour}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Put(ctx, "a", []byte("1")); err != context.Canceled {
+		t.Errorf("Put() err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestS3_Faults(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	opt := srv.Options("test")
+	i := s3.New(S3(s3.NewS3Client(opt), Options{Rules: []Rule{
+		{Rate: Always, Methods: []string{"GetObject"}, Key: "missing", Fault: NotFound},
+		{Rate: Always, Key: "partial", Fault: PartialWrite},
+		{Rate: Always, Key: "partial", Fault: TruncatedBody},
+		{Rate: Always, Methods: []string{"DeleteObjects"}, Key: "keep", Fault: Throttled},
+	}}), opt)
+
+	if _, _, err := i.Download("missing"); !s3.IsNotFound(err) {
+		t.Errorf("Download() err = %v, want not found", err)
+	}
+
+	if err := i.Upload(strings.NewReader("abcd"), "partial", s3.Private, "text/plain"); err == nil {
+		t.Error("Upload() err = nil, want error")
+	}
+	body, _, err := i.Download("partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != io.ErrUnexpectedEOF || string(b) != "a" {
+		t.Errorf("Download() read %q, %v, want %q, %v", b, err, "a", io.ErrUnexpectedEOF)
+	}
+
+	for _, key := range []string{"keep", "drop"} {
+		if err := i.Upload(strings.NewReader("x"), key, s3.Private, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var derrs s3.DeleteErrors
+	if err := i.DeleteMany([]string{"keep", "drop"}); !errors.As(err, &derrs) || len(derrs) != 1 {
+		t.Errorf("DeleteMany() err = %v, want one failed key", err)
+	}
+	if got, want := srv.Keys("test"), []string{"keep", "partial"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+
+	if u, err := i.SignedURL("keep", time.Minute); err != nil || !strings.Contains(u, "keep") {
+		t.Errorf("SignedURL() = %q, %v", u, err)
+	}
+}
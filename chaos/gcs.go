@@ -0,0 +1,361 @@
+package chaos
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/hayashiki/go-pkg/gcs"
+)
+
+type gcsClient struct {
+	next gcs.Client
+	in   *injector
+}
+
+// GCS returns a gcs.Client that injects the faults of opts into calls to c.
+// Faults are returned as the errors the storage library reports, so they
+// are classified like real ones.
+func GCS(c gcs.Client, opts Options) gcs.Client {
+	return &gcsClient{next: c, in: newInjector(opts)}
+}
+
+func gcsError(r *Rule) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	switch r.Fault {
+	case NotFound:
+		return gcs.ErrObjectNotExist
+	case Unavailable, PartialWrite:
+		return &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "chaos: service unavailable"}
+	case Throttled:
+		return &googleapi.Error{Code: http.StatusTooManyRequests, Message: "chaos: rate limit exceeded"}
+	case TruncatedBody:
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// do runs fn unless a rule fails the call.
+func (c *gcsClient) do(ctx context.Context, method, key string, fn func() error) error {
+	r, err := c.in.inject(ctx, method, key, NoFault)
+	if err != nil {
+		return err
+	}
+	if r.fails() {
+		return gcsError(r)
+	}
+	return fn()
+}
+
+func (c *gcsClient) Put(ctx context.Context, objName string, data []byte) error {
+	return c.put(ctx, "Put", objName, data, func(data []byte) error {
+		return c.next.Put(ctx, objName, data)
+	})
+}
+
+func (c *gcsClient) PutWithOptions(ctx context.Context, objName string, data []byte, opts gcs.PutOptions) error {
+	return c.put(ctx, "PutWithOptions", objName, data, func(data []byte) error {
+		return c.next.PutWithOptions(ctx, objName, data, opts)
+	})
+}
+
+func (c *gcsClient) put(ctx context.Context, method, objName string, data []byte, fn func([]byte) error) error {
+	r, err := c.in.inject(ctx, method, objName, PartialWrite)
+	if err != nil {
+		return err
+	}
+	if !r.fails() {
+		return fn(data)
+	}
+	if r.Fault == PartialWrite && r.Err == nil {
+		if err := fn(data[:len(data)/2]); err != nil {
+			return err
+		}
+	}
+	return gcsError(r)
+}
+
+func (c *gcsClient) UpdateMetadata(ctx context.Context, objName string, opts gcs.PutOptions) error {
+	return c.do(ctx, "UpdateMetadata", objName, func() error {
+		return c.next.UpdateMetadata(ctx, objName, opts)
+	})
+}
+
+func (c *gcsClient) Attrs(ctx context.Context, objName string) (*gcs.ObjectAttrs, error) {
+	var attrs *gcs.ObjectAttrs
+	err := c.do(ctx, "Attrs", objName, func() (err error) {
+		attrs, err = c.next.Attrs(ctx, objName)
+		return err
+	})
+	return attrs, err
+}
+
+func (c *gcsClient) Get(ctx context.Context, objName string) ([]byte, error) {
+	return c.get(ctx, "Get", objName, func() ([]byte, error) {
+		return c.next.Get(ctx, objName)
+	})
+}
+
+func (c *gcsClient) GetVersion(ctx context.Context, objName string, generation int64) ([]byte, error) {
+	return c.get(ctx, "GetVersion", objName, func() ([]byte, error) {
+		return c.next.GetVersion(ctx, objName, generation)
+	})
+}
+
+func (c *gcsClient) get(ctx context.Context, method, objName string, fn func() ([]byte, error)) ([]byte, error) {
+	r, err := c.in.inject(ctx, method, objName, TruncatedBody)
+	if err != nil {
+		return nil, err
+	}
+	if !r.fails() {
+		return fn()
+	}
+	if r.Fault == TruncatedBody && r.Err == nil {
+		if _, err := fn(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, gcsError(r)
+}
+
+// NewReader truncates the body at half of the object size reported by Attrs.
+func (c *gcsClient) NewReader(ctx context.Context, objName string) (io.ReadCloser, error) {
+	r, err := c.in.inject(ctx, "NewReader", objName, TruncatedBody)
+	if err != nil {
+		return nil, err
+	}
+	if !r.fails() {
+		return c.next.NewReader(ctx, objName)
+	}
+	if r.Fault != TruncatedBody || r.Err != nil {
+		return nil, gcsError(r)
+	}
+
+	attrs, err := c.next.Attrs(ctx, objName)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.next.NewReader(ctx, objName)
+	if err != nil {
+		return nil, err
+	}
+	return truncate(body, attrs.Size), nil
+}
+
+// NewRangeReader truncates the body at half of the requested range.
+func (c *gcsClient) NewRangeReader(ctx context.Context, objName string, offset, length int64) (io.ReadCloser, error) {
+	return c.rangeReader(ctx, "NewRangeReader", objName, offset, length, func(offset, length int64) (io.ReadCloser, error) {
+		return c.next.NewRangeReader(ctx, objName, offset, length)
+	})
+}
+
+// DownloadToFile reads through the faults of Attrs and NewVersionRangeReader.
+func (c *gcsClient) DownloadToFile(ctx context.Context, objName, path string, opts gcs.DownloadOptions) error {
+	return gcs.DownloadToFile(ctx, c, objName, path, opts)
+}
+
+// NewVersionRangeReader truncates the body at half of the requested range.
+func (c *gcsClient) NewVersionRangeReader(ctx context.Context, objName string, generation, offset, length int64) (io.ReadCloser, error) {
+	return c.rangeReader(ctx, "NewVersionRangeReader", objName, offset, length, func(offset, length int64) (io.ReadCloser, error) {
+		return c.next.NewVersionRangeReader(ctx, objName, generation, offset, length)
+	})
+}
+
+func (c *gcsClient) rangeReader(ctx context.Context, method, objName string, offset, length int64, read func(offset, length int64) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	r, err := c.in.inject(ctx, method, objName, TruncatedBody)
+	if err != nil {
+		return nil, err
+	}
+	if !r.fails() {
+		return read(offset, length)
+	}
+	if r.Fault != TruncatedBody || r.Err != nil {
+		return nil, gcsError(r)
+	}
+
+	if length < 0 {
+		attrs, err := c.next.Attrs(ctx, objName)
+		if err != nil {
+			return nil, err
+		}
+		length = attrs.Size - offset
+	}
+	body, err := read(offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return truncate(body, length), nil
+}
+
+// NewWriter fails on Write or Close, as the returned writer would.
+func (c *gcsClient) NewWriter(ctx context.Context, objName string, opts gcs.PutOptions) io.WriteCloser {
+	r, err := c.in.inject(ctx, "NewWriter", objName, PartialWrite)
+	if err != nil {
+		return &failedWriter{err: err}
+	}
+	if !r.fails() {
+		return c.next.NewWriter(ctx, objName, opts)
+	}
+	if r.Fault != PartialWrite || r.Err != nil {
+		return &failedWriter{err: gcsError(r)}
+	}
+	return &partialWriter{WriteCloser: c.next.NewWriter(ctx, objName, opts), err: gcsError(r)}
+}
+
+// failedWriter fails every call with err.
+type failedWriter struct {
+	err error
+}
+
+func (w *failedWriter) Write([]byte) (int, error) { return 0, w.err }
+func (w *failedWriter) Close() error              { return w.err }
+
+// partialWriter forwards half of the first write, then fails with err.
+type partialWriter struct {
+	io.WriteCloser
+	err    error
+	failed bool
+}
+
+func (w *partialWriter) Write(p []byte) (int, error) {
+	if w.failed {
+		return 0, w.err
+	}
+	w.failed = true
+	n, err := w.WriteCloser.Write(p[:len(p)/2])
+	if err != nil {
+		return n, err
+	}
+	return n, w.err
+}
+
+func (w *partialWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.err
+}
+
+func (c *gcsClient) List(ctx context.Context, filePrefix string) ([]string, error) {
+	var names []string
+	err := c.do(ctx, "List", filePrefix, func() (err error) {
+		names, err = c.next.List(ctx, filePrefix)
+		return err
+	})
+	return names, err
+}
+
+func (c *gcsClient) Delete(ctx context.Context, objName string) error {
+	return c.do(ctx, "Delete", objName, func() error {
+		return c.next.Delete(ctx, objName)
+	})
+}
+
+// DeleteMany applies the rules per object and reports injected faults in
+// gcs.DeleteErrors alongside the real ones.
+func (c *gcsClient) DeleteMany(ctx context.Context, objNames []string) error {
+	errs := gcs.DeleteErrors{}
+	var names []string
+	for _, name := range objNames {
+		r, err := c.in.inject(ctx, "DeleteMany", name, NoFault)
+		if err != nil {
+			return err
+		}
+		if r.fails() {
+			errs[name] = gcsError(r)
+			continue
+		}
+		names = append(names, name)
+	}
+
+	if len(names) > 0 {
+		err := c.next.DeleteMany(ctx, names)
+		if derrs, ok := err.(gcs.DeleteErrors); ok {
+			for name, err := range derrs {
+				errs[name] = err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *gcsClient) DeletePrefix(ctx context.Context, prefix string) error {
+	return c.do(ctx, "DeletePrefix", prefix, func() error {
+		return c.next.DeletePrefix(ctx, prefix)
+	})
+}
+
+func (c *gcsClient) ListVersions(ctx context.Context, objName string) ([]gcs.Version, error) {
+	var versions []gcs.Version
+	err := c.do(ctx, "ListVersions", objName, func() (err error) {
+		versions, err = c.next.ListVersions(ctx, objName)
+		return err
+	})
+	return versions, err
+}
+
+func (c *gcsClient) DeleteVersion(ctx context.Context, objName string, generation int64) error {
+	return c.do(ctx, "DeleteVersion", objName, func() error {
+		return c.next.DeleteVersion(ctx, objName, generation)
+	})
+}
+
+func (c *gcsClient) RestoreVersion(ctx context.Context, objName string, generation int64) error {
+	return c.do(ctx, "RestoreVersion", objName, func() error {
+		return c.next.RestoreVersion(ctx, objName, generation)
+	})
+}
+
+func (c *gcsClient) Copy(ctx context.Context, src string, generation int64, dst string, opts gcs.PutOptions) error {
+	return c.do(ctx, "Copy", dst, func() error {
+		return c.next.Copy(ctx, src, generation, dst, opts)
+	})
+}
+
+func (c *gcsClient) MakeObjectPublic(ctx context.Context, objName string) error {
+	return c.do(ctx, "MakeObjectPublic", objName, func() error {
+		return c.next.MakeObjectPublic(ctx, objName)
+	})
+}
+
+func (c *gcsClient) MakeObjectPrivate(ctx context.Context, objName string) error {
+	return c.do(ctx, "MakeObjectPrivate", objName, func() error {
+		return c.next.MakeObjectPrivate(ctx, objName)
+	})
+}
+
+func (c *gcsClient) SetACL(ctx context.Context, objName string, entity gcs.ACLEntity, role gcs.ACLRole) error {
+	return c.do(ctx, "SetACL", objName, func() error {
+		return c.next.SetACL(ctx, objName, entity, role)
+	})
+}
+
+func (c *gcsClient) DeleteACL(ctx context.Context, objName string, entity gcs.ACLEntity) error {
+	return c.do(ctx, "DeleteACL", objName, func() error {
+		return c.next.DeleteACL(ctx, objName, entity)
+	})
+}
+
+func (c *gcsClient) ListACL(ctx context.Context, objName string) ([]gcs.ACLRule, error) {
+	var rules []gcs.ACLRule
+	err := c.do(ctx, "ListACL", objName, func() (err error) {
+		rules, err = c.next.ListACL(ctx, objName)
+		return err
+	})
+	return rules, err
+}
+
+// URL never fails; it does not call the service.
+func (c *gcsClient) URL(objName string) string {
+	return c.next.URL(objName)
+}
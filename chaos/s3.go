@@ -0,0 +1,385 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+type s3Client struct {
+	next s3.Client
+	in   *injector
+}
+
+// S3 returns an s3.Client that injects the faults of opts into calls to c.
+// Pass it to s3.New to exercise an Interactor. Faults are returned as the
+// errors the SDK reports, so s3.IsNotFound and SDK retryers see real ones.
+// Both variants of a method, e.g. GetObject and GetObjectWithContext, match
+// the rule method "GetObject".
+func S3(c s3.Client, opts Options) s3.Client {
+	return &s3Client{next: c, in: newInjector(opts)}
+}
+
+func s3Error(r *Rule) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	switch r.Fault {
+	case NotFound:
+		return awserr.NewRequestFailure(awserr.New(awss3.ErrCodeNoSuchKey, "chaos: the specified key does not exist", nil), http.StatusNotFound, "chaos")
+	case Unavailable, PartialWrite:
+		return awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "chaos: service unavailable", nil), http.StatusServiceUnavailable, "chaos")
+	case Throttled:
+		return awserr.NewRequestFailure(awserr.New("SlowDown", "chaos: please reduce your request rate", nil), http.StatusServiceUnavailable, "chaos")
+	case TruncatedBody:
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (c *s3Client) inject(ctx context.Context, method string, key *string, body Fault) (*Rule, error) {
+	return c.in.inject(ctx, method, aws.StringValue(key), body)
+}
+
+func (c *s3Client) PutObject(input *awss3.PutObjectInput) (*awss3.PutObjectOutput, error) {
+	return c.putObject(context.Background(), input, c.next.PutObject)
+}
+
+func (c *s3Client) PutObjectWithContext(ctx aws.Context, input *awss3.PutObjectInput, opts ...request.Option) (*awss3.PutObjectOutput, error) {
+	return c.putObject(ctx, input, func(input *awss3.PutObjectInput) (*awss3.PutObjectOutput, error) {
+		return c.next.PutObjectWithContext(ctx, input, opts...)
+	})
+}
+
+func (c *s3Client) putObject(ctx context.Context, input *awss3.PutObjectInput, fn func(*awss3.PutObjectInput) (*awss3.PutObjectOutput, error)) (*awss3.PutObjectOutput, error) {
+	r, err := c.inject(ctx, "PutObject", input.Key, PartialWrite)
+	if err != nil {
+		return nil, err
+	}
+	if !r.fails() {
+		return fn(input)
+	}
+	if r.Fault == PartialWrite && r.Err == nil {
+		var data []byte
+		if input.Body != nil {
+			if data, err = ioutil.ReadAll(input.Body); err != nil {
+				return nil, err
+			}
+		}
+		partial := *input
+		partial.Body = bytes.NewReader(data[:len(data)/2])
+		partial.ContentLength = nil
+		partial.ContentMD5 = nil
+		if _, err := fn(&partial); err != nil {
+			return nil, err
+		}
+	}
+	return nil, s3Error(r)
+}
+
+func (c *s3Client) GetObject(input *awss3.GetObjectInput) (*awss3.GetObjectOutput, error) {
+	return c.getObject(context.Background(), input, c.next.GetObject)
+}
+
+// GetObjectRequest forwards to the wrapped client so that SignedURL keeps
+// working. Presigning does not call S3, so no rule applies to it.
+func (c *s3Client) GetObjectRequest(input *awss3.GetObjectInput) (*request.Request, *awss3.GetObjectOutput) {
+	return s3.GetObjectRequest(c.next, input)
+}
+
+func (c *s3Client) GetObjectWithContext(ctx aws.Context, input *awss3.GetObjectInput, opts ...request.Option) (*awss3.GetObjectOutput, error) {
+	return c.getObject(ctx, input, func(input *awss3.GetObjectInput) (*awss3.GetObjectOutput, error) {
+		return c.next.GetObjectWithContext(ctx, input, opts...)
+	})
+}
+
+// getObject truncates the body at half of its content length.
+func (c *s3Client) getObject(ctx context.Context, input *awss3.GetObjectInput, fn func(*awss3.GetObjectInput) (*awss3.GetObjectOutput, error)) (*awss3.GetObjectOutput, error) {
+	r, err := c.inject(ctx, "GetObject", input.Key, TruncatedBody)
+	if err != nil {
+		return nil, err
+	}
+	if !r.fails() {
+		return fn(input)
+	}
+	if r.Fault != TruncatedBody || r.Err != nil {
+		return nil, s3Error(r)
+	}
+
+	out, err := fn(input)
+	if err != nil || out.Body == nil {
+		return out, err
+	}
+	out.Body = truncate(out.Body, aws.Int64Value(out.ContentLength))
+	return out, nil
+}
+
+func (c *s3Client) DeleteObject(input *awss3.DeleteObjectInput) (*awss3.DeleteObjectOutput, error) {
+	r, err := c.inject(context.Background(), "DeleteObject", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.DeleteObject(input)
+}
+
+func (c *s3Client) DeleteObjectWithContext(ctx aws.Context, input *awss3.DeleteObjectInput, opts ...request.Option) (*awss3.DeleteObjectOutput, error) {
+	r, err := c.inject(ctx, "DeleteObject", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.DeleteObjectWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) DeleteObjects(input *awss3.DeleteObjectsInput) (*awss3.DeleteObjectsOutput, error) {
+	return c.deleteObjects(context.Background(), input, c.next.DeleteObjects)
+}
+
+func (c *s3Client) DeleteObjectsWithContext(ctx aws.Context, input *awss3.DeleteObjectsInput, opts ...request.Option) (*awss3.DeleteObjectsOutput, error) {
+	return c.deleteObjects(ctx, input, func(input *awss3.DeleteObjectsInput) (*awss3.DeleteObjectsOutput, error) {
+		return c.next.DeleteObjectsWithContext(ctx, input, opts...)
+	})
+}
+
+// deleteObjects applies the rules per key and reports injected faults in
+// the Errors of the output, as the service reports per-key failures.
+func (c *s3Client) deleteObjects(ctx context.Context, input *awss3.DeleteObjectsInput, fn func(*awss3.DeleteObjectsInput) (*awss3.DeleteObjectsOutput, error)) (*awss3.DeleteObjectsOutput, error) {
+	if input.Delete == nil {
+		return fn(input)
+	}
+
+	var (
+		objects []*awss3.ObjectIdentifier
+		failed  []*awss3.Error
+	)
+	for _, obj := range input.Delete.Objects {
+		r, err := c.inject(ctx, "DeleteObjects", obj.Key, NoFault)
+		if err != nil {
+			return nil, err
+		}
+		if !r.fails() {
+			objects = append(objects, obj)
+			continue
+		}
+		e := &awss3.Error{Key: obj.Key, VersionId: obj.VersionId, Message: aws.String(s3Error(r).Error())}
+		if aerr, ok := s3Error(r).(awserr.Error); ok {
+			e.Code, e.Message = aws.String(aerr.Code()), aws.String(aerr.Message())
+		}
+		failed = append(failed, e)
+	}
+
+	out := &awss3.DeleteObjectsOutput{}
+	if len(objects) > 0 {
+		in := *input
+		del := *input.Delete
+		del.Objects = objects
+		in.Delete = &del
+		var err error
+		if out, err = fn(&in); err != nil {
+			return out, err
+		}
+	}
+	out.Errors = append(out.Errors, failed...)
+	return out, nil
+}
+
+func (c *s3Client) ListObjectsV2(input *awss3.ListObjectsV2Input) (*awss3.ListObjectsV2Output, error) {
+	r, err := c.inject(context.Background(), "ListObjectsV2", input.Prefix, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.ListObjectsV2(input)
+}
+
+func (c *s3Client) ListObjectsV2WithContext(ctx aws.Context, input *awss3.ListObjectsV2Input, opts ...request.Option) (*awss3.ListObjectsV2Output, error) {
+	r, err := c.inject(ctx, "ListObjectsV2", input.Prefix, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.ListObjectsV2WithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) ListObjectVersions(input *awss3.ListObjectVersionsInput) (*awss3.ListObjectVersionsOutput, error) {
+	r, err := c.inject(context.Background(), "ListObjectVersions", input.Prefix, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.ListObjectVersions(input)
+}
+
+func (c *s3Client) ListObjectVersionsWithContext(ctx aws.Context, input *awss3.ListObjectVersionsInput, opts ...request.Option) (*awss3.ListObjectVersionsOutput, error) {
+	r, err := c.inject(ctx, "ListObjectVersions", input.Prefix, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.ListObjectVersionsWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) CopyObject(input *awss3.CopyObjectInput) (*awss3.CopyObjectOutput, error) {
+	r, err := c.inject(context.Background(), "CopyObject", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.CopyObject(input)
+}
+
+func (c *s3Client) CopyObjectWithContext(ctx aws.Context, input *awss3.CopyObjectInput, opts ...request.Option) (*awss3.CopyObjectOutput, error) {
+	r, err := c.inject(ctx, "CopyObject", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.CopyObjectWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) HeadObject(input *awss3.HeadObjectInput) (*awss3.HeadObjectOutput, error) {
+	r, err := c.inject(context.Background(), "HeadObject", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.HeadObject(input)
+}
+
+func (c *s3Client) HeadObjectWithContext(ctx aws.Context, input *awss3.HeadObjectInput, opts ...request.Option) (*awss3.HeadObjectOutput, error) {
+	r, err := c.inject(ctx, "HeadObject", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.HeadObjectWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) PutObjectAcl(input *awss3.PutObjectAclInput) (*awss3.PutObjectAclOutput, error) {
+	r, err := c.inject(context.Background(), "PutObjectAcl", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.PutObjectAcl(input)
+}
+
+func (c *s3Client) PutObjectAclWithContext(ctx aws.Context, input *awss3.PutObjectAclInput, opts ...request.Option) (*awss3.PutObjectAclOutput, error) {
+	r, err := c.inject(ctx, "PutObjectAcl", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.PutObjectAclWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) GetObjectAcl(input *awss3.GetObjectAclInput) (*awss3.GetObjectAclOutput, error) {
+	r, err := c.inject(context.Background(), "GetObjectAcl", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.GetObjectAcl(input)
+}
+
+func (c *s3Client) GetObjectAclWithContext(ctx aws.Context, input *awss3.GetObjectAclInput, opts ...request.Option) (*awss3.GetObjectAclOutput, error) {
+	r, err := c.inject(ctx, "GetObjectAcl", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.GetObjectAclWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) CreateMultipartUploadWithContext(ctx aws.Context, input *awss3.CreateMultipartUploadInput, opts ...request.Option) (*awss3.CreateMultipartUploadOutput, error) {
+	r, err := c.inject(ctx, "CreateMultipartUpload", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.CreateMultipartUploadWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) UploadPartWithContext(ctx aws.Context, input *awss3.UploadPartInput, opts ...request.Option) (*awss3.UploadPartOutput, error) {
+	r, err := c.inject(ctx, "UploadPart", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.UploadPartWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) UploadPartCopyWithContext(ctx aws.Context, input *awss3.UploadPartCopyInput, opts ...request.Option) (*awss3.UploadPartCopyOutput, error) {
+	r, err := c.inject(ctx, "UploadPartCopy", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.UploadPartCopyWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) CompleteMultipartUploadWithContext(ctx aws.Context, input *awss3.CompleteMultipartUploadInput, opts ...request.Option) (*awss3.CompleteMultipartUploadOutput, error) {
+	r, err := c.inject(ctx, "CompleteMultipartUpload", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.CompleteMultipartUploadWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) AbortMultipartUploadWithContext(ctx aws.Context, input *awss3.AbortMultipartUploadInput, opts ...request.Option) (*awss3.AbortMultipartUploadOutput, error) {
+	r, err := c.inject(ctx, "AbortMultipartUpload", input.Key, NoFault)
+	if err != nil {
+		return nil, err
+	}
+	if r.fails() {
+		return nil, s3Error(r)
+	}
+	return c.next.AbortMultipartUploadWithContext(ctx, input, opts...)
+}
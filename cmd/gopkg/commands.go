@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+var errUsage = errors.New("invalid arguments")
+
+func parseFlags(usage string, args []string, nargs int, define func(fs *flag.FlagSet)) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet(strings.Fields(usage)[0], flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if define != nil {
+		define(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != nargs {
+		return nil, fmt.Errorf("%w: usage: gopkg %s", errUsage, usage)
+	}
+	return fs, nil
+}
+
+func runLs(ctx context.Context, args []string, stdout io.Writer) error {
+	var long bool
+	fs, err := parseFlags(lsUsage, args, 1, func(fs *flag.FlagSet) {
+		fs.BoolVar(&long, "l", false, "long format")
+	})
+	if err != nil {
+		return err
+	}
+
+	loc := parseLocation(fs.Arg(0))
+	st, err := openStore(ctx, loc)
+	if err != nil {
+		return err
+	}
+
+	keys, err := st.List(ctx, loc.key)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if !long {
+			fmt.Fprintln(stdout, loc.join(k))
+			continue
+		}
+		obj, err := st.Stat(ctx, k)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%12d  %s  %s\n", obj.Size, obj.Updated.UTC().Format(time.RFC3339), loc.join(k))
+	}
+	return nil
+}
+
+func runCp(ctx context.Context, args []string, stdout io.Writer) error {
+	var recursive bool
+	fs, err := parseFlags(cpUsage, args, 2, func(fs *flag.FlagSet) {
+		fs.BoolVar(&recursive, "r", false, "copy every object under SRC")
+	})
+	if err != nil {
+		return err
+	}
+
+	src, dst := parseLocation(fs.Arg(0)), parseLocation(fs.Arg(1))
+	srcStore, err := openStore(ctx, src)
+	if err != nil {
+		return err
+	}
+	dstStore, err := openStore(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	if !recursive {
+		dstKey := dst.key
+		if dstKey == "" || strings.HasSuffix(dstKey, "/") || isLocalDir(dst) {
+			dstKey = joinKey(dst, dstKey, path.Base(filepath.ToSlash(src.key)))
+		}
+		return copyOne(ctx, srcStore, dstStore, src.key, dstKey)
+	}
+
+	keys, err := srcStore.List(ctx, src.key)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		dstKey := joinKey(dst, dst.key, relKey(src.key, k))
+		if err := copyOne(ctx, srcStore, dstStore, k, dstKey); err != nil {
+			return fmt.Errorf("%s: %w", src.join(k), err)
+		}
+		fmt.Fprintf(stdout, "%s -> %s\n", src.join(k), dst.join(dstKey))
+	}
+	return nil
+}
+
+func runCat(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, err := parseFlags(catUsage, args, 1, nil)
+	if err != nil {
+		return err
+	}
+
+	loc := parseLocation(fs.Arg(0))
+	st, err := openStore(ctx, loc)
+	if err != nil {
+		return err
+	}
+
+	r, err := st.Open(ctx, loc.key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(stdout, r)
+	return err
+}
+
+func runRm(ctx context.Context, args []string, stdout io.Writer) error {
+	var recursive bool
+	fs, err := parseFlags(rmUsage, args, 1, func(fs *flag.FlagSet) {
+		fs.BoolVar(&recursive, "r", false, "remove every object under URL")
+	})
+	if err != nil {
+		return err
+	}
+
+	loc := parseLocation(fs.Arg(0))
+	st, err := openStore(ctx, loc)
+	if err != nil {
+		return err
+	}
+
+	if !recursive {
+		return st.Delete(ctx, loc.key)
+	}
+	if loc.key == "" {
+		return errors.New("refusing to remove a whole bucket; give a prefix")
+	}
+
+	if err := st.DeletePrefix(ctx, loc.key); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "removed %s*\n", loc)
+	return nil
+}
+
+func runStat(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, err := parseFlags(statUsage, args, 1, nil)
+	if err != nil {
+		return err
+	}
+
+	loc := parseLocation(fs.Arg(0))
+	st, err := openStore(ctx, loc)
+	if err != nil {
+		return err
+	}
+
+	obj, err := st.Stat(ctx, loc.key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "URL:                 %s\n", loc)
+	fmt.Fprintf(stdout, "Size:                %d\n", obj.Size)
+	fmt.Fprintf(stdout, "Updated:             %s\n", obj.Updated.UTC().Format(time.RFC3339))
+	fmt.Fprintf(stdout, "MD5:                 %x\n", obj.MD5)
+	fmt.Fprintf(stdout, "Content-Type:        %s\n", obj.ContentType)
+	fmt.Fprintf(stdout, "Cache-Control:       %s\n", obj.CacheControl)
+	fmt.Fprintf(stdout, "Content-Disposition: %s\n", obj.ContentDisposition)
+	fmt.Fprintf(stdout, "Content-Language:    %s\n", obj.ContentLanguage)
+	for k, v := range obj.Metadata {
+		fmt.Fprintf(stdout, "Metadata:            %s=%s\n", k, v)
+	}
+	return nil
+}
+
+// runSync copies objects under SRC that are missing from DST or differ in
+// size or MD5. Without an MD5 on both sides, an object is copied again unless
+// DST was modified after SRC, or -size-only is given.
+func runSync(ctx context.Context, args []string, stdout io.Writer) error {
+	var sizeOnly bool
+	fs, err := parseFlags(syncUsage, args, 2, func(fs *flag.FlagSet) {
+		fs.BoolVar(&sizeOnly, "size-only", false, "skip objects of the same size without comparing content")
+	})
+	if err != nil {
+		return err
+	}
+
+	src, dst := parseLocation(fs.Arg(0)), parseLocation(fs.Arg(1))
+	srcStore, err := openStore(ctx, src)
+	if err != nil {
+		return err
+	}
+	dstStore, err := openStore(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	keys, err := srcStore.List(ctx, src.key)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		dstKey := joinKey(dst, dst.key, relKey(src.key, k))
+
+		srcObj, err := srcStore.Stat(ctx, k)
+		if err != nil {
+			return err
+		}
+		if dstObj, err := dstStore.Stat(ctx, dstKey); err == nil && sameContent(srcObj, dstObj, sizeOnly) {
+			continue
+		}
+
+		if err := copyOne(ctx, srcStore, dstStore, k, dstKey); err != nil {
+			return fmt.Errorf("%s: %w", src.join(k), err)
+		}
+		fmt.Fprintf(stdout, "%s -> %s\n", src.join(k), dst.join(dstKey))
+	}
+	return nil
+}
+
+func runSignURL(ctx context.Context, args []string, stdout io.Writer) error {
+	var (
+		expires     time.Duration
+		credentials string
+	)
+	fs, err := parseFlags(signURLUsage, args, 1, func(fs *flag.FlagSet) {
+		fs.DurationVar(&expires, "expires", 15*time.Minute, "validity of the URL")
+		fs.StringVar(&credentials, "credentials", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "service account JSON key used to sign gs:// URLs")
+	})
+	if err != nil {
+		return err
+	}
+
+	loc := parseLocation(fs.Arg(0))
+
+	var u string
+	switch loc.scheme {
+	case "gs":
+		key, err := ioutil.ReadFile(credentials)
+		if err != nil {
+			return err
+		}
+		u, err = gcs.SignedURL(loc.bucket, loc.key, key, expires)
+		if err != nil {
+			return err
+		}
+	case "s3":
+		u, err = newS3Interactor(loc.bucket).SignedURL(loc.key, expires)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: sign-url needs a gs:// or s3:// URL", errUsage)
+	}
+
+	fmt.Fprintln(stdout, u)
+	return nil
+}
+
+// isLocalDir reports whether l is an existing local directory.
+func isLocalDir(l location) bool {
+	if !l.isLocal() {
+		return false
+	}
+	info, err := os.Stat(l.key)
+	return err == nil && info.IsDir()
+}
+
+func copyOne(ctx context.Context, src, dst storage.Store, srcKey, dstKey string) error {
+	obj, err := src.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	r, err := src.Open(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return dst.Write(ctx, dstKey, r, obj)
+}
+
+// sameContent reports whether b, the destination, holds a copy of a.
+func sameContent(a, b *storage.Object, sizeOnly bool) bool {
+	if a.Size != b.Size {
+		return false
+	}
+	if sizeOnly {
+		return true
+	}
+	if a.MD5 != nil && b.MD5 != nil {
+		return bytes.Equal(a.MD5, b.MD5)
+	}
+	// A multipart S3 upload has no MD5. Take b for a copy only if it was
+	// written after a last changed; copying keeps the time for local files.
+	return !a.Updated.IsZero() && !b.Updated.Before(a.Updated)
+}
+
+// relKey returns key relative to prefix using forward slashes.
+func relKey(prefix, key string) string {
+	rel := filepath.ToSlash(strings.TrimPrefix(key, prefix))
+	return strings.TrimPrefix(rel, "/")
+}
+
+// joinKey appends rel to dir, using the path separator of the destination.
+func joinKey(dst location, dir, rel string) string {
+	if dst.isLocal() {
+		return filepath.Join(dir, filepath.FromSlash(rel))
+	}
+	if dir == "" || strings.HasSuffix(dir, "/") {
+		return dir + rel
+	}
+	return dir + "/" + rel
+}
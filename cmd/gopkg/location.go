@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+// location is a parsed gs://, s3:// or local path argument.
+type location struct {
+	scheme string
+	bucket string
+	key    string
+}
+
+func parseLocation(arg string) location {
+	for _, scheme := range []string{"gs", "s3"} {
+		if rest := strings.TrimPrefix(arg, scheme+"://"); rest != arg {
+			parts := strings.SplitN(rest, "/", 2)
+			loc := location{scheme: scheme, bucket: parts[0]}
+			if len(parts) == 2 {
+				loc.key = parts[1]
+			}
+			return loc
+		}
+	}
+	return location{key: arg}
+}
+
+func (l location) isLocal() bool {
+	return l.scheme == ""
+}
+
+// join returns the location of key inside the same bucket.
+func (l location) join(key string) location {
+	l.key = key
+	return l
+}
+
+func (l location) String() string {
+	if l.isLocal() {
+		return l.key
+	}
+	return fmt.Sprintf("%s://%s/%s", l.scheme, l.bucket, l.key)
+}
+
+// store is a storage.Store that can also remove every key under a prefix.
+type store interface {
+	storage.Store
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+func openStore(ctx context.Context, l location) (store, error) {
+	switch l.scheme {
+	case "gs":
+		c, err := gcs.NewGCSClient(l.bucket)
+		if err != nil {
+			return nil, err
+		}
+		return &gcsStore{Store: storage.FromGCS(c), client: c}, nil
+	case "s3":
+		i := newS3Interactor(l.bucket)
+		return &s3Store{Store: storage.FromS3(i), interactor: i}, nil
+	default:
+		return localStore{}, nil
+	}
+}
+
+func newS3Interactor(bucket string) *s3.Interactor {
+	opt := s3.Options{
+		Region:          os.Getenv("AWS_REGION"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT"),
+		Bucket:          bucket,
+		CredentialChain: s3CredentialChain(),
+	}
+	return s3.New(s3.NewS3Client(opt), opt)
+}
+
+// s3CredentialChain follows the default chain of the AWS CLI: environment,
+// shared credentials file, web identity, then container or instance
+// credentials. Sources whose environment is not set up are left out so
+// they do not add a network round trip.
+func s3CredentialChain() []s3.CredentialSource {
+	chain := []s3.CredentialSource{s3.EnvCredentials, s3.SharedCredentials}
+	if os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" {
+		chain = append(chain, s3.WebIdentityCredentials)
+	}
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		return append(chain, s3.ECSCredentials)
+	}
+	return append(chain, s3.EC2Credentials)
+}
+
+type gcsStore struct {
+	storage.Store
+	client gcs.Client
+}
+
+func (g *gcsStore) DeletePrefix(ctx context.Context, prefix string) error {
+	return g.client.DeletePrefix(ctx, prefix)
+}
+
+type s3Store struct {
+	storage.Store
+	interactor *s3.Interactor
+}
+
+func (s *s3Store) DeletePrefix(ctx context.Context, prefix string) error {
+	return s.interactor.DeletePrefixContext(ctx, prefix)
+}
+
+// localStore treats keys as file paths.
+type localStore struct{}
+
+func (localStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.Walk(prefix, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			keys = append(keys, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (localStore) Stat(ctx context.Context, key string) (*storage.Object, error) {
+	f, err := os.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return &storage.Object{
+		Key:     key,
+		Size:    info.Size(),
+		MD5:     h.Sum(nil),
+		Updated: info.ModTime(),
+	}, nil
+}
+
+func (localStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(key)
+}
+
+// Write writes to a temporary file next to key and renames it into place.
+func (localStore) Write(ctx context.Context, key string, r io.Reader, obj *storage.Object) error {
+	dir := filepath.Dir(key)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := createTemp(dir, "."+filepath.Base(key)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !obj.Updated.IsZero() {
+		os.Chtimes(f.Name(), time.Now(), obj.Updated)
+	}
+
+	return os.Rename(f.Name(), key)
+}
+
+// createTemp creates a new file in dir like ioutil.TempFile, but with the
+// mode of a regular file, 0644 masked by the umask, instead of 0600, since it
+// is renamed into place.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for n := 0; ; n++ {
+		name := filepath.Join(dir, prefix+strconv.FormatInt(time.Now().UnixNano()+int64(os.Getpid()+n), 36))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) && n < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+func (localStore) Delete(ctx context.Context, key string) error {
+	return os.Remove(key)
+}
+
+func (l localStore) DeletePrefix(ctx context.Context, prefix string) error {
+	keys, err := l.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := os.Remove(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Command gopkg operates on gs://, s3:// and local objects using the gcs and s3 packages.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	lsUsage      = "ls [-l] URL"
+	cpUsage      = "cp [-r] SRC DST"
+	catUsage     = "cat URL"
+	rmUsage      = "rm [-r] URL"
+	statUsage    = "stat URL"
+	syncUsage    = "sync [-size-only] SRC DST"
+	signURLUsage = "sign-url [-expires DURATION] [-credentials FILE] URL"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"ls":       {lsUsage, runLs},
+	"cp":       {cpUsage, runCp},
+	"cat":      {catUsage, runCat},
+	"rm":       {rmUsage, runRm},
+	"stat":     {statUsage, runStat},
+	"sync":     {syncUsage, runSync},
+	"sign-url": {signURLUsage, runSignURL},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gopkg", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	showVersion := fs.Bool("version", false, "print version and exit")
+	fs.Usage = func() { usage(stderr) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *showVersion {
+		fmt.Fprintf(stdout, "gopkg version %s (rev: %s)\n", version, revision)
+		return 0
+	}
+
+	if fs.NArg() == 0 {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "gopkg: unknown command %q\n", fs.Arg(0))
+		usage(stderr)
+		return 2
+	}
+
+	if err := cmd.run(context.Background(), fs.Args()[1:], stdout); err != nil {
+		fmt.Fprintf(stderr, "gopkg %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: gopkg [--version] COMMAND [ARGS]")
+	fmt.Fprintln(w, "\nCommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want location
+	}{
+		{"gs://bucket/dir/a.txt", location{scheme: "gs", bucket: "bucket", key: "dir/a.txt"}},
+		{"s3://bucket", location{scheme: "s3", bucket: "bucket"}},
+		{"s3://bucket/", location{scheme: "s3", bucket: "bucket"}},
+		{"./local/a.txt", location{key: "./local/a.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			if got := parseLocation(tt.arg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLocation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_local(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0644)
+	dst := filepath.Join(dir, "dst")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"cp", "-r", src, dst}, &stdout, &stderr); code != 0 {
+		t.Fatalf("cp exit = %d, stderr = %s", code, stderr.String())
+	}
+
+	// Copies get the mode of a file created with 0644, not that of a temp file.
+	srcInfo, err := os.Stat(filepath.Join(src, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dstInfo, err := os.Stat(filepath.Join(dst, "a.txt")); err != nil || dstInfo.Mode() != srcInfo.Mode() {
+		t.Errorf("copy mode = %v, %v, want %v", dstInfo.Mode(), err, srcInfo.Mode())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"cat", filepath.Join(dst, "sub", "b.txt")}, &stdout, &stderr); code != 0 {
+		t.Fatalf("cat exit = %d, stderr = %s", code, stderr.String())
+	}
+	if stdout.String() != "b" {
+		t.Errorf("cat = %q, want %q", stdout.String(), "b")
+	}
+
+	stdout.Reset()
+	if code := run([]string{"sync", src, dst}, &stdout, &stderr); code != 0 {
+		t.Fatalf("sync exit = %d, stderr = %s", code, stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("sync copied unchanged files: %s", stdout.String())
+	}
+}
+
+func TestSameContent(t *testing.T) {
+	now := time.Now()
+	obj := func(body string, md5 []byte, updated time.Time) *storage.Object {
+		return &storage.Object{Size: int64(len(body)), MD5: md5, Updated: updated}
+	}
+
+	tests := []struct {
+		name     string
+		a, b     *storage.Object
+		sizeOnly bool
+		want     bool
+	}{
+		{"same digest", obj("a", []byte("1"), now), obj("a", []byte("1"), now.Add(-time.Hour)), false, true},
+		{"other digest", obj("a", []byte("1"), now), obj("a", []byte("2"), now), false, false},
+		{"other size", obj("a", nil, now), obj("ab", nil, now), true, false},
+		{"no digest, newer copy", obj("a", []byte("1"), now), obj("a", nil, now.Add(time.Minute)), false, true},
+		{"no digest, older copy", obj("a", []byte("1"), now), obj("a", nil, now.Add(-time.Minute)), false, false},
+		{"no digest, size only", obj("a", []byte("1"), now), obj("a", nil, now.Add(-time.Minute)), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameContent(tt.a, tt.b, tt.sizeOnly); got != tt.want {
+				t.Errorf("sameContent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_version(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--version"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit = %d", code)
+	}
+	if !strings.Contains(stdout.String(), version) {
+		t.Errorf("--version = %q, want it to contain %q", stdout.String(), version)
+	}
+}
+
+func TestRun_cpIntoDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "a.txt")
+	ioutil.WriteFile(src, []byte("a"), 0644)
+	dst := filepath.Join(dir, "dst")
+	os.MkdirAll(dst, 0755)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"cp", src, dst}, &stdout, &stderr); code != 0 {
+		t.Fatalf("cp exit = %d, stderr = %s", code, stderr.String())
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dst, "a.txt")); err != nil || string(b) != "a" {
+		t.Errorf("dst/a.txt = %q, %v, want %q", b, err, "a")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dst); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove("a.txt")
+	if code := run([]string{"cp", src, "."}, &stdout, &stderr); code != 0 {
+		t.Fatalf("cp . exit = %d, stderr = %s", code, stderr.String())
+	}
+	if b, err := ioutil.ReadFile("a.txt"); err != nil || string(b) != "a" {
+		t.Errorf("./a.txt = %q, %v, want %q", b, err, "a")
+	}
+}
+
+func TestRun_rmRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"rm", "-r", dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("rm exit = %d, stderr = %s", code, stderr.String())
+	}
+	keys, err := localStore{}.List(context.Background(), dir)
+	if err != nil || len(keys) != 0 {
+		t.Errorf("files after rm -r = %v, %v, want none", keys, err)
+	}
+}
+
+func TestS3CredentialChain(t *testing.T) {
+	vars := []string{"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI"}
+	saved := map[string]string{}
+	for _, v := range vars {
+		if val, ok := os.LookupEnv(v); ok {
+			saved[v] = val
+		}
+		os.Unsetenv(v)
+	}
+	defer func() {
+		for _, v := range vars {
+			os.Unsetenv(v)
+			if val, ok := saved[v]; ok {
+				os.Setenv(v, val)
+			}
+		}
+	}()
+
+	want := []s3.CredentialSource{s3.EnvCredentials, s3.SharedCredentials, s3.EC2Credentials}
+	if got := s3CredentialChain(); !reflect.DeepEqual(got, want) {
+		t.Errorf("s3CredentialChain() = %v, want %v", got, want)
+	}
+
+	os.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/token")
+	os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials")
+	want = []s3.CredentialSource{s3.EnvCredentials, s3.SharedCredentials, s3.WebIdentityCredentials, s3.ECSCredentials}
+	if got := s3CredentialChain(); !reflect.DeepEqual(got, want) {
+		t.Errorf("s3CredentialChain() = %v, want %v", got, want)
+	}
+}
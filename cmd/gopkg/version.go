@@ -0,0 +1,6 @@
+package main
+
+const version = "0.0.2"
+
+// revision is set at build time with -ldflags "-X main.revision=...".
+var revision = "HEAD"
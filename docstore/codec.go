@@ -0,0 +1,69 @@
+package docstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes documents to object bodies.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	// ContentType is the content type of the stored objects.
+	ContentType() string
+}
+
+var (
+	// JSON encodes documents with encoding/json. It is the default codec.
+	JSON Codec = jsonCodec{}
+	// Gob encodes documents with encoding/gob.
+	Gob Codec = gobCodec{}
+	// Proto encodes documents that implement proto.Message in the protobuf wire format.
+	Proto Codec = protoCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) ContentType() string                        { return "application/json" }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gobCodec) ContentType() string { return "application/x-gob" }
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("docstore: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("docstore: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (protoCodec) ContentType() string { return "application/x-protobuf" }
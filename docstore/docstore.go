@@ -0,0 +1,231 @@
+// Package docstore stores typed documents as objects through a gcs.Client.
+//
+//	s := docstore.New(c, docstore.Options{Prefix: "state/"})
+//	var st State
+//	err := s.Update(ctx, "cron", &st, func() error {
+//		st.Runs++
+//		return nil
+//	})
+//
+// Update reads, modifies and writes a document with a generation
+// precondition, retrying with jittered backoff when another writer got
+// there first.
+//
+// The module targets Go 1.13, which has no type parameters, so Update takes
+// the document as an interface{} pointer and fn as a func() error rather than
+// a func(*T) error. fn changes the document through the pointer it captures,
+// the one passed to Update, which holds the freshly loaded document on every
+// attempt:
+//
+//	var st State
+//	err := s.Update(ctx, "cron", &st, func() error {
+//		if st.Paused {
+//			return errPaused // aborts without writing
+//		}
+//		st.LastRun = time.Now()
+//		return nil
+//	})
+package docstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/internal/retry"
+)
+
+// schemaVersionKey is the object metadata key holding the schema version.
+const schemaVersionKey = "schema-version"
+
+// errRace is returned by an attempt of Update that lost a race.
+var errRace = errors.New("docstore: document changed")
+
+var (
+	// ErrConflict is returned by Update when every attempt lost a race
+	// with another writer.
+	ErrConflict = errors.New("docstore: too many concurrent updates")
+	// ErrNewerSchema is returned when a document was written with a schema
+	// version above Options.SchemaVersion.
+	ErrNewerSchema = errors.New("docstore: document has a newer schema version")
+)
+
+// Options configures a Store.
+type Options struct {
+	// Prefix is prepended to every key.
+	Prefix string
+	// Codec encodes documents. Defaults to JSON.
+	Codec Codec
+	// SchemaVersion is recorded with every saved document.
+	SchemaVersion int
+	// Upgrade, when set, converts the body of a document saved with an older
+	// schema version before it is decoded.
+	Upgrade func(version int, data []byte) ([]byte, error)
+	// MaxAttempts is the number of read-modify-write attempts of Update.
+	// Defaults to 5.
+	MaxAttempts int
+	// RetryBackoff is the longest wait before the first retry of Update. It
+	// doubles after each conflict, up to 2s, and the actual wait is random
+	// up to it. Defaults to 20ms.
+	RetryBackoff time.Duration
+}
+
+// Store saves and loads documents.
+type Store struct {
+	client gcs.Client
+	opts   Options
+}
+
+// New returns a Store writing documents with c.
+func New(c gcs.Client, opts Options) *Store {
+	if opts.Codec == nil {
+		opts.Codec = JSON
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 20 * time.Millisecond
+	}
+	return &Store{client: c, opts: opts}
+}
+
+// Save writes v to key, replacing any previous document.
+func (s *Store) Save(ctx context.Context, key string, v interface{}) error {
+	return s.save(ctx, key, v, gcs.PutOptions{})
+}
+
+func (s *Store) save(ctx context.Context, key string, v interface{}, opts gcs.PutOptions) error {
+	data, err := s.opts.Codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("docstore: encode %s: %w", key, err)
+	}
+
+	opts.ContentType = s.opts.Codec.ContentType()
+	opts.Metadata = map[string]string{schemaVersionKey: strconv.Itoa(s.opts.SchemaVersion)}
+	return s.client.PutWithOptions(ctx, s.opts.Prefix+key, data, opts)
+}
+
+// Load decodes the document at key into v, which must be a pointer.
+// It returns gcs.ErrObjectNotExist if there is no document.
+func (s *Store) Load(ctx context.Context, key string, v interface{}) error {
+	_, err := s.load(ctx, key, v)
+	return err
+}
+
+// load decodes the document at key into v and returns its generation.
+func (s *Store) load(ctx context.Context, key string, v interface{}) (int64, error) {
+	name := s.opts.Prefix + key
+
+	// Read the generation reported by Attrs, so the body and its schema
+	// version belong together. It disappears if it is overwritten in
+	// between on a bucket without versioning; start over then.
+	for attempt := 1; ; attempt++ {
+		attrs, err := s.client.Attrs(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		data, err := s.client.GetVersion(ctx, name, attrs.Generation)
+		if errors.Is(err, gcs.ErrObjectNotExist) && attempt < s.opts.MaxAttempts {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if data, err = s.upgrade(key, attrs.Metadata, data); err != nil {
+			return 0, err
+		}
+		if err := s.opts.Codec.Unmarshal(data, v); err != nil {
+			return 0, fmt.Errorf("docstore: decode %s: %w", key, err)
+		}
+		return attrs.Generation, nil
+	}
+}
+
+func (s *Store) upgrade(key string, meta map[string]string, data []byte) ([]byte, error) {
+	version := 0
+	if v, ok := meta[schemaVersionKey]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("docstore: %s has invalid schema version %q", key, v)
+		}
+		version = n
+	}
+
+	switch {
+	case version > s.opts.SchemaVersion:
+		return nil, fmt.Errorf("docstore: %s has version %d, want at most %d: %w", key, version, s.opts.SchemaVersion, ErrNewerSchema)
+	case version < s.opts.SchemaVersion && s.opts.Upgrade != nil:
+		data, err := s.opts.Upgrade(version, data)
+		if err != nil {
+			return nil, fmt.Errorf("docstore: upgrade %s from version %d: %w", key, version, err)
+		}
+		return data, nil
+	}
+	return data, nil
+}
+
+// Update loads the document at key into v, which must be a pointer, calls fn
+// to modify it and saves the result only if the document did not change in
+// the meantime. A missing document starts as the zero value. v is reset
+// before every attempt, so fn must derive all changes from it. An error from
+// fn aborts the update and is returned as is. Conflicting attempts are
+// retried after a backoff; when ctx is done meanwhile, its error is returned.
+func (s *Store) Update(ctx context.Context, key string, v interface{}, fn func() error) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("docstore: Update needs a non-nil pointer, got %T", v)
+	}
+
+	policy := retry.Policy{
+		MaxAttempts:    s.opts.MaxAttempts,
+		InitialBackoff: s.opts.RetryBackoff,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         true,
+	}
+	isRace := func(err error) bool { return err == errRace }
+	err := retry.Do(ctx, policy, isRace, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+		gen, err := s.load(ctx, key, v)
+		if err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+			return err
+		}
+
+		if err := fn(); err != nil {
+			return err
+		}
+
+		opts := gcs.PutOptions{IfGenerationMatch: gen, IfNotExist: gen == 0}
+		err = s.save(ctx, key, v, opts)
+		if gcs.IsPreconditionFailed(err) {
+			return errRace
+		}
+		return err
+	})
+	if err == errRace {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrConflict
+	}
+	return err
+}
+
+// Delete removes the document at key. Deleting a missing document is not an error.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	err := s.client.Delete(ctx, s.opts.Prefix+key)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
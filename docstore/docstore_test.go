@@ -0,0 +1,159 @@
+package docstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+)
+
+type state struct {
+	Name  string
+	Runs  int
+	Items []string
+}
+
+func TestStore_SaveLoad(t *testing.T) {
+	ctx := context.Background()
+	for name, codec := range map[string]Codec{"json": JSON, "gob": Gob} {
+		t.Run(name, func(t *testing.T) {
+			c := fake.New("test")
+			s := New(c, Options{Prefix: "state/", Codec: codec})
+
+			want := state{Name: "cron", Runs: 3, Items: []string{"a", "b"}}
+			if err := s.Save(ctx, "job", &want); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			var got state
+			if err := s.Load(ctx, "job", &got); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+
+			attrs, err := c.Attrs(ctx, "state/job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attrs.ContentType != codec.ContentType() {
+				t.Errorf("ContentType = %q, want %q", attrs.ContentType, codec.ContentType())
+			}
+
+			if err := s.Delete(ctx, "job"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if err := s.Load(ctx, "job", &got); !errors.Is(err, gcs.ErrObjectNotExist) {
+				t.Errorf("Load() after Delete() error = %v, want %v", err, gcs.ErrObjectNotExist)
+			}
+		})
+	}
+}
+
+func TestStore_Update(t *testing.T) {
+	ctx := context.Background()
+	s := New(fake.New("test"), Options{MaxAttempts: 100})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var st state
+			err := s.Update(ctx, "counter", &st, func() error {
+				st.Runs++
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Update() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var st state
+	if err := s.Load(ctx, "counter", &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Runs != 10 {
+		t.Errorf("Runs = %d, want 10", st.Runs)
+	}
+
+	boom := errors.New("boom")
+	if err := s.Update(ctx, "counter", &st, func() error { return boom }); err != boom {
+		t.Errorf("Update() error = %v, want %v", err, boom)
+	}
+}
+
+func TestStore_Conflict(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New("test")
+	s := New(c, Options{MaxAttempts: 2})
+
+	var st state
+	err := s.Update(ctx, "doc", &st, func() error {
+		// Another writer saves between every read and write.
+		return c.Put(ctx, "doc", []byte(`{"Runs":1}`))
+	})
+	if err != ErrConflict {
+		t.Errorf("Update() error = %v, want %v", err, ErrConflict)
+	}
+}
+
+func TestStore_ConflictBackoff(t *testing.T) {
+	c := fake.New("test")
+	s := New(c, Options{MaxAttempts: 3, RetryBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var st state
+	start := time.Now()
+	err := s.Update(ctx, "doc", &st, func() error {
+		return c.Put(ctx, "doc", []byte(`{"Runs":1}`))
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Update() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Update() returned after %v, want it to stop waiting when ctx is done", d)
+	}
+}
+
+func TestStore_SchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New("test")
+	old := New(c, Options{SchemaVersion: 1})
+	if err := old.Save(ctx, "doc", map[string]string{"title": "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(c, Options{
+		SchemaVersion: 2,
+		Upgrade: func(version int, data []byte) ([]byte, error) {
+			if version != 1 {
+				t.Errorf("Upgrade() version = %d, want 1", version)
+			}
+			return bytes.Replace(data, []byte(`"title"`), []byte(`"Name"`), 1), nil
+		},
+	})
+	var st state
+	if err := s.Load(ctx, "doc", &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Name != "x" {
+		t.Errorf("Name = %q, want %q", st.Name, "x")
+	}
+
+	if err := s.Save(ctx, "doc", &st); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Load(ctx, "doc", &st); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("Load() of newer document error = %v, want %v", err, ErrNewerSchema)
+	}
+}
@@ -0,0 +1,108 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// ACLEntity is a grantee of an object ACL, such as AllUsers or UserEntity("a@example.com").
+type ACLEntity string
+
+const (
+	AllUsers              ACLEntity = "allUsers"
+	AllAuthenticatedUsers ACLEntity = "allAuthenticatedUsers"
+)
+
+// UserEntity returns the entity of a Google account or service account.
+func UserEntity(email string) ACLEntity {
+	return ACLEntity("user-" + email)
+}
+
+// GroupEntity returns the entity of a Google group.
+func GroupEntity(email string) ACLEntity {
+	return ACLEntity("group-" + email)
+}
+
+// DomainEntity returns the entity of a Google Workspace domain.
+func DomainEntity(domain string) ACLEntity {
+	return ACLEntity("domain-" + domain)
+}
+
+// ACLRole is the access level granted to an entity.
+type ACLRole string
+
+const (
+	RoleOwner  ACLRole = "OWNER"
+	RoleReader ACLRole = "READER"
+	RoleWriter ACLRole = "WRITER"
+)
+
+// ACLRule grants Role to Entity.
+type ACLRule struct {
+	Entity ACLEntity
+	Role   ACLRole
+}
+
+// SetACL grants role on objName to entity, replacing any previous role of the entity.
+func (c *client) SetACL(ctx context.Context, objName string, entity ACLEntity, role ACLRole) error {
+	acl := c.bucketHandle().Object(objName).ACL()
+	return c.retry.do(ctx, func() error {
+		return acl.Set(ctx, storage.ACLEntity(entity), storage.ACLRole(role))
+	})
+}
+
+// DeleteACL revokes every role of entity on objName.
+func (c *client) DeleteACL(ctx context.Context, objName string, entity ACLEntity) error {
+	acl := c.bucketHandle().Object(objName).ACL()
+	return c.retry.do(ctx, func() error {
+		return acl.Delete(ctx, storage.ACLEntity(entity))
+	})
+}
+
+// ListACL Fetch the ACL rules of objName.
+func (c *client) ListACL(ctx context.Context, objName string) ([]ACLRule, error) {
+	var rules []storage.ACLRule
+	err := c.retry.do(ctx, func() error {
+		var err error
+		rules, err = c.bucketHandle().Object(objName).ACL().List(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	acl := make([]ACLRule, 0, len(rules))
+	for _, r := range rules {
+		acl = append(acl, ACLRule{Entity: ACLEntity(r.Entity), Role: ACLRole(r.Role)})
+	}
+	return acl, nil
+}
+
+// MakeObjectPrivate revokes the public grants made by MakeObjectPublic or AllAuthenticatedUsers.
+// It returns ErrObjectNotExist if objName does not exist.
+func (c *client) MakeObjectPrivate(ctx context.Context, objName string) error {
+	for _, entity := range []ACLEntity{AllUsers, AllAuthenticatedUsers} {
+		err := c.DeleteACL(ctx, objName, entity)
+		if isNotFound(err) {
+			// The API reports a missing entry and a missing object alike.
+			if _, err := c.Attrs(ctx, objName); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
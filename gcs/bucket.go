@@ -0,0 +1,183 @@
+package gcs
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// BucketAdmin Bucket administration interface
+type BucketAdmin interface {
+	Create(ctx context.Context, projectID string, attrs BucketOptions) error
+	Delete(ctx context.Context) error
+	Lifecycle(ctx context.Context) ([]LifecycleRule, error)
+	SetLifecycle(ctx context.Context, rules []LifecycleRule) error
+	CORS(ctx context.Context) ([]CORSRule, error)
+	SetCORS(ctx context.Context, rules []CORSRule) error
+	SetDefaultObjectACL(ctx context.Context, predefinedACL string) error
+	Versioning(ctx context.Context) (bool, error)
+	SetVersioning(ctx context.Context, enabled bool) error
+}
+
+// BucketOptions are the attributes of a new bucket.
+type BucketOptions struct {
+	Location          string
+	StorageClass      string
+	VersioningEnabled bool
+	Labels            map[string]string
+}
+
+// LifecycleRule deletes or transitions objects once they reach AgeInDays.
+type LifecycleRule struct {
+	AgeInDays int64
+	// StorageClass moves matching objects to this class; empty deletes them.
+	StorageClass string
+	// NoncurrentOnly restricts the rule to noncurrent versions.
+	NoncurrentOnly bool
+}
+
+// CORSRule is a single CORS configuration entry of a bucket.
+type CORSRule struct {
+	Origins         []string
+	Methods         []string
+	ResponseHeaders []string
+	MaxAge          time.Duration
+}
+
+type bucketAdmin struct {
+	gcsClient   *storage.Client
+	bucket      string
+	userProject string
+}
+
+func NewBucketAdmin(bucket string, opts ...Option) (BucketAdmin, error) {
+	ctx := context.Background()
+	cfg := newConfig(opts)
+
+	gcsClient, err := cfg.newStorageClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bucketAdmin{
+		gcsClient:   gcsClient,
+		bucket:      bucket,
+		userProject: cfg.userProject,
+	}, nil
+}
+
+func (b *bucketAdmin) bucketHandle() *storage.BucketHandle {
+	h := b.gcsClient.Bucket(b.bucket)
+	if b.userProject != "" {
+		h = h.UserProject(b.userProject)
+	}
+	return h
+}
+
+func (b *bucketAdmin) Create(ctx context.Context, projectID string, opts BucketOptions) error {
+	attrs := &storage.BucketAttrs{
+		Location:          opts.Location,
+		StorageClass:      opts.StorageClass,
+		VersioningEnabled: opts.VersioningEnabled,
+		Labels:            opts.Labels,
+	}
+
+	return b.bucketHandle().Create(ctx, projectID, attrs)
+}
+
+// Delete deletes the bucket, which must be empty.
+func (b *bucketAdmin) Delete(ctx context.Context) error {
+	return b.bucketHandle().Delete(ctx)
+}
+
+func (b *bucketAdmin) Lifecycle(ctx context.Context) ([]LifecycleRule, error) {
+	attrs, err := b.bucketHandle().Attrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []LifecycleRule
+	for _, r := range attrs.Lifecycle.Rules {
+		rules = append(rules, LifecycleRule{
+			AgeInDays:      r.Condition.AgeInDays,
+			StorageClass:   r.Action.StorageClass,
+			NoncurrentOnly: r.Condition.Liveness == storage.Archived,
+		})
+	}
+	return rules, nil
+}
+
+// SetLifecycle replaces the lifecycle rules of the bucket.
+func (b *bucketAdmin) SetLifecycle(ctx context.Context, rules []LifecycleRule) error {
+	lc := &storage.Lifecycle{}
+	for _, r := range rules {
+		rule := storage.LifecycleRule{
+			Action:    storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{AgeInDays: r.AgeInDays},
+		}
+		if r.StorageClass != "" {
+			rule.Action = storage.LifecycleAction{Type: storage.SetStorageClassAction, StorageClass: r.StorageClass}
+		}
+		if r.NoncurrentOnly {
+			rule.Condition.Liveness = storage.Archived
+		}
+		lc.Rules = append(lc.Rules, rule)
+	}
+
+	_, err := b.bucketHandle().Update(ctx, storage.BucketAttrsToUpdate{Lifecycle: lc})
+	return err
+}
+
+func (b *bucketAdmin) CORS(ctx context.Context) ([]CORSRule, error) {
+	attrs, err := b.bucketHandle().Attrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []CORSRule
+	for _, c := range attrs.CORS {
+		rules = append(rules, CORSRule{
+			Origins:         c.Origins,
+			Methods:         c.Methods,
+			ResponseHeaders: c.ResponseHeaders,
+			MaxAge:          c.MaxAge,
+		})
+	}
+	return rules, nil
+}
+
+// SetCORS replaces the CORS configuration of the bucket.
+func (b *bucketAdmin) SetCORS(ctx context.Context, rules []CORSRule) error {
+	cors := []storage.CORS{}
+	for _, r := range rules {
+		cors = append(cors, storage.CORS{
+			Origins:         r.Origins,
+			Methods:         r.Methods,
+			ResponseHeaders: r.ResponseHeaders,
+			MaxAge:          r.MaxAge,
+		})
+	}
+
+	_, err := b.bucketHandle().Update(ctx, storage.BucketAttrsToUpdate{CORS: cors})
+	return err
+}
+
+// SetDefaultObjectACL applies a predefined ACL such as "publicRead" or "private" to new objects.
+func (b *bucketAdmin) SetDefaultObjectACL(ctx context.Context, predefinedACL string) error {
+	_, err := b.bucketHandle().Update(ctx, storage.BucketAttrsToUpdate{PredefinedDefaultObjectACL: predefinedACL})
+	return err
+}
+
+func (b *bucketAdmin) Versioning(ctx context.Context) (bool, error) {
+	attrs, err := b.bucketHandle().Attrs(ctx)
+	if err != nil {
+		return false, err
+	}
+	return attrs.VersioningEnabled, nil
+}
+
+func (b *bucketAdmin) SetVersioning(ctx context.Context, enabled bool) error {
+	_, err := b.bucketHandle().Update(ctx, storage.BucketAttrsToUpdate{VersioningEnabled: enabled})
+	return err
+}
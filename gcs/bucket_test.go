@@ -0,0 +1,92 @@
+package gcs_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcstest"
+)
+
+func TestBucketAdmin(t *testing.T) {
+	srv := gcstest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	admin, err := gcs.NewBucketAdmin("admin", srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Create(ctx, "project", gcs.BucketOptions{Location: "ASIA-NORTHEAST1"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if rules, err := admin.Lifecycle(ctx); err != nil || len(rules) != 0 {
+		t.Errorf("Lifecycle() of a new bucket = %v, %v, want no rules", rules, err)
+	}
+	lifecycle := []gcs.LifecycleRule{
+		{AgeInDays: 7},
+		{AgeInDays: 30, StorageClass: "NEARLINE"},
+		{AgeInDays: 90, NoncurrentOnly: true},
+	}
+	if err := admin.SetLifecycle(ctx, lifecycle); err != nil {
+		t.Fatalf("SetLifecycle() error = %v", err)
+	}
+	if got, err := admin.Lifecycle(ctx); err != nil || !reflect.DeepEqual(got, lifecycle) {
+		t.Errorf("Lifecycle() = %+v, %v, want %+v", got, err, lifecycle)
+	}
+
+	cors := []gcs.CORSRule{{
+		Origins:         []string{"https://example.com"},
+		Methods:         []string{"GET", "HEAD"},
+		ResponseHeaders: []string{"Content-Type"},
+		MaxAge:          time.Hour,
+	}}
+	if err := admin.SetCORS(ctx, cors); err != nil {
+		t.Fatalf("SetCORS() error = %v", err)
+	}
+	if got, err := admin.CORS(ctx); err != nil || !reflect.DeepEqual(got, cors) {
+		t.Errorf("CORS() = %+v, %v, want %+v", got, err, cors)
+	}
+	if err := admin.SetCORS(ctx, nil); err != nil {
+		t.Fatalf("SetCORS(nil) error = %v", err)
+	}
+	if got, err := admin.CORS(ctx); err != nil || len(got) != 0 {
+		t.Errorf("CORS() after reset = %+v, %v, want no rules", got, err)
+	}
+
+	if err := admin.SetDefaultObjectACL(ctx, "publicRead"); err != nil {
+		t.Errorf("SetDefaultObjectACL() error = %v", err)
+	}
+
+	for _, enabled := range []bool{true, false} {
+		if err := admin.SetVersioning(ctx, enabled); err != nil {
+			t.Fatalf("SetVersioning(%v) error = %v", enabled, err)
+		}
+		if got, err := admin.Versioning(ctx); err != nil || got != enabled {
+			t.Errorf("Versioning() = %v, %v, want %v", got, err, enabled)
+		}
+	}
+
+	c, err := gcs.NewGCSClient("admin", srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ctx, "a", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Delete(ctx); err == nil {
+		t.Errorf("Delete() of a non-empty bucket error = nil")
+	}
+	if err := c.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Delete(ctx); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := admin.Versioning(ctx); err == nil {
+		t.Errorf("Versioning() of a deleted bucket error = nil")
+	}
+}
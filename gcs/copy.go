@@ -0,0 +1,49 @@
+package gcs
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+)
+
+// Copy copies generation of src to dst within the bucket without
+// downloading it. A zero generation copies the live version. The non-empty
+// attributes of opts replace those of src; a non-nil Metadata replaces its
+// metadata, so an empty map clears it. The preconditions of opts apply to dst.
+func (c *client) Copy(ctx context.Context, src string, generation int64, dst string, opts PutOptions) error {
+	s := c.bucketHandle().Object(src)
+	if generation != 0 {
+		s = s.Generation(generation)
+	}
+	d := c.bucketHandle().Object(dst)
+	conds, conditional := opts.conditions()
+	if conditional {
+		d = d.If(conds)
+	}
+
+	copier := d.CopierFrom(s)
+	copier.ContentType = opts.ContentType
+	copier.CacheControl = opts.CacheControl
+	copier.ContentDisposition = opts.ContentDisposition
+	copier.ContentLanguage = opts.ContentLanguage
+	copier.StorageClass = opts.StorageClass
+	copier.Metadata = opts.Metadata
+
+	var attrs *storage.ObjectAttrs
+	err := c.retry.conditional(conditional).do(ctx, func() error {
+		var err error
+		attrs, err = copier.Run(ctx)
+		return err
+	})
+	if err != nil || opts.Metadata == nil || len(opts.Metadata) > 0 {
+		return err
+	}
+
+	// A copy request cannot carry empty metadata, so clear it on the new
+	// generation afterwards.
+	o := d.If(storage.Conditions{GenerationMatch: attrs.Generation})
+	return c.retry.conditional(true).do(ctx, func() error {
+		_, err := o.Update(ctx, storage.ObjectAttrsToUpdate{Metadata: map[string]string{}})
+		return err
+	})
+}
@@ -0,0 +1,74 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hayashiki/go-pkg/internal/deleteerr"
+)
+
+// deleteConcurrency is the number of objects deleted in parallel by DeleteMany.
+const deleteConcurrency = 16
+
+// ErrEmptyPrefix is returned by DeletePrefix when called with an empty prefix,
+// which would otherwise delete every object in the bucket.
+var ErrEmptyPrefix = errors.New("gcs: refusing to delete with an empty prefix")
+
+// DeleteErrors holds the per-object errors of a bulk delete.
+type DeleteErrors map[string]error
+
+func (e DeleteErrors) Error() string {
+	return deleteerr.Message(fmt.Sprintf("gcs: failed to delete %d object(s)", len(e)), e)
+}
+
+// DeleteMany deletes objNames concurrently. Objects that do not exist are
+// ignored. If any deletion fails the returned error is a DeleteErrors.
+func (c *client) DeleteMany(ctx context.Context, objNames []string) error {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = DeleteErrors{}
+		sem  = make(chan struct{}, deleteConcurrency)
+	)
+
+	for _, name := range objNames {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			err := c.Delete(ctx, name)
+			if err == nil || err == ErrObjectNotExist {
+				return
+			}
+			mu.Lock()
+			errs[name] = err
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// DeletePrefix deletes every object whose name starts with prefix.
+func (c *client) DeletePrefix(ctx context.Context, prefix string) error {
+	if prefix == "" {
+		return ErrEmptyPrefix
+	}
+
+	names, err := c.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	return c.DeleteMany(ctx, names)
+}
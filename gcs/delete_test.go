@@ -0,0 +1,69 @@
+package gcs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcstest"
+)
+
+func TestClient_DeleteMany(t *testing.T) {
+	srv := gcstest.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	c, err := gcs.NewGCSClient("test", srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var names []string
+	for n := 0; n < 40; n++ {
+		name := fmt.Sprintf("a/%02d", n)
+		if err := c.Put(ctx, name, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := c.Put(ctx, "b/keep", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	var derrs gcs.DeleteErrors
+	if err := c.DeleteMany(canceled, names[:3]); !errors.As(err, &derrs) || len(derrs) != 3 {
+		t.Errorf("DeleteMany() with canceled context error = %v, want 3 failed objects", err)
+	}
+
+	batch := append(append([]string{}, names[:20]...), "a/missing")
+	if err := c.DeleteMany(ctx, batch); err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+	if got, want := srv.Objects("test"), append(append([]string{}, names[20:]...), "b/keep"); !reflect.DeepEqual(got, want) {
+		t.Errorf("objects after DeleteMany() = %v, want %v", got, want)
+	}
+
+	if err := c.DeletePrefix(ctx, ""); !errors.Is(err, gcs.ErrEmptyPrefix) {
+		t.Errorf("DeletePrefix(\"\") error = %v, want %v", err, gcs.ErrEmptyPrefix)
+	}
+	if err := c.DeletePrefix(ctx, "a/"); err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	if got, want := srv.Objects("test"), []string{"b/keep"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("objects after DeletePrefix() = %v, want %v", got, want)
+	}
+}
+
+func TestDeleteErrors_Error(t *testing.T) {
+	err := gcs.DeleteErrors{"b": errors.New("denied"), "a": errors.New("timeout")}
+	want := "gcs: failed to delete 2 object(s): a: timeout; b: denied"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package gcs
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/hayashiki/go-pkg/internal/chunked"
+)
+
+// ErrChecksum is returned by DownloadToFile when the downloaded file does
+// not match the checksum of the object.
+var ErrChecksum = chunked.ErrChecksum
+
+// DownloadOptions configures DownloadToFile.
+type DownloadOptions struct {
+	// ChunkSize is the size of one range request. Defaults to 16 MiB.
+	ChunkSize int64
+	// Concurrency is the number of ranges fetched at once. Defaults to 8.
+	Concurrency int
+	// MaxAttempts is the number of attempts to fetch one range, with
+	// backoff between them. Defaults to 4.
+	MaxAttempts int
+}
+
+// DownloadToFile downloads objName to path in concurrent range requests.
+// The data goes to path+".part" and is renamed to path once its MD5, or
+// CRC32C for composite objects, matches. Every range is read from the
+// generation found at the start, so a replacement during the download makes
+// it fail rather than mix two objects. A download interrupted by a crash
+// resumes from the partial file when called again, unless the object has
+// been replaced since.
+func (c *client) DownloadToFile(ctx context.Context, objName, path string, opts DownloadOptions) error {
+	return DownloadToFile(ctx, c, objName, path, opts)
+}
+
+// DownloadToFile implements Client.DownloadToFile on the Attrs and
+// NewVersionRangeReader of c, for implementations of Client such as fakes
+// and decorators.
+func DownloadToFile(ctx context.Context, c Client, objName, path string, opts DownloadOptions) error {
+	attrs, err := c.Attrs(ctx, objName)
+	if err != nil {
+		return err
+	}
+
+	obj := chunked.Object{
+		Size:      attrs.Size,
+		Version:   strconv.FormatInt(attrs.Generation, 10),
+		MD5:       attrs.MD5,
+		CRC32C:    attrs.CRC32C,
+		HasCRC32C: true,
+	}
+	read := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return c.NewVersionRangeReader(ctx, objName, attrs.Generation, offset, length)
+	}
+	return chunked.Download(ctx, path, obj, read, chunked.Options{
+		ChunkSize:   opts.ChunkSize,
+		Concurrency: opts.Concurrency,
+		MaxAttempts: opts.MaxAttempts,
+		Retryable:   isRetryable,
+	})
+}
@@ -0,0 +1,676 @@
+// Package fake provides an in-memory gcs.Client for tests that need real
+// storage semantics rather than gomock expectations.
+//
+//	c := fake.New("bucket")
+//	c.Fail("Get", errors.New("boom"))
+//	svc := NewService(c)
+package fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"google.golang.org/api/googleapi"
+)
+
+// Hook runs before a Client method with the object name it operates on,
+// or "" for methods without one. A non-nil error is returned in place of the call.
+type Hook func(ctx context.Context, objName string) error
+
+// Call is a recorded Client method call.
+type Call struct {
+	Method string
+	Object string
+}
+
+// Client is an in-memory gcs.Client. It is safe for concurrent use.
+type Client struct {
+	// Versioning keeps noncurrent generations on overwrite and delete, as in
+	// a bucket with object versioning enabled. Set it before use.
+	Versioning bool
+
+	bucket string
+
+	mu         sync.Mutex
+	objects    map[string][]*object
+	generation int64
+	hooks      map[string]Hook
+	calls      []Call
+}
+
+type object struct {
+	attrs   gcs.ObjectAttrs
+	data    []byte
+	acl     []gcs.ACLRule
+	deleted time.Time
+}
+
+var _ gcs.Client = (*Client)(nil)
+
+// New returns an empty Client for bucket.
+func New(bucket string) *Client {
+	return &Client{
+		bucket:  bucket,
+		objects: map[string][]*object{},
+		hooks:   map[string]Hook{},
+	}
+}
+
+// SetHook runs h before every call of method, named as in gcs.Client
+// (e.g. "Put"). A nil h removes the hook.
+func (c *Client) SetHook(method string, h Hook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if h == nil {
+		delete(c.hooks, method)
+		return
+	}
+	c.hooks[method] = h
+}
+
+// Fail makes every call of method return err. A nil err removes the hook.
+func (c *Client) Fail(method string, err error) {
+	if err == nil {
+		c.SetHook(method, nil)
+		return
+	}
+	c.SetHook(method, func(context.Context, string) error { return err })
+}
+
+// Calls returns the method calls made so far, in order. Methods implemented
+// on top of others, such as Get on NewReader, record both.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Call(nil), c.calls...)
+}
+
+// Objects returns the names of the live objects in lexical order.
+func (c *Client) Objects() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for name := range c.objects {
+		if c.live(name) != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// call records a method call and runs its hook.
+func (c *Client) call(ctx context.Context, method, objName string) error {
+	c.mu.Lock()
+	c.calls = append(c.calls, Call{Method: method, Object: objName})
+	h := c.hooks[method]
+	c.mu.Unlock()
+
+	if h != nil {
+		if err := h(ctx, objName); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (c *Client) live(name string) *object {
+	gens := c.objects[name]
+	if len(gens) == 0 {
+		return nil
+	}
+	if o := gens[len(gens)-1]; o.deleted.IsZero() {
+		return o
+	}
+	return nil
+}
+
+func (c *Client) version(name string, generation int64) *object {
+	for _, o := range c.objects[name] {
+		if o.attrs.Generation == generation {
+			return o
+		}
+	}
+	return nil
+}
+
+// errPrecondition is the error the service returns for a failed write condition.
+var errPrecondition = &googleapi.Error{Code: http.StatusPreconditionFailed, Message: "conditionNotMet"}
+
+// checkConditions reports whether the preconditions of opts hold for the live generation of name.
+func (c *Client) checkConditions(name string, opts gcs.PutOptions) error {
+	var gen int64
+	if o := c.live(name); o != nil {
+		gen = o.attrs.Generation
+	}
+	if opts.IfNotExist && gen != 0 {
+		return errPrecondition
+	}
+	if opts.IfGenerationMatch != 0 && opts.IfGenerationMatch != gen {
+		return errPrecondition
+	}
+	return nil
+}
+
+// put stores data as the new live generation of name if the preconditions of opts hold.
+func (c *Client) put(name string, data []byte, opts gcs.PutOptions) error {
+	if err := c.checkConditions(name, opts); err != nil {
+		return err
+	}
+	c.generation++
+	now := time.Now()
+
+	md5sum := md5.Sum(data)
+	o := &object{
+		attrs: gcs.ObjectAttrs{
+			Name:               name,
+			Size:               int64(len(data)),
+			ContentType:        opts.ContentType,
+			CacheControl:       opts.CacheControl,
+			ContentDisposition: opts.ContentDisposition,
+			ContentLanguage:    opts.ContentLanguage,
+			StorageClass:       opts.StorageClass,
+			Metadata:           copyMetadata(opts.Metadata),
+			MD5:                md5sum[:],
+			CRC32C:             crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)),
+			Generation:         c.generation,
+			Metageneration:     1,
+			Updated:            now,
+		},
+		data: data,
+	}
+	if o.attrs.ContentType == "" {
+		o.attrs.ContentType = http.DetectContentType(data)
+	}
+	if o.attrs.StorageClass == "" {
+		o.attrs.StorageClass = "STANDARD"
+	}
+
+	if prev := c.live(name); prev != nil {
+		prev.deleted = now
+	}
+	if !c.Versioning {
+		c.objects[name] = nil
+	}
+	c.objects[name] = append(c.objects[name], o)
+	return nil
+}
+
+func (c *Client) Put(ctx context.Context, objName string, data []byte) error {
+	if err := c.call(ctx, "Put", objName); err != nil {
+		return err
+	}
+	return c.PutWithOptions(ctx, objName, data, gcs.PutOptions{})
+}
+
+func (c *Client) PutWithOptions(ctx context.Context, objName string, data []byte, opts gcs.PutOptions) error {
+	if err := c.call(ctx, "PutWithOptions", objName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.put(objName, append([]byte(nil), data...), opts)
+}
+
+func (c *Client) NewWriter(ctx context.Context, objName string, opts gcs.PutOptions) io.WriteCloser {
+	return &writer{ctx: ctx, c: c, name: objName, opts: opts}
+}
+
+// writer buffers an object and stores it on Close.
+type writer struct {
+	ctx  context.Context
+	c    *Client
+	name string
+	opts gcs.PutOptions
+	buf  bytes.Buffer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	if err := w.c.call(w.ctx, "NewWriter", w.name); err != nil {
+		return err
+	}
+
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+
+	return w.c.put(w.name, w.buf.Bytes(), w.opts)
+}
+
+func (c *Client) UpdateMetadata(ctx context.Context, objName string, opts gcs.PutOptions) error {
+	if err := c.call(ctx, "UpdateMetadata", objName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(objName)
+	if o == nil {
+		return gcs.ErrObjectNotExist
+	}
+	if opts.IfGenerationMatch != 0 && opts.IfGenerationMatch != o.attrs.Generation {
+		return errPrecondition
+	}
+	if opts.ContentType != "" {
+		o.attrs.ContentType = opts.ContentType
+	}
+	if opts.CacheControl != "" {
+		o.attrs.CacheControl = opts.CacheControl
+	}
+	if opts.ContentDisposition != "" {
+		o.attrs.ContentDisposition = opts.ContentDisposition
+	}
+	if opts.ContentLanguage != "" {
+		o.attrs.ContentLanguage = opts.ContentLanguage
+	}
+	if opts.Metadata != nil {
+		o.attrs.Metadata = copyMetadata(opts.Metadata)
+	}
+	o.attrs.Metageneration++
+	o.attrs.Updated = time.Now()
+	return nil
+}
+
+func (c *Client) Attrs(ctx context.Context, objName string) (*gcs.ObjectAttrs, error) {
+	if err := c.call(ctx, "Attrs", objName); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(objName)
+	if o == nil {
+		return nil, gcs.ErrObjectNotExist
+	}
+	attrs := o.attrs
+	attrs.Metadata = copyMetadata(o.attrs.Metadata)
+	return &attrs, nil
+}
+
+func (c *Client) Get(ctx context.Context, objName string) ([]byte, error) {
+	if err := c.call(ctx, "Get", objName); err != nil {
+		return []byte{}, err
+	}
+
+	r, err := c.NewReader(ctx, objName)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (c *Client) NewReader(ctx context.Context, objName string) (io.ReadCloser, error) {
+	if err := c.call(ctx, "NewReader", objName); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(objName)
+	if o == nil {
+		return nil, gcs.ErrObjectNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(o.data)), nil
+}
+
+func (c *Client) NewRangeReader(ctx context.Context, objName string, offset, length int64) (io.ReadCloser, error) {
+	if err := c.call(ctx, "NewRangeReader", objName); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return rangeReader(c.live(objName), objName, offset, length)
+}
+
+func (c *Client) NewVersionRangeReader(ctx context.Context, objName string, generation, offset, length int64) (io.ReadCloser, error) {
+	if err := c.call(ctx, "NewVersionRangeReader", objName); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return rangeReader(c.version(objName, generation), objName, offset, length)
+}
+
+func (c *Client) DownloadToFile(ctx context.Context, objName, path string, opts gcs.DownloadOptions) error {
+	return gcs.DownloadToFile(ctx, c, objName, path, opts)
+}
+
+// rangeReader reads length bytes of o from offset, or to its end if length
+// is negative.
+func rangeReader(o *object, objName string, offset, length int64) (io.ReadCloser, error) {
+	if o == nil {
+		return nil, gcs.ErrObjectNotExist
+	}
+	size := int64(len(o.data))
+	if offset < 0 || offset > size {
+		return nil, fmt.Errorf("fake: offset %d out of range for %s of %d bytes", offset, objName, size)
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return ioutil.NopCloser(bytes.NewReader(o.data[offset:end])), nil
+}
+
+func (c *Client) List(ctx context.Context, filePrefix string) ([]string, error) {
+	if err := c.call(ctx, "List", filePrefix); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range c.Objects() {
+		if strings.HasPrefix(name, filePrefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (c *Client) Delete(ctx context.Context, objName string) error {
+	if err := c.call(ctx, "Delete", objName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(objName)
+	if o == nil {
+		return gcs.ErrObjectNotExist
+	}
+	if c.Versioning {
+		o.deleted = time.Now()
+		return nil
+	}
+	delete(c.objects, objName)
+	return nil
+}
+
+func (c *Client) DeleteMany(ctx context.Context, objNames []string) error {
+	if err := c.call(ctx, "DeleteMany", ""); err != nil {
+		return err
+	}
+
+	errs := gcs.DeleteErrors{}
+	for _, name := range objNames {
+		if err := c.Delete(ctx, name); err != nil && err != gcs.ErrObjectNotExist {
+			errs[name] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := c.call(ctx, "DeletePrefix", prefix); err != nil {
+		return err
+	}
+	if prefix == "" {
+		return gcs.ErrEmptyPrefix
+	}
+
+	names, err := c.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	return c.DeleteMany(ctx, names)
+}
+
+func (c *Client) ListVersions(ctx context.Context, objName string) ([]gcs.Version, error) {
+	if err := c.call(ctx, "ListVersions", objName); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gens := c.objects[objName]
+	versions := make([]gcs.Version, 0, len(gens))
+	for i := len(gens) - 1; i >= 0; i-- {
+		o := gens[i]
+		versions = append(versions, gcs.Version{
+			Generation: o.attrs.Generation,
+			Size:       o.attrs.Size,
+			Created:    o.attrs.Updated,
+			Deleted:    o.deleted,
+			IsLatest:   o.deleted.IsZero(),
+		})
+	}
+	return versions, nil
+}
+
+func (c *Client) GetVersion(ctx context.Context, objName string, generation int64) ([]byte, error) {
+	if err := c.call(ctx, "GetVersion", objName); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.version(objName, generation)
+	if o == nil {
+		return nil, gcs.ErrObjectNotExist
+	}
+	return append([]byte(nil), o.data...), nil
+}
+
+func (c *Client) DeleteVersion(ctx context.Context, objName string, generation int64) error {
+	if err := c.call(ctx, "DeleteVersion", objName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gens := c.objects[objName]
+	for i, o := range gens {
+		if o.attrs.Generation != generation {
+			continue
+		}
+		gens = append(gens[:i:i], gens[i+1:]...)
+		if len(gens) == 0 {
+			delete(c.objects, objName)
+		} else {
+			c.objects[objName] = gens
+		}
+		return nil
+	}
+	return gcs.ErrObjectNotExist
+}
+
+func (c *Client) RestoreVersion(ctx context.Context, objName string, generation int64) error {
+	if err := c.call(ctx, "RestoreVersion", objName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.version(objName, generation)
+	if o == nil {
+		return gcs.ErrObjectNotExist
+	}
+	return c.put(objName, o.data, gcs.PutOptions{
+		ContentType:        o.attrs.ContentType,
+		CacheControl:       o.attrs.CacheControl,
+		ContentDisposition: o.attrs.ContentDisposition,
+		ContentLanguage:    o.attrs.ContentLanguage,
+		StorageClass:       o.attrs.StorageClass,
+		Metadata:           o.attrs.Metadata,
+	})
+}
+
+func (c *Client) Copy(ctx context.Context, src string, generation int64, dst string, opts gcs.PutOptions) error {
+	if err := c.call(ctx, "Copy", dst); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(src)
+	if generation != 0 {
+		o = c.version(src, generation)
+	}
+	if o == nil {
+		return gcs.ErrObjectNotExist
+	}
+	merged := gcs.PutOptions{
+		ContentType:        firstNonEmpty(opts.ContentType, o.attrs.ContentType),
+		CacheControl:       firstNonEmpty(opts.CacheControl, o.attrs.CacheControl),
+		ContentDisposition: firstNonEmpty(opts.ContentDisposition, o.attrs.ContentDisposition),
+		ContentLanguage:    firstNonEmpty(opts.ContentLanguage, o.attrs.ContentLanguage),
+		StorageClass:       firstNonEmpty(opts.StorageClass, o.attrs.StorageClass),
+		Metadata:           o.attrs.Metadata,
+		IfGenerationMatch:  opts.IfGenerationMatch,
+		IfNotExist:         opts.IfNotExist,
+	}
+	if opts.Metadata != nil {
+		merged.Metadata = opts.Metadata
+	}
+	return c.put(dst, o.data, merged)
+}
+
+func firstNonEmpty(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+func (c *Client) MakeObjectPublic(ctx context.Context, objName string) error {
+	if err := c.call(ctx, "MakeObjectPublic", objName); err != nil {
+		return err
+	}
+	return c.SetACL(ctx, objName, gcs.AllUsers, gcs.RoleReader)
+}
+
+func (c *Client) MakeObjectPrivate(ctx context.Context, objName string) error {
+	if err := c.call(ctx, "MakeObjectPrivate", objName); err != nil {
+		return err
+	}
+	for _, entity := range []gcs.ACLEntity{gcs.AllUsers, gcs.AllAuthenticatedUsers} {
+		err := c.DeleteACL(ctx, objName, entity)
+		if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) SetACL(ctx context.Context, objName string, entity gcs.ACLEntity, role gcs.ACLRole) error {
+	if err := c.call(ctx, "SetACL", objName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(objName)
+	if o == nil {
+		return gcs.ErrObjectNotExist
+	}
+	for i, r := range o.acl {
+		if r.Entity == entity {
+			o.acl[i].Role = role
+			return nil
+		}
+	}
+	o.acl = append(o.acl, gcs.ACLRule{Entity: entity, Role: role})
+	return nil
+}
+
+// DeleteACL returns a 404 *googleapi.Error when entity has no role, as GCS does.
+func (c *Client) DeleteACL(ctx context.Context, objName string, entity gcs.ACLEntity) error {
+	if err := c.call(ctx, "DeleteACL", objName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(objName)
+	if o == nil {
+		return gcs.ErrObjectNotExist
+	}
+	for i, r := range o.acl {
+		if r.Entity == entity {
+			o.acl = append(o.acl[:i:i], o.acl[i+1:]...)
+			return nil
+		}
+	}
+	return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("no such entity: %s", entity)}
+}
+
+func (c *Client) ListACL(ctx context.Context, objName string) ([]gcs.ACLRule, error) {
+	if err := c.call(ctx, "ListACL", objName); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := c.live(objName)
+	if o == nil {
+		return nil, gcs.ErrObjectNotExist
+	}
+	return append([]gcs.ACLRule{}, o.acl...), nil
+}
+
+// URL returns the public storage.googleapis.com URL of objName.
+func (c *Client) URL(objName string) string {
+	var b strings.Builder
+	for _, ch := range []byte(objName) {
+		if 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", c.bucket, b.String())
+}
+
+func copyMetadata(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
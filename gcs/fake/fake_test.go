@@ -0,0 +1,122 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func TestClient_Conformance(t *testing.T) {
+	storagetest.TestGCSClient(t, func(t *testing.T) gcs.Client {
+		return fake.New("test")
+	})
+}
+
+func TestClient_Hooks(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New("test")
+	boom := errors.New("boom")
+
+	c.Fail("Put", boom)
+	if err := c.Put(ctx, "a", []byte("1")); err != boom {
+		t.Errorf("Put() err = %v, want %v", err, boom)
+	}
+	c.Fail("Put", nil)
+	if err := c.Put(ctx, "a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetHook("Delete", func(_ context.Context, objName string) error {
+		if objName == "b" {
+			return boom
+		}
+		return nil
+	})
+	if err := c.Put(ctx, "b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	err := c.DeleteMany(ctx, []string{"a", "b", "missing"})
+	if want := (gcs.DeleteErrors{"b": boom}); !reflect.DeepEqual(err, want) {
+		t.Errorf("DeleteMany() err = %v, want %v", err, want)
+	}
+	if got, want := c.Objects(), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Objects() = %v, want %v", got, want)
+	}
+
+	calls := c.Calls()
+	if len(calls) == 0 || calls[0] != (fake.Call{Method: "Put", Object: "a"}) {
+		t.Errorf("Calls()[0] = %v", calls)
+	}
+}
+
+func TestClient_ACL(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New("test")
+	if err := c.Put(ctx, "k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MakeObjectPublic(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := c.ListACL(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []gcs.ACLRule{{Entity: gcs.AllUsers, Role: gcs.RoleReader}}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("ListACL() = %v, want %v", rules, want)
+	}
+
+	if err := c.MakeObjectPrivate(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := c.ListACL(ctx, "k"); len(rules) != 0 {
+		t.Errorf("ListACL() after MakeObjectPrivate = %v", rules)
+	}
+	if err := c.SetACL(ctx, "missing", gcs.AllUsers, gcs.RoleReader); err != gcs.ErrObjectNotExist {
+		t.Errorf("SetACL() on missing object err = %v", err)
+	}
+}
+
+func TestClient_Versioning(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New("test")
+	c.Versioning = true
+
+	for _, v := range []string{"v1", "v2"} {
+		if err := c.Put(ctx, "k", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := c.ListVersions(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].IsLatest || versions[1].IsLatest {
+		t.Fatalf("ListVersions() = %+v", versions)
+	}
+
+	if err := c.RestoreVersion(ctx, "k", versions[1].Generation); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "v1" {
+		t.Errorf("Get() = %q, want v1", got)
+	}
+}
+
+func TestClient_URL(t *testing.T) {
+	if got, want := fake.New("b").URL("a b/c+d.txt"), "https://storage.googleapis.com/b/a%20b/c%2Bd.txt"; got != want {
+		t.Errorf("URL() = %q, want %q", got, want)
+	}
+}
@@ -4,52 +4,87 @@ import (
 	"context"
 	"fmt"
 	"google.golang.org/api/iterator"
+	"io"
 	"io/ioutil"
 	"sort"
+	"strings"
 
 	"cloud.google.com/go/storage"
 )
 
-// Storage Storage service interface
-//go:generate mockgen -source gcs.go -destination mock_gcs/mock_gcs.go
+// ErrObjectNotExist is returned when the requested object does not exist.
+var ErrObjectNotExist = storage.ErrObjectNotExist
+
+//go:generate go run github.com/golang/mock/mockgen -source gcs.go -destination mock_gcs/mock_gcs.go -package mock_gcs
+
+// Client Storage service interface
 type Client interface {
 	Put(ctx context.Context, objName string, data []byte) error
+	PutWithOptions(ctx context.Context, objName string, data []byte, opts PutOptions) error
+	UpdateMetadata(ctx context.Context, objName string, opts PutOptions) error
+	Attrs(ctx context.Context, objName string) (*ObjectAttrs, error)
 	Get(ctx context.Context, objName string) ([]byte, error)
+	NewReader(ctx context.Context, objName string) (io.ReadCloser, error)
+	NewRangeReader(ctx context.Context, objName string, offset, length int64) (io.ReadCloser, error)
+	NewVersionRangeReader(ctx context.Context, objName string, generation, offset, length int64) (io.ReadCloser, error)
+	DownloadToFile(ctx context.Context, objName, path string, opts DownloadOptions) error
+	NewWriter(ctx context.Context, objName string, opts PutOptions) io.WriteCloser
 	List(ctx context.Context, filePrefix string) ([]string, error)
 	Delete(ctx context.Context, objName string) error
+	DeleteMany(ctx context.Context, objNames []string) error
+	DeletePrefix(ctx context.Context, prefix string) error
+	ListVersions(ctx context.Context, objName string) ([]Version, error)
+	GetVersion(ctx context.Context, objName string, generation int64) ([]byte, error)
+	DeleteVersion(ctx context.Context, objName string, generation int64) error
+	RestoreVersion(ctx context.Context, objName string, generation int64) error
+	Copy(ctx context.Context, src string, generation int64, dst string, opts PutOptions) error
 	MakeObjectPublic(ctx context.Context, objName string) error
+	MakeObjectPrivate(ctx context.Context, objName string) error
+	SetACL(ctx context.Context, objName string, entity ACLEntity, role ACLRole) error
+	DeleteACL(ctx context.Context, objName string, entity ACLEntity) error
+	ListACL(ctx context.Context, objName string) ([]ACLRule, error)
+	URL(objName string) string
 }
 
 type client struct {
-	gcsClient *storage.Client
-	bucket    string
+	gcsClient   *storage.Client
+	bucket      string
+	userProject string
+	retry       RetryConfig
+	baseURL     string
 }
 
-func (c *client) Put(ctx context.Context, objName string, data []byte) error {
-	w := c.gcsClient.Bucket(c.bucket).Object(objName).NewWriter(ctx)
-	defer w.Close()
-
-	if _, err := w.Write(data); err != nil {
-		return err
+func (c *client) bucketHandle() *storage.BucketHandle {
+	b := c.gcsClient.Bucket(c.bucket)
+	if c.userProject != "" {
+		b = b.UserProject(c.userProject)
 	}
+	return b
+}
 
-	return nil
+func (c *client) Put(ctx context.Context, objName string, data []byte) error {
+	return c.PutWithOptions(ctx, objName, data, PutOptions{})
 }
 
 // List Fetch Multi Object name request to google cloud storage.
 func (c *client) List(ctx context.Context, filePrefix string) ([]string, error) {
-	it := c.gcsClient.Bucket(c.bucket).Objects(ctx, &storage.Query{Prefix: filePrefix})
-
 	var files []string
-	for {
-		objAttrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
+	err := c.retry.do(ctx, func() error {
+		files = nil
+		it := c.bucketHandle().Objects(ctx, &storage.Query{Prefix: filePrefix})
+		for {
+			objAttrs, err := it.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			files = append(files, objAttrs.Name)
 		}
-		files = append(files, objAttrs.Name)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	sort.Strings(files)
@@ -58,8 +93,8 @@ func (c *client) List(ctx context.Context, filePrefix string) ([]string, error)
 }
 
 func (c *client) Delete(ctx context.Context, objName string) error {
-	o := c.gcsClient.Bucket(c.bucket).Object(objName)
-	if err := o.Delete(ctx); err != nil {
+	o := c.bucketHandle().Object(objName)
+	if err := c.retry.remove(ctx, func() error { return o.Delete(ctx) }); err != nil {
 		return err
 	}
 
@@ -67,9 +102,9 @@ func (c *client) Delete(ctx context.Context, objName string) error {
 }
 
 func (c *client) MakeObjectPublic(ctx context.Context, objName string) error {
-	acl := c.gcsClient.Bucket(c.bucket).Object(objName).ACL()
+	acl := c.bucketHandle().Object(objName).ACL()
 
-	if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+	if err := c.retry.do(ctx, func() error { return acl.Set(ctx, storage.AllUsers, storage.RoleReader) }); err != nil {
 		return err
 	}
 
@@ -77,27 +112,38 @@ func (c *client) MakeObjectPublic(ctx context.Context, objName string) error {
 
 }
 
-func NewGCSClient(bucket string) (Client, error) {
+func NewGCSClient(bucket string, opts ...Option) (Client, error) {
 	ctx := context.Background()
+	cfg := newConfig(opts)
 
-	gcsClient, err := storage.NewClient(ctx)
+	gcsClient, err := cfg.newStorageClient(ctx)
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	return &client{
-		gcsClient: gcsClient,
-		bucket:    bucket,
+		gcsClient:   gcsClient,
+		bucket:      bucket,
+		userProject: cfg.userProject,
+		retry:       cfg.retry,
+		baseURL:     cfg.publicBaseURL(bucket),
 	}, nil
 }
 
 // Get Get request to google cloud storage.
 func (c *client) Get(ctx context.Context, objName string) ([]byte, error) {
-	r, err := c.gcsClient.Bucket(c.bucket).Object(objName).NewReader(ctx)
-	defer r.Close()
+	var b []byte
+	err := c.retry.do(ctx, func() error {
+		r, err := c.NewReader(ctx, objName)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
 
-	b, err := ioutil.ReadAll(r)
+		b, err = ioutil.ReadAll(r)
+		return err
+	})
 
 	if err != nil {
 		return []byte{}, err
@@ -106,7 +152,38 @@ func (c *client) Get(ctx context.Context, objName string) ([]byte, error) {
 	return b, nil
 }
 
+// NewReader Streaming get request to google cloud storage. The caller must close the reader.
+func (c *client) NewReader(ctx context.Context, objName string) (io.ReadCloser, error) {
+	return c.bucketHandle().Object(objName).NewReader(ctx)
+}
+
+// NewRangeReader reads length bytes of objName starting at offset. A negative
+// length reads to the end of the object.
+func (c *client) NewRangeReader(ctx context.Context, objName string, offset, length int64) (io.ReadCloser, error) {
+	return c.bucketHandle().Object(objName).NewRangeReader(ctx, offset, length)
+}
+
+// NewVersionRangeReader is NewRangeReader of the given generation of objName.
+// It fails with ErrObjectNotExist once that generation is gone.
+func (c *client) NewVersionRangeReader(ctx context.Context, objName string, generation, offset, length int64) (io.ReadCloser, error) {
+	return c.bucketHandle().Object(objName).Generation(generation).NewRangeReader(ctx, offset, length)
+}
+
 // URL gcs object path
 func (c *client) URL(obj string) string {
-	return fmt.Sprintf("https://%s/%s/%s", "storage.googleapis.com", c.bucket, obj)
+	return fmt.Sprintf("%s/%s", c.baseURL, escapeObjectName(obj))
+}
+
+// escapeObjectName percent-encodes obj for use in a URL path, keeping '/' separators.
+func escapeObjectName(obj string) string {
+	var b strings.Builder
+	for _, ch := range []byte(obj) {
+		if 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
 }
@@ -0,0 +1,57 @@
+package gcs
+
+import (
+	"os"
+	"testing"
+)
+
+func TestClient_URL(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		emulator string
+		obj      string
+		want     string
+	}{
+		{
+			name: "default",
+			obj:  "dir/a.png",
+			want: "https://storage.googleapis.com/test/dir/a.png",
+		},
+		{
+			name: "escaping",
+			obj:  "dir/日本 語+1.png",
+			want: "https://storage.googleapis.com/test/dir/%E6%97%A5%E6%9C%AC%20%E8%AA%9E%2B1.png",
+		},
+		{
+			name: "custom endpoint",
+			opts: []Option{OptionEndpoint("https://localhost:4443/storage/v1/")},
+			obj:  "a.png",
+			want: "https://localhost:4443/test/a.png",
+		},
+		{
+			name:     "emulator",
+			emulator: "localhost:9023",
+			obj:      "a.png",
+			want:     "http://localhost:9023/test/a.png",
+		},
+		{
+			name: "cdn",
+			opts: []Option{OptionCDNURL("https://cdn.example.com/")},
+			obj:  "a.png",
+			want: "https://cdn.example.com/a.png",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.emulator != "" {
+				os.Setenv("STORAGE_EMULATOR_HOST", tt.emulator)
+				defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+			}
+			c := &client{bucket: "test", baseURL: newConfig(tt.opts).publicBaseURL("test")}
+			if got := c.URL(tt.obj); got != tt.want {
+				t.Errorf("URL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
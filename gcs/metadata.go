@@ -0,0 +1,161 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// PutOptions are the object attributes applied by PutWithOptions and UpdateMetadata.
+// Empty fields are left unset.
+type PutOptions struct {
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentLanguage    string
+	// StorageClass is only applied on upload; GCS requires a rewrite to change it afterwards.
+	StorageClass string
+	// Metadata is the user metadata of the object. GCS has no per-object
+	// labels or tags, so they are stored here as well.
+	Metadata map[string]string
+	// IfGenerationMatch, when non-zero, only applies the write if the live
+	// generation of the object still matches. Failed preconditions are
+	// reported by IsPreconditionFailed.
+	IfGenerationMatch int64
+	// IfNotExist only uploads the object if it does not exist yet.
+	IfNotExist bool
+}
+
+// conditions returns the preconditions of opts, or false if there are none.
+func (opts PutOptions) conditions() (storage.Conditions, bool) {
+	conds := storage.Conditions{
+		GenerationMatch: opts.IfGenerationMatch,
+		DoesNotExist:    opts.IfNotExist,
+	}
+	return conds, conds.GenerationMatch != 0 || conds.DoesNotExist
+}
+
+// IsPreconditionFailed reports whether err was caused by a write whose
+// IfGenerationMatch or IfNotExist condition did not hold.
+func IsPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// ObjectAttrs are the attributes of a stored object.
+type ObjectAttrs struct {
+	Name               string
+	Size               int64
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentLanguage    string
+	StorageClass       string
+	Metadata           map[string]string
+	MD5                []byte
+	CRC32C             uint32
+	Generation         int64
+	Metageneration     int64
+	Updated            time.Time
+}
+
+func newObjectAttrs(a *storage.ObjectAttrs) *ObjectAttrs {
+	return &ObjectAttrs{
+		Name:               a.Name,
+		Size:               a.Size,
+		ContentType:        a.ContentType,
+		CacheControl:       a.CacheControl,
+		ContentDisposition: a.ContentDisposition,
+		ContentLanguage:    a.ContentLanguage,
+		StorageClass:       a.StorageClass,
+		Metadata:           a.Metadata,
+		MD5:                a.MD5,
+		CRC32C:             a.CRC32C,
+		Generation:         a.Generation,
+		Metageneration:     a.Metageneration,
+		Updated:            a.Updated,
+	}
+}
+
+// PutWithOptions Put request to google cloud storage with object attributes.
+// Writes with IfGenerationMatch or IfNotExist are not retried.
+func (c *client) PutWithOptions(ctx context.Context, objName string, data []byte, opts PutOptions) error {
+	_, cond := opts.conditions()
+	return c.retry.conditional(cond).do(ctx, func() error {
+		w := c.NewWriter(ctx, objName, opts)
+
+		if _, err := w.Write(data); err != nil {
+			w.Close()
+			return err
+		}
+
+		return w.Close()
+	})
+}
+
+// NewWriter Streaming put request to google cloud storage. The object is
+// committed when the writer is closed, and Close reports any upload error.
+func (c *client) NewWriter(ctx context.Context, objName string, opts PutOptions) io.WriteCloser {
+	o := c.bucketHandle().Object(objName)
+	if conds, ok := opts.conditions(); ok {
+		o = o.If(conds)
+	}
+	w := o.NewWriter(ctx)
+	w.ContentType = opts.ContentType
+	w.CacheControl = opts.CacheControl
+	w.ContentDisposition = opts.ContentDisposition
+	w.ContentLanguage = opts.ContentLanguage
+	w.StorageClass = opts.StorageClass
+	w.Metadata = opts.Metadata
+
+	return w
+}
+
+// UpdateMetadata replaces the attributes of an existing object with the non-empty fields of opts.
+func (c *client) UpdateMetadata(ctx context.Context, objName string, opts PutOptions) error {
+	var attrs storage.ObjectAttrsToUpdate
+	if opts.ContentType != "" {
+		attrs.ContentType = opts.ContentType
+	}
+	if opts.CacheControl != "" {
+		attrs.CacheControl = opts.CacheControl
+	}
+	if opts.ContentDisposition != "" {
+		attrs.ContentDisposition = opts.ContentDisposition
+	}
+	if opts.ContentLanguage != "" {
+		attrs.ContentLanguage = opts.ContentLanguage
+	}
+	if opts.Metadata != nil {
+		attrs.Metadata = opts.Metadata
+	}
+
+	o := c.bucketHandle().Object(objName)
+	if opts.IfGenerationMatch != 0 {
+		o = o.If(storage.Conditions{GenerationMatch: opts.IfGenerationMatch})
+	}
+	return c.retry.conditional(opts.IfGenerationMatch != 0).do(ctx, func() error {
+		_, err := o.Update(ctx, attrs)
+		return err
+	})
+}
+
+// Attrs Fetch object attributes from google cloud storage.
+func (c *client) Attrs(ctx context.Context, objName string) (*ObjectAttrs, error) {
+	var attrs *storage.ObjectAttrs
+	err := c.retry.do(ctx, func() error {
+		var err error
+		attrs, err = c.bucketHandle().Object(objName).Attrs(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newObjectAttrs(attrs), nil
+}
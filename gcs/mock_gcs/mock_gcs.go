@@ -7,34 +7,36 @@ package mock_gcs
 import (
 	context "context"
 	gomock "github.com/golang/mock/gomock"
+	gcs "github.com/hayashiki/go-pkg/gcs"
+	io "io"
 	reflect "reflect"
 )
 
-// MockStorage is a mock of Storage interface
-type MockStorage struct {
+// MockClient is a mock of Client interface
+type MockClient struct {
 	ctrl     *gomock.Controller
-	recorder *MockStorageMockRecorder
+	recorder *MockClientMockRecorder
 }
 
-// MockStorageMockRecorder is the mock recorder for MockStorage
-type MockStorageMockRecorder struct {
-	mock *MockStorage
+// MockClientMockRecorder is the mock recorder for MockClient
+type MockClientMockRecorder struct {
+	mock *MockClient
 }
 
-// NewMockStorage creates a new mock instance
-func NewMockStorage(ctrl *gomock.Controller) *MockStorage {
-	mock := &MockStorage{ctrl: ctrl}
-	mock.recorder = &MockStorageMockRecorder{mock}
+// NewMockClient creates a new mock instance
+func NewMockClient(ctrl *gomock.Controller) *MockClient {
+	mock := &MockClient{ctrl: ctrl}
+	mock.recorder = &MockClientMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use
-func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
+func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
 // Put mocks base method
-func (m *MockStorage) Put(ctx context.Context, objName string, data []byte) error {
+func (m *MockClient) Put(ctx context.Context, objName string, data []byte) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Put", ctx, objName, data)
 	ret0, _ := ret[0].(error)
@@ -42,13 +44,56 @@ func (m *MockStorage) Put(ctx context.Context, objName string, data []byte) erro
 }
 
 // Put indicates an expected call of Put
-func (mr *MockStorageMockRecorder) Put(ctx, objName, data interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Put(ctx, objName, data interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockStorage)(nil).Put), ctx, objName, data)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockClient)(nil).Put), ctx, objName, data)
+}
+
+// PutWithOptions mocks base method
+func (m *MockClient) PutWithOptions(ctx context.Context, objName string, data []byte, opts gcs.PutOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutWithOptions", ctx, objName, data, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutWithOptions indicates an expected call of PutWithOptions
+func (mr *MockClientMockRecorder) PutWithOptions(ctx, objName, data, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutWithOptions", reflect.TypeOf((*MockClient)(nil).PutWithOptions), ctx, objName, data, opts)
+}
+
+// UpdateMetadata mocks base method
+func (m *MockClient) UpdateMetadata(ctx context.Context, objName string, opts gcs.PutOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMetadata", ctx, objName, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMetadata indicates an expected call of UpdateMetadata
+func (mr *MockClientMockRecorder) UpdateMetadata(ctx, objName, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetadata", reflect.TypeOf((*MockClient)(nil).UpdateMetadata), ctx, objName, opts)
+}
+
+// Attrs mocks base method
+func (m *MockClient) Attrs(ctx context.Context, objName string) (*gcs.ObjectAttrs, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Attrs", ctx, objName)
+	ret0, _ := ret[0].(*gcs.ObjectAttrs)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Attrs indicates an expected call of Attrs
+func (mr *MockClientMockRecorder) Attrs(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Attrs", reflect.TypeOf((*MockClient)(nil).Attrs), ctx, objName)
 }
 
 // Get mocks base method
-func (m *MockStorage) Get(ctx context.Context, objName string) ([]byte, error) {
+func (m *MockClient) Get(ctx context.Context, objName string) ([]byte, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Get", ctx, objName)
 	ret0, _ := ret[0].([]byte)
@@ -57,13 +102,86 @@ func (m *MockStorage) Get(ctx context.Context, objName string) ([]byte, error) {
 }
 
 // Get indicates an expected call of Get
-func (mr *MockStorageMockRecorder) Get(ctx, objName interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Get(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClient)(nil).Get), ctx, objName)
+}
+
+// NewReader mocks base method
+func (m *MockClient) NewReader(ctx context.Context, objName string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewReader", ctx, objName)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewReader indicates an expected call of NewReader
+func (mr *MockClientMockRecorder) NewReader(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewReader", reflect.TypeOf((*MockClient)(nil).NewReader), ctx, objName)
+}
+
+// NewRangeReader mocks base method
+func (m *MockClient) NewRangeReader(ctx context.Context, objName string, offset, length int64) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewRangeReader", ctx, objName, offset, length)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewRangeReader indicates an expected call of NewRangeReader
+func (mr *MockClientMockRecorder) NewRangeReader(ctx, objName, offset, length interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStorage)(nil).Get), ctx, objName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewRangeReader", reflect.TypeOf((*MockClient)(nil).NewRangeReader), ctx, objName, offset, length)
+}
+
+// NewVersionRangeReader mocks base method
+func (m *MockClient) NewVersionRangeReader(ctx context.Context, objName string, generation, offset, length int64) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewVersionRangeReader", ctx, objName, generation, offset, length)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewVersionRangeReader indicates an expected call of NewVersionRangeReader
+func (mr *MockClientMockRecorder) NewVersionRangeReader(ctx, objName, generation, offset, length interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewVersionRangeReader", reflect.TypeOf((*MockClient)(nil).NewVersionRangeReader), ctx, objName, generation, offset, length)
+}
+
+// DownloadToFile mocks base method
+func (m *MockClient) DownloadToFile(ctx context.Context, objName, path string, opts gcs.DownloadOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadToFile", ctx, objName, path, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DownloadToFile indicates an expected call of DownloadToFile
+func (mr *MockClientMockRecorder) DownloadToFile(ctx, objName, path, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadToFile", reflect.TypeOf((*MockClient)(nil).DownloadToFile), ctx, objName, path, opts)
+}
+
+// NewWriter mocks base method
+func (m *MockClient) NewWriter(ctx context.Context, objName string, opts gcs.PutOptions) io.WriteCloser {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewWriter", ctx, objName, opts)
+	ret0, _ := ret[0].(io.WriteCloser)
+	return ret0
+}
+
+// NewWriter indicates an expected call of NewWriter
+func (mr *MockClientMockRecorder) NewWriter(ctx, objName, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewWriter", reflect.TypeOf((*MockClient)(nil).NewWriter), ctx, objName, opts)
 }
 
 // List mocks base method
-func (m *MockStorage) List(ctx context.Context, filePrefix string) ([]string, error) {
+func (m *MockClient) List(ctx context.Context, filePrefix string) ([]string, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "List", ctx, filePrefix)
 	ret0, _ := ret[0].([]string)
@@ -72,13 +190,13 @@ func (m *MockStorage) List(ctx context.Context, filePrefix string) ([]string, er
 }
 
 // List indicates an expected call of List
-func (mr *MockStorageMockRecorder) List(ctx, filePrefix interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) List(ctx, filePrefix interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockStorage)(nil).List), ctx, filePrefix)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockClient)(nil).List), ctx, filePrefix)
 }
 
 // Delete mocks base method
-func (m *MockStorage) Delete(ctx context.Context, objName string) error {
+func (m *MockClient) Delete(ctx context.Context, objName string) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Delete", ctx, objName)
 	ret0, _ := ret[0].(error)
@@ -86,13 +204,113 @@ func (m *MockStorage) Delete(ctx context.Context, objName string) error {
 }
 
 // Delete indicates an expected call of Delete
-func (mr *MockStorageMockRecorder) Delete(ctx, objName interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Delete(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockClient)(nil).Delete), ctx, objName)
+}
+
+// DeleteMany mocks base method
+func (m *MockClient) DeleteMany(ctx context.Context, objNames []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMany", ctx, objNames)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMany indicates an expected call of DeleteMany
+func (mr *MockClientMockRecorder) DeleteMany(ctx, objNames interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMany", reflect.TypeOf((*MockClient)(nil).DeleteMany), ctx, objNames)
+}
+
+// DeletePrefix mocks base method
+func (m *MockClient) DeletePrefix(ctx context.Context, prefix string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePrefix", ctx, prefix)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePrefix indicates an expected call of DeletePrefix
+func (mr *MockClientMockRecorder) DeletePrefix(ctx, prefix interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStorage)(nil).Delete), ctx, objName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePrefix", reflect.TypeOf((*MockClient)(nil).DeletePrefix), ctx, prefix)
+}
+
+// ListVersions mocks base method
+func (m *MockClient) ListVersions(ctx context.Context, objName string) ([]gcs.Version, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListVersions", ctx, objName)
+	ret0, _ := ret[0].([]gcs.Version)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListVersions indicates an expected call of ListVersions
+func (mr *MockClientMockRecorder) ListVersions(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListVersions", reflect.TypeOf((*MockClient)(nil).ListVersions), ctx, objName)
+}
+
+// GetVersion mocks base method
+func (m *MockClient) GetVersion(ctx context.Context, objName string, generation int64) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVersion", ctx, objName, generation)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVersion indicates an expected call of GetVersion
+func (mr *MockClientMockRecorder) GetVersion(ctx, objName, generation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersion", reflect.TypeOf((*MockClient)(nil).GetVersion), ctx, objName, generation)
+}
+
+// DeleteVersion mocks base method
+func (m *MockClient) DeleteVersion(ctx context.Context, objName string, generation int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteVersion", ctx, objName, generation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteVersion indicates an expected call of DeleteVersion
+func (mr *MockClientMockRecorder) DeleteVersion(ctx, objName, generation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteVersion", reflect.TypeOf((*MockClient)(nil).DeleteVersion), ctx, objName, generation)
+}
+
+// RestoreVersion mocks base method
+func (m *MockClient) RestoreVersion(ctx context.Context, objName string, generation int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreVersion", ctx, objName, generation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreVersion indicates an expected call of RestoreVersion
+func (mr *MockClientMockRecorder) RestoreVersion(ctx, objName, generation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreVersion", reflect.TypeOf((*MockClient)(nil).RestoreVersion), ctx, objName, generation)
+}
+
+// Copy mocks base method
+func (m *MockClient) Copy(ctx context.Context, src string, generation int64, dst string, opts gcs.PutOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Copy", ctx, src, generation, dst, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Copy indicates an expected call of Copy
+func (mr *MockClientMockRecorder) Copy(ctx, src, generation, dst, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Copy", reflect.TypeOf((*MockClient)(nil).Copy), ctx, src, generation, dst, opts)
 }
 
 // MakeObjectPublic mocks base method
-func (m *MockStorage) MakeObjectPublic(ctx context.Context, objName string) error {
+func (m *MockClient) MakeObjectPublic(ctx context.Context, objName string) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "MakeObjectPublic", ctx, objName)
 	ret0, _ := ret[0].(error)
@@ -100,7 +318,78 @@ func (m *MockStorage) MakeObjectPublic(ctx context.Context, objName string) erro
 }
 
 // MakeObjectPublic indicates an expected call of MakeObjectPublic
-func (mr *MockStorageMockRecorder) MakeObjectPublic(ctx, objName interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) MakeObjectPublic(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeObjectPublic", reflect.TypeOf((*MockClient)(nil).MakeObjectPublic), ctx, objName)
+}
+
+// MakeObjectPrivate mocks base method
+func (m *MockClient) MakeObjectPrivate(ctx context.Context, objName string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MakeObjectPrivate", ctx, objName)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MakeObjectPrivate indicates an expected call of MakeObjectPrivate
+func (mr *MockClientMockRecorder) MakeObjectPrivate(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeObjectPrivate", reflect.TypeOf((*MockClient)(nil).MakeObjectPrivate), ctx, objName)
+}
+
+// SetACL mocks base method
+func (m *MockClient) SetACL(ctx context.Context, objName string, entity gcs.ACLEntity, role gcs.ACLRole) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetACL", ctx, objName, entity, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetACL indicates an expected call of SetACL
+func (mr *MockClientMockRecorder) SetACL(ctx, objName, entity, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetACL", reflect.TypeOf((*MockClient)(nil).SetACL), ctx, objName, entity, role)
+}
+
+// DeleteACL mocks base method
+func (m *MockClient) DeleteACL(ctx context.Context, objName string, entity gcs.ACLEntity) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteACL", ctx, objName, entity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteACL indicates an expected call of DeleteACL
+func (mr *MockClientMockRecorder) DeleteACL(ctx, objName, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteACL", reflect.TypeOf((*MockClient)(nil).DeleteACL), ctx, objName, entity)
+}
+
+// ListACL mocks base method
+func (m *MockClient) ListACL(ctx context.Context, objName string) ([]gcs.ACLRule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListACL", ctx, objName)
+	ret0, _ := ret[0].([]gcs.ACLRule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListACL indicates an expected call of ListACL
+func (mr *MockClientMockRecorder) ListACL(ctx, objName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListACL", reflect.TypeOf((*MockClient)(nil).ListACL), ctx, objName)
+}
+
+// URL mocks base method
+func (m *MockClient) URL(objName string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "URL", objName)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// URL indicates an expected call of URL
+func (mr *MockClientMockRecorder) URL(objName interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeObjectPublic", reflect.TypeOf((*MockStorage)(nil).MakeObjectPublic), ctx, objName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "URL", reflect.TypeOf((*MockClient)(nil).URL), objName)
 }
@@ -0,0 +1,9 @@
+package gcs_test
+
+import (
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/mock_gcs"
+)
+
+// Fails to compile when mock_gcs is stale; run go generate ./gcs to update it.
+var _ gcs.Client = (*mock_gcs.MockClient)(nil)
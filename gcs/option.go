@@ -0,0 +1,120 @@
+package gcs
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// Option configures NewGCSClient and NewBucketAdmin.
+type Option func(*config)
+
+type config struct {
+	credentials   []option.ClientOption
+	clientOptions []option.ClientOption
+	endpoint      string
+	cdnURL        string
+	userProject   string
+	retry         RetryConfig
+}
+
+// OptionCredentialsJSON authenticates with a service account or user credentials JSON.
+func OptionCredentialsJSON(json []byte) Option {
+	return func(c *config) {
+		c.credentials = append(c.credentials, option.WithCredentialsJSON(json))
+	}
+}
+
+// OptionCredentialsFile authenticates with a credentials JSON file.
+func OptionCredentialsFile(path string) Option {
+	return func(c *config) {
+		c.credentials = append(c.credentials, option.WithCredentialsFile(path))
+	}
+}
+
+// OptionEndpoint overrides the JSON API endpoint, e.g. "https://localhost:4443/storage/v1/".
+// Media downloads always use https, so plain-HTTP emulators must be set with
+// STORAGE_EMULATOR_HOST instead, which NewGCSClient honours without any option.
+func OptionEndpoint(endpoint string) Option {
+	return func(c *config) {
+		c.clientOptions = append(c.clientOptions, option.WithEndpoint(endpoint))
+		c.endpoint = endpoint
+	}
+}
+
+// OptionCDNURL makes Client.URL build object URLs from the base URL of a CDN in front of the bucket.
+func OptionCDNURL(baseURL string) Option {
+	return func(c *config) {
+		c.cdnURL = baseURL
+	}
+}
+
+// OptionUserProject bills requests to projectID, as required by requester-pays buckets.
+func OptionUserProject(projectID string) Option {
+	return func(c *config) {
+		c.userProject = projectID
+	}
+}
+
+// OptionHTTPClient sends requests with httpClient, which must handle authentication itself.
+func OptionHTTPClient(httpClient *http.Client) Option {
+	return func(c *config) {
+		c.clientOptions = append(c.clientOptions, option.WithHTTPClient(httpClient))
+	}
+}
+
+// OptionScopes replaces the default full-control OAuth scope.
+func OptionScopes(scopes ...string) Option {
+	return func(c *config) {
+		c.clientOptions = append(c.clientOptions, option.WithScopes(scopes...))
+	}
+}
+
+// OptionRetry sets the retry policy applied to every client operation.
+func OptionRetry(retry RetryConfig) Option {
+	return func(c *config) {
+		c.retry = retry
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{retry: RetryConfig{MaxAttempts: 1}}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// publicBaseURL returns the URL objects are served from, including the bucket when it is part of the path.
+func (c *config) publicBaseURL(bucket string) string {
+	if c.cdnURL != "" {
+		return strings.TrimSuffix(c.cdnURL, "/")
+	}
+
+	host := "https://storage.googleapis.com"
+	if env := os.Getenv("STORAGE_EMULATOR_HOST"); env != "" {
+		host = env
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+	} else if u, err := url.Parse(c.endpoint); err == nil && u.Host != "" {
+		host = u.Scheme + "://" + u.Host
+	}
+	return strings.TrimSuffix(host, "/") + "/" + bucket
+}
+
+func (c *config) newStorageClient(ctx context.Context) (*storage.Client, error) {
+	opts := c.clientOptions
+	// The storage library disables authentication for emulators, which
+	// conflicts with explicit credentials.
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		opts = append(append([]option.ClientOption{}, c.credentials...), opts...)
+	}
+
+	return storage.NewClient(ctx, opts...)
+}
@@ -0,0 +1,86 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/hayashiki/go-pkg/internal/retry"
+)
+
+// RetryConfig retries whole client operations with exponential backoff.
+// The storage library already retries transient errors of a single request;
+// this also covers failures it does not, such as a download cut off mid-stream.
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts; 1 or less disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryConfig is a reasonable policy for OptionRetry.
+var DefaultRetryConfig = RetryConfig{
+	MaxAttempts:    4,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+func (r RetryConfig) do(ctx context.Context, fn func() error) error {
+	return retry.Do(ctx, r.policy(), isRetryable, fn)
+}
+
+func (r RetryConfig) policy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    r.MaxAttempts,
+		InitialBackoff: r.InitialBackoff,
+		MaxBackoff:     r.MaxBackoff,
+		Multiplier:     r.Multiplier,
+	}
+}
+
+// remove runs an unconditional delete. When a first attempt succeeds but its
+// response is lost, the retry finds the object gone; that is reported as the
+// success it is rather than as ErrObjectNotExist.
+func (r RetryConfig) remove(ctx context.Context, fn func() error) error {
+	attempt := 0
+	return r.do(ctx, func() error {
+		attempt++
+		err := fn()
+		if attempt > 1 && errors.Is(err, ErrObjectNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// conditional returns the policy for a request with a precondition, which
+// is never retried: when a first attempt succeeds but its response is lost,
+// the retry fails its precondition and the caller would take its own write
+// for a conflicting one.
+func (r RetryConfig) conditional(cond bool) RetryConfig {
+	if cond {
+		r.MaxAttempts = 1
+	}
+	return r
+}
+
+func isRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
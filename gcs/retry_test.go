@@ -0,0 +1,133 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestRetryConfig_do(t *testing.T) {
+	retry := RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+	tests := []struct {
+		name      string
+		retry     RetryConfig
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "success",
+			retry:     retry,
+			errs:      []error{nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "retry server error",
+			retry:     retry,
+			errs:      []error{&googleapi.Error{Code: http.StatusServiceUnavailable}, io.ErrUnexpectedEOF, nil},
+			wantCalls: 3,
+		},
+		{
+			name:      "give up",
+			retry:     retry,
+			errs:      []error{&googleapi.Error{Code: http.StatusTooManyRequests}, &googleapi.Error{Code: http.StatusTooManyRequests}, &googleapi.Error{Code: http.StatusTooManyRequests}},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "not retryable",
+			retry:     retry,
+			errs:      []error{&googleapi.Error{Code: http.StatusForbidden}, nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "disabled",
+			retry:     RetryConfig{MaxAttempts: 1},
+			errs:      []error{errors.New("x"), nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.retry.do(context.Background(), func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("do() calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryConfig_conditional(t *testing.T) {
+	if got := DefaultRetryConfig.conditional(true).MaxAttempts; got != 1 {
+		t.Errorf("conditional(true).MaxAttempts = %d, want 1", got)
+	}
+	if got := DefaultRetryConfig.conditional(false); got != DefaultRetryConfig {
+		t.Errorf("conditional(false) = %v, want %v", got, DefaultRetryConfig)
+	}
+}
+
+func TestRetryConfig_remove(t *testing.T) {
+	retry := RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name    string
+		errs    []error
+		wantErr error
+	}{
+		{name: "missing", errs: []error{ErrObjectNotExist}, wantErr: ErrObjectNotExist},
+		{name: "lost response", errs: []error{unavailable, ErrObjectNotExist}},
+		{name: "give up", errs: []error{unavailable, unavailable, unavailable}, wantErr: unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retry.remove(context.Background(), func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("remove() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	cfg := newConfig([]Option{
+		OptionCredentialsJSON([]byte("{}")),
+		OptionUserProject("billing"),
+		OptionScopes("https://www.googleapis.com/auth/devstorage.read_only"),
+		OptionRetry(DefaultRetryConfig),
+	})
+
+	if cfg.userProject != "billing" {
+		t.Errorf("userProject = %q, want billing", cfg.userProject)
+	}
+	if cfg.retry != DefaultRetryConfig {
+		t.Errorf("retry = %v, want %v", cfg.retry, DefaultRetryConfig)
+	}
+	if len(cfg.credentials) != 1 || len(cfg.clientOptions) != 1 {
+		t.Errorf("credentials = %d, clientOptions = %d, want 1 and 1", len(cfg.credentials), len(cfg.clientOptions))
+	}
+	if newConfig(nil).retry.MaxAttempts != 1 {
+		t.Errorf("default retry should not retry")
+	}
+}
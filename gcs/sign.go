@@ -0,0 +1,26 @@
+package gcs
+
+import (
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+)
+
+// SignedURL returns a V4 signed GET URL for objName that is valid for expires,
+// signed with the private key of a service account JSON key file.
+func SignedURL(bucket, objName string, serviceAccountJSON []byte, expires time.Duration) (string, error) {
+	conf, err := google.JWTConfigFromJSON(serviceAccountJSON)
+	if err != nil {
+		return "", err
+	}
+
+	return storage.SignedURL(bucket, objName, &storage.SignedURLOptions{
+		GoogleAccessID: conf.Email,
+		PrivateKey:     conf.PrivateKey,
+		Method:         http.MethodGet,
+		Expires:        time.Now().Add(expires),
+		Scheme:         storage.SigningSchemeV4,
+	})
+}
@@ -0,0 +1,94 @@
+package gcs
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// Version is a single generation of an object in a versioned bucket.
+type Version struct {
+	Generation int64
+	Size       int64
+	Created    time.Time
+	// Deleted is the time the generation became noncurrent; zero for the live generation.
+	Deleted  time.Time
+	IsLatest bool
+}
+
+// ListVersions Fetch every generation of objName, newest first.
+func (c *client) ListVersions(ctx context.Context, objName string) ([]Version, error) {
+	var versions []Version
+	err := c.retry.do(ctx, func() error {
+		versions = nil
+		it := c.bucketHandle().Objects(ctx, &storage.Query{Prefix: objName, Versions: true})
+		for {
+			objAttrs, err := it.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if objAttrs.Name != objName {
+				continue
+			}
+			versions = append(versions, Version{
+				Generation: objAttrs.Generation,
+				Size:       objAttrs.Size,
+				Created:    objAttrs.Created,
+				Deleted:    objAttrs.Deleted,
+				IsLatest:   objAttrs.Deleted.IsZero(),
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Generation > versions[j].Generation
+	})
+
+	return versions, nil
+}
+
+// GetVersion Get request for a specific generation of objName.
+func (c *client) GetVersion(ctx context.Context, objName string, generation int64) ([]byte, error) {
+	var b []byte
+	err := c.retry.do(ctx, func() error {
+		r, err := c.bucketHandle().Object(objName).Generation(generation).NewReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		b, err = ioutil.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DeleteVersion permanently deletes a single generation of objName.
+func (c *client) DeleteVersion(ctx context.Context, objName string, generation int64) error {
+	// A retry after a lost response would report the generation as missing.
+	o := c.bucketHandle().Object(objName).Generation(generation)
+	return c.retry.conditional(true).do(ctx, func() error { return o.Delete(ctx) })
+}
+
+// RestoreVersion makes generation the live version of objName by copying it over the current one.
+func (c *client) RestoreVersion(ctx context.Context, objName string, generation int64) error {
+	o := c.bucketHandle().Object(objName)
+	return c.retry.do(ctx, func() error {
+		_, err := o.CopierFrom(o.Generation(generation)).Run(ctx)
+		return err
+	})
+}
@@ -0,0 +1,708 @@
+package gcstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	raw "google.golang.org/api/storage/v1"
+)
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Errors  []errorDetail `json:"errors"`
+}
+
+type errorDetail struct {
+	Domain  string `json:"domain"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	segs, err := splitPath(r.URL.EscapedPath())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case hasPrefix(segs, "storage", "v1"):
+		s.serveJSON(w, r, segs[2:])
+	case hasPrefix(segs, "download", "storage", "v1"):
+		s.serveJSON(w, r, segs[3:])
+	case hasPrefix(segs, "upload", "storage", "v1", "b") && len(segs) == 6 && segs[5] == "o":
+		s.serveUpload(w, r, segs[4])
+	case len(segs) >= 2:
+		// Media downloads address objects as /bucket/name with unescaped slashes.
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		s.serveMedia(w, r, parts[0], parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+	}
+}
+
+func splitPath(p string) ([]string, error) {
+	segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, seg := range segs {
+		v, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, err
+		}
+		segs[i] = v
+	}
+	return segs, nil
+}
+
+func hasPrefix(segs []string, prefix ...string) bool {
+	if len(segs) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if segs[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) serveJSON(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) == 0 || segs[0] != "b" {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+	if len(segs) == 1 {
+		s.serveBuckets(w, r)
+		return
+	}
+
+	b, ok := s.buckets[segs[1]]
+	if !ok && !(len(segs) == 2 && r.Method == http.MethodPost) {
+		writeError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+		return
+	}
+
+	switch {
+	case len(segs) == 2:
+		s.serveBucket(w, r, b)
+	case len(segs) == 3 && segs[2] == "o" && r.Method == http.MethodGet:
+		s.listObjects(w, r, b)
+	case len(segs) == 4 && segs[2] == "o":
+		s.serveObject(w, r, b, segs[3])
+	case len(segs) >= 5 && segs[2] == "o" && segs[4] == "acl":
+		s.serveACL(w, r, b, segs[3], segs[5:])
+	case len(segs) == 9 && segs[2] == "o" && (segs[4] == "rewriteTo" || segs[4] == "copyTo") && segs[5] == "b" && segs[7] == "o":
+		s.rewriteObject(w, r, b, segs[3], segs[6], segs[8], segs[4] == "rewriteTo")
+	default:
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+	}
+}
+
+func (s *Server) serveBuckets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		res := raw.Buckets{Kind: "storage#buckets"}
+		for _, b := range s.buckets {
+			attrs := b.attrs
+			res.Items = append(res.Items, &attrs)
+		}
+		writeJSON(w, http.StatusOK, res)
+	case http.MethodPost:
+		var attrs raw.Bucket
+		if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		if attrs.Name == "" {
+			writeError(w, http.StatusBadRequest, "required", "Required")
+			return
+		}
+		if _, ok := s.buckets[attrs.Name]; ok {
+			writeError(w, http.StatusConflict, "conflict", "You already own this bucket. Please select another name.")
+			return
+		}
+		b := s.newBucket(attrs)
+		s.buckets[attrs.Name] = b
+		writeJSON(w, http.StatusOK, b.attrs)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "invalid", r.Method+" is not supported")
+	}
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, b *bucket) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, b.attrs)
+	case http.MethodPatch, http.MethodPut:
+		attrs, err := patchBucket(b.attrs, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		if acl := predefinedACL(r.URL.Query().Get("predefinedDefaultObjectAcl")); acl != nil {
+			attrs.DefaultObjectAcl = acl
+		}
+		attrs.Metageneration++
+		attrs.Updated = time.Now().UTC().Format(time.RFC3339Nano)
+		b.attrs = attrs
+		writeJSON(w, http.StatusOK, b.attrs)
+	case http.MethodDelete:
+		if len(b.objects) > 0 {
+			writeError(w, http.StatusConflict, "conflict", "The bucket you tried to delete is not empty.")
+			return
+		}
+		delete(s.buckets, b.attrs.Name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "invalid", r.Method+" is not supported")
+	}
+}
+
+// patchBucket merges the top-level fields of the request body into attrs.
+// A null field resets it.
+func patchBucket(attrs raw.Bucket, r *http.Request) (raw.Bucket, error) {
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return attrs, err
+	}
+
+	cur, err := json.Marshal(attrs)
+	if err != nil {
+		return attrs, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(cur, &fields); err != nil {
+		return attrs, err
+	}
+	for k, v := range patch {
+		if string(v) == "null" {
+			delete(fields, k)
+			continue
+		}
+		fields[k] = v
+	}
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return attrs, err
+	}
+	var res raw.Bucket
+	err = json.Unmarshal(merged, &res)
+	return res, err
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, b *bucket) {
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	delimiter := q.Get("delimiter")
+	versions := q.Get("versions") == "true"
+	maxResults := 1000
+	if v := q.Get("maxResults"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n < maxResults {
+			maxResults = n
+		}
+	}
+
+	res := raw.Objects{Kind: "storage#objects"}
+	seen := map[string]bool{}
+	count := 0
+	last := ""
+	for _, name := range b.sortedNames() {
+		if !strings.HasPrefix(name, prefix) || name <= q.Get("pageToken") {
+			continue
+		}
+
+		var objs []*object
+		if versions {
+			objs = b.objects[name]
+		} else if o := b.live(name); o != nil {
+			objs = []*object{o}
+		}
+		if len(objs) == 0 {
+			continue
+		}
+
+		if count >= maxResults {
+			res.NextPageToken = last
+			break
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				p := name[:len(prefix)+i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					res.Prefixes = append(res.Prefixes, p)
+					count++
+				}
+				// Skip past every name under the prefix on the next page.
+				last = p + "\xff"
+				continue
+			}
+		}
+
+		for _, o := range objs {
+			attrs := o.attrs
+			res.Items = append(res.Items, &attrs)
+		}
+		count++
+		last = name
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// lookup returns the generation of name selected by the generation query
+// parameter, or the live one.
+func lookup(b *bucket, name string, q url.Values, param string) (*object, error) {
+	v := q.Get(param)
+	if v == "" {
+		return b.live(name), nil
+	}
+	gen, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return b.generation(name, gen), nil
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, b *bucket, name string) {
+	q := r.URL.Query()
+	if r.Method == http.MethodGet && q.Get("alt") == "media" {
+		s.serveMedia(w, r, b.attrs.Name, name)
+		return
+	}
+
+	o, err := lookup(b, name, q, "generation")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if o == nil {
+		writeError(w, http.StatusNotFound, "notFound", "No such object: "+b.attrs.Name+"/"+name)
+		return
+	}
+	if !checkConditions(w, q, o) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, o.attrs)
+	case http.MethodPatch, http.MethodPut:
+		if err := patchObject(&o.attrs, r, r.Method == http.MethodPut); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		if acl := predefinedACL(q.Get("predefinedAcl")); acl != nil {
+			o.attrs.Acl = acl
+		}
+		for _, a := range o.attrs.Acl {
+			s.fillACL(b.attrs.Name, name, a)
+		}
+		o.attrs.Metageneration++
+		o.attrs.Updated = time.Now().UTC().Format(time.RFC3339Nano)
+		writeJSON(w, http.StatusOK, o.attrs)
+	case http.MethodDelete:
+		if q.Get("generation") != "" {
+			b.removeGeneration(name, o.attrs.Generation)
+		} else {
+			b.remove(name)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "invalid", r.Method+" is not supported")
+	}
+}
+
+// patchObject applies the writable fields of the request body to attrs.
+// With replace, fields missing from the body are cleared.
+func patchObject(attrs *raw.Object, r *http.Request, replace bool) error {
+	var patch struct {
+		ContentType        *string                    `json:"contentType"`
+		ContentEncoding    *string                    `json:"contentEncoding"`
+		CacheControl       *string                    `json:"cacheControl"`
+		ContentDisposition *string                    `json:"contentDisposition"`
+		ContentLanguage    *string                    `json:"contentLanguage"`
+		Metadata           map[string]*string         `json:"metadata"`
+		Acl                []*raw.ObjectAccessControl `json:"acl"`
+	}
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		return err
+	}
+	b, _ := json.Marshal(fields)
+	if err := json.Unmarshal(b, &patch); err != nil {
+		return err
+	}
+
+	set := func(dst *string, key string, v *string) {
+		_, ok := fields[key]
+		switch {
+		case v != nil:
+			*dst = *v
+		case ok || replace:
+			*dst = ""
+		}
+	}
+	set(&attrs.ContentType, "contentType", patch.ContentType)
+	set(&attrs.ContentEncoding, "contentEncoding", patch.ContentEncoding)
+	set(&attrs.CacheControl, "cacheControl", patch.CacheControl)
+	set(&attrs.ContentDisposition, "contentDisposition", patch.ContentDisposition)
+	set(&attrs.ContentLanguage, "contentLanguage", patch.ContentLanguage)
+
+	if _, ok := fields["metadata"]; ok || replace {
+		if patch.Metadata == nil || replace {
+			attrs.Metadata = nil
+		}
+		for k, v := range patch.Metadata {
+			if v == nil {
+				delete(attrs.Metadata, k)
+				continue
+			}
+			if attrs.Metadata == nil {
+				attrs.Metadata = map[string]string{}
+			}
+			attrs.Metadata[k] = *v
+		}
+	}
+	if patch.Acl != nil {
+		attrs.Acl = patch.Acl
+	}
+	return nil
+}
+
+// checkConditions reports whether o satisfies the precondition query
+// parameters, writing a 412 response when it does not. o is nil when the
+// object does not exist.
+func checkConditions(w http.ResponseWriter, q url.Values, o *object) bool {
+	var gen, metagen int64
+	if o != nil {
+		gen, metagen = o.attrs.Generation, o.attrs.Metageneration
+	}
+
+	ok := true
+	check := func(param string, cur int64, match bool) {
+		v := q.Get(param)
+		if v == "" {
+			return
+		}
+		want, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || (cur == want) != match {
+			ok = false
+		}
+	}
+	check("ifGenerationMatch", gen, true)
+	check("ifGenerationNotMatch", gen, false)
+	check("ifMetagenerationMatch", metagen, true)
+	check("ifMetagenerationNotMatch", metagen, false)
+
+	if !ok {
+		writeError(w, http.StatusPreconditionFailed, "conditionNotMet", "Precondition Failed")
+	}
+	return ok
+}
+
+func (s *Server) rewriteObject(w http.ResponseWriter, r *http.Request, src *bucket, srcName, dstBucket, dstName string, rewrite bool) {
+	q := r.URL.Query()
+	dst, ok := s.buckets[dstBucket]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+		return
+	}
+	so, err := lookup(src, srcName, q, "sourceGeneration")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if so == nil {
+		writeError(w, http.StatusNotFound, "notFound", "No such object: "+src.attrs.Name+"/"+srcName)
+		return
+	}
+	if !checkConditions(w, q, dst.live(dstName)) {
+		return
+	}
+
+	var body raw.Object
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+	}
+
+	attrs := raw.Object{
+		Name:               dstName,
+		ContentType:        firstNonEmpty(body.ContentType, so.attrs.ContentType),
+		ContentEncoding:    firstNonEmpty(body.ContentEncoding, so.attrs.ContentEncoding),
+		CacheControl:       firstNonEmpty(body.CacheControl, so.attrs.CacheControl),
+		ContentDisposition: firstNonEmpty(body.ContentDisposition, so.attrs.ContentDisposition),
+		ContentLanguage:    firstNonEmpty(body.ContentLanguage, so.attrs.ContentLanguage),
+		StorageClass:       firstNonEmpty(body.StorageClass, so.attrs.StorageClass),
+		Metadata:           so.attrs.Metadata,
+		Acl:                predefinedACL(q.Get("destinationPredefinedAcl")),
+	}
+	if body.Metadata != nil {
+		attrs.Metadata = body.Metadata
+	}
+	if attrs.Acl == nil {
+		attrs.Acl = copyACL(dst.attrs.DefaultObjectAcl)
+	}
+
+	o := s.newObject(dstBucket, attrs, append([]byte(nil), so.data...))
+	dst.put(o)
+
+	if !rewrite {
+		writeJSON(w, http.StatusOK, o.attrs)
+		return
+	}
+	res := o.attrs
+	writeJSON(w, http.StatusOK, raw.RewriteResponse{
+		Kind:                "storage#rewriteResponse",
+		Done:                true,
+		ObjectSize:          int64(len(o.data)),
+		TotalBytesRewritten: int64(len(o.data)),
+		Resource:            &res,
+	})
+}
+
+func (s *Server) serveACL(w http.ResponseWriter, r *http.Request, b *bucket, name string, rest []string) {
+	o, err := lookup(b, name, r.URL.Query(), "generation")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if o == nil {
+		writeError(w, http.StatusNotFound, "notFound", "No such object: "+b.attrs.Name+"/"+name)
+		return
+	}
+
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, raw.ObjectAccessControls{Kind: "storage#objectAccessControls", Items: o.attrs.Acl})
+		case http.MethodPost:
+			var a raw.ObjectAccessControl
+			if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid", err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, s.setACL(o, a.Entity, a.Role))
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "invalid", r.Method+" is not supported")
+		}
+		return
+	}
+	if len(rest) != 1 {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+
+	entity := rest[0]
+	i := aclIndex(o.attrs.Acl, entity)
+	switch r.Method {
+	case http.MethodGet:
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "notFound", "No such entity: "+entity)
+			return
+		}
+		writeJSON(w, http.StatusOK, o.attrs.Acl[i])
+	case http.MethodPut, http.MethodPatch:
+		var a raw.ObjectAccessControl
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.setACL(o, entity, a.Role))
+	case http.MethodDelete:
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "notFound", "No such entity: "+entity)
+			return
+		}
+		o.attrs.Acl = append(o.attrs.Acl[:i:i], o.attrs.Acl[i+1:]...)
+		o.attrs.Metageneration++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "invalid", r.Method+" is not supported")
+	}
+}
+
+func (s *Server) setACL(o *object, entity, role string) *raw.ObjectAccessControl {
+	a := &raw.ObjectAccessControl{Entity: entity, Role: role}
+	s.fillACL(o.attrs.Bucket, o.attrs.Name, a)
+	if i := aclIndex(o.attrs.Acl, entity); i >= 0 {
+		o.attrs.Acl[i] = a
+	} else {
+		o.attrs.Acl = append(o.attrs.Acl, a)
+	}
+	o.attrs.Metageneration++
+	return a
+}
+
+func aclIndex(acl []*raw.ObjectAccessControl, entity string) int {
+	for i, a := range acl {
+		if a.Entity == entity {
+			return i
+		}
+	}
+	return -1
+}
+
+func copyACL(acl []*raw.ObjectAccessControl) []*raw.ObjectAccessControl {
+	if acl == nil {
+		return nil
+	}
+	res := make([]*raw.ObjectAccessControl, len(acl))
+	for i, a := range acl {
+		c := *a
+		res[i] = &c
+	}
+	return res
+}
+
+func (s *Server) serveMedia(w http.ResponseWriter, r *http.Request, bucketName, name string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "invalid", r.Method+" is not supported")
+		return
+	}
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+		return
+	}
+	q := r.URL.Query()
+	o, err := lookup(b, name, q, "generation")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if o == nil {
+		writeError(w, http.StatusNotFound, "notFound", "No such object: "+bucketName+"/"+name)
+		return
+	}
+	if !checkConditions(w, q, o) {
+		return
+	}
+
+	h := w.Header()
+	setHeader(h, "Content-Type", o.attrs.ContentType)
+	setHeader(h, "Content-Encoding", o.attrs.ContentEncoding)
+	setHeader(h, "Cache-Control", o.attrs.CacheControl)
+	setHeader(h, "Content-Disposition", o.attrs.ContentDisposition)
+	setHeader(h, "Content-Language", o.attrs.ContentLanguage)
+	for k, v := range o.attrs.Metadata {
+		h.Set("X-Goog-Meta-"+k, v)
+	}
+	h.Set("X-Goog-Generation", strconv.FormatInt(o.attrs.Generation, 10))
+	h.Set("X-Goog-Metageneration", strconv.FormatInt(o.attrs.Metageneration, 10))
+	h.Set("X-Goog-Hash", "crc32c="+o.attrs.Crc32c+",md5="+o.attrs.Md5Hash)
+	h.Set("ETag", `"`+o.attrs.Etag+`"`)
+	if t, err := time.Parse(time.RFC3339Nano, o.attrs.Updated); err == nil {
+		h.Set("Last-Modified", t.Format(http.TimeFormat))
+	}
+
+	data := o.data
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(data)))
+		if !ok {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", len(data)))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "requestedRangeNotSatisfiable", "Requested range not satisfiable")
+			return
+		}
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// parseRange parses a single "bytes=start-end", "bytes=start-" or "bytes=-suffix" range.
+func parseRange(rng string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(rng, "bytes=")
+	if spec == rng || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	if parts[0] == "" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+func setHeader(h http.Header, name, value string) {
+	if value != "" {
+		h.Set(name, value)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, reason, message string) {
+	writeJSON(w, status, errorResponse{Error: errorBody{
+		Code:    status,
+		Message: message,
+		Errors:  []errorDetail{{Domain: "global", Reason: reason, Message: message}},
+	}})
+}
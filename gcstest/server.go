@@ -0,0 +1,271 @@
+// Package gcstest provides an in-process server speaking the subset of the
+// Cloud Storage JSON and upload APIs used by the gcs package, so tests can
+// exercise cloud.google.com/go/storage against a custom endpoint.
+//
+//	srv := gcstest.NewServer()
+//	defer srv.Close()
+//	srv.CreateBucket("test")
+//	c, err := gcs.NewGCSClient("test", srv.Options()...)
+package gcstest
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"google.golang.org/api/option"
+	raw "google.golang.org/api/storage/v1"
+)
+
+// Server is a GCS-compatible HTTPS stand-in that keeps objects in memory.
+// Requests are not authenticated.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	uploads    map[string]*upload
+	generation int64
+	nextID     int
+}
+
+type bucket struct {
+	attrs raw.Bucket
+	// objects holds every generation of each object, oldest first.
+	// Only the last one can be live.
+	objects map[string][]*object
+}
+
+type object struct {
+	attrs raw.Object
+	data  []byte
+}
+
+type upload struct {
+	bucket string
+	attrs  raw.Object
+	query  map[string][]string
+	data   []byte
+}
+
+// NewServer starts a TLS server with no buckets.
+func NewServer() *Server {
+	s := &Server{
+		buckets:    map[string]*bucket{},
+		uploads:    map[string]*upload{},
+		generation: time.Now().UnixNano() / 1000,
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// CreateBucket creates an empty bucket if it does not exist.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[name]; !ok {
+		s.buckets[name] = s.newBucket(raw.Bucket{Name: name})
+	}
+}
+
+// ClientOptions returns the options that point storage.NewClient at the server.
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithHTTPClient(s.Client()),
+		option.WithEndpoint(s.URL + "/storage/v1/"),
+	}
+}
+
+// Options returns the options that point gcs.NewGCSClient and gcs.NewBucketAdmin at the server.
+func (s *Server) Options() []gcs.Option {
+	return []gcs.Option{
+		gcs.OptionHTTPClient(s.Client()),
+		gcs.OptionEndpoint(s.URL + "/storage/v1/"),
+	}
+}
+
+// Objects returns the names of the live objects in a bucket in lexical order.
+func (s *Server) Objects(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, name := range b.sortedNames() {
+		if b.live(name) != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (s *Server) newBucket(attrs raw.Bucket) *bucket {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	attrs.Kind = "storage#bucket"
+	attrs.Id = attrs.Name
+	attrs.Metageneration = 1
+	attrs.TimeCreated = now
+	attrs.Updated = now
+	if attrs.StorageClass == "" {
+		attrs.StorageClass = "STANDARD"
+	}
+	if attrs.Location == "" {
+		attrs.Location = "US"
+	}
+	return &bucket{attrs: attrs, objects: map[string][]*object{}}
+}
+
+func (b *bucket) sortedNames() []string {
+	names := make([]string, 0, len(b.objects))
+	for name := range b.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// live returns the current generation of name, or nil if it does not exist.
+func (b *bucket) live(name string) *object {
+	gens := b.objects[name]
+	if len(gens) == 0 {
+		return nil
+	}
+	if o := gens[len(gens)-1]; o.attrs.TimeDeleted == "" {
+		return o
+	}
+	return nil
+}
+
+// generation returns the given generation of name, or nil if it does not exist.
+func (b *bucket) generation(name string, gen int64) *object {
+	for _, o := range b.objects[name] {
+		if o.attrs.Generation == gen {
+			return o
+		}
+	}
+	return nil
+}
+
+func (b *bucket) versioned() bool {
+	return b.attrs.Versioning != nil && b.attrs.Versioning.Enabled
+}
+
+// put makes o the live generation of its name, archiving or dropping the previous one.
+func (b *bucket) put(o *object) {
+	name := o.attrs.Name
+	if prev := b.live(name); prev != nil {
+		prev.attrs.TimeDeleted = o.attrs.Updated
+	}
+	if !b.versioned() {
+		b.objects[name] = nil
+	}
+	b.objects[name] = append(b.objects[name], o)
+}
+
+// remove deletes the live generation of name, archiving it when versioning is enabled.
+func (b *bucket) remove(name string) {
+	o := b.live(name)
+	if o == nil {
+		return
+	}
+	if b.versioned() {
+		o.attrs.TimeDeleted = time.Now().UTC().Format(time.RFC3339Nano)
+		return
+	}
+	delete(b.objects, name)
+}
+
+// removeGeneration permanently deletes one generation of name.
+func (b *bucket) removeGeneration(name string, gen int64) {
+	gens := b.objects[name]
+	for i, o := range gens {
+		if o.attrs.Generation == gen {
+			gens = append(gens[:i:i], gens[i+1:]...)
+			break
+		}
+	}
+	if len(gens) == 0 {
+		delete(b.objects, name)
+		return
+	}
+	b.objects[name] = gens
+}
+
+// newObject fills in the server-assigned attributes of an object holding data.
+func (s *Server) newObject(bucketName string, attrs raw.Object, data []byte) *object {
+	s.generation++
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+
+	md5sum := md5.Sum(data)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+
+	attrs.Kind = "storage#object"
+	attrs.Bucket = bucketName
+	attrs.Id = fmt.Sprintf("%s/%s/%d", bucketName, attrs.Name, s.generation)
+	attrs.Generation = s.generation
+	attrs.Metageneration = 1
+	attrs.Size = uint64(len(data))
+	attrs.Md5Hash = base64.StdEncoding.EncodeToString(md5sum[:])
+	attrs.Crc32c = base64.StdEncoding.EncodeToString(crc[:])
+	attrs.Etag = strconv.FormatInt(s.generation, 10)
+	attrs.TimeCreated = now
+	attrs.Updated = now
+	attrs.TimeDeleted = ""
+	if attrs.ContentType == "" {
+		attrs.ContentType = "application/octet-stream"
+	}
+	if attrs.StorageClass == "" {
+		attrs.StorageClass = "STANDARD"
+	}
+	if attrs.Acl == nil {
+		attrs.Acl = defaultACL()
+	}
+	for _, a := range attrs.Acl {
+		s.fillACL(bucketName, attrs.Name, a)
+	}
+	return &object{attrs: attrs, data: data}
+}
+
+func (s *Server) fillACL(bucketName, name string, a *raw.ObjectAccessControl) {
+	a.Kind = "storage#objectAccessControl"
+	a.Bucket = bucketName
+	a.Object = name
+	a.Id = fmt.Sprintf("%s/%s/%s", bucketName, name, a.Entity)
+}
+
+func defaultACL() []*raw.ObjectAccessControl {
+	return []*raw.ObjectAccessControl{{Entity: "user-gcstest", Role: "OWNER"}}
+}
+
+// predefinedACL expands a predefinedAcl query parameter.
+func predefinedACL(name string) []*raw.ObjectAccessControl {
+	acl := defaultACL()
+	switch name {
+	case "publicRead":
+		acl = append(acl, &raw.ObjectAccessControl{Entity: "allUsers", Role: "READER"})
+	case "authenticatedRead":
+		acl = append(acl, &raw.ObjectAccessControl{Entity: "allAuthenticatedUsers", Role: "READER"})
+	case "":
+		return nil
+	}
+	return acl
+}
+
+func (s *Server) newUploadID() string {
+	s.nextID++
+	return fmt.Sprintf("upload-%d", s.nextID)
+}
@@ -0,0 +1,240 @@
+package gcstest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func newClient(t *testing.T, srv *Server, bucket string) gcs.Client {
+	t.Helper()
+	c, err := gcs.NewGCSClient(bucket, srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestServer_Conformance(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	storagetest.TestGCSClient(t, func(t *testing.T) gcs.Client {
+		return newClient(t, srv, "test")
+	})
+}
+
+func TestServer_Resumable(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	ctx := context.Background()
+	sc, err := storage.NewClient(ctx, srv.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+
+	w := sc.Bucket("test").Object("big").NewWriter(ctx)
+	w.ChunkSize = 256 << 10
+	w.ContentType = "text/plain"
+	if _, err := w.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.nextID == 0 {
+		t.Error("upload was not resumable")
+	}
+	if got := w.Attrs().Size; got != int64(len(body)) {
+		t.Errorf("Size = %d, want %d", got, len(body))
+	}
+
+	got, err := newClient(t, srv, "test").Get(ctx, "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("Get() returned %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func TestServer_ListDelimiterAndPages(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	ctx := context.Background()
+	c := newClient(t, srv, "test")
+	for _, name := range []string{"a/1", "a/2", "b/1", "c", "d"} {
+		if err := c.Put(ctx, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc, err := storage.NewClient(ctx, srv.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := sc.Bucket("test").Objects(ctx, &storage.Query{Delimiter: "/"})
+	it.PageInfo().MaxSize = 2
+
+	var got []string
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, attrs.Name+attrs.Prefix)
+	}
+	if want := []string{"a/", "b/", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Objects() = %v, want %v", got, want)
+	}
+}
+
+func TestServer_ACL(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	ctx := context.Background()
+	c := newClient(t, srv, "test")
+	if err := c.Put(ctx, "k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MakeObjectPublic(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetACL(ctx, "k", gcs.UserEntity("a@example.com"), gcs.RoleWriter); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := c.ListACL(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := map[gcs.ACLEntity]gcs.ACLRole{}
+	for _, r := range rules {
+		roles[r.Entity] = r.Role
+	}
+	if roles[gcs.AllUsers] != gcs.RoleReader || roles[gcs.UserEntity("a@example.com")] != gcs.RoleWriter {
+		t.Errorf("ListACL() = %v", rules)
+	}
+
+	if err := c.MakeObjectPrivate(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	rules, err = c.ListACL(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rules {
+		if r.Entity == gcs.AllUsers {
+			t.Errorf("allUsers still granted after MakeObjectPrivate: %v", rules)
+		}
+	}
+
+	// The grants are gone now, which is not an error.
+	if err := c.MakeObjectPrivate(ctx, "k"); err != nil {
+		t.Errorf("MakeObjectPrivate() of a private object error = %v", err)
+	}
+	if err := c.MakeObjectPrivate(ctx, "missing"); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Errorf("MakeObjectPrivate() of a missing object error = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+}
+
+func TestServer_Versions(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	admin, err := gcs.NewBucketAdmin("versioned", srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Create(ctx, "project", gcs.BucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.SetVersioning(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t, srv, "versioned")
+	for _, v := range []string{"v1", "v2"} {
+		if err := c.Put(ctx, "k", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := c.ListVersions(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || !versions[0].IsLatest {
+		t.Fatalf("ListVersions() = %+v", versions)
+	}
+
+	if err := c.RestoreVersion(ctx, "k", versions[1].Generation); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "v1" {
+		t.Errorf("Get() after restore = %q, want v1", got)
+	}
+
+	old, err := c.GetVersion(ctx, "k", versions[0].Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(old) != "v2" {
+		t.Errorf("GetVersion() = %q, want v2", old)
+	}
+}
+
+func TestServer_Conditions(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	ctx := context.Background()
+	sc, err := storage.NewClient(ctx, srv.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := sc.Bucket("test").Object("k").If(storage.Conditions{DoesNotExist: true})
+
+	for i, wantErr := range []bool{false, true} {
+		w := o.NewWriter(ctx)
+		w.Write([]byte("v"))
+		err := w.Close()
+		if (err != nil) != wantErr {
+			t.Errorf("write %d: err = %v, want error %v", i, err, wantErr)
+		}
+	}
+
+	r, err := sc.Bucket("test").Object("k").NewReader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if b, _ := ioutil.ReadAll(r); string(b) != "v" {
+		t.Errorf("read %q, want v", b)
+	}
+}
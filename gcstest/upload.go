@@ -0,0 +1,209 @@
+package gcstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	raw "google.golang.org/api/storage/v1"
+)
+
+// serveUpload handles media, multipart and resumable object inserts.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, bucketName string) {
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "The specified bucket does not exist.")
+		return
+	}
+
+	q := r.URL.Query()
+	if id := q.Get("upload_id"); id != "" {
+		s.uploadChunk(w, r, b, id)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid", r.Method+" is not supported")
+		return
+	}
+
+	switch q.Get("uploadType") {
+	case "media":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		attrs := raw.Object{ContentType: r.Header.Get("Content-Type")}
+		s.insertObject(w, b, attrs, q, data)
+	case "multipart":
+		attrs, data, err := readMultipart(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		s.insertObject(w, b, attrs, q, data)
+	case "resumable":
+		s.startResumable(w, r, b)
+	default:
+		writeError(w, http.StatusBadRequest, "invalid", "unsupported uploadType "+q.Get("uploadType"))
+	}
+}
+
+// readMultipart splits a multipart/related body into object metadata and media.
+func readMultipart(r *http.Request) (raw.Object, []byte, error) {
+	var attrs raw.Object
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return attrs, nil, err
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := mr.NextPart()
+	if err != nil {
+		return attrs, nil, err
+	}
+	if err := json.NewDecoder(part).Decode(&attrs); err != nil {
+		return attrs, nil, err
+	}
+
+	part, err = mr.NextPart()
+	if err != nil {
+		return attrs, nil, err
+	}
+	data, err := ioutil.ReadAll(part)
+	if err != nil {
+		return attrs, nil, err
+	}
+	if attrs.ContentType == "" {
+		attrs.ContentType = part.Header.Get("Content-Type")
+	}
+	return attrs, data, nil
+}
+
+func (s *Server) insertObject(w http.ResponseWriter, b *bucket, attrs raw.Object, q url.Values, data []byte) {
+	if name := q.Get("name"); name != "" {
+		attrs.Name = name
+	}
+	if attrs.Name == "" {
+		writeError(w, http.StatusBadRequest, "required", "Required")
+		return
+	}
+	if !checkConditions(w, q, b.live(attrs.Name)) {
+		return
+	}
+
+	if acl := predefinedACL(q.Get("predefinedAcl")); acl != nil {
+		attrs.Acl = acl
+	} else if attrs.Acl == nil {
+		attrs.Acl = copyACL(b.attrs.DefaultObjectAcl)
+	}
+
+	o := s.newObject(b.attrs.Name, attrs, data)
+	b.put(o)
+	writeJSON(w, http.StatusOK, o.attrs)
+}
+
+func (s *Server) startResumable(w http.ResponseWriter, r *http.Request, b *bucket) {
+	var attrs raw.Object
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+	}
+	if attrs.ContentType == "" {
+		attrs.ContentType = r.Header.Get("X-Upload-Content-Type")
+	}
+
+	id := s.newUploadID()
+	s.uploads[id] = &upload{bucket: b.attrs.Name, attrs: attrs, query: r.URL.Query()}
+
+	loc := *r.URL
+	loc.Scheme, loc.Host = "https", r.Host
+	q := loc.Query()
+	q.Set("upload_id", id)
+	loc.RawQuery = q.Encode()
+	w.Header().Set("Location", loc.String())
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadChunk appends a chunk to a resumable upload, creating the object
+// once the final chunk arrives.
+func (s *Server) uploadChunk(w http.ResponseWriter, r *http.Request, b *bucket, id string) {
+	u, ok := s.uploads[id]
+	if !ok || u.bucket != b.attrs.Name {
+		writeError(w, http.StatusNotFound, "notFound", "No such upload: "+id)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		delete(s.uploads, id)
+		w.WriteHeader(499)
+		return
+	}
+
+	start, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if start >= 0 {
+		if start > int64(len(u.data)) {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("chunk starts at %d, have %d bytes", start, len(u.data)))
+			return
+		}
+		// Bytes already received are resent after a retry; keep the newer copy.
+		u.data = append(u.data[:start], data...)
+	}
+
+	if total < 0 || int64(len(u.data)) < total {
+		if len(u.data) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(u.data)-1))
+		}
+		if r.Header.Get("X-Guploader-No-308") == "yes" {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+
+	delete(s.uploads, id)
+	s.insertObject(w, b, u.attrs, u.query, u.data)
+}
+
+// parseContentRange parses "bytes start-end/total", "bytes start-end/*" and
+// "bytes */total". It returns -1 for an absent start or unknown total.
+func parseContentRange(v string) (int64, int64, error) {
+	spec := strings.TrimPrefix(v, "bytes ")
+	parts := strings.SplitN(spec, "/", 2)
+	if spec == v || len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+
+	start, total := int64(-1), int64(-1)
+	var err error
+	if parts[0] != "*" {
+		rng := strings.SplitN(parts[0], "-", 2)
+		if start, err = strconv.ParseInt(rng[0], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+		}
+	}
+	if parts[1] != "*" {
+		if total, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+		}
+	}
+	return start, total, nil
+}
@@ -10,6 +10,9 @@ require (
 	github.com/golang/mock v1.4.3
 	github.com/google/go-github v17.0.0+incompatible
 	github.com/google/uuid v1.1.2
+	github.com/prometheus/client_golang v1.7.1
+	go.opentelemetry.io/otel v0.13.0
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	google.golang.org/api v0.28.0
+	google.golang.org/protobuf v1.24.0
 )
@@ -0,0 +1,185 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+type gcsBucketAdmin struct {
+	next   gcs.BucketAdmin
+	bucket string
+	g      *guard
+}
+
+// GCSBucket returns a gcs.BucketAdmin that passes reads to b and guards
+// every call that would create, delete or reconfigure bucket.
+func GCSBucket(b gcs.BucketAdmin, bucket string, opts Options) gcs.BucketAdmin {
+	return &gcsBucketAdmin{next: b, bucket: bucket, g: newGuard(opts)}
+}
+
+func (b *gcsBucketAdmin) Create(ctx context.Context, projectID string, attrs gcs.BucketOptions) error {
+	return b.g.block("Create", fmt.Sprintf("%s project=%s", b.bucket, projectID))
+}
+
+func (b *gcsBucketAdmin) Delete(ctx context.Context) error {
+	return b.g.block("Delete", b.bucket)
+}
+
+func (b *gcsBucketAdmin) Lifecycle(ctx context.Context) ([]gcs.LifecycleRule, error) {
+	return b.next.Lifecycle(ctx)
+}
+
+func (b *gcsBucketAdmin) SetLifecycle(ctx context.Context, rules []gcs.LifecycleRule) error {
+	return b.g.block("SetLifecycle", fmt.Sprintf("%s (%d rules)", b.bucket, len(rules)))
+}
+
+func (b *gcsBucketAdmin) CORS(ctx context.Context) ([]gcs.CORSRule, error) {
+	return b.next.CORS(ctx)
+}
+
+func (b *gcsBucketAdmin) SetCORS(ctx context.Context, rules []gcs.CORSRule) error {
+	return b.g.block("SetCORS", fmt.Sprintf("%s (%d rules)", b.bucket, len(rules)))
+}
+
+func (b *gcsBucketAdmin) SetDefaultObjectACL(ctx context.Context, predefinedACL string) error {
+	return b.g.block("SetDefaultObjectACL", fmt.Sprintf("%s %s", b.bucket, predefinedACL))
+}
+
+func (b *gcsBucketAdmin) Versioning(ctx context.Context) (bool, error) {
+	return b.next.Versioning(ctx)
+}
+
+func (b *gcsBucketAdmin) SetVersioning(ctx context.Context, enabled bool) error {
+	return b.g.block("SetVersioning", fmt.Sprintf("%s enabled=%t", b.bucket, enabled))
+}
+
+type s3BucketClient struct {
+	next s3.BucketClient
+	g    *guard
+}
+
+// S3Bucket returns an s3.BucketClient that passes reads to c and guards
+// every call that would create, delete or reconfigure a bucket. Pass it to
+// s3.NewBucketAdmin to guard a BucketAdmin.
+func S3Bucket(c s3.BucketClient, opts Options) s3.BucketClient {
+	return &s3BucketClient{next: c, g: newGuard(opts)}
+}
+
+func (c *s3BucketClient) CreateBucket(input *awss3.CreateBucketInput) (*awss3.CreateBucketOutput, error) {
+	if err := c.g.block("CreateBucket", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.CreateBucketOutput{}, nil
+}
+
+func (c *s3BucketClient) CreateBucketWithContext(ctx aws.Context, input *awss3.CreateBucketInput, opts ...request.Option) (*awss3.CreateBucketOutput, error) {
+	return c.CreateBucket(input)
+}
+
+func (c *s3BucketClient) DeleteBucket(input *awss3.DeleteBucketInput) (*awss3.DeleteBucketOutput, error) {
+	if err := c.g.block("DeleteBucket", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.DeleteBucketOutput{}, nil
+}
+
+func (c *s3BucketClient) DeleteBucketWithContext(ctx aws.Context, input *awss3.DeleteBucketInput, opts ...request.Option) (*awss3.DeleteBucketOutput, error) {
+	return c.DeleteBucket(input)
+}
+
+func (c *s3BucketClient) GetBucketLifecycleConfiguration(input *awss3.GetBucketLifecycleConfigurationInput) (*awss3.GetBucketLifecycleConfigurationOutput, error) {
+	return c.next.GetBucketLifecycleConfiguration(input)
+}
+
+func (c *s3BucketClient) GetBucketLifecycleConfigurationWithContext(ctx aws.Context, input *awss3.GetBucketLifecycleConfigurationInput, opts ...request.Option) (*awss3.GetBucketLifecycleConfigurationOutput, error) {
+	return c.next.GetBucketLifecycleConfigurationWithContext(ctx, input, opts...)
+}
+
+func (c *s3BucketClient) PutBucketLifecycleConfiguration(input *awss3.PutBucketLifecycleConfigurationInput) (*awss3.PutBucketLifecycleConfigurationOutput, error) {
+	if err := c.g.block("PutBucketLifecycleConfiguration", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (c *s3BucketClient) PutBucketLifecycleConfigurationWithContext(ctx aws.Context, input *awss3.PutBucketLifecycleConfigurationInput, opts ...request.Option) (*awss3.PutBucketLifecycleConfigurationOutput, error) {
+	return c.PutBucketLifecycleConfiguration(input)
+}
+
+func (c *s3BucketClient) DeleteBucketLifecycle(input *awss3.DeleteBucketLifecycleInput) (*awss3.DeleteBucketLifecycleOutput, error) {
+	if err := c.g.block("DeleteBucketLifecycle", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.DeleteBucketLifecycleOutput{}, nil
+}
+
+func (c *s3BucketClient) DeleteBucketLifecycleWithContext(ctx aws.Context, input *awss3.DeleteBucketLifecycleInput, opts ...request.Option) (*awss3.DeleteBucketLifecycleOutput, error) {
+	return c.DeleteBucketLifecycle(input)
+}
+
+func (c *s3BucketClient) GetBucketCors(input *awss3.GetBucketCorsInput) (*awss3.GetBucketCorsOutput, error) {
+	return c.next.GetBucketCors(input)
+}
+
+func (c *s3BucketClient) GetBucketCorsWithContext(ctx aws.Context, input *awss3.GetBucketCorsInput, opts ...request.Option) (*awss3.GetBucketCorsOutput, error) {
+	return c.next.GetBucketCorsWithContext(ctx, input, opts...)
+}
+
+func (c *s3BucketClient) PutBucketCors(input *awss3.PutBucketCorsInput) (*awss3.PutBucketCorsOutput, error) {
+	if err := c.g.block("PutBucketCors", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.PutBucketCorsOutput{}, nil
+}
+
+func (c *s3BucketClient) PutBucketCorsWithContext(ctx aws.Context, input *awss3.PutBucketCorsInput, opts ...request.Option) (*awss3.PutBucketCorsOutput, error) {
+	return c.PutBucketCors(input)
+}
+
+func (c *s3BucketClient) DeleteBucketCors(input *awss3.DeleteBucketCorsInput) (*awss3.DeleteBucketCorsOutput, error) {
+	if err := c.g.block("DeleteBucketCors", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.DeleteBucketCorsOutput{}, nil
+}
+
+func (c *s3BucketClient) DeleteBucketCorsWithContext(ctx aws.Context, input *awss3.DeleteBucketCorsInput, opts ...request.Option) (*awss3.DeleteBucketCorsOutput, error) {
+	return c.DeleteBucketCors(input)
+}
+
+func (c *s3BucketClient) PutBucketAcl(input *awss3.PutBucketAclInput) (*awss3.PutBucketAclOutput, error) {
+	if err := c.g.block("PutBucketAcl", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.PutBucketAclOutput{}, nil
+}
+
+func (c *s3BucketClient) PutBucketAclWithContext(ctx aws.Context, input *awss3.PutBucketAclInput, opts ...request.Option) (*awss3.PutBucketAclOutput, error) {
+	return c.PutBucketAcl(input)
+}
+
+func (c *s3BucketClient) GetBucketVersioning(input *awss3.GetBucketVersioningInput) (*awss3.GetBucketVersioningOutput, error) {
+	return c.next.GetBucketVersioning(input)
+}
+
+func (c *s3BucketClient) GetBucketVersioningWithContext(ctx aws.Context, input *awss3.GetBucketVersioningInput, opts ...request.Option) (*awss3.GetBucketVersioningOutput, error) {
+	return c.next.GetBucketVersioningWithContext(ctx, input, opts...)
+}
+
+func (c *s3BucketClient) PutBucketVersioning(input *awss3.PutBucketVersioningInput) (*awss3.PutBucketVersioningOutput, error) {
+	if err := c.g.block("PutBucketVersioning", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return &awss3.PutBucketVersioningOutput{}, nil
+}
+
+func (c *s3BucketClient) PutBucketVersioningWithContext(ctx aws.Context, input *awss3.PutBucketVersioningInput, opts ...request.Option) (*awss3.PutBucketVersioningOutput, error) {
+	return c.PutBucketVersioning(input)
+}
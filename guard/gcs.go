@@ -0,0 +1,167 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hayashiki/go-pkg/gcs"
+)
+
+type gcsClient struct {
+	next gcs.Client
+	g    *guard
+}
+
+// GCS returns a gcs.Client that passes reads to c and guards every call
+// that would change an object, its metadata or its ACL.
+func GCS(c gcs.Client, opts Options) gcs.Client {
+	return &gcsClient{next: c, g: newGuard(opts)}
+}
+
+func (c *gcsClient) Put(ctx context.Context, objName string, data []byte) error {
+	return c.g.block("Put", objName)
+}
+
+func (c *gcsClient) PutWithOptions(ctx context.Context, objName string, data []byte, opts gcs.PutOptions) error {
+	return c.g.block("PutWithOptions", objName)
+}
+
+func (c *gcsClient) UpdateMetadata(ctx context.Context, objName string, opts gcs.PutOptions) error {
+	return c.g.block("UpdateMetadata", objName)
+}
+
+func (c *gcsClient) Attrs(ctx context.Context, objName string) (*gcs.ObjectAttrs, error) {
+	return c.next.Attrs(ctx, objName)
+}
+
+func (c *gcsClient) Get(ctx context.Context, objName string) ([]byte, error) {
+	return c.next.Get(ctx, objName)
+}
+
+func (c *gcsClient) NewReader(ctx context.Context, objName string) (io.ReadCloser, error) {
+	return c.next.NewReader(ctx, objName)
+}
+
+func (c *gcsClient) NewRangeReader(ctx context.Context, objName string, offset, length int64) (io.ReadCloser, error) {
+	return c.next.NewRangeReader(ctx, objName, offset, length)
+}
+
+func (c *gcsClient) DownloadToFile(ctx context.Context, objName, path string, opts gcs.DownloadOptions) error {
+	return c.next.DownloadToFile(ctx, objName, path, opts)
+}
+
+func (c *gcsClient) NewVersionRangeReader(ctx context.Context, objName string, generation, offset, length int64) (io.ReadCloser, error) {
+	return c.next.NewVersionRangeReader(ctx, objName, generation, offset, length)
+}
+
+// NewWriter returns a writer that fails in ReadOnly mode and discards the
+// data in DryRun mode, logging the write when it is closed.
+func (c *gcsClient) NewWriter(ctx context.Context, objName string, opts gcs.PutOptions) io.WriteCloser {
+	if c.g.mode != DryRun {
+		return &deniedWriter{g: c.g, objName: objName}
+	}
+	return &discardWriter{g: c.g, objName: objName}
+}
+
+// deniedWriter fails every call with ErrReadOnly, logging the write once.
+type deniedWriter struct {
+	g       *guard
+	objName string
+	logged  bool
+}
+
+func (w *deniedWriter) Write([]byte) (int, error) { return 0, w.deny() }
+func (w *deniedWriter) Close() error              { return w.deny() }
+
+func (w *deniedWriter) deny() error {
+	if w.logged {
+		return ErrReadOnly
+	}
+	w.logged = true
+	return w.g.block("NewWriter", w.objName)
+}
+
+// discardWriter counts and drops the data written to it.
+type discardWriter struct {
+	g       *guard
+	objName string
+	n       int64
+}
+
+func (w *discardWriter) Write(p []byte) (int, error) {
+	n, err := ioutil.Discard.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *discardWriter) Close() error {
+	return w.g.block("NewWriter", fmt.Sprintf("%s (%d bytes)", w.objName, w.n))
+}
+
+func (c *gcsClient) List(ctx context.Context, filePrefix string) ([]string, error) {
+	return c.next.List(ctx, filePrefix)
+}
+
+func (c *gcsClient) Delete(ctx context.Context, objName string) error {
+	return c.g.block("Delete", objName)
+}
+
+func (c *gcsClient) DeleteMany(ctx context.Context, objNames []string) error {
+	return c.g.block("DeleteMany", strings.Join(objNames, " "))
+}
+
+// DeletePrefix lists the objects it would delete, so a dry run shows them.
+func (c *gcsClient) DeletePrefix(ctx context.Context, prefix string) error {
+	names, err := c.next.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	return c.g.block("DeletePrefix", strings.Join(names, " "))
+}
+
+func (c *gcsClient) ListVersions(ctx context.Context, objName string) ([]gcs.Version, error) {
+	return c.next.ListVersions(ctx, objName)
+}
+
+func (c *gcsClient) GetVersion(ctx context.Context, objName string, generation int64) ([]byte, error) {
+	return c.next.GetVersion(ctx, objName, generation)
+}
+
+func (c *gcsClient) DeleteVersion(ctx context.Context, objName string, generation int64) error {
+	return c.g.block("DeleteVersion", fmt.Sprintf("%s#%d", objName, generation))
+}
+
+func (c *gcsClient) RestoreVersion(ctx context.Context, objName string, generation int64) error {
+	return c.g.block("RestoreVersion", fmt.Sprintf("%s#%d", objName, generation))
+}
+
+func (c *gcsClient) Copy(ctx context.Context, src string, generation int64, dst string, opts gcs.PutOptions) error {
+	return c.g.block("Copy", fmt.Sprintf("%s#%d -> %s", src, generation, dst))
+}
+
+func (c *gcsClient) MakeObjectPublic(ctx context.Context, objName string) error {
+	return c.g.block("MakeObjectPublic", objName)
+}
+
+func (c *gcsClient) MakeObjectPrivate(ctx context.Context, objName string) error {
+	return c.g.block("MakeObjectPrivate", objName)
+}
+
+func (c *gcsClient) SetACL(ctx context.Context, objName string, entity gcs.ACLEntity, role gcs.ACLRole) error {
+	return c.g.block("SetACL", fmt.Sprintf("%s %s=%s", objName, entity, role))
+}
+
+func (c *gcsClient) DeleteACL(ctx context.Context, objName string, entity gcs.ACLEntity) error {
+	return c.g.block("DeleteACL", fmt.Sprintf("%s %s", objName, entity))
+}
+
+func (c *gcsClient) ListACL(ctx context.Context, objName string) ([]gcs.ACLRule, error) {
+	return c.next.ListACL(ctx, objName)
+}
+
+func (c *gcsClient) URL(objName string) string {
+	return c.next.URL(objName)
+}
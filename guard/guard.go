@@ -0,0 +1,65 @@
+// Package guard decorates storage clients so that mutating calls are
+// rejected (ReadOnly) or only logged (DryRun), while reads pass through.
+// It makes maintenance scripts safe to rehearse against production buckets.
+//
+//	c = guard.GCS(c, guard.Options{Mode: guard.DryRun})
+//	i := s3.New(guard.S3(s3.NewS3Client(opt), guard.Options{Mode: guard.ReadOnly}), opt)
+//	b := s3.NewBucketAdmin(guard.S3Bucket(s3.NewS3Client(opt), guard.Options{}), opt.Bucket)
+package guard
+
+import (
+	"errors"
+	"log"
+)
+
+// Mode selects what happens to a mutating call.
+type Mode int
+
+const (
+	// ReadOnly fails every mutating call with ErrReadOnly.
+	ReadOnly Mode = iota
+	// DryRun logs every mutating call and reports success without making it.
+	DryRun
+)
+
+func (m Mode) String() string {
+	if m == DryRun {
+		return "dry-run"
+	}
+	return "read-only"
+}
+
+// ErrReadOnly is returned for a mutating call in ReadOnly mode.
+var ErrReadOnly = errors.New("guard: storage is read-only")
+
+// Options configures the decorators.
+type Options struct {
+	// Mode defaults to ReadOnly, the safer of the two.
+	Mode Mode
+	// Logf receives one line per blocked or skipped call. Defaults to log.Printf.
+	Logf func(format string, args ...interface{})
+}
+
+// guard applies the mode of Options to a mutating call.
+type guard struct {
+	mode Mode
+	logf func(format string, args ...interface{})
+}
+
+func newGuard(opts Options) *guard {
+	g := &guard{mode: opts.Mode, logf: opts.Logf}
+	if g.logf == nil {
+		g.logf = log.Printf
+	}
+	return g
+}
+
+// block logs the mutating call method on key and returns the error it
+// fails with, which is nil in DryRun mode.
+func (g *guard) block(method, key string) error {
+	g.logf("guard: %s: skipped %s %s", g.mode, method, key)
+	if g.mode == DryRun {
+		return nil
+	}
+	return ErrReadOnly
+}
@@ -0,0 +1,236 @@
+package guard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/s3test"
+)
+
+type logs []string
+
+func (l *logs) logf(format string, args ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, args...))
+}
+
+func TestGCS(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []Mode{ReadOnly, DryRun} {
+		t.Run(mode.String(), func(t *testing.T) {
+			f := fake.New("test")
+			if err := f.Put(ctx, "a", []byte("a")); err != nil {
+				t.Fatal(err)
+			}
+			setup := len(f.Calls())
+			var l logs
+			c := GCS(f, Options{Mode: mode, Logf: l.logf})
+
+			want := error(nil)
+			if mode == ReadOnly {
+				want = ErrReadOnly
+			}
+			calls := map[string]func() error{
+				"Put":              func() error { return c.Put(ctx, "a", []byte("b")) },
+				"PutWithOptions":   func() error { return c.PutWithOptions(ctx, "b", []byte("b"), gcs.PutOptions{}) },
+				"UpdateMetadata":   func() error { return c.UpdateMetadata(ctx, "a", gcs.PutOptions{ContentType: "text/plain"}) },
+				"Delete":           func() error { return c.Delete(ctx, "a") },
+				"DeleteMany":       func() error { return c.DeleteMany(ctx, []string{"a"}) },
+				"DeletePrefix":     func() error { return c.DeletePrefix(ctx, "a") },
+				"MakeObjectPublic": func() error { return c.MakeObjectPublic(ctx, "a") },
+				"SetACL":           func() error { return c.SetACL(ctx, "a", gcs.AllUsers, gcs.RoleReader) },
+				"NewWriter": func() error {
+					w := c.NewWriter(ctx, "a", gcs.PutOptions{})
+					if _, err := w.Write([]byte("b")); err != nil {
+						w.Close()
+						return err
+					}
+					return w.Close()
+				},
+			}
+			for name, call := range calls {
+				if err := call(); err != want {
+					t.Errorf("%s() error = %v, want %v", name, err, want)
+				}
+			}
+			if len(l) != len(calls) {
+				t.Errorf("logged %d lines, want %d: %q", len(l), len(calls), l)
+			}
+
+			if got := f.Objects(); !reflect.DeepEqual(got, []string{"a"}) {
+				t.Errorf("objects = %v, want [a]", got)
+			}
+			if data, err := c.Get(ctx, "a"); err != nil || string(data) != "a" {
+				t.Errorf("Get() = %q, %v, want %q", data, err, "a")
+			}
+			for _, call := range f.Calls()[setup:] {
+				if _, ok := calls[call.Method]; ok {
+					t.Errorf("%s reached the wrapped client", call.Method)
+				}
+			}
+		})
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+	opt := srv.Options("test")
+	if err := s3.New(s3.NewS3Client(opt), opt).Upload(strings.NewReader("a"), "a", s3.Private, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []Mode{ReadOnly, DryRun} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var l logs
+			i := s3.New(S3(s3.NewS3Client(opt), Options{Mode: mode, Logf: l.logf}), opt)
+
+			calls := map[string]func() error{
+				"Upload":         func() error { return i.Upload(bytes.NewReader([]byte("b")), "b", s3.Private, "text/plain") },
+				"Remove":         func() error { return i.Remove("a") },
+				"DeletePrefix":   func() error { return i.DeletePrefix("a") },
+				"UpdateMetadata": func() error { return i.UpdateMetadata("a", s3.UploadOptions{ContentType: "text/html"}) },
+				"SetACL":         func() error { return i.SetACL("a", s3.Public) },
+			}
+			for name, call := range calls {
+				err := call()
+				if derrs, ok := err.(s3.DeleteErrors); ok {
+					err = derrs["a"]
+				}
+				if mode == ReadOnly && !errors.Is(err, ErrReadOnly) {
+					t.Errorf("%s() error = %v, want %v", name, err, ErrReadOnly)
+				}
+				if mode == DryRun && err != nil {
+					t.Errorf("%s() error = %v", name, err)
+				}
+			}
+			// In dry-run mode UpdateMetadata also puts the ACL back after its copy.
+			want := len(calls)
+			if mode == DryRun {
+				want++
+			}
+			if len(l) != want {
+				t.Errorf("logged %d lines, want %d: %q", len(l), want, l)
+			}
+
+			if got := srv.Keys("test"); !reflect.DeepEqual(got, []string{"a"}) {
+				t.Errorf("keys = %v, want [a]", got)
+			}
+			attrs, err := i.Stat("a")
+			if err != nil || attrs.ContentType != "text/plain" {
+				t.Errorf("Stat() = %+v, %v, want text/plain", attrs, err)
+			}
+			body, _, err := i.Download("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+			if data, _ := ioutil.ReadAll(body); string(data) != "a" {
+				t.Errorf("Download() = %q, want %q", data, "a")
+			}
+			if u, err := i.SignedURL("a", time.Minute); err != nil || !strings.Contains(u, "/a?") {
+				t.Errorf("SignedURL() = %q, %v", u, err)
+			}
+		})
+	}
+}
+
+// recordingAdmin records the methods called on it.
+type recordingAdmin struct {
+	gcs.BucketAdmin
+	calls []string
+}
+
+func (b *recordingAdmin) Versioning(ctx context.Context) (bool, error) {
+	b.calls = append(b.calls, "Versioning")
+	return true, nil
+}
+
+func TestGCSBucket(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []Mode{ReadOnly, DryRun} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var l logs
+			next := &recordingAdmin{}
+			b := GCSBucket(next, "test", Options{Mode: mode, Logf: l.logf})
+
+			want := error(nil)
+			if mode == ReadOnly {
+				want = ErrReadOnly
+			}
+			calls := map[string]func() error{
+				"Create":              func() error { return b.Create(ctx, "project", gcs.BucketOptions{}) },
+				"Delete":              func() error { return b.Delete(ctx) },
+				"SetLifecycle":        func() error { return b.SetLifecycle(ctx, []gcs.LifecycleRule{{AgeInDays: 1}}) },
+				"SetCORS":             func() error { return b.SetCORS(ctx, nil) },
+				"SetDefaultObjectACL": func() error { return b.SetDefaultObjectACL(ctx, "publicRead") },
+				"SetVersioning":       func() error { return b.SetVersioning(ctx, false) },
+			}
+			for name, call := range calls {
+				if err := call(); err != want {
+					t.Errorf("%s() error = %v, want %v", name, err, want)
+				}
+			}
+			if len(l) != len(calls) {
+				t.Errorf("logged %d lines, want %d: %q", len(l), len(calls), l)
+			}
+
+			if on, err := b.Versioning(ctx); err != nil || !on {
+				t.Errorf("Versioning() = %v, %v, want true", on, err)
+			}
+			if !reflect.DeepEqual(next.calls, []string{"Versioning"}) {
+				t.Errorf("wrapped admin calls = %v, want [Versioning]", next.calls)
+			}
+		})
+	}
+}
+
+func TestS3Bucket(t *testing.T) {
+	for _, mode := range []Mode{ReadOnly, DryRun} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var l logs
+			m := &s3.S3mock{VersioningStatus: "Enabled"}
+			b := s3.NewBucketAdmin(S3Bucket(m, Options{Mode: mode, Logf: l.logf}), "test")
+
+			calls := map[string]func() error{
+				"Create":         func() error { return b.Create("") },
+				"Delete":         func() error { return b.Delete() },
+				"SetLifecycle":   func() error { return b.SetLifecycle([]s3.LifecycleRule{{ID: "a", Days: 1}}) },
+				"SetCORS":        func() error { return b.SetCORS([]s3.CORSRule{{AllowedOrigins: []string{"*"}}}) },
+				"ClearLifecycle": func() error { return b.SetLifecycle(nil) },
+				"ClearCORS":      func() error { return b.SetCORS(nil) },
+				"SetACL":         func() error { return b.SetACL(s3.Public) },
+				"SetVersioning":  func() error { return b.SetVersioning(false) },
+			}
+			for name, call := range calls {
+				err := call()
+				if mode == ReadOnly && !errors.Is(err, ErrReadOnly) {
+					t.Errorf("%s() error = %v, want %v", name, err, ErrReadOnly)
+				}
+				if mode == DryRun && err != nil {
+					t.Errorf("%s() error = %v", name, err)
+				}
+			}
+			if len(l) != len(calls) {
+				t.Errorf("logged %d lines, want %d: %q", len(l), len(calls), l)
+			}
+
+			if on, err := b.Versioning(); err != nil || !on {
+				t.Errorf("Versioning() = %v, %v, want the mock left enabled", on, err)
+			}
+			if m.LifecycleRules != nil || m.CORSRules != nil {
+				t.Errorf("rules reached the wrapped client: %v, %v", m.LifecycleRules, m.CORSRules)
+			}
+		})
+	}
+}
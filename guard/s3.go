@@ -0,0 +1,162 @@
+package guard
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+type s3Client struct {
+	next s3.Client
+	g    *guard
+}
+
+// S3 returns an s3.Client that passes reads to c and guards every call that
+// would change an object, its metadata or its ACL. Pass it to s3.New to
+// guard an Interactor. Its methods wrap ErrReadOnly in the errors they
+// return; bulk deletes report it per key in s3.DeleteErrors.
+func S3(c s3.Client, opts Options) s3.Client {
+	return &s3Client{next: c, g: newGuard(opts)}
+}
+
+func (c *s3Client) block(method string, bucket, key *string) error {
+	return c.g.block(method, aws.StringValue(bucket)+"/"+aws.StringValue(key))
+}
+
+func (c *s3Client) PutObject(input *awss3.PutObjectInput) (*awss3.PutObjectOutput, error) {
+	if err := c.block("PutObject", input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return &awss3.PutObjectOutput{}, nil
+}
+
+func (c *s3Client) PutObjectWithContext(ctx aws.Context, input *awss3.PutObjectInput, opts ...request.Option) (*awss3.PutObjectOutput, error) {
+	return c.PutObject(input)
+}
+
+func (c *s3Client) GetObject(input *awss3.GetObjectInput) (*awss3.GetObjectOutput, error) {
+	return c.next.GetObject(input)
+}
+
+// GetObjectRequest forwards to the wrapped client so that SignedURL keeps
+// working. A presigned URL only reads the object.
+func (c *s3Client) GetObjectRequest(input *awss3.GetObjectInput) (*request.Request, *awss3.GetObjectOutput) {
+	return s3.GetObjectRequest(c.next, input)
+}
+
+func (c *s3Client) GetObjectWithContext(ctx aws.Context, input *awss3.GetObjectInput, opts ...request.Option) (*awss3.GetObjectOutput, error) {
+	return c.next.GetObjectWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) DeleteObject(input *awss3.DeleteObjectInput) (*awss3.DeleteObjectOutput, error) {
+	if err := c.block("DeleteObject", input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return &awss3.DeleteObjectOutput{}, nil
+}
+
+func (c *s3Client) DeleteObjectWithContext(ctx aws.Context, input *awss3.DeleteObjectInput, opts ...request.Option) (*awss3.DeleteObjectOutput, error) {
+	return c.DeleteObject(input)
+}
+
+func (c *s3Client) DeleteObjects(input *awss3.DeleteObjectsInput) (*awss3.DeleteObjectsOutput, error) {
+	var keys []string
+	if input.Delete != nil {
+		for _, obj := range input.Delete.Objects {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+	}
+	if err := c.block("DeleteObjects", input.Bucket, aws.String(strings.Join(keys, " "))); err != nil {
+		return nil, err
+	}
+	return &awss3.DeleteObjectsOutput{}, nil
+}
+
+func (c *s3Client) DeleteObjectsWithContext(ctx aws.Context, input *awss3.DeleteObjectsInput, opts ...request.Option) (*awss3.DeleteObjectsOutput, error) {
+	return c.DeleteObjects(input)
+}
+
+func (c *s3Client) ListObjectsV2(input *awss3.ListObjectsV2Input) (*awss3.ListObjectsV2Output, error) {
+	return c.next.ListObjectsV2(input)
+}
+
+func (c *s3Client) ListObjectsV2WithContext(ctx aws.Context, input *awss3.ListObjectsV2Input, opts ...request.Option) (*awss3.ListObjectsV2Output, error) {
+	return c.next.ListObjectsV2WithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) ListObjectVersions(input *awss3.ListObjectVersionsInput) (*awss3.ListObjectVersionsOutput, error) {
+	return c.next.ListObjectVersions(input)
+}
+
+func (c *s3Client) ListObjectVersionsWithContext(ctx aws.Context, input *awss3.ListObjectVersionsInput, opts ...request.Option) (*awss3.ListObjectVersionsOutput, error) {
+	return c.next.ListObjectVersionsWithContext(ctx, input, opts...)
+}
+
+// CopyObject is guarded as a write to its destination; UpdateMetadata and
+// RestoreVersion are implemented with it.
+func (c *s3Client) CopyObject(input *awss3.CopyObjectInput) (*awss3.CopyObjectOutput, error) {
+	if err := c.block("CopyObject", input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return &awss3.CopyObjectOutput{}, nil
+}
+
+func (c *s3Client) CopyObjectWithContext(ctx aws.Context, input *awss3.CopyObjectInput, opts ...request.Option) (*awss3.CopyObjectOutput, error) {
+	return c.CopyObject(input)
+}
+
+func (c *s3Client) HeadObject(input *awss3.HeadObjectInput) (*awss3.HeadObjectOutput, error) {
+	return c.next.HeadObject(input)
+}
+
+func (c *s3Client) HeadObjectWithContext(ctx aws.Context, input *awss3.HeadObjectInput, opts ...request.Option) (*awss3.HeadObjectOutput, error) {
+	return c.next.HeadObjectWithContext(ctx, input, opts...)
+}
+
+func (c *s3Client) PutObjectAcl(input *awss3.PutObjectAclInput) (*awss3.PutObjectAclOutput, error) {
+	if err := c.block("PutObjectAcl", input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return &awss3.PutObjectAclOutput{}, nil
+}
+
+func (c *s3Client) PutObjectAclWithContext(ctx aws.Context, input *awss3.PutObjectAclInput, opts ...request.Option) (*awss3.PutObjectAclOutput, error) {
+	return c.PutObjectAcl(input)
+}
+
+func (c *s3Client) GetObjectAcl(input *awss3.GetObjectAclInput) (*awss3.GetObjectAclOutput, error) {
+	return c.next.GetObjectAcl(input)
+}
+
+func (c *s3Client) GetObjectAclWithContext(ctx aws.Context, input *awss3.GetObjectAclInput, opts ...request.Option) (*awss3.GetObjectAclOutput, error) {
+	return c.next.GetObjectAclWithContext(ctx, input, opts...)
+}
+
+// CreateMultipartUploadWithContext guards a streamed upload once, up front.
+// The parts of the upload it pretends to start never reach the client.
+func (c *s3Client) CreateMultipartUploadWithContext(ctx aws.Context, input *awss3.CreateMultipartUploadInput, opts ...request.Option) (*awss3.CreateMultipartUploadOutput, error) {
+	if err := c.block("CreateMultipartUpload", input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return &awss3.CreateMultipartUploadOutput{UploadId: aws.String("guard")}, nil
+}
+
+func (c *s3Client) UploadPartWithContext(ctx aws.Context, input *awss3.UploadPartInput, opts ...request.Option) (*awss3.UploadPartOutput, error) {
+	return &awss3.UploadPartOutput{}, nil
+}
+
+func (c *s3Client) UploadPartCopyWithContext(ctx aws.Context, input *awss3.UploadPartCopyInput, opts ...request.Option) (*awss3.UploadPartCopyOutput, error) {
+	return &awss3.UploadPartCopyOutput{CopyPartResult: &awss3.CopyPartResult{}}, nil
+}
+
+func (c *s3Client) CompleteMultipartUploadWithContext(ctx aws.Context, input *awss3.CompleteMultipartUploadInput, opts ...request.Option) (*awss3.CompleteMultipartUploadOutput, error) {
+	return &awss3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c *s3Client) AbortMultipartUploadWithContext(ctx aws.Context, input *awss3.AbortMultipartUploadInput, opts ...request.Option) (*awss3.AbortMultipartUploadOutput, error) {
+	return &awss3.AbortMultipartUploadOutput{}, nil
+}
@@ -0,0 +1,226 @@
+package instrument
+
+import (
+	"context"
+	"io"
+
+	"github.com/hayashiki/go-pkg/gcs"
+)
+
+type gcsClient struct {
+	next   gcs.Client
+	bucket string
+	rec    recorder
+}
+
+// GCS returns a gcs.Client that measures every call to c, whose objects live in bucket.
+// Readers and writers are measured until they are closed.
+func GCS(c gcs.Client, bucket string, opts Options) gcs.Client {
+	return &gcsClient{next: c, bucket: bucket, rec: newRecorder("gcs", opts)}
+}
+
+func (c *gcsClient) start(ctx context.Context, method, objName string) (context.Context, func(int64, error)) {
+	return c.rec.start(ctx, c.bucket, method, objName)
+}
+
+func (c *gcsClient) Put(ctx context.Context, objName string, data []byte) error {
+	ctx, done := c.start(ctx, "Put", objName)
+	err := c.next.Put(ctx, objName, data)
+	done(int64(len(data)), err)
+	return err
+}
+
+func (c *gcsClient) PutWithOptions(ctx context.Context, objName string, data []byte, opts gcs.PutOptions) error {
+	ctx, done := c.start(ctx, "PutWithOptions", objName)
+	err := c.next.PutWithOptions(ctx, objName, data, opts)
+	done(int64(len(data)), err)
+	return err
+}
+
+func (c *gcsClient) UpdateMetadata(ctx context.Context, objName string, opts gcs.PutOptions) error {
+	ctx, done := c.start(ctx, "UpdateMetadata", objName)
+	err := c.next.UpdateMetadata(ctx, objName, opts)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) Attrs(ctx context.Context, objName string) (*gcs.ObjectAttrs, error) {
+	ctx, done := c.start(ctx, "Attrs", objName)
+	attrs, err := c.next.Attrs(ctx, objName)
+	done(0, err)
+	return attrs, err
+}
+
+func (c *gcsClient) Get(ctx context.Context, objName string) ([]byte, error) {
+	ctx, done := c.start(ctx, "Get", objName)
+	b, err := c.next.Get(ctx, objName)
+	done(int64(len(b)), err)
+	return b, err
+}
+
+func (c *gcsClient) NewReader(ctx context.Context, objName string) (io.ReadCloser, error) {
+	ctx, done := c.start(ctx, "NewReader", objName)
+	r, err := c.next.NewReader(ctx, objName)
+	if err != nil {
+		done(0, err)
+		return nil, err
+	}
+	return &countingReader{ReadCloser: r, done: done}, nil
+}
+
+func (c *gcsClient) NewRangeReader(ctx context.Context, objName string, offset, length int64) (io.ReadCloser, error) {
+	ctx, done := c.start(ctx, "NewRangeReader", objName)
+	r, err := c.next.NewRangeReader(ctx, objName, offset, length)
+	if err != nil {
+		done(0, err)
+		return nil, err
+	}
+	return &countingReader{ReadCloser: r, done: done}, nil
+}
+
+func (c *gcsClient) DownloadToFile(ctx context.Context, objName, path string, opts gcs.DownloadOptions) error {
+	ctx, done := c.start(ctx, "DownloadToFile", objName)
+	err := c.next.DownloadToFile(ctx, objName, path, opts)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) NewVersionRangeReader(ctx context.Context, objName string, generation, offset, length int64) (io.ReadCloser, error) {
+	ctx, done := c.start(ctx, "NewVersionRangeReader", objName)
+	r, err := c.next.NewVersionRangeReader(ctx, objName, generation, offset, length)
+	if err != nil {
+		done(0, err)
+		return nil, err
+	}
+	return &countingReader{ReadCloser: r, done: done}, nil
+}
+
+func (c *gcsClient) NewWriter(ctx context.Context, objName string, opts gcs.PutOptions) io.WriteCloser {
+	ctx, done := c.start(ctx, "NewWriter", objName)
+	return &countingWriter{WriteCloser: c.next.NewWriter(ctx, objName, opts), done: done}
+}
+
+// countingWriter counts the bytes written through it and reports them on Close.
+type countingWriter struct {
+	io.WriteCloser
+	n    int64
+	done func(n int64, err error)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if w.done != nil {
+		w.done(w.n, err)
+		w.done = nil
+	}
+	return err
+}
+
+func (c *gcsClient) List(ctx context.Context, filePrefix string) ([]string, error) {
+	ctx, done := c.start(ctx, "List", filePrefix)
+	names, err := c.next.List(ctx, filePrefix)
+	done(0, err)
+	return names, err
+}
+
+func (c *gcsClient) Delete(ctx context.Context, objName string) error {
+	ctx, done := c.start(ctx, "Delete", objName)
+	err := c.next.Delete(ctx, objName)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) DeleteMany(ctx context.Context, objNames []string) error {
+	ctx, done := c.start(ctx, "DeleteMany", "")
+	err := c.next.DeleteMany(ctx, objNames)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) DeletePrefix(ctx context.Context, prefix string) error {
+	ctx, done := c.start(ctx, "DeletePrefix", prefix)
+	err := c.next.DeletePrefix(ctx, prefix)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) ListVersions(ctx context.Context, objName string) ([]gcs.Version, error) {
+	ctx, done := c.start(ctx, "ListVersions", objName)
+	versions, err := c.next.ListVersions(ctx, objName)
+	done(0, err)
+	return versions, err
+}
+
+func (c *gcsClient) GetVersion(ctx context.Context, objName string, generation int64) ([]byte, error) {
+	ctx, done := c.start(ctx, "GetVersion", objName)
+	b, err := c.next.GetVersion(ctx, objName, generation)
+	done(int64(len(b)), err)
+	return b, err
+}
+
+func (c *gcsClient) DeleteVersion(ctx context.Context, objName string, generation int64) error {
+	ctx, done := c.start(ctx, "DeleteVersion", objName)
+	err := c.next.DeleteVersion(ctx, objName, generation)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) RestoreVersion(ctx context.Context, objName string, generation int64) error {
+	ctx, done := c.start(ctx, "RestoreVersion", objName)
+	err := c.next.RestoreVersion(ctx, objName, generation)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) Copy(ctx context.Context, src string, generation int64, dst string, opts gcs.PutOptions) error {
+	ctx, done := c.start(ctx, "Copy", dst)
+	err := c.next.Copy(ctx, src, generation, dst, opts)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) MakeObjectPublic(ctx context.Context, objName string) error {
+	ctx, done := c.start(ctx, "MakeObjectPublic", objName)
+	err := c.next.MakeObjectPublic(ctx, objName)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) MakeObjectPrivate(ctx context.Context, objName string) error {
+	ctx, done := c.start(ctx, "MakeObjectPrivate", objName)
+	err := c.next.MakeObjectPrivate(ctx, objName)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) SetACL(ctx context.Context, objName string, entity gcs.ACLEntity, role gcs.ACLRole) error {
+	ctx, done := c.start(ctx, "SetACL", objName)
+	err := c.next.SetACL(ctx, objName, entity, role)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) DeleteACL(ctx context.Context, objName string, entity gcs.ACLEntity) error {
+	ctx, done := c.start(ctx, "DeleteACL", objName)
+	err := c.next.DeleteACL(ctx, objName, entity)
+	done(0, err)
+	return err
+}
+
+func (c *gcsClient) ListACL(ctx context.Context, objName string) ([]gcs.ACLRule, error) {
+	ctx, done := c.start(ctx, "ListACL", objName)
+	rules, err := c.next.ListACL(ctx, objName)
+	done(0, err)
+	return rules, err
+}
+
+// URL is not measured; it does not call the service.
+func (c *gcsClient) URL(objName string) string {
+	return c.next.URL(objName)
+}
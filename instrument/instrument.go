@@ -0,0 +1,186 @@
+// Package instrument decorates storage clients with metrics and trace spans.
+//
+//	m, _ := prometheus.NewMetrics(prom.DefaultRegisterer, "app")
+//	c = instrument.GCS(c, "bucket", instrument.Options{Metrics: m})
+//	i := s3.New(instrument.S3(s3.NewS3Client(opt), instrument.Options{Metrics: m}), opt)
+package instrument
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+// Operation identifies the storage call a measurement belongs to.
+type Operation struct {
+	// Backend is "gcs" or "s3".
+	Backend string
+	Bucket  string
+	// Method is the decorated method, e.g. "Put" or "GetObject".
+	Method string
+}
+
+// Metrics receives the measurements of storage operations.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveLatency records the duration of a finished operation.
+	ObserveLatency(op Operation, d time.Duration)
+	// AddBytes counts the payload bytes sent or received by an operation.
+	AddBytes(op Operation, n int64)
+	// IncError counts a failed operation by the class returned by Options.Classify.
+	IncError(op Operation, class string)
+	// AddInFlight adds delta to the number of running operations.
+	AddInFlight(op Operation, delta int64)
+}
+
+// Tracer starts a span for each storage operation.
+type Tracer interface {
+	// Start starts a span named name with attrs, such as AttrBucket, and
+	// returns a context carrying it.
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+// Span is a started trace span.
+type Span interface {
+	// End finishes the span, marking it failed when err is not nil.
+	End(err error)
+}
+
+// Span attribute keys.
+const (
+	AttrBackend = "storage.backend"
+	AttrBucket  = "storage.bucket"
+	AttrKey     = "storage.key"
+	AttrMethod  = "storage.method"
+)
+
+// Error classes returned by Classify.
+const (
+	ClassNotFound         = "not_found"
+	ClassCanceled         = "canceled"
+	ClassDeadlineExceeded = "deadline_exceeded"
+	ClassInvalidArgument  = "invalid_argument"
+	ClassPartial          = "partial"
+	ClassOther            = "other"
+)
+
+// Options configures the decorators. Nil Metrics or Tracer disables them.
+type Options struct {
+	Metrics Metrics
+	Tracer  Tracer
+	// Classify maps an error to the class passed to Metrics.IncError.
+	// It defaults to Classify.
+	Classify func(error) string
+}
+
+// Classify maps the sentinel errors of the gcs and s3 packages and context
+// errors to an error class.
+func Classify(err error) string {
+	var (
+		deleteErrors gcs.DeleteErrors
+		s3Errors     s3.DeleteErrors
+		aerr         awserr.Error
+	)
+	switch {
+	case errors.Is(err, gcs.ErrObjectNotExist), s3.IsNotFound(err):
+		return ClassNotFound
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassDeadlineExceeded
+	case errors.Is(err, gcs.ErrEmptyPrefix), errors.Is(err, s3.ErrEmptyPrefix):
+		return ClassInvalidArgument
+	case errors.As(err, &deleteErrors), errors.As(err, &s3Errors):
+		return ClassPartial
+	case errors.As(err, &aerr) && aerr.Code() == request.CanceledErrorCode:
+		return ClassCanceled
+	}
+	return ClassOther
+}
+
+// recorder measures the operations of one decorated client.
+type recorder struct {
+	backend string
+	opts    Options
+}
+
+func newRecorder(backend string, opts Options) recorder {
+	if opts.Classify == nil {
+		opts.Classify = Classify
+	}
+	return recorder{backend: backend, opts: opts}
+}
+
+// start begins measuring method on key. The returned func ends the
+// measurement with the payload size and error of the operation.
+func (r recorder) start(ctx context.Context, bucket, method, key string) (context.Context, func(n int64, err error)) {
+	op := Operation{Backend: r.backend, Bucket: bucket, Method: method}
+	begin := time.Now()
+
+	var span Span
+	if r.opts.Tracer != nil {
+		attrs := map[string]string{
+			AttrBackend: r.backend,
+			AttrBucket:  bucket,
+			AttrMethod:  method,
+		}
+		if key != "" {
+			attrs[AttrKey] = key
+		}
+		ctx, span = r.opts.Tracer.Start(ctx, r.backend+"."+method, attrs)
+	}
+	if m := r.opts.Metrics; m != nil {
+		m.AddInFlight(op, 1)
+	}
+
+	return ctx, func(n int64, err error) {
+		if m := r.opts.Metrics; m != nil {
+			m.AddInFlight(op, -1)
+			m.ObserveLatency(op, time.Since(begin))
+			if n > 0 {
+				m.AddBytes(op, n)
+			}
+			if err != nil {
+				m.IncError(op, r.opts.Classify(err))
+			}
+		}
+		if span != nil {
+			span.End(err)
+		}
+	}
+}
+
+// countingReader counts the bytes read through it and reports them on Close.
+type countingReader struct {
+	io.ReadCloser
+	n    int64
+	done func(n int64, err error)
+	err  error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if r.done != nil {
+		if r.err == nil {
+			r.err = err
+		}
+		r.done(r.n, r.err)
+		r.done = nil
+	}
+	return err
+}
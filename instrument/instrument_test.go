@@ -0,0 +1,205 @@
+package instrument
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/s3test"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+type recordingMetrics struct {
+	mu        sync.Mutex
+	latencies map[Operation]int
+	bytes     map[Operation]int64
+	errors    map[string]int
+	inFlight  map[Operation]int64
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		latencies: map[Operation]int{},
+		bytes:     map[Operation]int64{},
+		errors:    map[string]int{},
+		inFlight:  map[Operation]int64{},
+	}
+}
+
+func (m *recordingMetrics) ObserveLatency(op Operation, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies[op]++
+}
+
+func (m *recordingMetrics) AddBytes(op Operation, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes[op] += n
+}
+
+func (m *recordingMetrics) IncError(op Operation, class string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[op.Method+"/"+class]++
+}
+
+func (m *recordingMetrics) AddInFlight(op Operation, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[op] += delta
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	return ctx, spanFunc(func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.spans = append(t.spans, fmt.Sprintf("%s %s/%s err=%v", name, attrs[AttrBucket], attrs[AttrKey], err != nil))
+	})
+}
+
+type spanFunc func(err error)
+
+func (f spanFunc) End(err error) { f(err) }
+
+func TestGCS_Conformance(t *testing.T) {
+	storagetest.TestGCSClient(t, func(t *testing.T) gcs.Client {
+		return GCS(fake.New("test"), "test", Options{Metrics: newRecordingMetrics(), Tracer: &recordingTracer{}})
+	})
+}
+
+func TestGCS(t *testing.T) {
+	ctx := context.Background()
+	m := newRecordingMetrics()
+	tr := &recordingTracer{}
+	c := GCS(fake.New("test"), "test", Options{Metrics: m, Tracer: tr})
+
+	if err := c.Put(ctx, "a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewReader(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	get := Operation{Backend: "gcs", Bucket: "test", Method: "NewReader"}
+	if got := m.inFlight[get]; got != 1 {
+		t.Errorf("in flight before Close = %d, want 1", got)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Fatalf("Get() err = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+
+	put := Operation{Backend: "gcs", Bucket: "test", Method: "Put"}
+	if got := m.bytes[put]; got != 5 {
+		t.Errorf("Put bytes = %d, want 5", got)
+	}
+	if got := m.bytes[get]; got != 5 {
+		t.Errorf("NewReader bytes = %d, want 5", got)
+	}
+	if got := m.inFlight[get]; got != 0 {
+		t.Errorf("in flight after Close = %d, want 0", got)
+	}
+	if got := m.latencies[put]; got != 1 {
+		t.Errorf("Put latencies = %d, want 1", got)
+	}
+	if got := m.errors["Get/"+ClassNotFound]; got != 1 {
+		t.Errorf("Get errors = %v, want 1 %s", m.errors, ClassNotFound)
+	}
+
+	want := []string{
+		"gcs.Put test/a err=false",
+		"gcs.NewReader test/a err=false",
+		"gcs.Get test/missing err=true",
+	}
+	if fmt.Sprint(tr.spans) != fmt.Sprint(want) {
+		t.Errorf("spans = %q, want %q", tr.spans, want)
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	m := newRecordingMetrics()
+	tr := &recordingTracer{}
+	opt := srv.Options("test")
+	i := s3.New(S3(s3.NewS3Client(opt), Options{Metrics: m, Tracer: tr}), opt)
+
+	if err := i.Upload(strings.NewReader("hello"), "a.txt", s3.Private, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	body, _, err := i.Download("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("Download() = %q, want %q", b, "hello")
+	}
+
+	put := Operation{Backend: "s3", Bucket: "test", Method: "PutObject"}
+	get := Operation{Backend: "s3", Bucket: "test", Method: "GetObject"}
+	if got := m.bytes[put]; got != 5 {
+		t.Errorf("PutObject bytes = %d, want 5", got)
+	}
+	if got := m.bytes[get]; got != 5 {
+		t.Errorf("GetObject bytes = %d, want 5", got)
+	}
+	if got := m.inFlight[get]; got != 0 {
+		t.Errorf("GetObject in flight = %d, want 0", got)
+	}
+	if len(tr.spans) != 2 || tr.spans[0] != "s3.PutObject test/a.txt err=false" {
+		t.Errorf("spans = %q", tr.spans)
+	}
+
+	if u, err := i.SignedURL("a.txt", time.Minute); err != nil || !strings.Contains(u, "a.txt") {
+		t.Errorf("SignedURL() = %q, %v", u, err)
+	}
+	mock := s3.New(S3(&s3.S3mock{}, Options{}), opt)
+	if _, err := mock.SignedURL("a.txt", time.Minute); !errors.Is(err, s3.ErrPresignNotSupported) {
+		t.Errorf("SignedURL() err = %v, want %v", err, s3.ErrPresignNotSupported)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("get: %w", gcs.ErrObjectNotExist), ClassNotFound},
+		{context.Canceled, ClassCanceled},
+		{context.DeadlineExceeded, ClassDeadlineExceeded},
+		{s3.ErrEmptyPrefix, ClassInvalidArgument},
+		{gcs.DeleteErrors{"a": errors.New("boom")}, ClassPartial},
+		{errors.New("boom"), ClassOther},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package otel exports instrument metrics and spans through OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/unit"
+
+	"github.com/hayashiki/go-pkg/instrument"
+)
+
+// Metrics is an instrument.Metrics backed by OpenTelemetry instruments.
+type Metrics struct {
+	latency  metric.Float64ValueRecorder
+	bytes    metric.Int64Counter
+	errors   metric.Int64Counter
+	inFlight metric.Int64UpDownCounter
+}
+
+var _ instrument.Metrics = (*Metrics)(nil)
+
+// NewMetrics creates the storage instruments with meter.
+func NewMetrics(meter metric.Meter) (*Metrics, error) {
+	var (
+		m   Metrics
+		err error
+	)
+	if m.latency, err = meter.NewFloat64ValueRecorder("storage.operation.duration",
+		metric.WithDescription("Latency of storage operations."), metric.WithUnit(unit.Milliseconds)); err != nil {
+		return nil, err
+	}
+	if m.bytes, err = meter.NewInt64Counter("storage.bytes",
+		metric.WithDescription("Payload bytes sent or received by storage operations."), metric.WithUnit(unit.Bytes)); err != nil {
+		return nil, err
+	}
+	if m.errors, err = meter.NewInt64Counter("storage.errors",
+		metric.WithDescription("Failed storage operations by error class.")); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = meter.NewInt64UpDownCounter("storage.in_flight",
+		metric.WithDescription("Storage operations currently running.")); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func labels(op instrument.Operation) []label.KeyValue {
+	return []label.KeyValue{
+		label.String(instrument.AttrBackend, op.Backend),
+		label.String(instrument.AttrBucket, op.Bucket),
+		label.String(instrument.AttrMethod, op.Method),
+	}
+}
+
+func (m *Metrics) ObserveLatency(op instrument.Operation, d time.Duration) {
+	m.latency.Record(context.Background(), float64(d)/float64(time.Millisecond), labels(op)...)
+}
+
+func (m *Metrics) AddBytes(op instrument.Operation, n int64) {
+	m.bytes.Add(context.Background(), n, labels(op)...)
+}
+
+func (m *Metrics) IncError(op instrument.Operation, class string) {
+	m.errors.Add(context.Background(), 1, append(labels(op), label.String("error.class", class))...)
+}
+
+func (m *Metrics) AddInFlight(op instrument.Operation, delta int64) {
+	m.inFlight.Add(context.Background(), delta, labels(op)...)
+}
+
+// Tracer is an instrument.Tracer that starts OpenTelemetry client spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ instrument.Tracer = (*Tracer)(nil)
+
+// NewTracer returns a Tracer that starts spans with tracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, instrument.Span) {
+	kvs := make([]label.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, label.String(k, v))
+	}
+	ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(kvs...))
+	return ctx, &span{ctx: ctx, span: s}
+}
+
+type span struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(s.ctx, err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
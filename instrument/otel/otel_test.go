@@ -0,0 +1,95 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/api/metric/metrictest"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/instrument"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	impl, meter := metrictest.NewMeter()
+	m, err := NewMetrics(meter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := instrument.GCS(fake.New("bucket"), "bucket", instrument.Options{Metrics: m})
+
+	if err := c.Put(ctx, "a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Fatalf("Get() err = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+
+	var bytes, errs, latencies int64
+	for _, r := range metrictest.AsStructs(impl.MeasurementBatches) {
+		method := r.Labels[instrument.AttrMethod].AsString()
+		switch r.Name {
+		case "storage.bytes":
+			if method == "Put" {
+				bytes += r.Number.AsInt64()
+			}
+		case "storage.errors":
+			if method == "Get" && r.Labels["error.class"].AsString() == instrument.ClassNotFound {
+				errs += r.Number.AsInt64()
+			}
+		case "storage.operation.duration":
+			latencies++
+		}
+	}
+	if bytes != 5 {
+		t.Errorf("storage.bytes{Put} = %d, want 5", bytes)
+	}
+	if errs != 1 {
+		t.Errorf("storage.errors{Get} = %d, want 1", errs)
+	}
+	if latencies != 2 {
+		t.Errorf("storage.operation.duration measurements = %d, want 2", latencies)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+	sr := new(tracetest.StandardSpanRecorder)
+	tr := NewTracer(tracetest.NewTracerProvider(tracetest.WithSpanRecorder(sr)).Tracer("test"))
+	c := instrument.GCS(fake.New("bucket"), "bucket", instrument.Options{Tracer: tr})
+
+	if err := c.Put(ctx, "a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "missing"); err == nil {
+		t.Fatal("Get() err = nil, want an error")
+	}
+
+	spans := sr.Completed()
+	if len(spans) != 2 {
+		t.Fatalf("completed spans = %d, want 2", len(spans))
+	}
+	put, get := spans[0], spans[1]
+	if put.Name() != "gcs.Put" || put.StatusCode() != codes.Unset {
+		t.Errorf("Put span = %s %v, want gcs.Put %v", put.Name(), put.StatusCode(), codes.Unset)
+	}
+	if put.SpanKind() != trace.SpanKindClient {
+		t.Errorf("Put span kind = %v, want %v", put.SpanKind(), trace.SpanKindClient)
+	}
+	if got := put.Attributes()[label.Key(instrument.AttrKey)].AsString(); got != "a" {
+		t.Errorf("Put span %s = %q, want %q", instrument.AttrKey, got, "a")
+	}
+	if get.Name() != "gcs.Get" || get.StatusCode() != codes.Error {
+		t.Errorf("Get span = %s %v, want gcs.Get %v", get.Name(), get.StatusCode(), codes.Error)
+	}
+	if len(get.Events()) != 1 {
+		t.Errorf("Get span events = %d, want the recorded error", len(get.Events()))
+	}
+}
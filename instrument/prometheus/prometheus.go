@@ -0,0 +1,80 @@
+// Package prometheus exports instrument metrics as Prometheus collectors.
+package prometheus
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/hayashiki/go-pkg/instrument"
+)
+
+var labels = []string{"backend", "bucket", "method"}
+
+// Metrics is an instrument.Metrics backed by Prometheus collectors.
+type Metrics struct {
+	latency  *prom.HistogramVec
+	bytes    *prom.CounterVec
+	errors   *prom.CounterVec
+	inFlight *prom.GaugeVec
+}
+
+var _ instrument.Metrics = (*Metrics)(nil)
+
+// NewMetrics creates the storage collectors under namespace and registers them with reg.
+func NewMetrics(reg prom.Registerer, namespace string) (*Metrics, error) {
+	m := &Metrics{
+		latency: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of storage operations.",
+			Buckets:   prom.DefBuckets,
+		}, labels),
+		bytes: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "bytes_total",
+			Help:      "Payload bytes sent or received by storage operations.",
+		}, labels),
+		errors: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "errors_total",
+			Help:      "Failed storage operations by error class.",
+		}, append(append([]string{}, labels...), "class")),
+		inFlight: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "in_flight_operations",
+			Help:      "Storage operations currently running.",
+		}, labels),
+	}
+
+	for _, c := range []prom.Collector{m.latency, m.bytes, m.errors, m.inFlight} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func values(op instrument.Operation) []string {
+	return []string{op.Backend, op.Bucket, op.Method}
+}
+
+func (m *Metrics) ObserveLatency(op instrument.Operation, d time.Duration) {
+	m.latency.WithLabelValues(values(op)...).Observe(d.Seconds())
+}
+
+func (m *Metrics) AddBytes(op instrument.Operation, n int64) {
+	m.bytes.WithLabelValues(values(op)...).Add(float64(n))
+}
+
+func (m *Metrics) IncError(op instrument.Operation, class string) {
+	m.errors.WithLabelValues(append(values(op), class)...).Inc()
+}
+
+func (m *Metrics) AddInFlight(op instrument.Operation, delta int64) {
+	m.inFlight.WithLabelValues(values(op)...).Add(float64(delta))
+}
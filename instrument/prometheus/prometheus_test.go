@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/instrument"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	reg := prom.NewRegistry()
+	m, err := NewMetrics(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := instrument.GCS(fake.New("bucket"), "bucket", instrument.Options{Metrics: m})
+
+	if err := c.Put(ctx, "a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Fatalf("Get() err = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+
+	if got := testutil.ToFloat64(m.bytes.WithLabelValues("gcs", "bucket", "Put")); got != 5 {
+		t.Errorf("bytes_total{method=Put} = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(m.errors.WithLabelValues("gcs", "bucket", "Get", instrument.ClassNotFound)); got != 1 {
+		t.Errorf("errors_total{method=Get} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues("gcs", "bucket", "Put")); got != 0 {
+		t.Errorf("in_flight_operations{method=Put} = %v, want 0", got)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count uint64
+	for _, f := range families {
+		if f.GetName() != "test_storage_operation_duration_seconds" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			count += metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if count != 2 {
+		t.Errorf("operation_duration_seconds samples = %d, want 2", count)
+	}
+}
+
+func TestNewMetrics_alreadyRegistered(t *testing.T) {
+	reg := prom.NewRegistry()
+	if _, err := NewMetrics(reg, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMetrics(reg, "test"); err == nil {
+		t.Error("NewMetrics() err = nil, want a registration error")
+	}
+}
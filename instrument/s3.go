@@ -0,0 +1,234 @@
+package instrument
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+type s3Client struct {
+	next s3.Client
+	rec  recorder
+}
+
+// S3 returns an s3.Client that measures every call to c. Pass it to s3.New
+// to instrument an Interactor. GetObject is measured until its body is closed.
+func S3(c s3.Client, opts Options) s3.Client {
+	return &s3Client{next: c, rec: newRecorder("s3", opts)}
+}
+
+func (c *s3Client) start(ctx context.Context, method string, bucket, key *string) (context.Context, func(int64, error)) {
+	return c.rec.start(ctx, aws.StringValue(bucket), method, aws.StringValue(key))
+}
+
+// bodySize returns the number of unread bytes in body without consuming them.
+func bodySize(body io.ReadSeeker) int64 {
+	if body == nil {
+		return 0
+	}
+	cur, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0
+	}
+	end, err := body.Seek(0, io.SeekEnd)
+	if _, serr := body.Seek(cur, io.SeekStart); err != nil || serr != nil {
+		return 0
+	}
+	return end - cur
+}
+
+func (c *s3Client) PutObject(input *awss3.PutObjectInput) (*awss3.PutObjectOutput, error) {
+	_, done := c.start(context.Background(), "PutObject", input.Bucket, input.Key)
+	n := bodySize(input.Body)
+	out, err := c.next.PutObject(input)
+	done(n, err)
+	return out, err
+}
+
+func (c *s3Client) PutObjectWithContext(ctx aws.Context, input *awss3.PutObjectInput, opts ...request.Option) (*awss3.PutObjectOutput, error) {
+	ctx, done := c.start(ctx, "PutObject", input.Bucket, input.Key)
+	n := bodySize(input.Body)
+	out, err := c.next.PutObjectWithContext(ctx, input, opts...)
+	done(n, err)
+	return out, err
+}
+
+func (c *s3Client) GetObject(input *awss3.GetObjectInput) (*awss3.GetObjectOutput, error) {
+	_, done := c.start(context.Background(), "GetObject", input.Bucket, input.Key)
+	out, err := c.next.GetObject(input)
+	return countBody(out, err, done)
+}
+
+// GetObjectRequest forwards to the wrapped client so that SignedURL keeps
+// working. Presigning does not call S3 and is not measured.
+func (c *s3Client) GetObjectRequest(input *awss3.GetObjectInput) (*request.Request, *awss3.GetObjectOutput) {
+	return s3.GetObjectRequest(c.next, input)
+}
+
+func (c *s3Client) GetObjectWithContext(ctx aws.Context, input *awss3.GetObjectInput, opts ...request.Option) (*awss3.GetObjectOutput, error) {
+	ctx, done := c.start(ctx, "GetObject", input.Bucket, input.Key)
+	out, err := c.next.GetObjectWithContext(ctx, input, opts...)
+	return countBody(out, err, done)
+}
+
+// countBody defers the end of a GetObject measurement until its body is closed.
+func countBody(out *awss3.GetObjectOutput, err error, done func(int64, error)) (*awss3.GetObjectOutput, error) {
+	if err != nil || out.Body == nil {
+		done(0, err)
+		return out, err
+	}
+	out.Body = &countingReader{ReadCloser: out.Body, done: done}
+	return out, nil
+}
+
+func (c *s3Client) DeleteObject(input *awss3.DeleteObjectInput) (*awss3.DeleteObjectOutput, error) {
+	_, done := c.start(context.Background(), "DeleteObject", input.Bucket, input.Key)
+	out, err := c.next.DeleteObject(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) DeleteObjectWithContext(ctx aws.Context, input *awss3.DeleteObjectInput, opts ...request.Option) (*awss3.DeleteObjectOutput, error) {
+	ctx, done := c.start(ctx, "DeleteObject", input.Bucket, input.Key)
+	out, err := c.next.DeleteObjectWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) DeleteObjects(input *awss3.DeleteObjectsInput) (*awss3.DeleteObjectsOutput, error) {
+	_, done := c.start(context.Background(), "DeleteObjects", input.Bucket, nil)
+	out, err := c.next.DeleteObjects(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) DeleteObjectsWithContext(ctx aws.Context, input *awss3.DeleteObjectsInput, opts ...request.Option) (*awss3.DeleteObjectsOutput, error) {
+	ctx, done := c.start(ctx, "DeleteObjects", input.Bucket, nil)
+	out, err := c.next.DeleteObjectsWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) ListObjectsV2(input *awss3.ListObjectsV2Input) (*awss3.ListObjectsV2Output, error) {
+	_, done := c.start(context.Background(), "ListObjectsV2", input.Bucket, input.Prefix)
+	out, err := c.next.ListObjectsV2(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) ListObjectsV2WithContext(ctx aws.Context, input *awss3.ListObjectsV2Input, opts ...request.Option) (*awss3.ListObjectsV2Output, error) {
+	ctx, done := c.start(ctx, "ListObjectsV2", input.Bucket, input.Prefix)
+	out, err := c.next.ListObjectsV2WithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) ListObjectVersions(input *awss3.ListObjectVersionsInput) (*awss3.ListObjectVersionsOutput, error) {
+	_, done := c.start(context.Background(), "ListObjectVersions", input.Bucket, input.Prefix)
+	out, err := c.next.ListObjectVersions(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) ListObjectVersionsWithContext(ctx aws.Context, input *awss3.ListObjectVersionsInput, opts ...request.Option) (*awss3.ListObjectVersionsOutput, error) {
+	ctx, done := c.start(ctx, "ListObjectVersions", input.Bucket, input.Prefix)
+	out, err := c.next.ListObjectVersionsWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) CopyObject(input *awss3.CopyObjectInput) (*awss3.CopyObjectOutput, error) {
+	_, done := c.start(context.Background(), "CopyObject", input.Bucket, input.Key)
+	out, err := c.next.CopyObject(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) CopyObjectWithContext(ctx aws.Context, input *awss3.CopyObjectInput, opts ...request.Option) (*awss3.CopyObjectOutput, error) {
+	ctx, done := c.start(ctx, "CopyObject", input.Bucket, input.Key)
+	out, err := c.next.CopyObjectWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) HeadObject(input *awss3.HeadObjectInput) (*awss3.HeadObjectOutput, error) {
+	_, done := c.start(context.Background(), "HeadObject", input.Bucket, input.Key)
+	out, err := c.next.HeadObject(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) HeadObjectWithContext(ctx aws.Context, input *awss3.HeadObjectInput, opts ...request.Option) (*awss3.HeadObjectOutput, error) {
+	ctx, done := c.start(ctx, "HeadObject", input.Bucket, input.Key)
+	out, err := c.next.HeadObjectWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) PutObjectAcl(input *awss3.PutObjectAclInput) (*awss3.PutObjectAclOutput, error) {
+	_, done := c.start(context.Background(), "PutObjectAcl", input.Bucket, input.Key)
+	out, err := c.next.PutObjectAcl(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) PutObjectAclWithContext(ctx aws.Context, input *awss3.PutObjectAclInput, opts ...request.Option) (*awss3.PutObjectAclOutput, error) {
+	ctx, done := c.start(ctx, "PutObjectAcl", input.Bucket, input.Key)
+	out, err := c.next.PutObjectAclWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) GetObjectAcl(input *awss3.GetObjectAclInput) (*awss3.GetObjectAclOutput, error) {
+	_, done := c.start(context.Background(), "GetObjectAcl", input.Bucket, input.Key)
+	out, err := c.next.GetObjectAcl(input)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) GetObjectAclWithContext(ctx aws.Context, input *awss3.GetObjectAclInput, opts ...request.Option) (*awss3.GetObjectAclOutput, error) {
+	ctx, done := c.start(ctx, "GetObjectAcl", input.Bucket, input.Key)
+	out, err := c.next.GetObjectAclWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) CreateMultipartUploadWithContext(ctx aws.Context, input *awss3.CreateMultipartUploadInput, opts ...request.Option) (*awss3.CreateMultipartUploadOutput, error) {
+	ctx, done := c.start(ctx, "CreateMultipartUpload", input.Bucket, input.Key)
+	out, err := c.next.CreateMultipartUploadWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) UploadPartWithContext(ctx aws.Context, input *awss3.UploadPartInput, opts ...request.Option) (*awss3.UploadPartOutput, error) {
+	ctx, done := c.start(ctx, "UploadPart", input.Bucket, input.Key)
+	n := bodySize(input.Body)
+	out, err := c.next.UploadPartWithContext(ctx, input, opts...)
+	done(n, err)
+	return out, err
+}
+
+func (c *s3Client) UploadPartCopyWithContext(ctx aws.Context, input *awss3.UploadPartCopyInput, opts ...request.Option) (*awss3.UploadPartCopyOutput, error) {
+	ctx, done := c.start(ctx, "UploadPartCopy", input.Bucket, input.Key)
+	out, err := c.next.UploadPartCopyWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) CompleteMultipartUploadWithContext(ctx aws.Context, input *awss3.CompleteMultipartUploadInput, opts ...request.Option) (*awss3.CompleteMultipartUploadOutput, error) {
+	ctx, done := c.start(ctx, "CompleteMultipartUpload", input.Bucket, input.Key)
+	out, err := c.next.CompleteMultipartUploadWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
+
+func (c *s3Client) AbortMultipartUploadWithContext(ctx aws.Context, input *awss3.AbortMultipartUploadInput, opts ...request.Option) (*awss3.AbortMultipartUploadOutput, error) {
+	ctx, done := c.start(ctx, "AbortMultipartUpload", input.Bucket, input.Key)
+	out, err := c.next.AbortMultipartUploadWithContext(ctx, input, opts...)
+	done(0, err)
+	return out, err
+}
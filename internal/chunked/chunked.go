@@ -0,0 +1,387 @@
+// Package chunked downloads an object to a file in concurrent ranges. It
+// backs gcs.DownloadToFile and s3.Interactor.DownloadToFile.
+//
+// The data is written into <path>.part, preallocated to the object size,
+// and the completed ranges are recorded in <path>.part.json after each one.
+// A download that finds both files for the same object version continues
+// with the missing ranges. The file is renamed to path only after the
+// checksum of the whole file matched.
+package chunked
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hayashiki/go-pkg/internal/retry"
+)
+
+// ErrChecksum is returned when the downloaded file does not match the
+// checksum of the object.
+var ErrChecksum = errors.New("download: checksum mismatch")
+
+// Object describes the object being downloaded.
+type Object struct {
+	Size int64
+	// Version identifies the contents of the object, such as a generation or
+	// an ETag. A partial file is only resumed for the same version.
+	Version string
+	// MD5, when set, is verified after the download.
+	MD5 []byte
+	// Parts, when set, are the part sizes of an S3 multipart upload. MD5 is
+	// then the MD5 of the MD5s of the parts, as in the ETag of the upload.
+	Parts []int64
+	// CRC32C is verified when MD5 is not set and HasCRC32C is.
+	CRC32C    uint32
+	HasCRC32C bool
+}
+
+// ReadRange returns the length bytes of the object starting at offset.
+type ReadRange func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// Options configures Download.
+type Options struct {
+	// ChunkSize is the size of one range. Defaults to 16 MiB.
+	ChunkSize int64
+	// Concurrency is the number of ranges fetched at once. Defaults to 8.
+	Concurrency int
+	// MaxAttempts is the number of attempts to read one range. Defaults to 4.
+	MaxAttempts int
+	// Retryable reports whether a failed range read is worth another
+	// attempt. Defaults to every error but the end of ctx.
+	Retryable func(error) bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = 16 << 20
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 8
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 4
+	}
+	if o.Retryable == nil {
+		o.Retryable = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	return o
+}
+
+// backoff is the schedule of the attempts to read one range.
+var backoff = retry.Policy{InitialBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second, Multiplier: 2, Jitter: true}
+
+// state is the content of the resume file.
+type state struct {
+	Size      int64  `json:"size"`
+	Version   string `json:"version"`
+	ChunkSize int64  `json:"chunk_size"`
+	Done      []int  `json:"done"`
+}
+
+// Download writes obj to path, reading it with read.
+func Download(ctx context.Context, path string, obj Object, read ReadRange, opts Options) error {
+	opts = opts.withDefaults()
+	d := &download{
+		part:  path + ".part",
+		state: path + ".part.json",
+		st:    state{Size: obj.Size, Version: obj.Version, ChunkSize: opts.ChunkSize},
+	}
+
+	f, done, err := d.open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chunks := int((obj.Size + opts.ChunkSize - 1) / opts.ChunkSize)
+	var todo []int
+	for i := 0; i < chunks; i++ {
+		if !done[i] {
+			todo = append(todo, i)
+		}
+	}
+	if err := d.fetch(ctx, f, todo, obj.Size, read, opts); err != nil {
+		return err
+	}
+
+	if err := verify(f, obj); err != nil {
+		// The ranges are complete but wrong; start over next time.
+		f.Close()
+		os.Remove(d.part)
+		os.Remove(d.state)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(d.part, path); err != nil {
+		return err
+	}
+	return os.Remove(d.state)
+}
+
+type download struct {
+	part  string
+	state string
+
+	mu sync.Mutex
+	st state
+	// pending are the chunks written since the last sync.
+	pending []int
+}
+
+// open returns the partial file and the chunks already in it, starting a
+// new preallocated file unless a matching one can be resumed.
+func (d *download) open() (*os.File, map[int]bool, error) {
+	done := make(map[int]bool)
+	if prev, ok := d.resumable(); ok {
+		f, err := os.OpenFile(d.part, os.O_RDWR, 0)
+		if err == nil {
+			for _, i := range prev.Done {
+				done[i] = true
+			}
+			d.st.Done = prev.Done
+			return f, done, nil
+		}
+	}
+
+	f, err := os.OpenFile(d.part, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := f.Truncate(d.st.Size); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if err := d.save(); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, done, nil
+}
+
+// resumable returns the saved state if it belongs to the same object
+// version and chunk layout and the partial file has the full size.
+func (d *download) resumable() (state, bool) {
+	data, err := ioutil.ReadFile(d.state)
+	if err != nil {
+		return state{}, false
+	}
+	var prev state
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return state{}, false
+	}
+	if prev.Size != d.st.Size || prev.Version != d.st.Version || prev.ChunkSize != d.st.ChunkSize {
+		return state{}, false
+	}
+	fi, err := os.Stat(d.part)
+	if err != nil || fi.Size() != d.st.Size {
+		return state{}, false
+	}
+	return prev, true
+}
+
+// save writes the state through a temporary file, so a crash leaves either
+// the old or the new state.
+func (d *download) save() error {
+	data, err := json.Marshal(d.st)
+	if err != nil {
+		return err
+	}
+	tmp := d.state + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.state)
+}
+
+// fetch downloads the chunks in todo with opts.Concurrency workers. Chunks
+// are recorded as done in batches of opts.Concurrency, with one sync of f
+// per batch, and whatever is complete is recorded when fetch returns.
+func (d *download) fetch(ctx context.Context, f *os.File, todo []int, size int64, read ReadRange, opts Options) error {
+	err := Each(ctx, len(todo), opts.Concurrency, func(ctx context.Context, n int) error {
+		i := todo[n]
+		if err := d.chunk(ctx, f, i, size, read, opts); err != nil {
+			return err
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.pending = append(d.pending, i)
+		if len(d.pending) < opts.Concurrency {
+			return nil
+		}
+		return d.record(f)
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rerr := d.record(f); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// record syncs f and saves the pending chunks as done. The chunks must be on
+// disk before the state says so, or a crash could resume from a file with a
+// hole in it. d.mu must be held.
+func (d *download) record(f *os.File) error {
+	if len(d.pending) == 0 {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	d.st.Done = append(d.st.Done, d.pending...)
+	d.pending = d.pending[:0]
+	return d.save()
+}
+
+// chunk downloads chunk i into f, retrying failed reads with backoff.
+func (d *download) chunk(ctx context.Context, f *os.File, i int, size int64, read ReadRange, opts Options) error {
+	offset := int64(i) * opts.ChunkSize
+	length := opts.ChunkSize
+	if offset+length > size {
+		length = size - offset
+	}
+
+	policy := backoff
+	policy.MaxAttempts = opts.MaxAttempts
+	err := retry.Do(ctx, policy, opts.Retryable, func() error {
+		r, err := read(ctx, offset, length)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		n, err := io.Copy(&offsetWriter{f: f, offset: offset}, io.LimitReader(r, length))
+		if err != nil {
+			return err
+		}
+		if n != length {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("download: range %d-%d: %w", offset, offset+length-1, err)
+	}
+	return nil
+}
+
+// Each calls fn for 0 through n-1 with up to concurrency calls at once. It
+// stops at the first error, cancelling the ctx passed to the other calls,
+// and returns that error, or the error of ctx if it ended first.
+func Each(ctx context.Context, n, concurrency int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan int)
+	errc := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if err := fn(ctx, i); err != nil {
+					errc <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// offsetWriter writes sequentially into f starting at offset.
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// verify compares the checksum of f with that of obj, if it has one.
+func verify(f *os.File, obj Object) error {
+	var h hash.Hash
+	var want []byte
+	switch {
+	case len(obj.MD5) > 0 && len(obj.Parts) > 0:
+		return verifyParts(f, obj)
+	case len(obj.MD5) > 0:
+		h, want = md5.New(), obj.MD5
+	case obj.HasCRC32C:
+		h = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+		want = []byte{byte(obj.CRC32C >> 24), byte(obj.CRC32C >> 16), byte(obj.CRC32C >> 8), byte(obj.CRC32C)}
+	default:
+		return nil
+	}
+
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, obj.Size)); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); string(got) != string(want) {
+		return fmt.Errorf("%w: got %x, want %x", ErrChecksum, got, want)
+	}
+	return nil
+}
+
+// verifyParts compares the MD5 of the MD5s of the parts of f with obj.MD5.
+func verifyParts(f *os.File, obj Object) error {
+	var sums []byte
+	var offset int64
+	for _, size := range obj.Parts {
+		h := md5.New()
+		if _, err := io.Copy(h, io.NewSectionReader(f, offset, size)); err != nil {
+			return err
+		}
+		sums = h.Sum(sums)
+		offset += size
+	}
+	if offset != obj.Size {
+		return fmt.Errorf("%w: parts add up to %d bytes, want %d", ErrChecksum, offset, obj.Size)
+	}
+
+	if got := md5.Sum(sums); string(got[:]) != string(obj.MD5) {
+		return fmt.Errorf("%w: got %x, want %x", ErrChecksum, got, obj.MD5)
+	}
+	return nil
+}
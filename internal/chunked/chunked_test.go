@@ -0,0 +1,207 @@
+package chunked
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// source serves ranges of data and counts the requested offsets.
+type source struct {
+	data []byte
+	fail func(offset int64) error
+
+	mu    sync.Mutex
+	reads map[int64]int
+}
+
+func (s *source) read(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	s.reads[offset]++
+	s.mu.Unlock()
+	if s.fail != nil {
+		if err := s.fail(offset); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.NopCloser(bytes.NewReader(s.data[offset : offset+length])), nil
+}
+
+func init() {
+	backoff.InitialBackoff = time.Millisecond
+	backoff.MaxBackoff = time.Millisecond
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "chunked-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDownload_Resume(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out")
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	sum := md5.Sum(data)
+	obj := Object{Size: int64(len(data)), Version: "1", MD5: sum[:]}
+	opts := Options{ChunkSize: 10, Concurrency: 1}
+
+	// The first attempt dies at the sixth chunk.
+	boom := errors.New("boom")
+	src := &source{data: data, reads: map[int64]int{}, fail: func(offset int64) error {
+		if offset == 50 {
+			return boom
+		}
+		return nil
+	}}
+	if err := Download(context.Background(), path, obj, src.read, opts); !errors.Is(err, boom) {
+		t.Fatalf("Download() error = %v, want %v", err, boom)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Download() created %s before completing", path)
+	}
+
+	src.fail = nil
+	src.reads = map[int64]int{}
+	if err := Download(context.Background(), path, obj, src.read, opts); err != nil {
+		t.Fatalf("resumed Download() error = %v", err)
+	}
+	for offset := int64(0); offset < 50; offset += 10 {
+		if src.reads[offset] != 0 {
+			t.Errorf("resumed Download() fetched offset %d again", offset)
+		}
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("file = %q, %v, want %q", got, err, data)
+	}
+	if names, _ := filepath.Glob(path + ".part*"); len(names) != 0 {
+		t.Errorf("Download() left %v", names)
+	}
+}
+
+func TestDownload_Retry(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out")
+
+	data := bytes.Repeat([]byte("0123456789"), 4)
+	sum := md5.Sum(data)
+	obj := Object{Size: int64(len(data)), Version: "1", MD5: sum[:]}
+
+	// Every range fails once before it is served.
+	var mu sync.Mutex
+	failed := map[int64]bool{}
+	src := &source{data: data, reads: map[int64]int{}, fail: func(offset int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed[offset] {
+			return nil
+		}
+		failed[offset] = true
+		return io.ErrUnexpectedEOF
+	}}
+	if err := Download(context.Background(), path, obj, src.read, Options{ChunkSize: 10, Concurrency: 2}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, data) {
+		t.Errorf("file = %q, want %q", got, data)
+	}
+
+	// A range that keeps failing gives up after MaxAttempts.
+	src.fail = func(offset int64) error { return io.ErrUnexpectedEOF }
+	src.reads = map[int64]int{}
+	os.Remove(path)
+	err := Download(context.Background(), path, obj, src.read, Options{ChunkSize: 40, MaxAttempts: 3})
+	if !errors.Is(err, io.ErrUnexpectedEOF) || src.reads[0] != 3 {
+		t.Errorf("Download() = %v after %d reads, want %v after 3", err, src.reads[0], io.ErrUnexpectedEOF)
+	}
+}
+
+func TestDownload_NewVersion(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out")
+
+	data := bytes.Repeat([]byte("a"), 40)
+	src := &source{data: data, reads: map[int64]int{}, fail: func(offset int64) error {
+		if offset == 20 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}}
+	opts := Options{ChunkSize: 10, Concurrency: 1}
+	Download(context.Background(), path, Object{Size: 40, Version: "1"}, src.read, opts)
+
+	// A new version of the object must not reuse the old ranges.
+	src.data = bytes.Repeat([]byte("b"), 40)
+	src.fail = nil
+	src.reads = map[int64]int{}
+	if err := Download(context.Background(), path, Object{Size: 40, Version: "2"}, src.read, opts); err != nil {
+		t.Fatal(err)
+	}
+	if src.reads[0] != 1 {
+		t.Error("Download() of a new version resumed the old partial file")
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, src.data) {
+		t.Errorf("file = %q, want %q", got, src.data)
+	}
+}
+
+func TestDownload_Checksum(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out")
+
+	data := []byte("hello, world")
+	src := &source{data: data, reads: map[int64]int{}}
+	obj := Object{Size: int64(len(data)), Version: "1", CRC32C: 1, HasCRC32C: true}
+	err := Download(context.Background(), path, obj, src.read, Options{ChunkSize: 5})
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("Download() error = %v, want %v", err, ErrChecksum)
+	}
+	if names, _ := filepath.Glob(path + "*"); len(names) != 0 {
+		t.Errorf("Download() with a bad checksum left %v", names)
+	}
+}
+
+func TestDownload_Parts(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out")
+
+	data := []byte("hello, multipart world")
+	var sums []byte
+	for _, part := range [][]byte{data[:10], data[10:20], data[20:]} {
+		sum := md5.Sum(part)
+		sums = append(sums, sum[:]...)
+	}
+	sum := md5.Sum(sums)
+	src := &source{data: data, reads: map[int64]int{}}
+
+	obj := Object{Size: int64(len(data)), Version: "1", MD5: sum[:], Parts: []int64{10, 10, 2}}
+	if err := Download(context.Background(), path, obj, src.read, Options{ChunkSize: 7}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, data) {
+		t.Errorf("file = %q, want %q", got, data)
+	}
+
+	// The same digest over other part boundaries does not match.
+	obj.Parts = []int64{11, 9, 2}
+	if err := Download(context.Background(), path, obj, src.read, Options{ChunkSize: 7}); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Download() with other parts error = %v, want %v", err, ErrChecksum)
+	}
+}
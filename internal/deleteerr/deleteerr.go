@@ -0,0 +1,24 @@
+// Package deleteerr formats the per-object errors of the bulk deletes in gcs
+// and s3, and of migrate runs.
+package deleteerr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Message returns summary followed by the errors of errs sorted by key.
+func Message(summary string, errs map[string]error) string {
+	keys := make([]string, 0, len(errs))
+	for k := range errs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", k, errs[k]))
+	}
+	return summary + ": " + strings.Join(msgs, "; ")
+}
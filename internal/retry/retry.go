@@ -0,0 +1,52 @@
+// Package retry calls an operation again with exponential backoff while it
+// fails with a retryable error. It backs the retries of gcs, the range
+// reads of DownloadToFile and the optimistic updates of docstore.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy is a backoff schedule.
+type Policy struct {
+	// MaxAttempts is the total number of attempts; 1 or less disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter waits a random duration up to the backoff instead of all of it,
+	// so writers that collided do not retry in lockstep.
+	Jitter bool
+}
+
+// Do calls fn until it succeeds, fails with an error retryable rejects, has
+// been called MaxAttempts times or ctx is done. It returns the last error of
+// fn.
+func Do(ctx context.Context, p Policy, retryable func(error) bool, fn func() error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		wait := backoff
+		if p.Jitter && wait > 0 {
+			wait = time.Duration(rand.Int63n(int64(wait)) + 1)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		backoff = time.Duration(float64(backoff) * p.Multiplier)
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
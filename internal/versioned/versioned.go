@@ -0,0 +1,301 @@
+// Package versioned reads and writes objects under version preconditions
+// for the stores of cas, lock, manifest and trash. A version identifies one
+// write of an object: its GCS generation or its S3 ETag.
+//
+// Those packages export ErrNotExist and ErrConflict as aliases of the errors
+// here, so a Store can return them unchanged.
+//
+// On S3 the bucket must support conditional writes (If-Match and
+// If-None-Match).
+package versioned
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+var (
+	// ErrNotExist is returned when an object does not exist.
+	ErrNotExist = errors.New("storage: object does not exist")
+	// ErrConflict is returned when a precondition fails because an object
+	// changed or already exists.
+	ErrConflict = errors.New("storage: object changed")
+)
+
+// Store is a storage.Store with versioned reads and conditional writes.
+type Store interface {
+	storage.Store
+	// StatVersion returns the attributes and version of key, or ErrNotExist.
+	StatVersion(ctx context.Context, key string) (*storage.Object, string, error)
+	// Get returns the body and version of key, or ErrNotExist.
+	Get(ctx context.Context, key string) ([]byte, string, error)
+	// Put writes data to key only if its version is still version, or only
+	// if key does not exist when version is empty. It returns ErrConflict
+	// otherwise. obj, which may be nil, carries the attributes of key.
+	Put(ctx context.Context, key string, data []byte, version string, obj *storage.Object) error
+	// Copy copies version of src to obj.Key with the attributes of obj,
+	// only if obj.Key does not exist. It returns ErrConflict when obj.Key
+	// exists or src is no longer at version.
+	Copy(ctx context.Context, src, version string, obj *storage.Object) error
+	// DeleteVersion removes key only if its version is still version, or
+	// returns ErrConflict. An empty version removes key unconditionally and
+	// does not fail for a missing key.
+	DeleteVersion(ctx context.Context, key, version string) error
+}
+
+type gcsStore struct {
+	storage.Store
+	client gcs.Client
+}
+
+// FromGCS adapts a gcs.Client to a Store using generation preconditions.
+// DeleteVersion removes the exact generation, so on a bucket with object
+// versioning a stale delete only removes its own noncurrent generation.
+func FromGCS(c gcs.Client) Store {
+	return &gcsStore{Store: storage.FromGCS(c), client: c}
+}
+
+func (g *gcsStore) StatVersion(ctx context.Context, key string) (*storage.Object, string, error) {
+	attrs, err := g.client.Attrs(ctx, key)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, "", ErrNotExist
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	obj := &storage.Object{
+		Key:                key,
+		Size:               attrs.Size,
+		MD5:                attrs.MD5,
+		ContentType:        attrs.ContentType,
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentLanguage:    attrs.ContentLanguage,
+		Metadata:           attrs.Metadata,
+		Updated:            attrs.Updated,
+	}
+	return obj, strconv.FormatInt(attrs.Generation, 10), nil
+}
+
+func (g *gcsStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	attrs, err := g.client.Attrs(ctx, key)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, "", ErrNotExist
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Read the generation reported by Attrs, so the body and version belong
+	// together. If it has been replaced since, report a conflict so the
+	// caller starts over.
+	data, err := g.client.GetVersion(ctx, key, attrs.Generation)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, "", ErrConflict
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, strconv.FormatInt(attrs.Generation, 10), nil
+}
+
+func (g *gcsStore) Put(ctx context.Context, key string, data []byte, version string, obj *storage.Object) error {
+	opts := putOptions(obj)
+	if version == "" {
+		opts.IfNotExist = true
+	} else {
+		gen, err := parseGeneration(version)
+		if err != nil {
+			return err
+		}
+		opts.IfGenerationMatch = gen
+	}
+
+	err := g.client.PutWithOptions(ctx, key, data, opts)
+	if gcs.IsPreconditionFailed(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (g *gcsStore) Copy(ctx context.Context, src, version string, obj *storage.Object) error {
+	gen, err := parseGeneration(version)
+	if err != nil {
+		return err
+	}
+	opts := putOptions(obj)
+	opts.IfNotExist = true
+	// Copy keeps the source metadata unless it is given; an empty map
+	// clears it, so obj.Metadata always replaces it.
+	if opts.Metadata == nil {
+		opts.Metadata = map[string]string{}
+	}
+
+	err = g.client.Copy(ctx, src, gen, obj.Key, opts)
+	if errors.Is(err, gcs.ErrObjectNotExist) || gcs.IsPreconditionFailed(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (g *gcsStore) DeleteVersion(ctx context.Context, key, version string) error {
+	if version == "" {
+		err := g.client.Delete(ctx, key)
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	gen, err := parseGeneration(version)
+	if err != nil {
+		return err
+	}
+	err = g.client.DeleteVersion(ctx, key, gen)
+	if errors.Is(err, gcs.ErrObjectNotExist) || gcs.IsPreconditionFailed(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func putOptions(obj *storage.Object) gcs.PutOptions {
+	if obj == nil {
+		return gcs.PutOptions{}
+	}
+	return gcs.PutOptions{
+		ContentType:        obj.ContentType,
+		CacheControl:       obj.CacheControl,
+		ContentDisposition: obj.ContentDisposition,
+		ContentLanguage:    obj.ContentLanguage,
+		Metadata:           obj.Metadata,
+	}
+}
+
+func parseGeneration(version string) (int64, error) {
+	gen, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("versioned: invalid generation %q", version)
+	}
+	return gen, nil
+}
+
+type s3Store struct {
+	storage.Store
+	interactor *s3.Interactor
+}
+
+// FromS3 adapts an s3.Interactor to a Store using ETag preconditions.
+// Written objects get the bucket's default, private ACL; copies keep the
+// grants of their source.
+func FromS3(i *s3.Interactor) Store {
+	return &s3Store{Store: storage.FromS3(i), interactor: i}
+}
+
+func (s *s3Store) StatVersion(ctx context.Context, key string) (*storage.Object, string, error) {
+	attrs, err := s.interactor.StatContext(ctx, key)
+	if s3.IsNotFound(err) {
+		return nil, "", ErrNotExist
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	obj := &storage.Object{
+		Key:                key,
+		Size:               attrs.Size,
+		ContentType:        attrs.ContentType,
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentLanguage:    attrs.ContentLanguage,
+		Metadata:           attrs.Metadata,
+		Updated:            attrs.LastModified,
+	}
+	return obj, attrs.ETag, nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) ([]byte, string, error) {
+	// Stat before downloading: a body newer than the ETag only makes the
+	// next conditional write fail, never succeed on stale data.
+	attrs, err := s.interactor.StatContext(ctx, key)
+	if s3.IsNotFound(err) {
+		return nil, "", ErrNotExist
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	body, _, err := s.interactor.DownloadContext(ctx, key)
+	if s3.IsNotFound(err) {
+		return nil, "", ErrConflict
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, attrs.ETag, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, data []byte, version string, obj *storage.Object) error {
+	opts := uploadOptions(obj)
+	opts.IfNotExist = version == ""
+	opts.IfMatch = version
+	err := s.interactor.UploadWithOptionsContext(ctx, bytes.NewReader(data), key, opts)
+	if s3.IsPreconditionFailed(err) || (version != "" && s3.IsNotFound(err)) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *s3Store) Copy(ctx context.Context, src, version string, obj *storage.Object) error {
+	opts := uploadOptions(obj)
+	opts.IfNotExist = true
+	opts.KeepACL = true
+	err := s.interactor.CopyContext(ctx, src, version, obj.Key, opts)
+	if s3.IsPreconditionFailed(err) || s3.IsNotFound(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *s3Store) DeleteVersion(ctx context.Context, key, version string) error {
+	if version == "" {
+		err := s.interactor.RemoveContext(ctx, key)
+		if s3.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	err := s.interactor.RemoveIfMatchContext(ctx, key, version)
+	if s3.IsPreconditionFailed(err) || s3.IsNotFound(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func uploadOptions(obj *storage.Object) s3.UploadOptions {
+	if obj == nil {
+		return s3.UploadOptions{}
+	}
+	return s3.UploadOptions{
+		ContentType:        obj.ContentType,
+		CacheControl:       obj.CacheControl,
+		ContentDisposition: obj.ContentDisposition,
+		ContentLanguage:    obj.ContentLanguage,
+		Metadata:           obj.Metadata,
+	}
+}
@@ -0,0 +1,290 @@
+// Package lock provides mutual exclusion across processes with a lock
+// object in a GCS or S3 bucket.
+//
+// A lease is acquired by creating the lock object only if it is absent, or by
+// replacing it once the lease it records has expired. Holders renew the lease
+// with a compare-and-swap on the object generation or ETag, and release it by
+// deleting exactly the version they wrote.
+//
+//	l := lock.New(lock.FromGCS(c), "locks/cron", lock.Options{TTL: time.Minute})
+//	lease, err := l.TryAcquire(ctx)
+//	if errors.Is(err, lock.ErrLocked) {
+//		return nil // another instance runs the job
+//	}
+//	defer lease.Release(context.Background())
+//
+// Expiry compares the recorded deadline with the local clock, so clocks of
+// the participating hosts must agree to well within the TTL.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrLocked is returned when the lock is held by an unexpired lease.
+	ErrLocked = errors.New("lock: held by another owner")
+	// ErrLost is returned when a lease expired or was taken over before it
+	// could be renewed or released.
+	ErrLost = errors.New("lock: lease lost")
+	// ErrReleased is returned by a Lease after Release.
+	ErrReleased = errors.New("lock: lease released")
+)
+
+// Options configures a Locker.
+type Options struct {
+	// TTL is how long a lease stays valid without renewal. Defaults to 30s.
+	TTL time.Duration
+	// RenewInterval is how often a lease is renewed in the background.
+	// Defaults to TTL/3; a negative value disables background renewal.
+	RenewInterval time.Duration
+	// RetryInterval is how often Acquire retries a held lock. Defaults to 1s.
+	RetryInterval time.Duration
+	// Owner identifies this process in the lock object. Defaults to hostname:pid.
+	Owner string
+}
+
+func (o Options) withDefaults() Options {
+	if o.TTL <= 0 {
+		o.TTL = 30 * time.Second
+	}
+	if o.RenewInterval == 0 {
+		o.RenewInterval = o.TTL / 3
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = time.Second
+	}
+	if o.Owner == "" {
+		host, _ := os.Hostname()
+		o.Owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return o
+}
+
+// Locker acquires leases on one lock object.
+type Locker struct {
+	store Store
+	key   string
+	opts  Options
+	now   func() time.Time
+}
+
+// New returns a Locker for the lock object key in store.
+func New(store Store, key string, opts Options) *Locker {
+	return &Locker{store: store, key: key, opts: opts.withDefaults(), now: time.Now}
+}
+
+// TryAcquire acquires the lock once, returning ErrLocked if it is held.
+func (l *Locker) TryAcquire(ctx context.Context) (*Lease, error) {
+	rec := Record{Owner: l.opts.Owner, Token: uuid.New().String(), Expires: l.now().Add(l.opts.TTL)}
+
+	cur, version, err := l.store.Stat(ctx, l.key)
+	switch {
+	case errors.Is(err, ErrNotExist):
+		err = l.store.Create(ctx, l.key, rec)
+	case err != nil:
+		return nil, err
+	case l.now().Before(cur.Expires):
+		return nil, ErrLocked
+	default:
+		err = l.store.Replace(ctx, l.key, version, rec)
+	}
+	if errors.Is(err, ErrConflict) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version, err = l.confirm(ctx, rec.Token)
+	if errors.Is(err, ErrLost) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &Lease{l: l, rec: rec, version: version, done: make(chan struct{}), stop: make(chan struct{})}
+	if l.opts.RenewInterval > 0 {
+		lease.wg.Add(1)
+		go lease.heartbeat()
+	}
+	return lease, nil
+}
+
+// Acquire retries TryAcquire every RetryInterval until it succeeds or ctx is done.
+func (l *Locker) Acquire(ctx context.Context) (*Lease, error) {
+	for {
+		lease, err := l.TryAcquire(ctx)
+		if !errors.Is(err, ErrLocked) {
+			return lease, err
+		}
+
+		t := time.NewTimer(l.opts.RetryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// confirm returns the version of the lock object after a successful write,
+// or ErrLost if another owner replaced it in the meantime.
+func (l *Locker) confirm(ctx context.Context, token string) (string, error) {
+	cur, version, err := l.store.Stat(ctx, l.key)
+	if errors.Is(err, ErrNotExist) {
+		return "", ErrLost
+	}
+	if err != nil {
+		return "", err
+	}
+	if cur.Token != token {
+		return "", ErrLost
+	}
+	return version, nil
+}
+
+// Lease is a held lock. It is renewed in the background unless
+// Options.RenewInterval is negative. It is safe for concurrent use.
+type Lease struct {
+	l    *Locker
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	rec     Record
+	version string
+	done    chan struct{}
+	err     error
+}
+
+// Token returns the unique token of the lease, usable as a fencing token.
+func (le *Lease) Token() string {
+	return le.rec.Token
+}
+
+// Expires returns the deadline of the lease as last written.
+func (le *Lease) Expires() time.Time {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.rec.Expires
+}
+
+// Done returns a channel that is closed when the lease is lost or released.
+func (le *Lease) Done() <-chan struct{} {
+	return le.done
+}
+
+// Err returns nil while the lease is held, then ErrLost or ErrReleased.
+func (le *Lease) Err() error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.err
+}
+
+// end records why the lease ended. The caller must hold le.mu.
+func (le *Lease) end(err error) {
+	if le.err == nil {
+		le.err = err
+		close(le.done)
+	}
+}
+
+// Renew extends the lease by the TTL, returning ErrLost if it was taken over.
+func (le *Lease) Renew(ctx context.Context) error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	if le.err != nil {
+		return le.err
+	}
+
+	rec := le.rec
+	rec.Expires = le.l.now().Add(le.l.opts.TTL)
+	err := le.l.store.Replace(ctx, le.l.key, le.version, rec)
+	if err == nil {
+		var version string
+		if version, err = le.l.confirm(ctx, rec.Token); err == nil {
+			le.rec, le.version = rec, version
+			return nil
+		}
+	}
+
+	if errors.Is(err, ErrConflict) || errors.Is(err, ErrLost) {
+		le.end(ErrLost)
+		return ErrLost
+	}
+	return err
+}
+
+// heartbeat renews the lease until it ends, giving up once it has expired
+// without a successful renewal.
+func (le *Lease) heartbeat() {
+	defer le.wg.Done()
+
+	interval := le.l.opts.RenewInterval
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-le.stop:
+			return
+		case <-le.done:
+			return
+		case <-t.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := le.Renew(ctx)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		le.mu.Lock()
+		if le.err == nil && !le.l.now().Before(le.rec.Expires) {
+			le.end(ErrLost)
+		}
+		le.mu.Unlock()
+	}
+}
+
+// Release stops renewal and deletes the lock object, returning ErrLost if
+// the lease was lost before. Releasing twice returns ErrReleased.
+func (le *Lease) Release(ctx context.Context) error {
+	le.mu.Lock()
+	select {
+	case <-le.stop:
+	default:
+		close(le.stop)
+	}
+	le.mu.Unlock()
+	le.wg.Wait()
+
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	if le.err != nil {
+		return le.err
+	}
+	err := le.l.store.Delete(ctx, le.l.key, le.version)
+	if errors.Is(err, ErrConflict) {
+		le.end(ErrLost)
+		return ErrLost
+	}
+	if err != nil {
+		return err
+	}
+	le.end(ErrReleased)
+	return nil
+}
@@ -0,0 +1,132 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func newStore(b storagetest.Backend) Store {
+	if b.GCS != nil {
+		return FromGCS(b.GCS)
+	}
+	return FromS3(b.S3)
+}
+
+func newLocker(store Store, owner string, c *storagetest.Clock) *Locker {
+	l := New(store, "locks/job", Options{TTL: time.Minute, RenewInterval: -1, Owner: owner})
+	l.now = c.Now
+	return l
+}
+
+func TestLocker(t *testing.T) {
+	storagetest.RunBackends(t, func(t *testing.T, backend storagetest.Backend) {
+		store := newStore(backend)
+		ctx := context.Background()
+		c := storagetest.NewClock(time.Now())
+		a, b := newLocker(store, "a", c), newLocker(store, "b", c)
+
+		lease, err := a.TryAcquire(ctx)
+		if err != nil {
+			t.Fatalf("TryAcquire() error = %v", err)
+		}
+		if _, err := b.TryAcquire(ctx); err != ErrLocked {
+			t.Fatalf("second TryAcquire() error = %v, want %v", err, ErrLocked)
+		}
+
+		c.Advance(30 * time.Second)
+		if err := lease.Renew(ctx); err != nil {
+			t.Fatalf("Renew() error = %v", err)
+		}
+		c.Advance(45 * time.Second)
+		if _, err := b.TryAcquire(ctx); err != ErrLocked {
+			t.Fatalf("TryAcquire() after Renew() error = %v, want %v", err, ErrLocked)
+		}
+
+		// The lease expires and b takes over.
+		c.Advance(time.Minute)
+		stolen, err := b.TryAcquire(ctx)
+		if err != nil {
+			t.Fatalf("TryAcquire() of expired lock error = %v", err)
+		}
+		if err := lease.Renew(ctx); err != ErrLost {
+			t.Errorf("Renew() of lost lease error = %v, want %v", err, ErrLost)
+		}
+		select {
+		case <-lease.Done():
+		default:
+			t.Error("Done() not closed after loss")
+		}
+		if err := lease.Release(ctx); err != ErrLost {
+			t.Errorf("Release() of lost lease error = %v, want %v", err, ErrLost)
+		}
+
+		if err := stolen.Release(ctx); err != nil {
+			t.Fatalf("Release() error = %v", err)
+		}
+		if err := stolen.Err(); err != ErrReleased {
+			t.Errorf("Err() after Release() = %v, want %v", err, ErrReleased)
+		}
+		if _, _, err := store.Stat(ctx, "locks/job"); err != ErrNotExist {
+			t.Errorf("Stat() after Release() error = %v, want %v", err, ErrNotExist)
+		}
+
+		lease, err = a.TryAcquire(ctx)
+		if err != nil {
+			t.Fatalf("TryAcquire() after Release() error = %v", err)
+		}
+		if err := lease.Release(ctx); err != nil {
+			t.Fatalf("Release() error = %v", err)
+		}
+	})
+}
+
+func TestLease_Heartbeat(t *testing.T) {
+	ctx := context.Background()
+	store := FromGCS(fake.New("test"))
+	a := New(store, "lock", Options{TTL: 100 * time.Millisecond, RenewInterval: 20 * time.Millisecond})
+	b := New(store, "lock", Options{TTL: 100 * time.Millisecond})
+
+	lease, err := a.TryAcquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err := b.TryAcquire(ctx); err != ErrLocked {
+		t.Errorf("TryAcquire() of renewed lock error = %v, want %v", err, ErrLocked)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocker_Acquire(t *testing.T) {
+	ctx := context.Background()
+	store := FromGCS(fake.New("test"))
+	opts := Options{TTL: time.Minute, RetryInterval: 10 * time.Millisecond}
+
+	lease, err := New(store, "lock", opts).TryAcquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		lease.Release(ctx)
+	}()
+
+	next, err := New(store, "lock", opts).Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer next.Release(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if _, err := New(store, "lock", opts).Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() of held lock error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
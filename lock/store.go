@@ -0,0 +1,133 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/internal/versioned"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+var (
+	// ErrNotExist is returned by a Store when the lock object does not exist.
+	ErrNotExist = versioned.ErrNotExist
+	// ErrConflict is returned by a Store when a conditional write or delete
+	// fails because the lock object changed.
+	ErrConflict = versioned.ErrConflict
+)
+
+// Record is the content of a lock object.
+type Record struct {
+	Owner   string    `json:"owner"`
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// Store holds lock objects with compare-and-swap semantics. A version
+// identifies one write of an object, such as a GCS generation or an S3 ETag.
+type Store interface {
+	// Stat returns the record and version of key, or ErrNotExist.
+	Stat(ctx context.Context, key string) (Record, string, error)
+	// Create writes rec to key only if key does not exist, or returns ErrConflict.
+	Create(ctx context.Context, key string, rec Record) error
+	// Replace writes rec to key only if its version is still version, or returns ErrConflict.
+	Replace(ctx context.Context, key, version string, rec Record) error
+	// Delete removes key only if its version is still version, or returns ErrConflict.
+	Delete(ctx context.Context, key, version string) error
+}
+
+// Metadata keys of a lock object. The record is also stored as the JSON
+// body, which makes every write change the S3 ETag.
+const (
+	metaOwner   = "lock-owner"
+	metaToken   = "lock-token"
+	metaExpires = "lock-expires"
+)
+
+func (r Record) metadata() map[string]string {
+	return map[string]string{
+		metaOwner:   r.Owner,
+		metaToken:   r.Token,
+		metaExpires: r.Expires.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func (r Record) body() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// parseRecord reads a record from object metadata. S3 returns metadata keys
+// in canonical header case, so they are matched case-insensitively.
+func parseRecord(key string, meta map[string]string) (Record, error) {
+	get := func(name string) string {
+		for k, v := range meta {
+			if strings.EqualFold(k, name) {
+				return v
+			}
+		}
+		return ""
+	}
+
+	rec := Record{Owner: get(metaOwner), Token: get(metaToken)}
+	expires, err := time.Parse(time.RFC3339Nano, get(metaExpires))
+	if rec.Token == "" || err != nil {
+		return Record{}, fmt.Errorf("lock: %s is not a lock object", key)
+	}
+	rec.Expires = expires
+	return rec, nil
+}
+
+type store struct {
+	v versioned.Store
+}
+
+// FromGCS keeps locks in a GCS bucket, conditioned on object generations.
+// Delete removes the exact generation, so on a bucket with object versioning
+// a stale release only deletes its own noncurrent generation.
+func FromGCS(c gcs.Client) Store {
+	return &store{v: versioned.FromGCS(c)}
+}
+
+// FromS3 keeps locks in an S3 bucket, conditioned on ETags.
+func FromS3(i *s3.Interactor) Store {
+	return &store{v: versioned.FromS3(i)}
+}
+
+func (s *store) Stat(ctx context.Context, key string) (Record, string, error) {
+	obj, version, err := s.v.StatVersion(ctx, key)
+	if err != nil {
+		return Record{}, "", err
+	}
+
+	rec, err := parseRecord(key, obj.Metadata)
+	return rec, version, err
+}
+
+func (s *store) Create(ctx context.Context, key string, rec Record) error {
+	return s.put(ctx, key, "", rec)
+}
+
+func (s *store) Replace(ctx context.Context, key, version string, rec Record) error {
+	if version == "" {
+		return fmt.Errorf("lock: replace %s without a version", key)
+	}
+	return s.put(ctx, key, version, rec)
+}
+
+func (s *store) put(ctx context.Context, key, version string, rec Record) error {
+	obj := &storage.Object{ContentType: "application/json", Metadata: rec.metadata()}
+	return s.v.Put(ctx, key, rec.body(), version, obj)
+}
+
+func (s *store) Delete(ctx context.Context, key, version string) error {
+	if version == "" {
+		return fmt.Errorf("lock: delete %s without a version", key)
+	}
+	return s.v.DeleteVersion(ctx, key, version)
+}
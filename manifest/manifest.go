@@ -0,0 +1,398 @@
+// Package manifest publishes sets of objects atomically. A transaction
+// uploads its objects under a staging prefix and commits by swapping the
+// manifest object of the dataset with a conditional write, so readers that
+// resolve keys through the manifest see either the old or the new set.
+//
+//	ds := manifest.New(manifest.FromGCS(c), manifest.Options{Prefix: "datasets/sales/"})
+//	tx, err := ds.Begin(ctx)
+//	err = tx.Write(ctx, "2020-09.csv", r, nil)
+//	m, err := tx.Commit(ctx)
+//
+// A dataset under Prefix holds:
+//
+//	MANIFEST               the committed set
+//	staging/<tx>/<name>    the objects written by transaction <tx>
+//
+// Objects no manifest refers to any more are removed by Clean once they have
+// been unreferenced for the grace period.
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+const (
+	manifestName = "MANIFEST"
+	stagingDir   = "staging/"
+	// timeFormat starts transaction IDs. It has a fixed width, so staging
+	// keys sort by start time and Clean can age them without a Stat.
+	timeFormat = "20060102T150405.000000000Z"
+)
+
+var (
+	// ErrDone is returned when a committed or aborted transaction is used.
+	ErrDone = errors.New("manifest: transaction already committed or aborted")
+	// ErrExpired is returned by Commit for a transaction that started more
+	// than the grace period ago, whose staged objects Clean may have removed.
+	ErrExpired = errors.New("manifest: transaction older than the grace period")
+	// ErrTooManyAttempts is returned when the manifest was replaced during
+	// every attempt to read it.
+	ErrTooManyAttempts = errors.New("manifest: too many concurrent commits")
+)
+
+// Options configures a Dataset.
+type Options struct {
+	// Prefix is the root of the dataset.
+	Prefix string
+	// GracePeriod is how long Clean keeps staging data that the current
+	// manifest does not refer to, which covers running transactions and
+	// readers of an older manifest. A transaction must commit within it.
+	// Defaults to 24h.
+	GracePeriod time.Duration
+	// MaxAttempts is the number of attempts to read a manifest that is
+	// being replaced. Defaults to 10.
+	MaxAttempts int
+}
+
+func (o Options) withDefaults() Options {
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = 24 * time.Hour
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	return o
+}
+
+// Manifest is a committed set of objects.
+type Manifest struct {
+	// Version starts at 1 and grows by one with every commit.
+	Version   int       `json:"version"`
+	Tx        string    `json:"tx"`
+	Committed time.Time `json:"committed"`
+	// Objects maps names to their objects.
+	Objects map[string]Entry `json:"objects"`
+	// Retired maps the keys that commits within the grace period removed
+	// from the set to the time they were removed. Clean keeps them for
+	// readers of the older manifests.
+	Retired map[string]time.Time `json:"retired,omitempty"`
+}
+
+// Entry is an object in a manifest.
+type Entry struct {
+	// Key is relative to the dataset prefix.
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// Names returns the names in m in lexical order.
+func (m *Manifest) Names() []string {
+	names := make([]string, 0, len(m.Objects))
+	for name := range m.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dataset is a set of objects published through a manifest.
+type Dataset struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+}
+
+// New returns the Dataset under opts.Prefix of store.
+func New(store Store, opts Options) *Dataset {
+	return &Dataset{store: store, opts: opts.withDefaults(), now: time.Now}
+}
+
+func (d *Dataset) manifestKey() string { return d.opts.Prefix + manifestName }
+
+// load returns the current manifest and its version, which is empty when
+// nothing has been committed yet.
+func (d *Dataset) load(ctx context.Context) (*Manifest, string, error) {
+	for attempt := 0; attempt < d.opts.MaxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		data, version, err := d.store.Get(ctx, d.manifestKey())
+		switch {
+		case errors.Is(err, ErrNotExist):
+			return &Manifest{Objects: map[string]Entry{}}, "", nil
+		case errors.Is(err, ErrConflict):
+			// Replaced while being read; read the newer one.
+			continue
+		case err != nil:
+			return nil, "", fmt.Errorf("manifest: read %s: %w", d.manifestKey(), err)
+		}
+
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, "", fmt.Errorf("manifest: decode %s: %w", d.manifestKey(), err)
+		}
+		if m.Objects == nil {
+			m.Objects = map[string]Entry{}
+		}
+		return &m, version, nil
+	}
+	return nil, "", ErrTooManyAttempts
+}
+
+// Snapshot returns the current manifest for reading. Reads through one
+// snapshot see one consistent set, as long as they finish within the grace
+// period after a newer commit.
+func (d *Dataset) Snapshot(ctx context.Context) (*Snapshot, error) {
+	m, _, err := d.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Manifest: m, d: d}, nil
+}
+
+// Open opens name in the current manifest.
+func (d *Dataset) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	s, err := d.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Open(ctx, name)
+}
+
+// Snapshot reads the objects of one manifest.
+type Snapshot struct {
+	*Manifest
+	d *Dataset
+}
+
+// Open opens name, or returns ErrNotExist if the manifest does not list it.
+func (s *Snapshot) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	e, ok := s.Objects[name]
+	if !ok {
+		return nil, fmt.Errorf("manifest: %s: %w", name, ErrNotExist)
+	}
+	return s.d.store.Open(ctx, s.d.opts.Prefix+e.Key)
+}
+
+// Begin starts a transaction on top of the current manifest. The committed
+// set is that manifest with the writes and deletes of the transaction
+// applied.
+func (d *Dataset) Begin(ctx context.Context) (*Tx, error) {
+	base, version, err := d.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	started := d.now().UTC()
+	id := started.Format(timeFormat) + "-" + uuid.New().String()
+	return &Tx{d: d, id: id, started: started, base: base, version: version, writes: map[string]Entry{}, deletes: map[string]bool{}}, nil
+}
+
+// Tx is a transaction. Its methods are safe for concurrent use, so objects
+// can be uploaded in parallel.
+type Tx struct {
+	d       *Dataset
+	id      string
+	started time.Time
+	base    *Manifest
+	version string
+
+	mu      sync.Mutex
+	writes  map[string]Entry
+	deletes map[string]bool
+	done    bool
+}
+
+// ID returns the transaction ID, which names its staging prefix.
+func (tx *Tx) ID() string { return tx.id }
+
+// Write stages r as name. obj, which may be nil, carries the attributes of
+// the object.
+func (tx *Tx) Write(ctx context.Context, name string, r io.Reader, obj *storage.Object) error {
+	if name == "" {
+		return errors.New("manifest: empty name")
+	}
+	if tx.isDone() {
+		return ErrDone
+	}
+
+	key := stagingDir + tx.id + "/" + name
+	attrs := storage.Object{}
+	if obj != nil {
+		attrs = *obj
+	}
+	attrs.Key = tx.d.opts.Prefix + key
+	cr := &countingReader{r: r}
+	if err := tx.d.store.Write(ctx, attrs.Key, cr, &attrs); err != nil {
+		return fmt.Errorf("manifest: write %s: %w", name, err)
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.writes[name] = Entry{Key: key, Size: cr.n}
+	delete(tx.deletes, name)
+	return nil
+}
+
+// Delete removes name from the committed set.
+func (tx *Tx) Delete(name string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrDone
+	}
+	delete(tx.writes, name)
+	tx.deletes[name] = true
+	return nil
+}
+
+func (tx *Tx) isDone() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.done
+}
+
+// Commit publishes the transaction and returns the new manifest. It
+// returns ErrConflict if another transaction committed since Begin, and
+// ErrExpired if the transaction started more than the grace period ago; the
+// staged objects are then left for Abort or Clean.
+func (tx *Tx) Commit(ctx context.Context) (*Manifest, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, ErrDone
+	}
+
+	now := tx.d.now().UTC()
+	cutoff := now.Add(-tx.d.opts.GracePeriod)
+	if !tx.started.After(cutoff) {
+		return nil, ErrExpired
+	}
+
+	m := &Manifest{
+		Version:   tx.base.Version + 1,
+		Tx:        tx.id,
+		Committed: now,
+		Objects:   make(map[string]Entry, len(tx.base.Objects)+len(tx.writes)),
+		Retired:   map[string]time.Time{},
+	}
+	for name, e := range tx.base.Objects {
+		if !tx.deletes[name] {
+			m.Objects[name] = e
+		}
+	}
+	for name, e := range tx.writes {
+		m.Objects[name] = e
+	}
+
+	// Keep the keys this commit drops, and those dropped within the grace
+	// period, so Clean ages them from now rather than from their start.
+	for key, at := range tx.base.Retired {
+		if at.After(cutoff) {
+			m.Retired[key] = at
+		}
+	}
+	for name, e := range tx.base.Objects {
+		if m.Objects[name] != e {
+			m.Retired[e.Key] = now
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.d.store.Put(ctx, tx.d.manifestKey(), data, tx.version); err != nil {
+		if errors.Is(err, ErrConflict) {
+			return nil, ErrConflict
+		}
+		return nil, fmt.Errorf("manifest: commit %s: %w", tx.id, err)
+	}
+	tx.done = true
+	return m, nil
+}
+
+// Abort deletes the staged objects of an uncommitted transaction.
+func (tx *Tx) Abort(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrDone
+	}
+	tx.done = true
+
+	for _, e := range tx.writes {
+		if err := tx.d.store.Delete(ctx, tx.d.opts.Prefix+e.Key); err != nil {
+			return fmt.Errorf("manifest: abort %s: %w", tx.id, err)
+		}
+	}
+	return nil
+}
+
+// Clean deletes the staging objects that the current manifest does not
+// refer to and whose transaction started more than GracePeriod ago, such as
+// the leftovers of failed transactions. Data replaced by a commit is kept
+// until GracePeriod after that commit. It returns the deleted keys.
+func (d *Dataset) Clean(ctx context.Context) ([]string, error) {
+	m, _, err := d.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := d.now().Add(-d.opts.GracePeriod)
+	live := make(map[string]bool, len(m.Objects)+len(m.Retired))
+	for _, e := range m.Objects {
+		live[e.Key] = true
+	}
+	for key, at := range m.Retired {
+		if at.After(cutoff) {
+			live[key] = true
+		}
+	}
+
+	keys, err := d.store.List(ctx, d.opts.Prefix+stagingDir)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: list staging: %w", err)
+	}
+
+	var deleted []string
+	for _, key := range keys {
+		rel := strings.TrimPrefix(key, d.opts.Prefix)
+		if live[rel] {
+			continue
+		}
+		// Keys that do not start with a transaction time are not ours.
+		started, err := time.Parse(timeFormat, strings.SplitN(strings.TrimPrefix(rel, stagingDir), "-", 2)[0])
+		if err != nil || !started.Before(cutoff) {
+			continue
+		}
+		if err := d.store.Delete(ctx, key); err != nil {
+			return deleted, fmt.Errorf("manifest: clean %s: %w", key, err)
+		}
+		deleted = append(deleted, key)
+	}
+	return deleted, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,261 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func newStore(b storagetest.Backend) Store {
+	if b.GCS != nil {
+		return FromGCS(b.GCS)
+	}
+	return FromS3(b.S3)
+}
+
+func TestDataset(t *testing.T) {
+	storagetest.RunBackends(t, func(t *testing.T, backend storagetest.Backend) {
+		store := newStore(backend)
+		ctx := context.Background()
+		now := time.Now()
+		d := New(store, Options{Prefix: "ds/", GracePeriod: time.Hour})
+		d.now = func() time.Time { return now }
+
+		read := func(s *Snapshot, name string) string {
+			t.Helper()
+			r, err := s.Open(ctx, name)
+			if err != nil {
+				t.Fatalf("Open(%s) error = %v", name, err)
+			}
+			defer r.Close()
+			data, _ := ioutil.ReadAll(r)
+			return string(data)
+		}
+
+		tx, err := d.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []string{"a", "b"} {
+			if err := tx.Write(ctx, n, strings.NewReader(n+"1"), nil); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+
+		// Nothing is visible before the commit.
+		if _, err := d.Open(ctx, "a"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Open() before Commit() error = %v, want %v", err, ErrNotExist)
+		}
+		m, err := tx.Commit(ctx)
+		if err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+		if m.Version != 1 || !reflect.DeepEqual(m.Names(), []string{"a", "b"}) {
+			t.Errorf("Commit() = %+v", m)
+		}
+		if err := tx.Write(ctx, "c", strings.NewReader("c"), nil); err != ErrDone {
+			t.Errorf("Write() after Commit() error = %v, want %v", err, ErrDone)
+		}
+
+		old, err := d.Snapshot(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Two transactions race; the second to commit loses.
+		tx2, _ := d.Begin(ctx)
+		tx3, _ := d.Begin(ctx)
+		if err := tx2.Write(ctx, "a", strings.NewReader("a2"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx2.Delete("b"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx3.Write(ctx, "x", strings.NewReader("x"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx2.Commit(ctx); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+		if _, err := tx3.Commit(ctx); err != ErrConflict {
+			t.Errorf("Commit() of stale transaction error = %v, want %v", err, ErrConflict)
+		}
+
+		cur, err := d.Snapshot(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cur.Version != 2 || !reflect.DeepEqual(cur.Names(), []string{"a"}) || read(cur, "a") != "a2" {
+			t.Errorf("current manifest = %+v", cur.Manifest)
+		}
+		// The old snapshot still reads the old set.
+		if read(old, "a") != "a1" || read(old, "b") != "b1" {
+			t.Error("old snapshot changed")
+		}
+
+		// Clean keeps everything within the grace period, then removes
+		// the replaced objects and the staging data of tx3.
+		if deleted, err := d.Clean(ctx); err != nil || len(deleted) != 0 {
+			t.Errorf("Clean() = %v, %v, want nothing", deleted, err)
+		}
+		now = now.Add(2 * time.Hour)
+		deleted, err := d.Clean(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			"ds/staging/" + tx.ID() + "/a",
+			"ds/staging/" + tx.ID() + "/b",
+			"ds/staging/" + tx3.ID() + "/x",
+		}
+		if !sameSet(deleted, want) {
+			t.Errorf("Clean() = %v, want %v", deleted, want)
+		}
+		if read(cur, "a") != "a2" {
+			t.Error("Clean() removed live data")
+		}
+	})
+}
+
+func TestTx_Abort(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New("test")
+	d := New(FromGCS(c), Options{})
+
+	tx, err := d.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Write(ctx, "a", strings.NewReader("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Abort(ctx); err != nil {
+		t.Fatalf("Abort() error = %v", err)
+	}
+	if objs := c.Objects(); len(objs) != 0 {
+		t.Errorf("objects after Abort() = %v", objs)
+	}
+	if _, err := tx.Commit(ctx); err != ErrDone {
+		t.Errorf("Commit() after Abort() error = %v, want %v", err, ErrDone)
+	}
+}
+
+func TestDataset_CleanRetired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := New(FromGCS(fake.New("test")), Options{GracePeriod: time.Hour})
+	d.now = func() time.Time { return now }
+
+	commit := func(body string) *Tx {
+		t.Helper()
+		tx, err := d.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Write(ctx, "a", strings.NewReader(body), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+		return tx
+	}
+
+	tx1 := commit("a1")
+	now = now.Add(2 * time.Hour)
+	old, err := d.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit("a2")
+
+	// tx1 started long ago, but its data was only replaced now.
+	if deleted, err := d.Clean(ctx); err != nil || len(deleted) != 0 {
+		t.Errorf("Clean() = %v, %v, want nothing", deleted, err)
+	}
+	if r, err := old.Open(ctx, "a"); err != nil {
+		t.Errorf("Open() of replaced data error = %v", err)
+	} else {
+		r.Close()
+	}
+
+	now = now.Add(2 * time.Hour)
+	deleted, err := d.Clean(ctx)
+	if want := []string{"staging/" + tx1.ID() + "/a"}; err != nil || !reflect.DeepEqual(deleted, want) {
+		t.Errorf("Clean() = %v, %v, want %v", deleted, err, want)
+	}
+}
+
+func TestTx_CommitExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := New(FromGCS(fake.New("test")), Options{GracePeriod: time.Hour})
+	d.now = func() time.Time { return now }
+
+	tx, err := d.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Write(ctx, "a", strings.NewReader("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := tx.Commit(ctx); err != ErrExpired {
+		t.Errorf("Commit() error = %v, want %v", err, ErrExpired)
+	}
+	if _, err := d.Open(ctx, "a"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Open() after expired Commit() error = %v, want %v", err, ErrNotExist)
+	}
+}
+
+// conflictStore reports every manifest read as replaced.
+type conflictStore struct {
+	Store
+	gets int
+}
+
+func (s *conflictStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	s.gets++
+	return nil, "", ErrConflict
+}
+
+func TestDataset_loadAttempts(t *testing.T) {
+	store := &conflictStore{Store: FromGCS(fake.New("test"))}
+	d := New(store, Options{MaxAttempts: 3})
+
+	if _, err := d.Snapshot(context.Background()); err != ErrTooManyAttempts {
+		t.Errorf("Snapshot() error = %v, want %v", err, ErrTooManyAttempts)
+	}
+	if store.gets != 3 {
+		t.Errorf("Get() called %d times, want 3", store.gets)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.Snapshot(ctx); err != context.Canceled {
+		t.Errorf("Snapshot() with canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func sameSet(a, b []string) bool {
+	m := make(map[string]int)
+	for _, s := range a {
+		m[s]++
+	}
+	for _, s := range b {
+		m[s]--
+	}
+	for _, n := range m {
+		if n != 0 {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
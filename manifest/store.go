@@ -0,0 +1,55 @@
+package manifest
+
+import (
+	"context"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/internal/versioned"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+var (
+	// ErrNotExist is returned when an object or a manifest entry does not exist.
+	ErrNotExist = versioned.ErrNotExist
+	// ErrConflict is returned when a conditional write fails because the
+	// object changed, and by Commit when another transaction committed first.
+	ErrConflict = versioned.ErrConflict
+)
+
+// Store is the view of a bucket a Dataset lives in. Data objects are
+// streamed through the storage.Store methods; the manifest is swapped with
+// Get and Put. A version identifies one write of an object, such as a GCS
+// generation or an S3 ETag.
+type Store interface {
+	storage.Store
+	// Get returns the body and version of key, or ErrNotExist.
+	Get(ctx context.Context, key string) ([]byte, string, error)
+	// Put writes data to key only if its version is still version, or only
+	// if key does not exist when version is empty. It returns ErrConflict
+	// otherwise.
+	Put(ctx context.Context, key string, data []byte, version string) error
+}
+
+type store struct {
+	versioned.Store
+}
+
+// FromGCS keeps a Dataset in a GCS bucket.
+func FromGCS(c gcs.Client) Store {
+	return &store{Store: versioned.FromGCS(c)}
+}
+
+// FromS3 keeps a Dataset in an S3 bucket.
+func FromS3(i *s3.Interactor) Store {
+	return &store{Store: versioned.FromS3(i)}
+}
+
+func (s *store) Put(ctx context.Context, key string, data []byte, version string) error {
+	return s.Store.Put(ctx, key, data, version, &storage.Object{ContentType: "application/json"})
+}
+
+// Delete does not fail for a missing key, so Clean and Abort can be retried.
+func (s *store) Delete(ctx context.Context, key string) error {
+	return s.DeleteVersion(ctx, key, "")
+}
@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// checkpoint records finished copies in an append-only JSON lines file so an
+// interrupted run can skip them on restart. An entry only counts for a run
+// with the same source prefix and destination key. A torn last line is
+// ignored.
+type checkpoint struct {
+	mu     sync.Mutex
+	file   *os.File
+	prefix string
+	done   map[copyID]bool
+}
+
+type copyID struct {
+	key, dest string
+}
+
+type checkpointEntry struct {
+	Prefix string `json:"prefix"`
+	Key    string `json:"key"`
+	Dest   string `json:"dest"`
+	MD5    string `json:"md5,omitempty"`
+}
+
+func openCheckpoint(path, prefix string) (*checkpoint, error) {
+	cp := &checkpoint{prefix: prefix, done: map[copyID]bool{}}
+	if path == "" {
+		return cp, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e checkpointEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Prefix != prefix || e.Dest == "" {
+			continue
+		}
+		cp.done[copyID{e.Key, e.Dest}] = true
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cp.file = f
+	return cp, nil
+}
+
+func (c *checkpoint) isDone(key, dest string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[copyID{key, dest}]
+}
+
+func (c *checkpoint) markDone(key, dest, md5 string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.done[copyID{key, dest}] = true
+	if c.file == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(checkpointEntry{Prefix: c.prefix, Key: key, Dest: dest, MD5: md5})
+	if err != nil {
+		return err
+	}
+	// Start on a fresh line in case a previous run was killed mid-write.
+	if _, err := c.file.Write(append(append([]byte{'\n'}, b...), '\n')); err != nil {
+		return err
+	}
+	return c.file.Sync()
+}
+
+func (c *checkpoint) close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
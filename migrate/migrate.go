@@ -0,0 +1,215 @@
+// Package migrate copies objects between gcs and s3 buckets.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hayashiki/go-pkg/internal/deleteerr"
+)
+
+// defaultParallelism is the number of objects copied at once when Options.Parallelism is unset.
+const defaultParallelism = 4
+
+// ErrChecksumMismatch is returned when the copied bytes do not match the source or destination digest.
+var ErrChecksumMismatch = errors.New("migrate: checksum mismatch")
+
+type Options struct {
+	// Prefix selects the source objects to copy.
+	Prefix string
+	// DestPrefix replaces Prefix in destination keys. Keys are kept as is when empty.
+	DestPrefix string
+	// Parallelism bounds the number of concurrent copies.
+	Parallelism int
+	// CheckpointFile records finished copies so a rerun resumes where it
+	// stopped. A copy is only skipped if it was recorded for the same Prefix
+	// and destination key; use one file per destination bucket.
+	CheckpointFile string
+}
+
+// Result summarises a migration run.
+type Result struct {
+	Copied  []string
+	Skipped []string
+	Failed  map[string]error
+	// SizeOnly lists the copied keys whose destination reported no digest,
+	// such as multipart S3 uploads, so only their size could be verified.
+	SizeOnly []string
+}
+
+// Err returns an error describing the failed keys, or nil if every copy succeeded.
+func (r *Result) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+
+	return errors.New(deleteerr.Message(fmt.Sprintf("migrate: failed to copy %d object(s)", len(r.Failed)), r.Failed))
+}
+
+// Run copies every object under opts.Prefix from src to dst. Copies already
+// recorded in the checkpoint file are skipped. Per-object failures are
+// collected in the result; the returned error is only set when the run
+// could not start or ctx was cancelled.
+func Run(ctx context.Context, src, dst Store, opts Options) (*Result, error) {
+	cp, err := openCheckpoint(opts.CheckpointFile, opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: open checkpoint: %w", err)
+	}
+	defer cp.close()
+
+	keys, err := src.List(ctx, opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: list %q: %w", opts.Prefix, err)
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = &Result{Failed: map[string]error{}}
+		sem    = make(chan struct{}, parallelism)
+	)
+
+	for _, key := range keys {
+		if cp.isDone(key, destKey(key, opts)) {
+			result.Skipped = append(result.Skipped, key)
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			sum, verified, err := copyObject(ctx, src, dst, key, destKey(key, opts))
+			if err == nil {
+				err = cp.markDone(key, destKey(key, opts), hex.EncodeToString(sum))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed[key] = err
+				return
+			}
+			result.Copied = append(result.Copied, key)
+			if !verified {
+				result.SizeOnly = append(result.SizeOnly, key)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	sort.Strings(result.Copied)
+	sort.Strings(result.Skipped)
+	sort.Strings(result.SizeOnly)
+
+	return result, ctx.Err()
+}
+
+func destKey(key string, opts Options) string {
+	if opts.DestPrefix == "" {
+		return key
+	}
+	return opts.DestPrefix + strings.TrimPrefix(key, opts.Prefix)
+}
+
+// copyObject streams key from src to dst and returns the MD5 of the copied
+// bytes, and whether dst reported a digest to verify the copy against. The
+// source is verified while it is read, so a short or corrupt read fails the
+// write before dst commits it. A copy whose size or digest reported by dst
+// does not match is deleted.
+func copyObject(ctx context.Context, src, dst Store, key, dstKey string) ([]byte, bool, error) {
+	obj, err := src.Stat(ctx, key)
+	if err != nil {
+		return nil, false, fmt.Errorf("stat source: %w", err)
+	}
+
+	r, err := src.Open(ctx, key)
+	if err != nil {
+		return nil, false, fmt.Errorf("open source: %w", err)
+	}
+	defer r.Close()
+
+	vr := &verifyingReader{r: r, h: md5.New(), key: key, obj: obj}
+	err = dst.Write(ctx, dstKey, vr, obj)
+	if vr.err != nil {
+		return nil, false, vr.err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("write destination: %w", err)
+	}
+	if err := vr.verify(); err != nil {
+		// The destination stopped reading early and committed a prefix.
+		dst.Delete(ctx, dstKey)
+		return nil, false, err
+	}
+	sum := vr.h.Sum(nil)
+
+	copied, err := dst.Stat(ctx, dstKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("stat destination: %w", err)
+	}
+	if copied.Size != vr.n || (copied.MD5 != nil && !bytes.Equal(copied.MD5, sum)) {
+		if err := dst.Delete(ctx, dstKey); err != nil {
+			return nil, false, fmt.Errorf("destination %s: %v, delete: %w", dstKey, ErrChecksumMismatch, err)
+		}
+		return nil, false, fmt.Errorf("destination %s: %w", dstKey, ErrChecksumMismatch)
+	}
+
+	return sum, copied.MD5 != nil, nil
+}
+
+// verifyingReader hashes the source while it is read. At the end of the
+// source it returns the verification error in place of io.EOF, so the
+// destination aborts its write.
+type verifyingReader struct {
+	r   io.Reader
+	h   hash.Hash
+	key string
+	obj *Object
+	n   int64
+	err error
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.h.Write(p[:n])
+	v.n += int64(n)
+	if err == io.EOF {
+		if v.err = v.verify(); v.err != nil {
+			return n, v.err
+		}
+	}
+	return n, err
+}
+
+// verify checks the bytes read so far against the size and digest of the source.
+func (v *verifyingReader) verify() error {
+	if v.n != v.obj.Size {
+		return fmt.Errorf("source %s: read %d of %d bytes: %w", v.key, v.n, v.obj.Size, io.ErrUnexpectedEOF)
+	}
+	if v.obj.MD5 != nil && !bytes.Equal(v.obj.MD5, v.h.Sum(nil)) {
+		return fmt.Errorf("source %s: %w", v.key, ErrChecksumMismatch)
+	}
+	return nil
+}
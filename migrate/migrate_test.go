@@ -0,0 +1,321 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/hayashiki/go-pkg/gcs/fake"
+)
+
+type memStore struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	attrs    map[string]*Object
+	badMD5   map[string]bool
+	failOpen map[string]bool
+	// corrupt makes Write store a different body than it read.
+	corrupt bool
+	// noMD5 makes Write store objects without a digest, like a multipart
+	// S3 upload.
+	noMD5 bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		objects:  map[string][]byte{},
+		attrs:    map[string]*Object{},
+		badMD5:   map[string]bool{},
+		failOpen: map[string]bool{},
+	}
+}
+
+func (m *memStore) put(key, body, contentType string) {
+	sum := md5.Sum([]byte(body))
+	m.objects[key] = []byte(body)
+	m.attrs[key] = &Object{Key: key, Size: int64(len(body)), MD5: sum[:], ContentType: contentType}
+}
+
+func (m *memStore) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memStore) Stat(ctx context.Context, key string) (*Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attrs[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	obj := *a
+	if m.badMD5[key] {
+		obj.MD5 = []byte("0123456789abcdef")
+	}
+	return &obj, nil
+}
+
+func (m *memStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failOpen[key] {
+		return nil, errors.New("open failed")
+	}
+	return ioutil.NopCloser(bytes.NewReader(m.objects[key])), nil
+}
+
+func (m *memStore) Write(ctx context.Context, key string, r io.Reader, obj *Object) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.corrupt {
+		b = append(b, '!')
+	}
+	sum := md5.Sum(b)
+	m.objects[key] = b
+	m.attrs[key] = &Object{Key: key, Size: int64(len(b)), MD5: sum[:], ContentType: obj.ContentType, Metadata: obj.Metadata}
+	if m.noMD5 {
+		m.attrs[key].MD5 = nil
+	}
+	return nil
+}
+
+func (m *memStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+	delete(m.attrs, key)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       Options
+		setup      func(src *memStore)
+		wantKeys   []string
+		wantCopied []string
+		wantFailed []string
+	}{
+		{
+			name: "copy prefix",
+			opts: Options{Prefix: "a/"},
+			setup: func(src *memStore) {
+				src.put("a/1.txt", "one", "text/plain")
+				src.put("a/2.png", "two", "image/png")
+				src.put("b/3.txt", "three", "text/plain")
+			},
+			wantKeys:   []string{"a/1.txt", "a/2.png"},
+			wantCopied: []string{"a/1.txt", "a/2.png"},
+		},
+		{
+			name: "dest prefix",
+			opts: Options{Prefix: "a/", DestPrefix: "backup/"},
+			setup: func(src *memStore) {
+				src.put("a/1.txt", "one", "text/plain")
+			},
+			wantKeys:   []string{"backup/1.txt"},
+			wantCopied: []string{"a/1.txt"},
+		},
+		{
+			name: "checksum mismatch",
+			opts: Options{},
+			setup: func(src *memStore) {
+				src.put("ok.txt", "ok", "text/plain")
+				src.put("bad.txt", "bad", "text/plain")
+				src.badMD5["bad.txt"] = true
+			},
+			wantKeys:   []string{"ok.txt"},
+			wantCopied: []string{"ok.txt"},
+			wantFailed: []string{"bad.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := newMemStore(), newMemStore()
+			tt.setup(src)
+
+			got, err := Run(context.Background(), src, dst, tt.opts)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Copied, tt.wantCopied) {
+				t.Errorf("Run() copied = %v, want %v", got.Copied, tt.wantCopied)
+			}
+			var failed []string
+			for k := range got.Failed {
+				failed = append(failed, k)
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("Run() failed = %v, want %v", failed, tt.wantFailed)
+			}
+			keys, _ := dst.List(context.Background(), "")
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("destination keys = %v, want %v", keys, tt.wantKeys)
+			}
+			for _, k := range got.Copied {
+				if !bytes.Equal(dst.objects[destKey(k, tt.opts)], src.objects[k]) {
+					t.Errorf("destination %s differs from source", k)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cpFile := filepath.Join(dir, "checkpoint.jsonl")
+
+	src, dst := newMemStore(), newMemStore()
+	src.put("1.txt", "one", "text/plain")
+	src.put("2.txt", "two", "text/plain")
+	src.failOpen["2.txt"] = true
+
+	first, err := Run(context.Background(), src, dst, Options{CheckpointFile: cpFile})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if first.Err() == nil {
+		t.Fatalf("Run() expected a failed key")
+	}
+
+	src.failOpen["2.txt"] = false
+	second, err := Run(context.Background(), src, dst, Options{CheckpointFile: cpFile})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(second.Skipped, []string{"1.txt"}) {
+		t.Errorf("Run() skipped = %v, want [1.txt]", second.Skipped)
+	}
+	if !reflect.DeepEqual(second.Copied, []string{"2.txt"}) {
+		t.Errorf("Run() copied = %v, want [2.txt]", second.Copied)
+	}
+}
+
+func TestRun_corruptDestination(t *testing.T) {
+	src, dst := newMemStore(), newMemStore()
+	src.put("a.txt", "a", "text/plain")
+	dst.corrupt = true
+
+	got, err := Run(context.Background(), src, dst, Options{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !errors.Is(got.Failed["a.txt"], ErrChecksumMismatch) {
+		t.Errorf("Run() failed = %v, want %v for a.txt", got.Failed, ErrChecksumMismatch)
+	}
+	if keys, _ := dst.List(context.Background(), ""); len(keys) != 0 {
+		t.Errorf("destination keys = %v, want none", keys)
+	}
+}
+
+func TestRun_sizeOnly(t *testing.T) {
+	src, dst := newMemStore(), newMemStore()
+	src.put("b.txt", "b", "text/plain")
+	src.put("a.txt", "a", "text/plain")
+	dst.noMD5 = true
+
+	got, err := Run(context.Background(), src, dst, Options{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := []string{"a.txt", "b.txt"}; !reflect.DeepEqual(got.SizeOnly, want) {
+		t.Errorf("Run() size only = %v, want %v", got.SizeOnly, want)
+	}
+
+	// Without a digest, a copy of the wrong size is still rejected.
+	dst = newMemStore()
+	dst.noMD5, dst.corrupt = true, true
+	got, err = Run(context.Background(), src, dst, Options{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !errors.Is(got.Failed["a.txt"], ErrChecksumMismatch) {
+		t.Errorf("Run() failed = %v, want %v for a.txt", got.Failed, ErrChecksumMismatch)
+	}
+}
+
+func TestResult_Err(t *testing.T) {
+	r := &Result{Failed: map[string]error{"b": errors.New("denied"), "a": errors.New("timeout")}}
+	want := "migrate: failed to copy 2 object(s): a: timeout; b: denied"
+	if err := r.Err(); err == nil || err.Error() != want {
+		t.Errorf("Err() = %v, want %q", err, want)
+	}
+	if err := (&Result{}).Err(); err != nil {
+		t.Errorf("Err() of a clean run = %v, want nil", err)
+	}
+}
+
+func TestRun_checkpointDestination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cpFile := filepath.Join(dir, "checkpoint.jsonl")
+
+	src, dst := newMemStore(), newMemStore()
+	src.put("a/1.txt", "one", "text/plain")
+
+	for _, tt := range []struct {
+		opts        Options
+		wantSkipped []string
+	}{
+		{Options{Prefix: "a/", DestPrefix: "x/", CheckpointFile: cpFile}, nil},
+		{Options{Prefix: "a/", DestPrefix: "x/", CheckpointFile: cpFile}, []string{"a/1.txt"}},
+		{Options{Prefix: "a/", DestPrefix: "y/", CheckpointFile: cpFile}, nil},
+		{Options{Prefix: "a/1", DestPrefix: "x/", CheckpointFile: cpFile}, nil},
+	} {
+		got, err := Run(context.Background(), src, dst, tt.opts)
+		if err != nil || got.Err() != nil {
+			t.Fatalf("Run(%+v) error = %v, %v", tt.opts, err, got.Err())
+		}
+		if !reflect.DeepEqual(got.Skipped, tt.wantSkipped) {
+			t.Errorf("Run(%+v) skipped = %v, want %v", tt.opts, got.Skipped, tt.wantSkipped)
+		}
+	}
+}
+
+func TestFromGCS_writeAborts(t *testing.T) {
+	c := fake.New("test")
+	r := iotest.TimeoutReader(strings.NewReader("partial"))
+	err := FromGCS(c).Write(context.Background(), "a.txt", r, &Object{})
+	if err != iotest.ErrTimeout {
+		t.Fatalf("Write() error = %v, want %v", err, iotest.ErrTimeout)
+	}
+	if objs := c.Objects(); len(objs) != 0 {
+		t.Errorf("Write() committed %v", objs)
+	}
+}
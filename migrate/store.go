@@ -0,0 +1,24 @@
+package migrate
+
+import (
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+// Object describes a stored object and the attributes preserved by a migration.
+type Object = storage.Object
+
+// Store is the minimal view of a bucket that Run copies between. Run uses
+// Delete to drop a copy whose digest does not match the source.
+type Store = storage.Store
+
+// FromGCS adapts a gcs.Client to a Store.
+func FromGCS(c gcs.Client) Store {
+	return storage.FromGCS(c)
+}
+
+// FromS3 adapts an s3.Interactor to a Store.
+func FromS3(i *s3.Interactor) Store {
+	return storage.FromS3(i)
+}
@@ -0,0 +1,93 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Grant is a single entry of an object ACL. Exactly one of ID, URI and Email identifies the grantee.
+type Grant struct {
+	ID          string
+	DisplayName string
+	URI         string
+	Email       string
+	Permission  string
+}
+
+// SetACL applies a canned ACL to an existing object.
+func (i *Interactor) SetACL(filepath string, acl ACL) error {
+	return i.SetACLContext(context.Background(), filepath, acl)
+}
+
+// SetACLContext is SetACL with a context for cancellation and deadlines.
+func (i *Interactor) SetACLContext(ctx context.Context, filepath string, acl ACL) error {
+	input := &s3.PutObjectAclInput{
+		Bucket: aws.String(i.bucket),
+		Key:    aws.String(filepath),
+		ACL:    aws.String(acl.String()),
+	}
+
+	if _, err := i.client.PutObjectAclWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.setACL, err: %w", err)
+	}
+
+	return nil
+}
+
+// GetACL returns the grants of an object.
+func (i *Interactor) GetACL(filepath string) ([]Grant, error) {
+	return i.GetACLContext(context.Background(), filepath)
+}
+
+// GetACLContext is GetACL with a context for cancellation and deadlines.
+func (i *Interactor) GetACLContext(ctx context.Context, filepath string) ([]Grant, error) {
+	input := &s3.GetObjectAclInput{
+		Bucket: aws.String(i.bucket),
+		Key:    aws.String(filepath),
+	}
+
+	out, err := i.client.GetObjectAclWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("storage.getACL, err: %w", err)
+	}
+
+	grants := make([]Grant, 0, len(out.Grants))
+	for _, g := range out.Grants {
+		grant := Grant{Permission: aws.StringValue(g.Permission)}
+		if g.Grantee != nil {
+			grant.ID = aws.StringValue(g.Grantee.ID)
+			grant.DisplayName = aws.StringValue(g.Grantee.DisplayName)
+			grant.URI = aws.StringValue(g.Grantee.URI)
+			grant.Email = aws.StringValue(g.Grantee.EmailAddress)
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, nil
+}
+
+// objectACL returns the access control policy of an object, so that it can be
+// applied again with putObjectACL after a copy, which resets it to private.
+func (i *Interactor) objectACL(ctx context.Context, filepath string) (*s3.AccessControlPolicy, error) {
+	out, err := i.client.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{
+		Bucket: aws.String(i.bucket),
+		Key:    aws.String(filepath),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3.AccessControlPolicy{Grants: out.Grants, Owner: out.Owner}, nil
+}
+
+// putObjectACL applies a policy returned by objectACL to an object.
+func (i *Interactor) putObjectACL(ctx context.Context, filepath string, policy *s3.AccessControlPolicy) error {
+	_, err := i.client.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+		Bucket:              aws.String(i.bucket),
+		Key:                 aws.String(filepath),
+		AccessControlPolicy: policy,
+	})
+	return err
+}
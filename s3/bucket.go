@@ -0,0 +1,333 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// BucketClient is the subset of the S3 API used by BucketAdmin.
+type BucketClient interface {
+	CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error)
+	CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (*s3.CreateBucketOutput, error)
+	DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error)
+	DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (*s3.DeleteBucketOutput, error)
+	GetBucketLifecycleConfiguration(input *s3.GetBucketLifecycleConfigurationInput) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	GetBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.GetBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(input *s3.PutBucketLifecycleConfigurationInput) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.PutBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	DeleteBucketLifecycle(input *s3.DeleteBucketLifecycleInput) (*s3.DeleteBucketLifecycleOutput, error)
+	DeleteBucketLifecycleWithContext(ctx aws.Context, input *s3.DeleteBucketLifecycleInput, opts ...request.Option) (*s3.DeleteBucketLifecycleOutput, error)
+	GetBucketCors(input *s3.GetBucketCorsInput) (*s3.GetBucketCorsOutput, error)
+	GetBucketCorsWithContext(ctx aws.Context, input *s3.GetBucketCorsInput, opts ...request.Option) (*s3.GetBucketCorsOutput, error)
+	PutBucketCors(input *s3.PutBucketCorsInput) (*s3.PutBucketCorsOutput, error)
+	PutBucketCorsWithContext(ctx aws.Context, input *s3.PutBucketCorsInput, opts ...request.Option) (*s3.PutBucketCorsOutput, error)
+	DeleteBucketCors(input *s3.DeleteBucketCorsInput) (*s3.DeleteBucketCorsOutput, error)
+	DeleteBucketCorsWithContext(ctx aws.Context, input *s3.DeleteBucketCorsInput, opts ...request.Option) (*s3.DeleteBucketCorsOutput, error)
+	PutBucketAcl(input *s3.PutBucketAclInput) (*s3.PutBucketAclOutput, error)
+	PutBucketAclWithContext(ctx aws.Context, input *s3.PutBucketAclInput, opts ...request.Option) (*s3.PutBucketAclOutput, error)
+	GetBucketVersioning(input *s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error)
+	GetBucketVersioningWithContext(ctx aws.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (*s3.GetBucketVersioningOutput, error)
+	PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error)
+	PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error)
+}
+
+// LifecycleRule expires or transitions objects under Prefix once they reach Days.
+// An S3 rule with several actions is returned as one LifecycleRule per action,
+// all with its ID; SetLifecycle puts rules sharing an ID back into one rule.
+type LifecycleRule struct {
+	ID     string
+	Prefix string
+	Days   int64
+	// StorageClass transitions matching objects to this class; empty expires them.
+	StorageClass string
+	// NoncurrentOnly restricts the rule to noncurrent versions.
+	NoncurrentOnly bool
+}
+
+// CORSRule is a single CORS configuration entry of a bucket.
+type CORSRule struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposeHeaders  []string
+	MaxAgeSeconds  int64
+}
+
+type BucketAdmin struct {
+	client BucketClient
+	bucket string
+}
+
+func NewBucketAdmin(c BucketClient, bucket string) *BucketAdmin {
+	return &BucketAdmin{
+		client: c,
+		bucket: bucket,
+	}
+}
+
+// Create creates the bucket in region. An empty region uses us-east-1.
+func (b *BucketAdmin) Create(region string) error {
+	return b.CreateContext(context.Background(), region)
+}
+
+// CreateContext is Create with a context for cancellation and deadlines.
+func (b *BucketAdmin) CreateContext(ctx context.Context, region string) error {
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(b.bucket),
+	}
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+
+	if _, err := b.client.CreateBucketWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.createBucket, err: %w", err)
+	}
+	return nil
+}
+
+// Delete deletes the bucket, which must be empty.
+func (b *BucketAdmin) Delete() error {
+	return b.DeleteContext(context.Background())
+}
+
+// DeleteContext is Delete with a context for cancellation and deadlines.
+func (b *BucketAdmin) DeleteContext(ctx context.Context) error {
+	if _, err := b.client.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(b.bucket)}); err != nil {
+		return fmt.Errorf("storage.deleteBucket, err: %w", err)
+	}
+	return nil
+}
+
+// Lifecycle returns the lifecycle rules of the bucket, or none if it has no
+// lifecycle configuration.
+func (b *BucketAdmin) Lifecycle() ([]LifecycleRule, error) {
+	return b.LifecycleContext(context.Background())
+}
+
+// LifecycleContext is Lifecycle with a context for cancellation and deadlines.
+func (b *BucketAdmin) LifecycleContext(ctx context.Context) ([]LifecycleRule, error) {
+	out, err := b.client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(b.bucket)})
+	if hasCode(err, errCodeNoSuchLifecycle) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.lifecycle, err: %w", err)
+	}
+
+	var rules []LifecycleRule
+	for _, r := range out.Rules {
+		rule := LifecycleRule{ID: aws.StringValue(r.ID)}
+		if r.Filter != nil {
+			rule.Prefix = aws.StringValue(r.Filter.Prefix)
+		}
+		if r.Expiration != nil && r.Expiration.Days != nil {
+			expire := rule
+			expire.Days = aws.Int64Value(r.Expiration.Days)
+			rules = append(rules, expire)
+		}
+		if r.NoncurrentVersionExpiration != nil {
+			expire := rule
+			expire.Days = aws.Int64Value(r.NoncurrentVersionExpiration.NoncurrentDays)
+			expire.NoncurrentOnly = true
+			rules = append(rules, expire)
+		}
+		for _, t := range r.Transitions {
+			transition := rule
+			transition.Days = aws.Int64Value(t.Days)
+			transition.StorageClass = aws.StringValue(t.StorageClass)
+			rules = append(rules, transition)
+		}
+		for _, t := range r.NoncurrentVersionTransitions {
+			transition := rule
+			transition.Days = aws.Int64Value(t.NoncurrentDays)
+			transition.StorageClass = aws.StringValue(t.StorageClass)
+			transition.NoncurrentOnly = true
+			rules = append(rules, transition)
+		}
+	}
+	return rules, nil
+}
+
+// SetLifecycle replaces the lifecycle configuration of the bucket. Rules
+// with the same non-empty ID become the actions of a single S3 rule and must
+// share its Prefix. No rules removes the lifecycle configuration.
+func (b *BucketAdmin) SetLifecycle(rules []LifecycleRule) error {
+	return b.SetLifecycleContext(context.Background(), rules)
+}
+
+// SetLifecycleContext is SetLifecycle with a context for cancellation and deadlines.
+func (b *BucketAdmin) SetLifecycleContext(ctx context.Context, rules []LifecycleRule) error {
+	if len(rules) == 0 {
+		// S3 rejects a configuration without rules.
+		if _, err := b.client.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(b.bucket)}); err != nil {
+			return fmt.Errorf("storage.setLifecycle, err: %w", err)
+		}
+		return nil
+	}
+
+	config := &s3.BucketLifecycleConfiguration{}
+	byID := map[string]*s3.LifecycleRule{}
+	for n, r := range rules {
+		id := r.ID
+		if id == "" {
+			id = fmt.Sprintf("rule-%d", n)
+		}
+		rule, ok := byID[id]
+		if !ok {
+			rule = &s3.LifecycleRule{
+				ID:     aws.String(id),
+				Status: aws.String(s3.ExpirationStatusEnabled),
+				Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(r.Prefix)},
+			}
+			byID[id] = rule
+			config.Rules = append(config.Rules, rule)
+		} else if aws.StringValue(rule.Filter.Prefix) != r.Prefix {
+			return fmt.Errorf("storage.setLifecycle, err: rule %q has prefixes %q and %q", id, aws.StringValue(rule.Filter.Prefix), r.Prefix)
+		}
+
+		switch {
+		case r.StorageClass == "" && !r.NoncurrentOnly:
+			rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(r.Days)}
+		case r.StorageClass == "" && r.NoncurrentOnly:
+			rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(r.Days)}
+		case !r.NoncurrentOnly:
+			rule.Transitions = append(rule.Transitions, &s3.Transition{Days: aws.Int64(r.Days), StorageClass: aws.String(r.StorageClass)})
+		default:
+			rule.NoncurrentVersionTransitions = append(rule.NoncurrentVersionTransitions, &s3.NoncurrentVersionTransition{NoncurrentDays: aws.Int64(r.Days), StorageClass: aws.String(r.StorageClass)})
+		}
+	}
+
+	input := &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(b.bucket),
+		LifecycleConfiguration: config,
+	}
+	if _, err := b.client.PutBucketLifecycleConfigurationWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.setLifecycle, err: %w", err)
+	}
+	return nil
+}
+
+// CORS returns the CORS rules of the bucket, or none if it has no CORS
+// configuration.
+func (b *BucketAdmin) CORS() ([]CORSRule, error) {
+	return b.CORSContext(context.Background())
+}
+
+// CORSContext is CORS with a context for cancellation and deadlines.
+func (b *BucketAdmin) CORSContext(ctx context.Context) ([]CORSRule, error) {
+	out, err := b.client.GetBucketCorsWithContext(ctx, &s3.GetBucketCorsInput{Bucket: aws.String(b.bucket)})
+	if hasCode(err, errCodeNoSuchCORS) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.cors, err: %w", err)
+	}
+
+	var rules []CORSRule
+	for _, r := range out.CORSRules {
+		rules = append(rules, CORSRule{
+			AllowedOrigins: aws.StringValueSlice(r.AllowedOrigins),
+			AllowedMethods: aws.StringValueSlice(r.AllowedMethods),
+			AllowedHeaders: aws.StringValueSlice(r.AllowedHeaders),
+			ExposeHeaders:  aws.StringValueSlice(r.ExposeHeaders),
+			MaxAgeSeconds:  aws.Int64Value(r.MaxAgeSeconds),
+		})
+	}
+	return rules, nil
+}
+
+// SetCORS replaces the CORS configuration of the bucket. No rules removes
+// the CORS configuration.
+func (b *BucketAdmin) SetCORS(rules []CORSRule) error {
+	return b.SetCORSContext(context.Background(), rules)
+}
+
+// SetCORSContext is SetCORS with a context for cancellation and deadlines.
+func (b *BucketAdmin) SetCORSContext(ctx context.Context, rules []CORSRule) error {
+	if len(rules) == 0 {
+		// S3 rejects a configuration without rules.
+		if _, err := b.client.DeleteBucketCorsWithContext(ctx, &s3.DeleteBucketCorsInput{Bucket: aws.String(b.bucket)}); err != nil {
+			return fmt.Errorf("storage.setCORS, err: %w", err)
+		}
+		return nil
+	}
+
+	config := &s3.CORSConfiguration{}
+	for _, r := range rules {
+		config.CORSRules = append(config.CORSRules, &s3.CORSRule{
+			AllowedOrigins: aws.StringSlice(r.AllowedOrigins),
+			AllowedMethods: aws.StringSlice(r.AllowedMethods),
+			AllowedHeaders: aws.StringSlice(r.AllowedHeaders),
+			ExposeHeaders:  aws.StringSlice(r.ExposeHeaders),
+			MaxAgeSeconds:  aws.Int64(r.MaxAgeSeconds),
+		})
+	}
+
+	input := &s3.PutBucketCorsInput{
+		Bucket:            aws.String(b.bucket),
+		CORSConfiguration: config,
+	}
+	if _, err := b.client.PutBucketCorsWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.setCORS, err: %w", err)
+	}
+	return nil
+}
+
+// SetACL applies a canned ACL to the bucket itself. S3 has no default object
+// ACL; objects take the ACL given on upload.
+func (b *BucketAdmin) SetACL(acl ACL) error {
+	return b.SetACLContext(context.Background(), acl)
+}
+
+// SetACLContext is SetACL with a context for cancellation and deadlines.
+func (b *BucketAdmin) SetACLContext(ctx context.Context, acl ACL) error {
+	input := &s3.PutBucketAclInput{
+		Bucket: aws.String(b.bucket),
+		ACL:    aws.String(acl.String()),
+	}
+	if _, err := b.client.PutBucketAclWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.setBucketACL, err: %w", err)
+	}
+	return nil
+}
+
+func (b *BucketAdmin) Versioning() (bool, error) {
+	return b.VersioningContext(context.Background())
+}
+
+// VersioningContext is Versioning with a context for cancellation and deadlines.
+func (b *BucketAdmin) VersioningContext(ctx context.Context) (bool, error) {
+	out, err := b.client.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(b.bucket)})
+	if err != nil {
+		return false, fmt.Errorf("storage.versioning, err: %w", err)
+	}
+	return aws.StringValue(out.Status) == s3.BucketVersioningStatusEnabled, nil
+}
+
+// SetVersioning enables versioning, or suspends it when enabled is false.
+func (b *BucketAdmin) SetVersioning(enabled bool) error {
+	return b.SetVersioningContext(context.Background(), enabled)
+}
+
+// SetVersioningContext is SetVersioning with a context for cancellation and deadlines.
+func (b *BucketAdmin) SetVersioningContext(ctx context.Context, enabled bool) error {
+	status := s3.BucketVersioningStatusSuspended
+	if enabled {
+		status = s3.BucketVersioningStatusEnabled
+	}
+
+	input := &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(b.bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(status)},
+	}
+	if _, err := b.client.PutBucketVersioningWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.setVersioning, err: %w", err)
+	}
+	return nil
+}
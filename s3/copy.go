@@ -0,0 +1,201 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxCopySize is the largest object a single CopyObject request copies.
+// Larger objects are copied part by part.
+var maxCopySize int64 = 5 << 30
+
+// copyPartSize is the smallest part of a multipart copy. Objects with more
+// than maxParts such parts are copied in larger ones.
+var copyPartSize int64 = 512 << 20
+
+// Copy copies src to dst within the bucket without downloading it. The
+// non-empty attributes of opts replace those of src, and a non-nil Metadata
+// replaces its metadata. A non-empty srcETag only copies src while its ETag
+// still matches. The IfMatch and IfNotExist conditions of opts apply to dst.
+// Like every S3 copy, dst gets the ACL of opts, private by default, unless
+// opts.KeepACL is set.
+//
+// Objects above 5 GB are copied as a multipart upload of ranges of src,
+// each only while src still has the copied ETag. Such a copy does not keep
+// the tags of src; set opts.Tags to tag dst.
+func (i *Interactor) Copy(src, srcETag, dst string, opts UploadOptions) error {
+	return i.CopyContext(context.Background(), src, srcETag, dst, opts)
+}
+
+// CopyContext is Copy with a context for cancellation and deadlines.
+func (i *Interactor) CopyContext(ctx context.Context, src, srcETag, dst string, opts UploadOptions) error {
+	cur, err := i.StatContext(ctx, src)
+	if err != nil {
+		return fmt.Errorf("storage.copy, err: %w", err)
+	}
+	if srcETag == "" {
+		// The attributes copied below must belong to the copied data.
+		srcETag = cur.ETag
+	}
+
+	var policy *s3.AccessControlPolicy
+	if opts.KeepACL {
+		if policy, err = i.objectACL(ctx, src); err != nil {
+			return fmt.Errorf("storage.copy, get acl, err: %w", err)
+		}
+	}
+
+	var etag string
+	if cur.Size > maxCopySize {
+		etag, err = i.copyParts(ctx, src, srcETag, dst, cur, opts)
+	} else {
+		etag, err = i.copyObject(ctx, src, srcETag, dst, cur, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("storage.copy, err: %w", err)
+	}
+
+	if policy != nil {
+		if err := i.putObjectACL(ctx, dst, policy); err != nil {
+			// Do not leave a copy behind with the wrong grants, unless dst
+			// has been replaced since.
+			if etag != "" {
+				i.RemoveIfMatchContext(context.Background(), dst, etag)
+			}
+			return fmt.Errorf("storage.copy, put acl, err: %w", err)
+		}
+	}
+	return nil
+}
+
+// copyObject copies src with a single CopyObject request and returns the
+// ETag of dst.
+func (i *Interactor) copyObject(ctx context.Context, src, srcETag, dst string, cur *ObjectAttrs, opts UploadOptions) (string, error) {
+	metadata := cur.Metadata
+	if opts.Metadata != nil {
+		metadata = opts.Metadata
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:             aws.String(i.bucket),
+		Key:                aws.String(dst),
+		CopySource:         aws.String(i.copySource(src, "")),
+		CopySourceIfMatch:  optionalString(srcETag),
+		MetadataDirective:  aws.String(s3.MetadataDirectiveReplace),
+		ACL:                optionalString(opts.ACL.String()),
+		ContentType:        optionalString(firstNonEmpty(opts.ContentType, cur.ContentType)),
+		CacheControl:       optionalString(firstNonEmpty(opts.CacheControl, cur.CacheControl)),
+		ContentDisposition: optionalString(firstNonEmpty(opts.ContentDisposition, cur.ContentDisposition)),
+		ContentLanguage:    optionalString(firstNonEmpty(opts.ContentLanguage, cur.ContentLanguage)),
+		StorageClass:       optionalString(firstNonEmpty(opts.StorageClass, cur.StorageClass)),
+		Metadata:           aws.StringMap(metadata),
+	}
+	if opts.Tags != nil {
+		input.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+		input.Tagging = aws.String(encodeTags(opts.Tags))
+	}
+
+	var reqOpts []request.Option
+	if h := opts.conditionHeaders(); len(h) > 0 {
+		reqOpts = append(reqOpts, request.WithSetRequestHeaders(h))
+	}
+	out, err := i.client.CopyObjectWithContext(ctx, input, reqOpts...)
+	if err != nil {
+		return "", err
+	}
+	if out.CopyObjectResult == nil {
+		return "", nil
+	}
+	return aws.StringValue(out.CopyObjectResult.ETag), nil
+}
+
+// copyParts copies src as a multipart upload of ranges of it and returns
+// the ETag of dst. The upload is aborted if any part fails.
+func (i *Interactor) copyParts(ctx context.Context, src, srcETag, dst string, cur *ObjectAttrs, opts UploadOptions) (string, error) {
+	metadata := cur.Metadata
+	if opts.Metadata != nil {
+		metadata = opts.Metadata
+	}
+
+	out, err := i.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(i.bucket),
+		Key:                aws.String(dst),
+		ACL:                optionalString(opts.ACL.String()),
+		ContentType:        optionalString(firstNonEmpty(opts.ContentType, cur.ContentType)),
+		CacheControl:       optionalString(firstNonEmpty(opts.CacheControl, cur.CacheControl)),
+		ContentDisposition: optionalString(firstNonEmpty(opts.ContentDisposition, cur.ContentDisposition)),
+		ContentLanguage:    optionalString(firstNonEmpty(opts.ContentLanguage, cur.ContentLanguage)),
+		StorageClass:       optionalString(firstNonEmpty(opts.StorageClass, cur.StorageClass)),
+		Metadata:           aws.StringMap(metadata),
+		Tagging:            optionalString(encodeTags(opts.Tags)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	etag, err := i.copyPartRanges(ctx, out.UploadId, src, srcETag, dst, cur.Size, opts)
+	if err != nil {
+		// As in UploadStream, abort even when ctx is done.
+		i.client.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(i.bucket),
+			Key:      aws.String(dst),
+			UploadId: out.UploadId,
+		})
+		return "", err
+	}
+	return etag, nil
+}
+
+// copyPartRanges copies the size bytes of src as the parts of uploadID,
+// then completes the upload.
+func (i *Interactor) copyPartRanges(ctx context.Context, uploadID *string, src, srcETag, dst string, size int64, opts UploadOptions) (string, error) {
+	partSize := copyPartSize
+	if n := (size + maxParts - 1) / maxParts; n > partSize {
+		partSize = n
+	}
+
+	var parts []*s3.CompletedPart
+	for off := int64(0); off < size; off += partSize {
+		end := off + partSize
+		if end > size {
+			end = size
+		}
+		num := aws.Int64(int64(len(parts) + 1))
+		out, err := i.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(i.bucket),
+			Key:               aws.String(dst),
+			UploadId:          uploadID,
+			PartNumber:        num,
+			CopySource:        aws.String(i.copySource(src, "")),
+			CopySourceIfMatch: optionalString(srcETag),
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", off, end-1)),
+		})
+		if err != nil {
+			return "", err
+		}
+		if out.CopyPartResult == nil {
+			return "", errors.New("copy part returned no result")
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: num})
+	}
+
+	var reqOpts []request.Option
+	if h := opts.conditionHeaders(); len(h) > 0 {
+		reqOpts = append(reqOpts, request.WithSetRequestHeaders(h))
+	}
+	out, err := i.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(i.bucket),
+		Key:             aws.String(dst),
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	}, reqOpts...)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.ETag), nil
+}
@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// CredentialSource selects where NewS3Client looks up credentials.
+type CredentialSource int
+
+const (
+	// StaticCredentials uses Options.Key and Options.Secret.
+	StaticCredentials CredentialSource = iota
+	// EnvCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+	EnvCredentials
+	// SharedCredentials reads Options.Profile from the shared credentials file.
+	SharedCredentials
+	// WebIdentityCredentials assumes Options.RoleARN with the token in Options.WebIdentityTokenFile.
+	WebIdentityCredentials
+	// ECSCredentials queries the container credentials endpoint.
+	ECSCredentials
+	// EC2Credentials queries the EC2 instance metadata service.
+	EC2Credentials
+	// CustomCredentials calls Options.CredentialsFunc.
+	CustomCredentials
+)
+
+// ecsCredentialsHost is the link-local host of the ECS container credentials endpoint.
+const ecsCredentialsHost = "http://169.254.170.2"
+
+// Credentials are the values returned by a CredentialsFunc. A zero Expires never expires.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// newCredentials builds a cached credential chain from opt.CredentialChain.
+// Credentials are retrieved lazily and refreshed once they are within
+// opt.ExpiryWindow of expiring.
+func newCredentials(opt Options) *credentials.Credentials {
+	chain := opt.CredentialChain
+	if len(chain) == 0 {
+		chain = []CredentialSource{StaticCredentials}
+	}
+
+	providers := make([]credentials.Provider, 0, len(chain))
+	for _, src := range chain {
+		providers = append(providers, newProvider(src, opt))
+	}
+	if len(providers) == 1 {
+		return credentials.NewCredentials(providers[0])
+	}
+
+	return credentials.NewCredentials(&credentials.ChainProvider{
+		Providers:     providers,
+		VerboseErrors: true,
+	})
+}
+
+func newProvider(src CredentialSource, opt Options) credentials.Provider {
+	switch src {
+	case EnvCredentials:
+		return &credentials.EnvProvider{}
+	case SharedCredentials:
+		return &credentials.SharedCredentialsProvider{
+			Filename: opt.SharedCredentialsFile,
+			Profile:  opt.Profile,
+		}
+	case WebIdentityCredentials:
+		roleARN := firstNonEmpty(opt.RoleARN, os.Getenv("AWS_ROLE_ARN"))
+		tokenFile := firstNonEmpty(opt.WebIdentityTokenFile, os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+		sessionName := firstNonEmpty(opt.RoleSessionName, os.Getenv("AWS_ROLE_SESSION_NAME"))
+
+		svc := sts.New(session.New(&aws.Config{
+			Region:      aws.String(opt.Region),
+			Credentials: credentials.AnonymousCredentials,
+		}))
+		p := stscreds.NewWebIdentityRoleProvider(svc, roleARN, sessionName, tokenFile)
+		p.ExpiryWindow = opt.ExpiryWindow
+		return p
+	case ECSCredentials:
+		return endpointcreds.NewProviderClient(*defaults.Config(), defaults.Handlers(), ecsEndpoint(opt), func(p *endpointcreds.Provider) {
+			p.ExpiryWindow = opt.ExpiryWindow
+			if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+				p.AuthorizationToken = token
+			}
+		})
+	case EC2Credentials:
+		cfg := &aws.Config{}
+		if opt.EC2MetadataEndpoint != "" {
+			cfg.Endpoint = aws.String(opt.EC2MetadataEndpoint)
+		}
+		return &ec2rolecreds.EC2RoleProvider{
+			Client:       ec2metadata.New(session.New(), cfg),
+			ExpiryWindow: opt.ExpiryWindow,
+		}
+	case CustomCredentials:
+		return &funcProvider{fn: opt.CredentialsFunc, window: opt.ExpiryWindow}
+	default:
+		return &credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     opt.Key,
+			SecretAccessKey: opt.Secret,
+		}}
+	}
+}
+
+// ecsEndpoint resolves the container credentials endpoint the same way the SDK does.
+func ecsEndpoint(opt Options) string {
+	if opt.ContainerCredentialsEndpoint != "" {
+		return opt.ContainerCredentialsEndpoint
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return uri
+	}
+	return ecsCredentialsHost + os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+}
+
+// funcProvider adapts a CredentialsFunc to credentials.Provider.
+type funcProvider struct {
+	credentials.Expiry
+	fn     func() (Credentials, error)
+	window time.Duration
+}
+
+func (p *funcProvider) Retrieve() (credentials.Value, error) {
+	if p.fn == nil {
+		return credentials.Value{}, fmt.Errorf("storage.credentials, err: CredentialsFunc is not set")
+	}
+
+	c, err := p.fn()
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("storage.credentials, err: %w", err)
+	}
+
+	if c.Expires.IsZero() {
+		p.SetExpiration(time.Now().Add(100*365*24*time.Hour), 0)
+	} else {
+		p.SetExpiration(c.Expires, p.window)
+	}
+
+	return credentials.Value{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		ProviderName:    "CustomCredentials",
+	}, nil
+}
@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// unsetenv clears the variables in keys and returns a func restoring them.
+func unsetenv(keys ...string) func() {
+	saved := map[string]string{}
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(k); ok {
+			saved[k] = v
+		}
+		os.Unsetenv(k)
+	}
+	return func() {
+		for k, v := range saved {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestNewCredentials(t *testing.T) {
+	ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"AccessKeyId":"ecs-key","SecretAccessKey":"ecs-secret","Token":"ecs-token","Expiration":%q}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer ecs.Close()
+
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	shared := filepath.Join(dir, "credentials")
+	ioutil.WriteFile(shared, []byte("[dev]\naws_access_key_id = shared-key\naws_secret_access_key = shared-secret\n"), 0600)
+
+	defer unsetenv("AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY")()
+
+	tests := []struct {
+		name    string
+		opt     Options
+		wantKey string
+		wantErr bool
+	}{
+		{
+			name:    "static",
+			opt:     Options{Key: "static-key", Secret: "static-secret"},
+			wantKey: "static-key",
+		},
+		{
+			name:    "shared profile",
+			opt:     Options{CredentialChain: []CredentialSource{SharedCredentials}, Profile: "dev", SharedCredentialsFile: shared},
+			wantKey: "shared-key",
+		},
+		{
+			name:    "ecs endpoint",
+			opt:     Options{CredentialChain: []CredentialSource{ECSCredentials}, ContainerCredentialsEndpoint: ecs.URL},
+			wantKey: "ecs-key",
+		},
+		{
+			name: "chain falls through empty env",
+			opt: Options{
+				CredentialChain: []CredentialSource{EnvCredentials, CustomCredentials},
+				CredentialsFunc: func() (Credentials, error) {
+					return Credentials{AccessKeyID: "custom-key", SecretAccessKey: "custom-secret"}, nil
+				},
+			},
+			wantKey: "custom-key",
+		},
+		{
+			name: "custom error",
+			opt: Options{
+				CredentialChain: []CredentialSource{CustomCredentials},
+				CredentialsFunc: func() (Credentials, error) { return Credentials{}, errors.New("vault down") },
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newCredentials(tt.opt).Get()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.AccessKeyID != tt.wantKey {
+				t.Errorf("Get() AccessKeyID = %v, want %v", got.AccessKeyID, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestNewCredentials_refresh(t *testing.T) {
+	calls := 0
+	opt := Options{
+		CredentialChain: []CredentialSource{CustomCredentials},
+		ExpiryWindow:    time.Minute,
+		CredentialsFunc: func() (Credentials, error) {
+			calls++
+			// Expires inside the window, so every Get must refresh.
+			return Credentials{AccessKeyID: fmt.Sprintf("key-%d", calls), Expires: time.Now().Add(30 * time.Second)}, nil
+		},
+	}
+
+	creds := newCredentials(opt)
+	for want := 1; want <= 2; want++ {
+		v, err := creds.Get()
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if v.AccessKeyID != fmt.Sprintf("key-%d", want) {
+			t.Errorf("Get() AccessKeyID = %v, want key-%d", v.AccessKeyID, want)
+		}
+	}
+
+	opt.ExpiryWindow = 0
+	calls = 0
+	creds = newCredentials(opt)
+	creds.Get()
+	creds.Get()
+	if calls != 1 {
+		t.Errorf("CredentialsFunc called %d times, want cached after 1", calls)
+	}
+}
@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/hayashiki/go-pkg/internal/deleteerr"
+)
+
+const (
+	// deleteBatchSize is the maximum number of keys accepted by DeleteObjects.
+	deleteBatchSize = 1000
+	// deleteConcurrency is the number of DeleteObjects batches sent in parallel.
+	deleteConcurrency = 4
+)
+
+// ErrEmptyPrefix is returned by DeletePrefix when called with an empty prefix,
+// which would otherwise delete every object in the bucket.
+var ErrEmptyPrefix = errors.New("storage.deletePrefix: refusing to delete with an empty prefix")
+
+// DeleteErrors holds the per-key errors of a bulk delete.
+type DeleteErrors map[string]error
+
+func (e DeleteErrors) Error() string {
+	return deleteerr.Message(fmt.Sprintf("storage.deleteMany, failed to delete %d key(s)", len(e)), e)
+}
+
+// DeleteMany deletes keys with DeleteObjects in batches of 1000.
+// If any key fails the returned error is a DeleteErrors.
+func (i *Interactor) DeleteMany(keys []string) error {
+	return i.DeleteManyContext(context.Background(), keys)
+}
+
+// DeleteManyContext is DeleteMany with a context for cancellation and deadlines.
+func (i *Interactor) DeleteManyContext(ctx context.Context, keys []string) error {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = DeleteErrors{}
+		sem  = make(chan struct{}, deleteConcurrency)
+	)
+
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(batch []string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			failed := i.deleteBatch(ctx, batch)
+			mu.Lock()
+			for k, err := range failed {
+				errs[k] = err
+			}
+			mu.Unlock()
+		}(keys[start:end])
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (i *Interactor) deleteBatch(ctx context.Context, keys []string) DeleteErrors {
+	objects := make([]*s3.ObjectIdentifier, 0, len(keys))
+	for _, k := range keys {
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(k)})
+	}
+
+	input := &s3.DeleteObjectsInput{
+		Bucket: aws.String(i.bucket),
+		Delete: &s3.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	}
+
+	errs := DeleteErrors{}
+	out, err := i.client.DeleteObjectsWithContext(ctx, input)
+	if err != nil {
+		for _, k := range keys {
+			errs[k] = err
+		}
+		return errs
+	}
+
+	for _, e := range out.Errors {
+		errs[aws.StringValue(e.Key)] = fmt.Errorf("%s: %s", aws.StringValue(e.Code), aws.StringValue(e.Message))
+	}
+	return errs
+}
+
+// DeletePrefix deletes every key starting with prefix.
+func (i *Interactor) DeletePrefix(prefix string) error {
+	return i.DeletePrefixContext(context.Background(), prefix)
+}
+
+// DeletePrefixContext is DeletePrefix with a context for cancellation and deadlines.
+func (i *Interactor) DeletePrefixContext(ctx context.Context, prefix string) error {
+	if prefix == "" {
+		return ErrEmptyPrefix
+	}
+
+	keys, err := i.ListContext(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("storage.deletePrefix, err: %w", err)
+	}
+
+	return i.DeleteManyContext(ctx, keys)
+}
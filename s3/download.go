@@ -0,0 +1,133 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/hayashiki/go-pkg/internal/chunked"
+)
+
+// ErrChecksum is returned by DownloadToFile when the downloaded file does
+// not match the checksum of the object.
+var ErrChecksum = chunked.ErrChecksum
+
+// DownloadOptions configures DownloadToFile.
+type DownloadOptions struct {
+	// ChunkSize is the size of one range request. Defaults to 16 MiB.
+	ChunkSize int64
+	// Concurrency is the number of ranges fetched at once. Defaults to 8.
+	Concurrency int
+	// MaxAttempts is the number of attempts to fetch one range, with
+	// backoff between them. Defaults to 4.
+	MaxAttempts int
+}
+
+// DownloadRangeContext reads length bytes of filepath starting at offset.
+// A negative length reads to the end of the object. A non-empty etag makes
+// the request fail with a 412 if the object has been replaced.
+func (i *Interactor) DownloadRangeContext(ctx context.Context, filepath string, offset, length int64, etag string) (io.ReadCloser, error) {
+	rng := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		rng = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	input := &s3.GetObjectInput{
+		Bucket:  aws.String(i.bucket),
+		Key:     aws.String(filepath),
+		Range:   aws.String(rng),
+		IfMatch: optionalString(etag),
+	}
+
+	result, err := i.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("storage.downloadRange, err: %w", err)
+	}
+	return result.Body, nil
+}
+
+// DownloadToFile downloads filepath to path in concurrent range requests.
+// The data goes to path+".part" and is renamed to path once complete. Its
+// MD5 is verified when the ETag is one, and for a multipart upload against
+// the part sizes reported by HeadObject; SSE-KMS and SSE-C objects are not
+// verified. A download interrupted by a crash resumes from the partial file
+// when called again, unless the object has been replaced since.
+func (i *Interactor) DownloadToFile(ctx context.Context, filepath, path string, opts DownloadOptions) error {
+	attrs, err := i.StatContext(ctx, filepath)
+	if err != nil {
+		return err
+	}
+
+	obj := chunked.Object{Size: attrs.Size, Version: attrs.ETag}
+	sum, parts := attrs.etagDigest()
+	if parts > 0 {
+		if obj.Parts, err = i.partSizes(ctx, filepath, attrs.ETag, parts, opts.Concurrency); err != nil {
+			return err
+		}
+	}
+	obj.MD5 = sum
+
+	read := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return i.DownloadRangeContext(ctx, filepath, offset, length, attrs.ETag)
+	}
+	return chunked.Download(ctx, path, obj, read, chunked.Options{
+		ChunkSize:   opts.ChunkSize,
+		Concurrency: opts.Concurrency,
+		MaxAttempts: opts.MaxAttempts,
+		Retryable:   isRetryable,
+	})
+}
+
+// partSizes returns the sizes of the parts of the multipart upload etag of
+// filepath, which are needed to check its ETag. The parts are looked up
+// concurrency at a time.
+func (i *Interactor) partSizes(ctx context.Context, filepath, etag string, parts, concurrency int) ([]int64, error) {
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	sizes := make([]int64, parts)
+	err := chunked.Each(ctx, parts, concurrency, func(ctx context.Context, n int) error {
+		out, err := i.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:     aws.String(i.bucket),
+			Key:        aws.String(filepath),
+			PartNumber: aws.Int64(int64(n + 1)),
+			IfMatch:    aws.String(etag),
+		})
+		if err != nil {
+			return fmt.Errorf("storage.downloadToFile, part %d: %w", n+1, err)
+		}
+		if c := aws.Int64Value(out.PartsCount); c != int64(parts) {
+			return fmt.Errorf("storage.downloadToFile, %s has %d parts, want %d", filepath, c, parts)
+		}
+		sizes[n] = aws.Int64Value(out.ContentLength)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+// isRetryable reports whether a failed range read may succeed if sent again.
+func isRetryable(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return request.IsErrorRetryable(awsErr) || request.IsErrorThrottle(awsErr)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,52 @@
+package s3
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// errCodeNotFound is the code of a HeadObject response for a missing key, which has no body.
+	errCodeNotFound = "NotFound"
+	// errCodeNoSuchLifecycle is returned for a bucket without a lifecycle configuration.
+	errCodeNoSuchLifecycle = "NoSuchLifecycleConfiguration"
+	// errCodeNoSuchCORS is returned for a bucket without a CORS configuration.
+	errCodeNoSuchCORS = "NoSuchCORSConfiguration"
+)
+
+// IsNotFound reports whether err was caused by a missing key or version.
+func IsNotFound(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+
+	switch aerr.Code() {
+	case s3.ErrCodeNoSuchKey, errCodeNotFound, "NoSuchVersion":
+		return true
+	}
+	return false
+}
+
+// IsPreconditionFailed reports whether err was caused by a conditional
+// request whose IfMatch or IfNotExist condition did not hold.
+func IsPreconditionFailed(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+
+	switch aerr.Code() {
+	case "PreconditionFailed", "ConditionalRequestConflict":
+		return true
+	}
+	return false
+}
+
+// hasCode reports whether err is an SDK error with the given code.
+func hasCode(err error, code string) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == code
+}
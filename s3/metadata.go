@@ -0,0 +1,227 @@
+package s3
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// UploadOptions are the object attributes applied by UploadWithOptions and UpdateMetadata.
+// Empty fields are left unset.
+type UploadOptions struct {
+	ACL                ACL
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentLanguage    string
+	StorageClass       string
+	Metadata           map[string]string
+	Tags               map[string]string
+	// IfMatch, when set, only uploads if the ETag of the current object
+	// still matches. It is only applied on upload.
+	IfMatch string
+	// IfNotExist only uploads if the key does not exist yet.
+	IfNotExist bool
+	// KeepACL gives the destination of Copy the grants of its source
+	// instead of ACL. It is only applied on copy.
+	KeepACL bool
+}
+
+// conditionHeaders returns the conditional request headers of opts.
+// The SDK version in use predates conditional writes, so they are sent
+// as raw headers. Failed conditions are reported by IsPreconditionFailed.
+func (opts UploadOptions) conditionHeaders() map[string]string {
+	h := map[string]string{}
+	if opts.IfMatch != "" {
+		h["If-Match"] = opts.IfMatch
+	}
+	if opts.IfNotExist {
+		h["If-None-Match"] = "*"
+	}
+	return h
+}
+
+// ObjectAttrs are the attributes of a stored object.
+type ObjectAttrs struct {
+	Key                string
+	Size               int64
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentLanguage    string
+	StorageClass       string
+	Metadata           map[string]string
+	ETag               string
+	VersionID          string
+	LastModified       time.Time
+	// ServerSideEncryption is "AES256" or "aws:kms" for encrypted objects.
+	ServerSideEncryption string
+	// SSECustomerAlgorithm is set for objects encrypted with a customer key.
+	SSECustomerAlgorithm string
+}
+
+// ContentMD5 returns the MD5 of the content when the ETag is one, which
+// holds for objects uploaded in a single part and stored unencrypted or with
+// SSE-S3. It returns nil for multipart uploads and for SSE-KMS and SSE-C
+// objects, whose ETags are not content digests.
+func (a *ObjectAttrs) ContentMD5() []byte {
+	sum, parts := a.etagDigest()
+	if parts > 0 {
+		return nil
+	}
+	return sum
+}
+
+// etagDigest decodes the ETag of a into the MD5 it holds and the number of
+// parts of a multipart upload, whose ETag is the MD5 of the MD5s of its
+// parts followed by "-<parts>". It returns nil if the ETag is no digest.
+func (a *ObjectAttrs) etagDigest() ([]byte, int) {
+	if a.SSECustomerAlgorithm != "" || (a.ServerSideEncryption != "" && a.ServerSideEncryption != s3.ServerSideEncryptionAes256) {
+		return nil, 0
+	}
+
+	etag := strings.Trim(a.ETag, `"`)
+	parts := 0
+	if i := strings.IndexByte(etag, '-'); i >= 0 {
+		n, err := strconv.Atoi(etag[i+1:])
+		if err != nil || n < 1 {
+			return nil, 0
+		}
+		etag, parts = etag[:i], n
+	}
+	if len(etag) != 32 {
+		return nil, 0
+	}
+	sum, err := hex.DecodeString(etag)
+	if err != nil {
+		return nil, 0
+	}
+	return sum, parts
+}
+
+// Stat returns the attributes of filepath without downloading it.
+func (i *Interactor) Stat(filepath string) (*ObjectAttrs, error) {
+	return i.StatContext(context.Background(), filepath)
+}
+
+// StatContext is Stat with a context for cancellation and deadlines.
+func (i *Interactor) StatContext(ctx context.Context, filepath string) (*ObjectAttrs, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(i.bucket),
+		Key:    aws.String(filepath),
+	}
+
+	out, err := i.client.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("storage.stat, err: %w", err)
+	}
+
+	return &ObjectAttrs{
+		Key:                  filepath,
+		Size:                 aws.Int64Value(out.ContentLength),
+		ContentType:          aws.StringValue(out.ContentType),
+		CacheControl:         aws.StringValue(out.CacheControl),
+		ContentDisposition:   aws.StringValue(out.ContentDisposition),
+		ContentLanguage:      aws.StringValue(out.ContentLanguage),
+		StorageClass:         aws.StringValue(out.StorageClass),
+		Metadata:             aws.StringValueMap(out.Metadata),
+		ETag:                 aws.StringValue(out.ETag),
+		VersionID:            aws.StringValue(out.VersionId),
+		LastModified:         aws.TimeValue(out.LastModified),
+		ServerSideEncryption: aws.StringValue(out.ServerSideEncryption),
+		SSECustomerAlgorithm: aws.StringValue(out.SSECustomerAlgorithm),
+	}, nil
+}
+
+// UpdateMetadata replaces the attributes of an existing object with the
+// non-empty fields of opts, keeping the current value of the others.
+// S3 objects are immutable, so this copies the object onto itself. A copy
+// resets the ACL, so unless opts.ACL is set the current grants are read
+// first and applied again to the copy. When the object is replaced while it
+// is being updated, the copy fails with an error for which
+// IsPreconditionFailed reports true.
+func (i *Interactor) UpdateMetadata(filepath string, opts UploadOptions) error {
+	return i.UpdateMetadataContext(context.Background(), filepath, opts)
+}
+
+// UpdateMetadataContext is UpdateMetadata with a context for cancellation and deadlines.
+func (i *Interactor) UpdateMetadataContext(ctx context.Context, filepath string, opts UploadOptions) error {
+	cur, err := i.StatContext(ctx, filepath)
+	if err != nil {
+		return fmt.Errorf("storage.updateMetadata, err: %w", err)
+	}
+
+	var acl *s3.AccessControlPolicy
+	if opts.ACL == "" {
+		acl, err = i.objectACL(ctx, filepath)
+		if err != nil {
+			return fmt.Errorf("storage.updateMetadata, err: %w", err)
+		}
+	}
+
+	metadata := cur.Metadata
+	if opts.Metadata != nil {
+		metadata = opts.Metadata
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:             aws.String(i.bucket),
+		Key:                aws.String(filepath),
+		CopySource:         aws.String(i.copySource(filepath, "")),
+		CopySourceIfMatch:  optionalString(cur.ETag),
+		MetadataDirective:  aws.String(s3.MetadataDirectiveReplace),
+		ACL:                optionalString(opts.ACL.String()),
+		ContentType:        optionalString(firstNonEmpty(opts.ContentType, cur.ContentType)),
+		CacheControl:       optionalString(firstNonEmpty(opts.CacheControl, cur.CacheControl)),
+		ContentDisposition: optionalString(firstNonEmpty(opts.ContentDisposition, cur.ContentDisposition)),
+		ContentLanguage:    optionalString(firstNonEmpty(opts.ContentLanguage, cur.ContentLanguage)),
+		StorageClass:       optionalString(firstNonEmpty(opts.StorageClass, cur.StorageClass)),
+		Metadata:           aws.StringMap(metadata),
+	}
+	if opts.Tags != nil {
+		input.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+		input.Tagging = aws.String(encodeTags(opts.Tags))
+	}
+
+	if _, err := i.client.CopyObjectWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.updateMetadata, err: %w", err)
+	}
+
+	if acl != nil {
+		if err := i.putObjectACL(ctx, filepath, acl); err != nil {
+			return fmt.Errorf("storage.updateMetadata, restore acl, err: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// encodeTags encodes tags as the URL query string expected by the Tagging parameter.
+func encodeTags(tags map[string]string) string {
+	v := url.Values{}
+	for k, t := range tags {
+		v.Set(k, t)
+	}
+	return v.Encode()
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func firstNonEmpty(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
@@ -1,19 +1,28 @@
 package s3
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"io"
+	"strings"
+	"time"
 )
 
 type ACL string
 
 const (
-	Public  ACL = "public-read"
-	Private ACL = "private"
+	Public                 ACL = "public-read"
+	Private                ACL = "private"
+	PublicReadWrite        ACL = "public-read-write"
+	AuthenticatedRead      ACL = "authenticated-read"
+	AWSExecRead            ACL = "aws-exec-read"
+	BucketOwnerRead        ACL = "bucket-owner-read"
+	BucketOwnerFullControl ACL = "bucket-owner-full-control"
+	LogDeliveryWrite       ACL = "log-delivery-write"
 )
 
 func (a ACL) String() string {
@@ -29,6 +38,36 @@ type Options struct {
 	URL            string
 	ForcePathStyle bool
 	DisableSSL     bool
+	// Dualstack uses the IPv4/IPv6 dual-stack endpoints.
+	Dualstack bool
+	// CDNURL is the base URL of a CDN such as CloudFront in front of the
+	// bucket. GetFullURL builds URLs from it when set.
+	CDNURL string
+
+	// CredentialChain lists the credential sources tried in order.
+	// Static Key and Secret are used when it is empty.
+	CredentialChain []CredentialSource
+	// ExpiryWindow refreshes expiring credentials this long before they expire.
+	ExpiryWindow time.Duration
+
+	// Profile and SharedCredentialsFile configure SharedCredentials.
+	// Empty values fall back to AWS_PROFILE and ~/.aws/credentials.
+	Profile               string
+	SharedCredentialsFile string
+
+	// RoleARN, RoleSessionName and WebIdentityTokenFile configure WebIdentityCredentials.
+	// Empty values fall back to AWS_ROLE_ARN, AWS_ROLE_SESSION_NAME and AWS_WEB_IDENTITY_TOKEN_FILE.
+	RoleARN              string
+	RoleSessionName      string
+	WebIdentityTokenFile string
+
+	// ContainerCredentialsEndpoint overrides the ECS credentials endpoint.
+	ContainerCredentialsEndpoint string
+	// EC2MetadataEndpoint overrides the EC2 instance metadata endpoint.
+	EC2MetadataEndpoint string
+
+	// CredentialsFunc is called by CustomCredentials.
+	CredentialsFunc func() (Credentials, error)
 }
 
 func New(c Client, opt Options) *Interactor {
@@ -37,16 +76,22 @@ func New(c Client, opt Options) *Interactor {
 		bucket:         opt.Bucket,
 		url:            opt.URL,
 		forcePathStyle: opt.ForcePathStyle,
+		region:         opt.Region,
+		endpoint:       opt.Endpoint,
+		disableSSL:     opt.DisableSSL,
+		dualstack:      opt.Dualstack,
+		cdnURL:         opt.CDNURL,
 	}
 }
 
 func NewS3Client(opt Options) *s3.S3 {
 	s3config := &aws.Config{
-		Credentials:      credentials.NewStaticCredentials(opt.Key, opt.Secret, ""),
+		Credentials:      newCredentials(opt),
 		Endpoint:         aws.String(opt.Endpoint),
 		Region:           aws.String(opt.Region),
 		DisableSSL:       aws.Bool(opt.DisableSSL),
 		S3ForcePathStyle: aws.Bool(opt.ForcePathStyle),
+		UseDualStack:     aws.Bool(opt.Dualstack),
 	}
 	newSession := session.New(s3config)
 	return s3.New(newSession)
@@ -54,8 +99,30 @@ func NewS3Client(opt Options) *s3.S3 {
 
 type Client interface {
 	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error)
 	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
 	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error)
+	DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error)
+	ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error)
+	ListObjectVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error)
+	ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error)
+	CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error)
+	CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error)
+	HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error)
+	PutObjectAcl(input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error)
+	PutObjectAclWithContext(ctx aws.Context, input *s3.PutObjectAclInput, opts ...request.Option) (*s3.PutObjectAclOutput, error)
+	GetObjectAcl(input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error)
+	GetObjectAclWithContext(ctx aws.Context, input *s3.GetObjectAclInput, opts ...request.Option) (*s3.GetObjectAclOutput, error)
+	CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error)
+	UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error)
+	CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error)
 }
 
 type Interactor struct {
@@ -63,18 +130,49 @@ type Interactor struct {
 	bucket         string
 	url            string
 	forcePathStyle bool
+	region         string
+	endpoint       string
+	disableSSL     bool
+	dualstack      bool
+	cdnURL         string
 }
 
 func (i *Interactor) Upload(file io.ReadSeeker, filepath string, acl ACL, contentType string) error {
+	return i.UploadContext(context.Background(), file, filepath, acl, contentType)
+}
+
+// UploadContext is Upload with a context for cancellation and deadlines.
+func (i *Interactor) UploadContext(ctx context.Context, file io.ReadSeeker, filepath string, acl ACL, contentType string) error {
+	return i.UploadWithOptionsContext(ctx, file, filepath, UploadOptions{ACL: acl, ContentType: contentType})
+}
+
+// UploadWithOptions uploads file with the object attributes in opts.
+func (i *Interactor) UploadWithOptions(file io.ReadSeeker, filepath string, opts UploadOptions) error {
+	return i.UploadWithOptionsContext(context.Background(), file, filepath, opts)
+}
+
+// UploadWithOptionsContext is UploadWithOptions with a context for cancellation and deadlines.
+func (i *Interactor) UploadWithOptionsContext(ctx context.Context, file io.ReadSeeker, filepath string, opts UploadOptions) error {
 	object := s3.PutObjectInput{
-		Bucket:      aws.String(i.bucket),
-		Key:         aws.String(filepath),
-		Body:        file,
-		ACL:         aws.String(acl.String()),
-		ContentType: aws.String(contentType),
+		Bucket:             aws.String(i.bucket),
+		Key:                aws.String(filepath),
+		Body:               file,
+		ACL:                optionalString(opts.ACL.String()),
+		ContentType:        optionalString(opts.ContentType),
+		CacheControl:       optionalString(opts.CacheControl),
+		ContentDisposition: optionalString(opts.ContentDisposition),
+		ContentLanguage:    optionalString(opts.ContentLanguage),
+		StorageClass:       optionalString(opts.StorageClass),
+		Metadata:           aws.StringMap(opts.Metadata),
+		Tagging:            optionalString(encodeTags(opts.Tags)),
 	}
 
-	_, err := i.client.PutObject(&object)
+	var reqOpts []request.Option
+	if h := opts.conditionHeaders(); len(h) > 0 {
+		reqOpts = append(reqOpts, request.WithSetRequestHeaders(h))
+	}
+
+	_, err := i.client.PutObjectWithContext(ctx, &object, reqOpts...)
 	if err != nil {
 		return fmt.Errorf("storage.upload, err: %w", err)
 	}
@@ -83,12 +181,17 @@ func (i *Interactor) Upload(file io.ReadSeeker, filepath string, acl ACL, conten
 }
 
 func (i *Interactor) Download(filepath string) (io.ReadCloser, *string, error) {
+	return i.DownloadContext(context.Background(), filepath)
+}
+
+// DownloadContext is Download with a context for cancellation and deadlines.
+func (i *Interactor) DownloadContext(ctx context.Context, filepath string) (io.ReadCloser, *string, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(i.bucket),
 		Key:    aws.String(filepath),
 	}
 
-	result, err := i.client.GetObject(input)
+	result, err := i.client.GetObjectWithContext(ctx, input)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("storage.download, err: %w", err)
@@ -97,12 +200,37 @@ func (i *Interactor) Download(filepath string) (io.ReadCloser, *string, error) {
 }
 
 func (i *Interactor) Remove(filepath string) error {
+	return i.RemoveContext(context.Background(), filepath)
+}
+
+// RemoveContext is Remove with a context for cancellation and deadlines.
+func (i *Interactor) RemoveContext(ctx context.Context, filepath string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(i.bucket),
+		Key:    aws.String(filepath),
+	}
+
+	_, err := i.client.DeleteObjectWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("storage.remove, err: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveIfMatch deletes filepath only if its ETag still matches etag.
+func (i *Interactor) RemoveIfMatch(filepath, etag string) error {
+	return i.RemoveIfMatchContext(context.Background(), filepath, etag)
+}
+
+// RemoveIfMatchContext is RemoveIfMatch with a context for cancellation and deadlines.
+func (i *Interactor) RemoveIfMatchContext(ctx context.Context, filepath, etag string) error {
 	input := &s3.DeleteObjectInput{
 		Bucket: aws.String(i.bucket),
 		Key:    aws.String(filepath),
 	}
 
-	_, err := i.client.DeleteObject(input)
+	_, err := i.client.DeleteObjectWithContext(ctx, input, request.WithSetRequestHeaders(map[string]string{"If-Match": etag}))
 	if err != nil {
 		return fmt.Errorf("storage.remove, err: %w", err)
 	}
@@ -110,6 +238,46 @@ func (i *Interactor) Remove(filepath string) error {
 	return nil
 }
 
+// List returns the keys starting with prefix in lexical order.
+func (i *Interactor) List(prefix string) ([]string, error) {
+	return i.ListContext(context.Background(), prefix)
+}
+
+// ListContext is List with a context for cancellation and deadlines.
+func (i *Interactor) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(i.bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	var keys []string
+	for {
+		out, err := i.client.ListObjectsV2WithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("storage.list, err: %w", err)
+		}
+		for _, o := range out.Contents {
+			keys = append(keys, aws.StringValue(o.Key))
+		}
+		if !aws.BoolValue(out.IsTruncated) {
+			return keys, nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+// GetFullURL returns the public URL of path. It uses the CDN base URL when
+// set, otherwise the custom endpoint or the regional AWS endpoint in
+// virtual-hosted or path style.
 func (i *Interactor) GetFullURL(path string) string {
-	return fmt.Sprintf("https://s3-%s.amazonaws.com/%s/%s", i.url, i.bucket, path)
+	key := escapeKey(path)
+	if i.cdnURL != "" {
+		return strings.TrimSuffix(i.cdnURL, "/") + "/" + key
+	}
+
+	scheme, host := i.endpointHost()
+	if i.usePathStyle() {
+		return fmt.Sprintf("%s://%s/%s/%s", scheme, host, i.bucket, key)
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", scheme, i.bucket, host, key)
 }
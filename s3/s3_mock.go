@@ -2,14 +2,34 @@ package s3
 
 import (
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"os"
+	"strings"
 )
 
+// canceled returns the error the SDK reports for a request whose context is done.
+func canceled(ctx aws.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
 type S3mock struct {
 	Error       error
 	Filepath    string
 	ContentType string
+	Metadata    map[string]string
+	Keys        []string
+	Versions    []*s3.ObjectVersion
+
+	LifecycleRules   []*s3.LifecycleRule
+	CORSRules        []*s3.CORSRule
+	VersioningStatus string
+
+	Grants []*s3.Grant
 }
 
 func (s *S3mock) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
@@ -19,6 +39,13 @@ func (s *S3mock) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error
 	return &s3.PutObjectOutput{}, nil
 }
 
+func (s *S3mock) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.PutObject(input)
+}
+
 func (s *S3mock) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
 	if s.Error != nil {
 		return nil, s.Error
@@ -40,9 +67,349 @@ func (s *S3mock) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error
 	return &s3.GetObjectOutput{}, nil
 }
 
+func (s *S3mock) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetObject(input)
+}
+
 func (s *S3mock) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
 	if s.Error != nil {
 		return nil, s.Error
 	}
 	return &s3.DeleteObjectOutput{}, nil
 }
+
+func (s *S3mock) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.DeleteObject(input)
+}
+
+func (s *S3mock) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	out := &s3.DeleteObjectsOutput{}
+	for _, o := range input.Delete.Objects {
+		out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: o.Key})
+	}
+	return out, nil
+}
+
+func (s *S3mock) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.DeleteObjects(input)
+}
+
+func (s *S3mock) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	out := &s3.ListObjectsV2Output{}
+	for _, k := range s.Keys {
+		if strings.HasPrefix(k, aws.StringValue(input.Prefix)) {
+			out.Contents = append(out.Contents, &s3.Object{Key: aws.String(k)})
+		}
+	}
+	return out, nil
+}
+
+func (s *S3mock) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.ListObjectsV2(input)
+}
+
+func (s *S3mock) ListObjectVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	out := &s3.ListObjectVersionsOutput{}
+	for _, v := range s.Versions {
+		if strings.HasPrefix(aws.StringValue(v.Key), aws.StringValue(input.Prefix)) {
+			out.Versions = append(out.Versions, v)
+		}
+	}
+	return out, nil
+}
+
+func (s *S3mock) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.ListObjectVersions(input)
+}
+
+func (s *S3mock) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (s *S3mock) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.CopyObject(input)
+}
+
+func (s *S3mock) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.HeadObjectOutput{
+		ContentType: aws.String(s.ContentType),
+		Metadata:    aws.StringMap(s.Metadata),
+	}, nil
+}
+
+func (s *S3mock) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.HeadObject(input)
+}
+
+func (s *S3mock) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (s *S3mock) CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (*s3.CreateBucketOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.CreateBucket(input)
+}
+
+func (s *S3mock) DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+func (s *S3mock) DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (*s3.DeleteBucketOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.DeleteBucket(input)
+}
+
+func (s *S3mock) GetBucketLifecycleConfiguration(input *s3.GetBucketLifecycleConfigurationInput) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: s.LifecycleRules}, nil
+}
+
+func (s *S3mock) GetBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.GetBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetBucketLifecycleConfiguration(input)
+}
+
+func (s *S3mock) PutBucketLifecycleConfiguration(input *s3.PutBucketLifecycleConfigurationInput) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	s.LifecycleRules = input.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (s *S3mock) PutBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.PutBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.PutBucketLifecycleConfiguration(input)
+}
+
+func (s *S3mock) DeleteBucketLifecycle(input *s3.DeleteBucketLifecycleInput) (*s3.DeleteBucketLifecycleOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	s.LifecycleRules = nil
+	return &s3.DeleteBucketLifecycleOutput{}, nil
+}
+
+func (s *S3mock) DeleteBucketLifecycleWithContext(ctx aws.Context, input *s3.DeleteBucketLifecycleInput, opts ...request.Option) (*s3.DeleteBucketLifecycleOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.DeleteBucketLifecycle(input)
+}
+
+func (s *S3mock) GetBucketCors(input *s3.GetBucketCorsInput) (*s3.GetBucketCorsOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.GetBucketCorsOutput{CORSRules: s.CORSRules}, nil
+}
+
+func (s *S3mock) GetBucketCorsWithContext(ctx aws.Context, input *s3.GetBucketCorsInput, opts ...request.Option) (*s3.GetBucketCorsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetBucketCors(input)
+}
+
+func (s *S3mock) PutBucketCors(input *s3.PutBucketCorsInput) (*s3.PutBucketCorsOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	s.CORSRules = input.CORSConfiguration.CORSRules
+	return &s3.PutBucketCorsOutput{}, nil
+}
+
+func (s *S3mock) PutBucketCorsWithContext(ctx aws.Context, input *s3.PutBucketCorsInput, opts ...request.Option) (*s3.PutBucketCorsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.PutBucketCors(input)
+}
+
+func (s *S3mock) DeleteBucketCors(input *s3.DeleteBucketCorsInput) (*s3.DeleteBucketCorsOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	s.CORSRules = nil
+	return &s3.DeleteBucketCorsOutput{}, nil
+}
+
+func (s *S3mock) DeleteBucketCorsWithContext(ctx aws.Context, input *s3.DeleteBucketCorsInput, opts ...request.Option) (*s3.DeleteBucketCorsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.DeleteBucketCors(input)
+}
+
+func (s *S3mock) PutBucketAcl(input *s3.PutBucketAclInput) (*s3.PutBucketAclOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.PutBucketAclOutput{}, nil
+}
+
+func (s *S3mock) PutBucketAclWithContext(ctx aws.Context, input *s3.PutBucketAclInput, opts ...request.Option) (*s3.PutBucketAclOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.PutBucketAcl(input)
+}
+
+func (s *S3mock) GetBucketVersioning(input *s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.GetBucketVersioningOutput{Status: aws.String(s.VersioningStatus)}, nil
+}
+
+func (s *S3mock) GetBucketVersioningWithContext(ctx aws.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (*s3.GetBucketVersioningOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetBucketVersioning(input)
+}
+
+func (s *S3mock) PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	s.VersioningStatus = aws.StringValue(input.VersioningConfiguration.Status)
+	return &s3.PutBucketVersioningOutput{}, nil
+}
+
+func (s *S3mock) PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.PutBucketVersioning(input)
+}
+
+func (s *S3mock) PutObjectAcl(input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.PutObjectAclOutput{}, nil
+}
+
+func (s *S3mock) PutObjectAclWithContext(ctx aws.Context, input *s3.PutObjectAclInput, opts ...request.Option) (*s3.PutObjectAclOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.PutObjectAcl(input)
+}
+
+func (s *S3mock) GetObjectAcl(input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.GetObjectAclOutput{Grants: s.Grants}, nil
+}
+
+func (s *S3mock) GetObjectAclWithContext(ctx aws.Context, input *s3.GetObjectAclInput, opts ...request.Option) (*s3.GetObjectAclOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetObjectAcl(input)
+}
+
+func (s *S3mock) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("mock")}, nil
+}
+
+func (s *S3mock) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.UploadPartOutput{ETag: aws.String(`"mock"`)}, nil
+}
+
+func (s *S3mock) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"mock"`)}}, nil
+}
+
+func (s *S3mock) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (s *S3mock) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
@@ -1,11 +1,20 @@
 package s3
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestACL_String(t *testing.T) {
@@ -19,6 +28,11 @@ func TestACL_String(t *testing.T) {
 			a:    Public,
 			want: "public-read",
 		},
+		{
+			name: "bucket owner full control",
+			a:    BucketOwnerFullControl,
+			want: "bucket-owner-full-control",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -189,3 +203,816 @@ func TestNewS3Client(t *testing.T) {
 		})
 	}
 }
+
+type deleteObjectsRecorder struct {
+	S3mock
+	mu      sync.Mutex
+	batches [][]string
+	failKey string
+}
+
+func (d *deleteObjectsRecorder) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	var batch []string
+	out := &s3.DeleteObjectsOutput{}
+	for _, o := range input.Delete.Objects {
+		batch = append(batch, *o.Key)
+		if *o.Key == d.failKey {
+			out.Errors = append(out.Errors, &s3.Error{Key: o.Key, Code: aws.String("AccessDenied"), Message: aws.String("denied")})
+		}
+	}
+	d.mu.Lock()
+	d.batches = append(d.batches, batch)
+	d.mu.Unlock()
+	return out, nil
+}
+
+func TestInteractor_DeleteMany(t *testing.T) {
+	keys := make([]string, 2500)
+	for n := range keys {
+		keys[n] = fmt.Sprintf("key-%d", n)
+	}
+
+	tests := []struct {
+		name        string
+		client      *deleteObjectsRecorder
+		keys        []string
+		wantBatches int
+		wantFailed  []string
+	}{
+		{
+			name:        "batches",
+			client:      &deleteObjectsRecorder{},
+			keys:        keys,
+			wantBatches: 3,
+		},
+		{
+			name:        "partial failure",
+			client:      &deleteObjectsRecorder{failKey: "key-1"},
+			keys:        keys[:10],
+			wantBatches: 1,
+			wantFailed:  []string{"key-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Interactor{client: tt.client, bucket: "test"}
+			err := i.DeleteMany(tt.keys)
+			if len(tt.client.batches) != tt.wantBatches {
+				t.Errorf("DeleteMany() batches = %d, want %d", len(tt.client.batches), tt.wantBatches)
+			}
+			if tt.wantFailed == nil {
+				if err != nil {
+					t.Errorf("DeleteMany() error = %v", err)
+				}
+				return
+			}
+			var derr DeleteErrors
+			if !errors.As(err, &derr) {
+				t.Fatalf("DeleteMany() error = %v, want DeleteErrors", err)
+			}
+			for _, k := range tt.wantFailed {
+				if _, ok := derr[k]; !ok {
+					t.Errorf("DeleteMany() missing error for %s", k)
+				}
+			}
+		})
+	}
+}
+
+func TestInteractor_DeletePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  Client
+		prefix  string
+		wantErr error
+	}{
+		{
+			name:   "success",
+			client: &S3mock{Keys: []string{"a/1", "a/2", "b/1"}},
+			prefix: "a/",
+		},
+		{
+			name:    "empty prefix",
+			client:  &S3mock{Keys: []string{"a/1"}},
+			prefix:  "",
+			wantErr: ErrEmptyPrefix,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Interactor{client: tt.client, bucket: "test"}
+			if err := i.DeletePrefix(tt.prefix); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeletePrefix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInteractor_DeleteManyContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	i := &Interactor{client: &S3mock{Keys: []string{"a/1", "a/2"}}, bucket: "test"}
+	var derr DeleteErrors
+	if err := i.DeleteManyContext(ctx, []string{"a/1", "a/2"}); !errors.As(err, &derr) || len(derr) != 2 {
+		t.Errorf("DeleteManyContext() error = %v, want 2 failed keys", err)
+	}
+}
+
+func TestInteractor_ListVersions(t *testing.T) {
+	now := time.Now()
+	client := &S3mock{Versions: []*s3.ObjectVersion{
+		{Key: aws.String("a.txt"), VersionId: aws.String("v1"), LastModified: aws.Time(now.Add(-time.Hour)), IsLatest: aws.Bool(false)},
+		{Key: aws.String("a.txt"), VersionId: aws.String("v2"), LastModified: aws.Time(now), IsLatest: aws.Bool(true)},
+		{Key: aws.String("a.txt.bak"), VersionId: aws.String("v3"), LastModified: aws.Time(now)},
+	}}
+
+	tests := []struct {
+		name     string
+		client   Client
+		filepath string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "success",
+			client:   client,
+			filepath: "a.txt",
+			want:     []string{"v2", "v1"},
+		},
+		{
+			name:     "error",
+			client:   &S3mock{Error: errors.New("list")},
+			filepath: "a.txt",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Interactor{client: tt.client, bucket: "test"}
+			got, err := i.ListVersions(tt.filepath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListVersions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var ids []string
+			for _, v := range got {
+				ids = append(ids, v.VersionID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("ListVersions() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestInteractor_copySource(t *testing.T) {
+	i := &Interactor{bucket: "test"}
+	if got, want := i.copySource("dir/a b.txt", "v+1"), "test/dir/a%20b.txt?versionId=v%2B1"; got != want {
+		t.Errorf("copySource() = %v, want %v", got, want)
+	}
+}
+
+func TestObjectAttrs_ContentMD5(t *testing.T) {
+	const etag = `"5d41402abc4b2a76b9719d911017c592"`
+	tests := []struct {
+		name  string
+		attrs ObjectAttrs
+		want  string
+	}{
+		{"single part", ObjectAttrs{ETag: etag}, "5d41402abc4b2a76b9719d911017c592"},
+		{"SSE-S3", ObjectAttrs{ETag: etag, ServerSideEncryption: "AES256"}, "5d41402abc4b2a76b9719d911017c592"},
+		{"SSE-KMS", ObjectAttrs{ETag: etag, ServerSideEncryption: "aws:kms"}, ""},
+		{"SSE-C", ObjectAttrs{ETag: etag, ServerSideEncryption: "AES256", SSECustomerAlgorithm: "AES256"}, ""},
+		{"multipart", ObjectAttrs{ETag: `"5d41402abc4b2a76b9719d911017c592-3"`}, ""},
+		{"not hex", ObjectAttrs{ETag: `"zz41402abc4b2a76b9719d911017c592"`}, ""},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprintf("%x", tt.attrs.ContentMD5()); got != tt.want {
+			t.Errorf("%s: ContentMD5() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// partHeadRecorder serves HeadObject by part and records how many run at once.
+type partHeadRecorder struct {
+	S3mock
+	sizes []int64
+
+	mu        sync.Mutex
+	running   int
+	maxActive int
+}
+
+func (p *partHeadRecorder) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	p.mu.Lock()
+	p.running++
+	if p.running > p.maxActive {
+		p.maxActive = p.running
+	}
+	p.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	p.mu.Lock()
+	p.running--
+	p.mu.Unlock()
+	n := aws.Int64Value(input.PartNumber)
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(p.sizes[n-1]), PartsCount: aws.Int64(int64(len(p.sizes)))}, nil
+}
+
+func TestInteractor_partSizes(t *testing.T) {
+	want := []int64{8, 8, 8, 8, 8, 8, 8, 3}
+	client := &partHeadRecorder{sizes: want}
+	i := &Interactor{client: client, bucket: "test"}
+
+	got, err := i.partSizes(context.Background(), "big", `"etag-8"`, len(want), 4)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("partSizes() = %v, %v, want %v", got, err, want)
+	}
+	if client.maxActive < 2 || client.maxActive > 4 {
+		t.Errorf("partSizes() ran %d HeadObject calls at once, want 2 to 4", client.maxActive)
+	}
+}
+
+type putObjectRecorder struct {
+	S3mock
+	input *s3.PutObjectInput
+}
+
+func (p *putObjectRecorder) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	p.input = input
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestInteractor_UploadWithOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts UploadOptions
+		want *s3.PutObjectInput
+	}{
+		{
+			name: "all options",
+			opts: UploadOptions{
+				ACL:                Public,
+				ContentType:        "image/png",
+				CacheControl:       "max-age=3600",
+				ContentDisposition: `attachment; filename="a.png"`,
+				ContentLanguage:    "ja",
+				StorageClass:       s3.StorageClassStandardIa,
+				Metadata:           map[string]string{"owner": "me"},
+				Tags:               map[string]string{"env": "dev", "team": "a b"},
+			},
+			want: &s3.PutObjectInput{
+				Bucket:             aws.String("test"),
+				Key:                aws.String("a.png"),
+				ACL:                aws.String("public-read"),
+				ContentType:        aws.String("image/png"),
+				CacheControl:       aws.String("max-age=3600"),
+				ContentDisposition: aws.String(`attachment; filename="a.png"`),
+				ContentLanguage:    aws.String("ja"),
+				StorageClass:       aws.String(s3.StorageClassStandardIa),
+				Metadata:           aws.StringMap(map[string]string{"owner": "me"}),
+				Tagging:            aws.String("env=dev&team=a+b"),
+			},
+		},
+		{
+			name: "no options",
+			opts: UploadOptions{},
+			want: &s3.PutObjectInput{
+				Bucket:   aws.String("test"),
+				Key:      aws.String("a.png"),
+				Metadata: map[string]*string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &putObjectRecorder{}
+			i := &Interactor{client: client, bucket: "test"}
+			if err := i.UploadWithOptions(nil, "a.png", tt.opts); err != nil {
+				t.Fatalf("UploadWithOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(client.input, tt.want) {
+				t.Errorf("UploadWithOptions() input = %v, want %v", client.input, tt.want)
+			}
+		})
+	}
+}
+
+type multipartRecorder struct {
+	S3mock
+	parts    []string
+	complete *s3.CompleteMultipartUploadInput
+	aborted  bool
+}
+
+func (m *multipartRecorder) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	b, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.parts = append(m.parts, string(b))
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf(`"%d"`, len(m.parts)))}, nil
+}
+
+func (m *multipartRecorder) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	m.complete = input
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *multipartRecorder) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	m.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestInteractor_UploadStream(t *testing.T) {
+	defer func(size int) { streamPartSize = size }(streamPartSize)
+	streamPartSize = 4
+
+	m := &multipartRecorder{}
+	i := &Interactor{client: m, bucket: "test"}
+	if err := i.UploadStream(strings.NewReader("0123456789"), "a.txt", UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0123", "4567", "89"}; !reflect.DeepEqual(m.parts, want) {
+		t.Errorf("parts = %q, want %q", m.parts, want)
+	}
+	if m.complete == nil || len(m.complete.MultipartUpload.Parts) != 3 || m.aborted {
+		t.Errorf("complete = %v, aborted = %v, want 3 completed parts", m.complete, m.aborted)
+	}
+
+	boom := errors.New("boom")
+	m = &multipartRecorder{}
+	i = &Interactor{client: m, bucket: "test"}
+	r := io.MultiReader(strings.NewReader("01234567"), errReader{boom})
+	if err := i.UploadStream(r, "a.txt", UploadOptions{}); !errors.Is(err, boom) {
+		t.Errorf("UploadStream() error = %v, want %v", err, boom)
+	}
+	if m.complete != nil || !m.aborted {
+		t.Errorf("complete = %v, aborted = %v, want the upload aborted", m.complete, m.aborted)
+	}
+
+	p := &putObjectRecorder{}
+	i = &Interactor{client: p, bucket: "test"}
+	if err := i.UploadStream(strings.NewReader("012"), "a.txt", UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if p.input == nil {
+		t.Error("UploadStream() of one part did not use PutObject")
+	}
+}
+
+type copyPartRecorder struct {
+	multipartRecorder
+	size   int64
+	ranges []string
+	acl    *s3.PutObjectAclInput
+}
+
+func (c *copyPartRecorder) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(c.size), ETag: aws.String(`"src"`)}, nil
+}
+
+func (c *copyPartRecorder) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	if got := aws.StringValue(input.CopySourceIfMatch); got != `"src"` {
+		return nil, fmt.Errorf("CopySourceIfMatch = %s", got)
+	}
+	c.ranges = append(c.ranges, aws.StringValue(input.CopySourceRange))
+	return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"part"`)}}, nil
+}
+
+func (c *copyPartRecorder) PutObjectAclWithContext(ctx aws.Context, input *s3.PutObjectAclInput, opts ...request.Option) (*s3.PutObjectAclOutput, error) {
+	c.acl = input
+	return &s3.PutObjectAclOutput{}, nil
+}
+
+func TestInteractor_CopyParts(t *testing.T) {
+	defer func(max, part int64) { maxCopySize, copyPartSize = max, part }(maxCopySize, copyPartSize)
+	maxCopySize, copyPartSize = 4, 4
+
+	grants := []*s3.Grant{{
+		Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+		Permission: aws.String(s3.PermissionRead),
+	}}
+	c := &copyPartRecorder{multipartRecorder: multipartRecorder{S3mock: S3mock{Grants: grants}}, size: 10}
+	i := &Interactor{client: c, bucket: "test"}
+	if err := i.Copy("a.txt", "", "b.txt", UploadOptions{KeepACL: true}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bytes=0-3", "bytes=4-7", "bytes=8-9"}; !reflect.DeepEqual(c.ranges, want) {
+		t.Errorf("ranges = %q, want %q", c.ranges, want)
+	}
+	if c.complete == nil || len(c.complete.MultipartUpload.Parts) != 3 || c.aborted {
+		t.Errorf("complete = %v, aborted = %v, want 3 completed parts", c.complete, c.aborted)
+	}
+	if c.acl == nil || aws.StringValue(c.acl.Key) != "b.txt" || !reflect.DeepEqual(c.acl.AccessControlPolicy.Grants, grants) {
+		t.Errorf("PutObjectAcl() input = %v, want grants %v on b.txt", c.acl, grants)
+	}
+
+	c = &copyPartRecorder{size: 4}
+	i = &Interactor{client: c, bucket: "test"}
+	if err := i.Copy("a.txt", "", "b.txt", UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if c.ranges != nil {
+		t.Errorf("ranges = %q, want a single CopyObject", c.ranges)
+	}
+
+	c = &copyPartRecorder{size: 10}
+	i = &Interactor{client: c, bucket: "test"}
+	if err := i.Copy("a.txt", `"stale"`, "b.txt", UploadOptions{}); err == nil {
+		t.Error("Copy() of a changed source succeeded")
+	}
+	if c.complete != nil || !c.aborted {
+		t.Errorf("complete = %v, aborted = %v, want the upload aborted", c.complete, c.aborted)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+type copyObjectRecorder struct {
+	S3mock
+	copy *s3.CopyObjectInput
+	acl  *s3.PutObjectAclInput
+}
+
+func (c *copyObjectRecorder) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	c.copy = input
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (c *copyObjectRecorder) PutObjectAclWithContext(ctx aws.Context, input *s3.PutObjectAclInput, opts ...request.Option) (*s3.PutObjectAclOutput, error) {
+	c.acl = input
+	return &s3.PutObjectAclOutput{}, nil
+}
+
+func TestInteractor_UpdateMetadata(t *testing.T) {
+	grants := []*s3.Grant{{
+		Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+		Permission: aws.String(s3.PermissionRead),
+	}}
+
+	tests := []struct {
+		name     string
+		opts     UploadOptions
+		wantACL  *string
+		wantMeta map[string]string
+		restored bool
+	}{
+		{
+			name:     "keeps acl and metadata",
+			opts:     UploadOptions{CacheControl: "no-cache"},
+			wantMeta: map[string]string{"owner": "me"},
+			restored: true,
+		},
+		{
+			name:     "replaces acl",
+			opts:     UploadOptions{ACL: Private, Metadata: map[string]string{"owner": "you"}},
+			wantACL:  aws.String("private"),
+			wantMeta: map[string]string{"owner": "you"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &copyObjectRecorder{S3mock: S3mock{ContentType: "text/plain", Metadata: map[string]string{"owner": "me"}, Grants: grants}}
+			i := &Interactor{client: client, bucket: "test"}
+			if err := i.UpdateMetadata("a.txt", tt.opts); err != nil {
+				t.Fatalf("UpdateMetadata() error = %v", err)
+			}
+			if got := client.copy.ACL; !reflect.DeepEqual(got, tt.wantACL) {
+				t.Errorf("CopyObject() ACL = %v, want %v", aws.StringValue(got), aws.StringValue(tt.wantACL))
+			}
+			if got := aws.StringValueMap(client.copy.Metadata); !reflect.DeepEqual(got, tt.wantMeta) {
+				t.Errorf("CopyObject() Metadata = %v, want %v", got, tt.wantMeta)
+			}
+			if got := aws.StringValue(client.copy.ContentType); got != "text/plain" {
+				t.Errorf("CopyObject() ContentType = %v, want text/plain", got)
+			}
+			if !tt.restored {
+				if client.acl != nil {
+					t.Errorf("PutObjectAcl() called with %v", client.acl)
+				}
+				return
+			}
+			if client.acl == nil || !reflect.DeepEqual(client.acl.AccessControlPolicy.Grants, grants) {
+				t.Errorf("PutObjectAcl() input = %v, want grants %v", client.acl, grants)
+			}
+		})
+	}
+}
+
+func TestBucketAdmin_Lifecycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []LifecycleRule
+		want  []LifecycleRule
+	}{
+		{
+			name: "round trip",
+			rules: []LifecycleRule{
+				{ID: "expire", Prefix: "tmp/", Days: 7},
+				{ID: "archive", Prefix: "logs/", Days: 30, StorageClass: s3.TransitionStorageClassGlacier},
+				{ID: "old", Days: 90, NoncurrentOnly: true},
+			},
+			want: []LifecycleRule{
+				{ID: "expire", Prefix: "tmp/", Days: 7},
+				{ID: "archive", Prefix: "logs/", Days: 30, StorageClass: s3.TransitionStorageClassGlacier},
+				{ID: "old", Days: 90, NoncurrentOnly: true},
+			},
+		},
+		{
+			name:  "generated id",
+			rules: []LifecycleRule{{Days: 1}},
+			want:  []LifecycleRule{{ID: "rule-0", Days: 1}},
+		},
+		{
+			name: "several actions",
+			rules: []LifecycleRule{
+				{ID: "logs", Prefix: "logs/", Days: 30, StorageClass: s3.TransitionStorageClassStandardIa},
+				{ID: "logs", Prefix: "logs/", Days: 90, StorageClass: s3.TransitionStorageClassGlacier},
+				{ID: "logs", Prefix: "logs/", Days: 365},
+			},
+			want: []LifecycleRule{
+				{ID: "logs", Prefix: "logs/", Days: 365},
+				{ID: "logs", Prefix: "logs/", Days: 30, StorageClass: s3.TransitionStorageClassStandardIa},
+				{ID: "logs", Prefix: "logs/", Days: 90, StorageClass: s3.TransitionStorageClassGlacier},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBucketAdmin(&S3mock{}, "test")
+			if err := b.SetLifecycle(tt.rules); err != nil {
+				t.Fatalf("SetLifecycle() error = %v", err)
+			}
+			got, err := b.Lifecycle()
+			if err != nil {
+				t.Fatalf("Lifecycle() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lifecycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucketAdmin_SetLifecycleSharedID(t *testing.T) {
+	m := &S3mock{}
+	b := NewBucketAdmin(m, "test")
+	if err := b.SetLifecycle([]LifecycleRule{{ID: "a", Days: 1}, {ID: "a", Days: 30, StorageClass: s3.TransitionStorageClassGlacier}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.LifecycleRules) != 1 {
+		t.Errorf("SetLifecycle() put %d rules, want 1", len(m.LifecycleRules))
+	}
+	if err := b.SetLifecycle([]LifecycleRule{{ID: "a", Prefix: "x/", Days: 1}, {ID: "a", Prefix: "y/", Days: 2}}); err == nil {
+		t.Error("SetLifecycle() with one ID on two prefixes error = nil")
+	}
+}
+
+// bucketRecorder records whether configurations were put or deleted.
+type bucketRecorder struct {
+	S3mock
+	calls []string
+}
+
+func (b *bucketRecorder) PutBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.PutBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	b.calls = append(b.calls, "PutBucketLifecycleConfiguration")
+	return b.S3mock.PutBucketLifecycleConfigurationWithContext(ctx, input, opts...)
+}
+
+func (b *bucketRecorder) DeleteBucketLifecycleWithContext(ctx aws.Context, input *s3.DeleteBucketLifecycleInput, opts ...request.Option) (*s3.DeleteBucketLifecycleOutput, error) {
+	b.calls = append(b.calls, "DeleteBucketLifecycle")
+	return b.S3mock.DeleteBucketLifecycleWithContext(ctx, input, opts...)
+}
+
+func (b *bucketRecorder) PutBucketCorsWithContext(ctx aws.Context, input *s3.PutBucketCorsInput, opts ...request.Option) (*s3.PutBucketCorsOutput, error) {
+	b.calls = append(b.calls, "PutBucketCors")
+	return b.S3mock.PutBucketCorsWithContext(ctx, input, opts...)
+}
+
+func (b *bucketRecorder) DeleteBucketCorsWithContext(ctx aws.Context, input *s3.DeleteBucketCorsInput, opts ...request.Option) (*s3.DeleteBucketCorsOutput, error) {
+	b.calls = append(b.calls, "DeleteBucketCors")
+	return b.S3mock.DeleteBucketCorsWithContext(ctx, input, opts...)
+}
+
+func TestBucketAdmin_ClearConfiguration(t *testing.T) {
+	m := &bucketRecorder{}
+	b := NewBucketAdmin(m, "test")
+	if err := b.SetLifecycle([]LifecycleRule{{Days: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetLifecycle(nil); err != nil {
+		t.Fatalf("SetLifecycle(nil) error = %v", err)
+	}
+	if err := b.SetCORS([]CORSRule{{AllowedOrigins: []string{"*"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetCORS(nil); err != nil {
+		t.Fatalf("SetCORS(nil) error = %v", err)
+	}
+
+	want := []string{"PutBucketLifecycleConfiguration", "DeleteBucketLifecycle", "PutBucketCors", "DeleteBucketCors"}
+	if !reflect.DeepEqual(m.calls, want) {
+		t.Errorf("calls = %v, want %v", m.calls, want)
+	}
+	if m.LifecycleRules != nil || m.CORSRules != nil {
+		t.Errorf("rules left after clearing: %v, %v", m.LifecycleRules, m.CORSRules)
+	}
+}
+
+func TestBucketAdmin_NoConfiguration(t *testing.T) {
+	lifecycle := NewBucketAdmin(&S3mock{Error: awserr.New("NoSuchLifecycleConfiguration", "none", nil)}, "test")
+	if rules, err := lifecycle.Lifecycle(); err != nil || len(rules) != 0 {
+		t.Errorf("Lifecycle() = %v, %v, want no rules", rules, err)
+	}
+	cors := NewBucketAdmin(&S3mock{Error: awserr.New("NoSuchCORSConfiguration", "none", nil)}, "test")
+	if rules, err := cors.CORS(); err != nil || len(rules) != 0 {
+		t.Errorf("CORS() = %v, %v, want no rules", rules, err)
+	}
+	denied := NewBucketAdmin(&S3mock{Error: awserr.New("AccessDenied", "denied", nil)}, "test")
+	if _, err := denied.CORS(); err == nil {
+		t.Errorf("CORS() error = nil, want AccessDenied")
+	}
+}
+
+func TestBucketAdmin_Versioning(t *testing.T) {
+	b := NewBucketAdmin(&S3mock{}, "test")
+	for _, enabled := range []bool{true, false} {
+		if err := b.SetVersioning(enabled); err != nil {
+			t.Fatalf("SetVersioning() error = %v", err)
+		}
+		if got, err := b.Versioning(); err != nil || got != enabled {
+			t.Errorf("Versioning() = %v, %v, want %v", got, err, enabled)
+		}
+	}
+}
+
+func TestInteractor_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	i := &Interactor{client: &S3mock{}, bucket: "test"}
+	b := NewBucketAdmin(&S3mock{}, "test")
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"UploadContext", func() error { return i.UploadContext(ctx, nil, "a.png", Public, "image/png") }},
+		{"UploadStreamContext", func() error { return i.UploadStreamContext(ctx, strings.NewReader("a"), "a.png", UploadOptions{}) }},
+		{"DownloadContext", func() error { _, _, err := i.DownloadContext(ctx, "a.png"); return err }},
+		{"RemoveContext", func() error { return i.RemoveContext(ctx, "a.png") }},
+		{"ListContext", func() error { _, err := i.ListContext(ctx, "a"); return err }},
+		{"DeletePrefixContext", func() error { return i.DeletePrefixContext(ctx, "a") }},
+		{"StatContext", func() error { _, err := i.StatContext(ctx, "a.png"); return err }},
+		{"UpdateMetadataContext", func() error { return i.UpdateMetadataContext(ctx, "a.png", UploadOptions{ACL: Private}) }},
+		{"ListVersionsContext", func() error { _, err := i.ListVersionsContext(ctx, "a.png"); return err }},
+		{"RestoreVersionContext", func() error { return i.RestoreVersionContext(ctx, "a.png", "v1") }},
+		{"SetACLContext", func() error { return i.SetACLContext(ctx, "a.png", Public) }},
+		{"GetACLContext", func() error { _, err := i.GetACLContext(ctx, "a.png"); return err }},
+		{"BucketAdmin.CreateContext", func() error { return b.CreateContext(ctx, "") }},
+		{"BucketAdmin.LifecycleContext", func() error { _, err := b.LifecycleContext(ctx); return err }},
+		{"BucketAdmin.SetCORSContext", func() error { return b.SetCORSContext(ctx, nil) }},
+		{"BucketAdmin.SetVersioningContext", func() error { return b.SetVersioningContext(ctx, true) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			var aerr awserr.Error
+			if !errors.As(err, &aerr) || aerr.Code() != request.CanceledErrorCode {
+				t.Errorf("%s() error = %v, want %s", tt.name, err, request.CanceledErrorCode)
+			}
+		})
+	}
+}
+
+func TestInteractor_GetFullURL(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+		path string
+		want string
+	}{
+		{
+			name: "virtual hosted",
+			opt:  Options{Bucket: "test", Region: "ap-northeast-1"},
+			path: "images/a.png",
+			want: "https://test.s3.ap-northeast-1.amazonaws.com/images/a.png",
+		},
+		{
+			name: "path style",
+			opt:  Options{Bucket: "test", Region: "ap-northeast-1", ForcePathStyle: true},
+			path: "a.png",
+			want: "https://s3.ap-northeast-1.amazonaws.com/test/a.png",
+		},
+		{
+			name: "legacy region in URL",
+			opt:  Options{Bucket: "test", URL: "us-west-2"},
+			path: "a.png",
+			want: "https://test.s3.us-west-2.amazonaws.com/a.png",
+		},
+		{
+			name: "dotted bucket",
+			opt:  Options{Bucket: "assets.example.com", Region: "us-east-1"},
+			path: "a.png",
+			want: "https://s3.us-east-1.amazonaws.com/assets.example.com/a.png",
+		},
+		{
+			name: "dualstack",
+			opt:  Options{Bucket: "test", Region: "eu-west-1", Dualstack: true},
+			path: "a.png",
+			want: "https://test.s3.dualstack.eu-west-1.amazonaws.com/a.png",
+		},
+		{
+			name: "minio",
+			opt:  Options{Bucket: "test", Endpoint: "http://localhost:9000", ForcePathStyle: true},
+			path: "a.png",
+			want: "http://localhost:9000/test/a.png",
+		},
+		{
+			name: "r2",
+			opt:  Options{Bucket: "test", Endpoint: "https://account.r2.cloudflarestorage.com"},
+			path: "a.png",
+			want: "https://test.account.r2.cloudflarestorage.com/a.png",
+		},
+		{
+			name: "cdn",
+			opt:  Options{Bucket: "test", Region: "us-east-1", CDNURL: "https://d111111abcdef8.cloudfront.net/"},
+			path: "a.png",
+			want: "https://d111111abcdef8.cloudfront.net/a.png",
+		},
+		{
+			name: "escaping",
+			opt:  Options{Bucket: "test", Region: "us-east-1"},
+			path: "dir/日本 語+1.png",
+			want: "https://test.s3.us-east-1.amazonaws.com/dir/%E6%97%A5%E6%9C%AC%20%E8%AA%9E%2B1.png",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(&S3mock{}, tt.opt).GetFullURL(tt.path); got != tt.want {
+				t.Errorf("GetFullURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInteractor_GetACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  Client
+		want    []Grant
+		wantErr bool
+	}{
+		{
+			name: "success",
+			client: &S3mock{Grants: []*s3.Grant{
+				{Grantee: &s3.Grantee{ID: aws.String("owner"), DisplayName: aws.String("me")}, Permission: aws.String(s3.PermissionFullControl)},
+				{Grantee: &s3.Grantee{URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")}, Permission: aws.String(s3.PermissionRead)},
+			}},
+			want: []Grant{
+				{ID: "owner", DisplayName: "me", Permission: "FULL_CONTROL"},
+				{URI: "http://acs.amazonaws.com/groups/global/AllUsers", Permission: "READ"},
+			},
+		},
+		{
+			name:    "error",
+			client:  &S3mock{Error: errors.New("acl")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Interactor{client: tt.client, bucket: "test"}
+			got, err := i.GetACL("a.png")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetACL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetACL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no such key", fmt.Errorf("storage.download, err: %w", awserr.New(s3.ErrCodeNoSuchKey, "missing", nil)), true},
+		{"head not found", awserr.New("NotFound", "", nil), true},
+		{"access denied", awserr.New("AccessDenied", "", nil), false},
+		{"other", errors.New("x"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNotFound(tt.err); got != tt.want {
+				t.Errorf("IsNotFound() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ErrPresignNotSupported is returned by SignedURL when the Client cannot build requests.
+var ErrPresignNotSupported = errors.New("storage.signedURL: client does not support presigning")
+
+type presigner interface {
+	GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
+}
+
+// GetObjectRequest calls c.GetObjectRequest so that Client decorators can keep
+// SignedURL working. When c cannot build requests, presigning the returned
+// request fails with ErrPresignNotSupported.
+func GetObjectRequest(c Client, input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	if p, ok := c.(presigner); ok {
+		return p.GetObjectRequest(input)
+	}
+	return &request.Request{
+		Operation:   &request.Operation{Name: "GetObject"},
+		HTTPRequest: &http.Request{URL: &url.URL{}, Header: http.Header{}},
+		Error:       ErrPresignNotSupported,
+	}, &s3.GetObjectOutput{}
+}
+
+// SignedURL returns a presigned GET URL for filepath that is valid for expires.
+// The Client must be an *s3.S3 or otherwise provide GetObjectRequest.
+func (i *Interactor) SignedURL(filepath string, expires time.Duration) (string, error) {
+	p, ok := i.client.(presigner)
+	if !ok {
+		return "", ErrPresignNotSupported
+	}
+
+	req, _ := p.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(i.bucket),
+		Key:    aws.String(filepath),
+	})
+	u, err := req.Presign(expires)
+	if err != nil {
+		return "", fmt.Errorf("storage.signedURL, err: %w", err)
+	}
+
+	return u, nil
+}
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxParts is the most parts S3 accepts in one multipart upload.
+const maxParts = 10000
+
+// streamPartSize is the size of one part of UploadStream. S3 requires every
+// part but the last to be at least 5 MiB.
+var streamPartSize = 8 << 20
+
+// UploadStream uploads the data read from r, whose size need not be known.
+// Data that fits in one part is sent with a single PutObject; larger data is
+// sent as a multipart upload, which is aborted if reading r or any part
+// fails, so a failed upload never leaves an object behind.
+func (i *Interactor) UploadStream(r io.Reader, filepath string, opts UploadOptions) error {
+	return i.UploadStreamContext(context.Background(), r, filepath, opts)
+}
+
+// UploadStreamContext is UploadStream with a context for cancellation and deadlines.
+func (i *Interactor) UploadStreamContext(ctx context.Context, r io.Reader, filepath string, opts UploadOptions) error {
+	buf := make([]byte, streamPartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return i.UploadWithOptionsContext(ctx, bytes.NewReader(buf[:n]), filepath, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("storage.uploadStream, err: %w", err)
+	}
+
+	out, err := i.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(i.bucket),
+		Key:                aws.String(filepath),
+		ACL:                optionalString(opts.ACL.String()),
+		ContentType:        optionalString(opts.ContentType),
+		CacheControl:       optionalString(opts.CacheControl),
+		ContentDisposition: optionalString(opts.ContentDisposition),
+		ContentLanguage:    optionalString(opts.ContentLanguage),
+		StorageClass:       optionalString(opts.StorageClass),
+		Metadata:           aws.StringMap(opts.Metadata),
+		Tagging:            optionalString(encodeTags(opts.Tags)),
+	})
+	if err != nil {
+		return fmt.Errorf("storage.uploadStream, err: %w", err)
+	}
+
+	if err := i.uploadParts(ctx, out.UploadId, filepath, r, buf, opts); err != nil {
+		// The upload is aborted even when ctx is done, so its parts are not
+		// left behind to be billed.
+		i.client.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(i.bucket),
+			Key:      aws.String(filepath),
+			UploadId: out.UploadId,
+		})
+		return fmt.Errorf("storage.uploadStream, err: %w", err)
+	}
+	return nil
+}
+
+// uploadParts uploads buf, which holds the first full part, and the rest of
+// r as the parts of uploadID, then completes the upload.
+func (i *Interactor) uploadParts(ctx context.Context, uploadID *string, filepath string, r io.Reader, buf []byte, opts UploadOptions) error {
+	var parts []*s3.CompletedPart
+	n := len(buf)
+	for {
+		if len(parts) == maxParts {
+			return errors.New("upload exceeds the maximum number of parts")
+		}
+		sum := md5.Sum(buf[:n])
+		num := aws.Int64(int64(len(parts) + 1))
+		out, err := i.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(i.bucket),
+			Key:        aws.String(filepath),
+			UploadId:   uploadID,
+			PartNumber: num,
+			Body:       bytes.NewReader(buf[:n]),
+			ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		})
+		if err != nil {
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: out.ETag, PartNumber: num})
+
+		var rerr error
+		n, rerr = io.ReadFull(r, buf)
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil && rerr != io.ErrUnexpectedEOF {
+			return rerr
+		}
+	}
+
+	var reqOpts []request.Option
+	if h := opts.conditionHeaders(); len(h) > 0 {
+		reqOpts = append(reqOpts, request.WithSetRequestHeaders(h))
+	}
+	_, err := i.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(i.bucket),
+		Key:             aws.String(filepath),
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	}, reqOpts...)
+	return err
+}
@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const defaultRegion = "us-east-1"
+
+// endpointHost returns the scheme and host that serve the bucket.
+func (i *Interactor) endpointHost() (string, string) {
+	scheme := "https"
+	if i.disableSSL {
+		scheme = "http"
+	}
+
+	if i.endpoint != "" {
+		u, err := url.Parse(i.endpoint)
+		if err == nil && u.Host != "" {
+			return u.Scheme, u.Host
+		}
+		// Endpoints may be given without a scheme, as the SDK accepts.
+		return scheme, strings.TrimSuffix(i.endpoint, "/")
+	}
+
+	region := i.region
+	// Options.URL used to hold the region; keep honouring it.
+	if region == "" && i.url != "" && !strings.Contains(i.url, "://") {
+		region = i.url
+	}
+	if region == "" {
+		region = defaultRegion
+	}
+
+	if i.dualstack {
+		return scheme, fmt.Sprintf("s3.dualstack.%s.amazonaws.com", region)
+	}
+	return scheme, fmt.Sprintf("s3.%s.amazonaws.com", region)
+}
+
+// usePathStyle reports whether the bucket must go in the path rather than the host.
+// Dotted bucket names do not match the wildcard TLS certificate of virtual hosts.
+func (i *Interactor) usePathStyle() bool {
+	return i.forcePathStyle || (!i.disableSSL && strings.Contains(i.bucket, "."))
+}
+
+// escapeKey percent-encodes key per the S3 URI encoding rules, keeping '/' separators.
+func escapeKey(key string) string {
+	var b strings.Builder
+	for _, c := range []byte(key) {
+		if isUnreserved(c) || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
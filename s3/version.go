@@ -0,0 +1,159 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Version is a single version of an object in a versioned bucket.
+type Version struct {
+	VersionID      string
+	Size           int64
+	LastModified   time.Time
+	IsLatest       bool
+	IsDeleteMarker bool
+}
+
+// ListVersions returns every version and delete marker of filepath, newest first.
+func (i *Interactor) ListVersions(filepath string) ([]Version, error) {
+	return i.ListVersionsContext(context.Background(), filepath)
+}
+
+// ListVersionsContext is ListVersions with a context for cancellation and deadlines.
+func (i *Interactor) ListVersionsContext(ctx context.Context, filepath string) ([]Version, error) {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(i.bucket),
+		Prefix: aws.String(filepath),
+	}
+
+	var versions []Version
+	for {
+		out, err := i.client.ListObjectVersionsWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("storage.listVersions, err: %w", err)
+		}
+
+		for _, v := range out.Versions {
+			if aws.StringValue(v.Key) != filepath {
+				continue
+			}
+			versions = append(versions, Version{
+				VersionID:    aws.StringValue(v.VersionId),
+				Size:         aws.Int64Value(v.Size),
+				LastModified: aws.TimeValue(v.LastModified),
+				IsLatest:     aws.BoolValue(v.IsLatest),
+			})
+		}
+		for _, m := range out.DeleteMarkers {
+			if aws.StringValue(m.Key) != filepath {
+				continue
+			}
+			versions = append(versions, Version{
+				VersionID:      aws.StringValue(m.VersionId),
+				LastModified:   aws.TimeValue(m.LastModified),
+				IsLatest:       aws.BoolValue(m.IsLatest),
+				IsDeleteMarker: true,
+			})
+		}
+
+		if !aws.BoolValue(out.IsTruncated) {
+			break
+		}
+		input.KeyMarker = out.NextKeyMarker
+		input.VersionIdMarker = out.NextVersionIdMarker
+	}
+
+	sort.SliceStable(versions, func(a, b int) bool {
+		return versions[a].LastModified.After(versions[b].LastModified)
+	})
+
+	return versions, nil
+}
+
+// DownloadVersion downloads a specific version of filepath.
+func (i *Interactor) DownloadVersion(filepath, versionID string) (io.ReadCloser, *string, error) {
+	return i.DownloadVersionContext(context.Background(), filepath, versionID)
+}
+
+// DownloadVersionContext is DownloadVersion with a context for cancellation and deadlines.
+func (i *Interactor) DownloadVersionContext(ctx context.Context, filepath, versionID string) (io.ReadCloser, *string, error) {
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(i.bucket),
+		Key:       aws.String(filepath),
+		VersionId: aws.String(versionID),
+	}
+
+	result, err := i.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("storage.downloadVersion, err: %w", err)
+	}
+	return result.Body, result.ContentType, nil
+}
+
+// RemoveVersion permanently deletes a specific version of filepath.
+func (i *Interactor) RemoveVersion(filepath, versionID string) error {
+	return i.RemoveVersionContext(context.Background(), filepath, versionID)
+}
+
+// RemoveVersionContext is RemoveVersion with a context for cancellation and deadlines.
+func (i *Interactor) RemoveVersionContext(ctx context.Context, filepath, versionID string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket:    aws.String(i.bucket),
+		Key:       aws.String(filepath),
+		VersionId: aws.String(versionID),
+	}
+
+	_, err := i.client.DeleteObjectWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("storage.removeVersion, err: %w", err)
+	}
+
+	return nil
+}
+
+// RestoreVersion makes versionID the current version of filepath by copying it onto itself.
+// A copy resets the ACL, so the grants of the current version are read first
+// and applied again to the restored one.
+func (i *Interactor) RestoreVersion(filepath, versionID string) error {
+	return i.RestoreVersionContext(context.Background(), filepath, versionID)
+}
+
+// RestoreVersionContext is RestoreVersion with a context for cancellation and deadlines.
+func (i *Interactor) RestoreVersionContext(ctx context.Context, filepath, versionID string) error {
+	acl, err := i.objectACL(ctx, filepath)
+	if err != nil {
+		return fmt.Errorf("storage.restoreVersion, err: %w", err)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(i.bucket),
+		Key:        aws.String(filepath),
+		CopySource: aws.String(i.copySource(filepath, versionID)),
+	}
+
+	if _, err := i.client.CopyObjectWithContext(ctx, input); err != nil {
+		return fmt.Errorf("storage.restoreVersion, err: %w", err)
+	}
+
+	if err := i.putObjectACL(ctx, filepath, acl); err != nil {
+		return fmt.Errorf("storage.restoreVersion, restore acl, err: %w", err)
+	}
+
+	return nil
+}
+
+// copySource builds the URL-encoded CopySource value for key in the interactor's bucket.
+func (i *Interactor) copySource(key, versionID string) string {
+	src := i.bucket + "/" + escapeKey(key)
+	if versionID != "" {
+		src += "?versionId=" + url.QueryEscape(versionID)
+	}
+	return src
+}
@@ -0,0 +1,635 @@
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// route splits a request into bucket and key for both path-style
+// (/bucket/key) and virtual-hosted (bucket.host/key) addressing.
+func route(r *http.Request) (string, string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if net.ParseIP(host) == nil && strings.Contains(host, ".") {
+		return host[:strings.Index(host, ".")], path
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	bucketName, key := route(r)
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if bucketName == "" {
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "listing buckets is not supported")
+		return
+	}
+
+	if key == "" {
+		s.serveBucket(w, r, bucketName, q)
+		return
+	}
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && has(q, "uploads"):
+		s.createMultipartUpload(w, r, bucketName, key)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		s.uploadPart(w, r, q)
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		s.completeMultipartUpload(w, r, b, key, q.Get("uploadId"))
+	case r.Method == http.MethodDelete && q.Get("uploadId") != "":
+		delete(s.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && has(q, "acl"):
+		s.putObjectACL(w, r, b, key)
+	case r.Method == http.MethodGet && has(q, "acl"):
+		s.getObjectACL(w, r, b, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, b, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, b, key)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		s.getObject(w, r, b, key)
+	case r.Method == http.MethodDelete:
+		if !checkConditions(w, r, b.objects[key]) {
+			return
+		}
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", r.Method+" is not supported")
+	}
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, name string, q url.Values) {
+	b, ok := s.buckets[name]
+
+	switch {
+	case r.Method == http.MethodPut:
+		if ok {
+			writeError(w, r, http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded")
+			return
+		}
+		s.buckets[name] = &bucket{objects: map[string]*object{}}
+		w.WriteHeader(http.StatusOK)
+		return
+	case !ok:
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete:
+		if len(b.objects) > 0 {
+			writeError(w, r, http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+			return
+		}
+		delete(s.buckets, name)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && has(q, "delete"):
+		s.deleteObjects(w, r, b)
+	case r.Method == http.MethodGet && q.Get("list-type") == "2":
+		s.listObjectsV2(w, r, name, b, q)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "bucket operation is not supported")
+	}
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if !checkContentMD5(w, r, data) {
+		return
+	}
+	if !checkConditions(w, r, b.objects[key]) {
+		return
+	}
+
+	obj := newObject(data, storedHeader(r.Header), r.Header.Get("X-Amz-Acl"))
+	b.objects[key] = obj
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkConditions evaluates the If-Match and If-None-Match headers of a
+// write or delete against the current object, which is nil if absent.
+func checkConditions(w http.ResponseWriter, r *http.Request, obj *object) bool {
+	if v := r.Header.Get("If-Match"); v != "" {
+		if obj == nil {
+			writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return false
+		}
+		if strings.Trim(v, `"`) != strings.Trim(obj.etag, `"`) {
+			writeError(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return false
+		}
+	}
+	if r.Header.Get("If-None-Match") == "*" && obj != nil {
+		writeError(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return false
+	}
+	return true
+}
+
+func checkContentMD5(w http.ResponseWriter, r *http.Request, data []byte) bool {
+	want := r.Header.Get("Content-Md5")
+	if want == "" {
+		return true
+	}
+	sum := md5.Sum(data)
+	if base64.StdEncoding.EncodeToString(sum[:]) != want {
+		writeError(w, r, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received")
+		return false
+	}
+	return true
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj, ok := b.objects[key]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	if !checkConditions(w, r, obj) {
+		return
+	}
+
+	h := w.Header()
+	for name, v := range obj.header {
+		h[name] = v
+	}
+	h.Set("ETag", obj.etag)
+	h.Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+
+	data := obj.data
+	status := http.StatusOK
+	if v := r.URL.Query().Get("partNumber"); v != "" {
+		start, end, count, ok := obj.part(v)
+		if !ok {
+			writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidPartNumber", "The requested partnumber is not satisfiable")
+			return
+		}
+		if obj.parts != nil {
+			h.Set("X-Amz-Mp-Parts-Count", strconv.Itoa(count))
+		}
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data)))
+		data = data[start:end]
+		status = http.StatusPartialContent
+	} else if rng := r.Header.Get("Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(data)))
+		if !ok {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", len(data)))
+			writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// part returns the byte range [start, end) of part number v of obj and the
+// number of parts. An object not uploaded in parts is its own part 1.
+func (obj *object) part(v string) (int, int, int, bool) {
+	n, err := strconv.Atoi(v)
+	sizes := obj.parts
+	if sizes == nil {
+		sizes = []int{len(obj.data)}
+	}
+	if err != nil || n < 1 || n > len(sizes) {
+		return 0, 0, 0, false
+	}
+
+	start := 0
+	for _, size := range sizes[:n-1] {
+		start += size
+	}
+	return start, start + sizes[n-1], len(sizes), true
+}
+
+// parseRange parses a single "bytes=start-end", "bytes=start-" or "bytes=-suffix" range.
+func parseRange(rng string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(rng, "bytes=")
+	if spec == rng || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	if parts[0] == "" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	srcObj, ok := s.copySource(w, r)
+	if !ok {
+		return
+	}
+	if !checkConditions(w, r, b.objects[key]) {
+		return
+	}
+
+	header := srcObj.header
+	if strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		header = storedHeader(r.Header)
+	}
+	// Like S3, a copy gets the ACL of the request, not that of its source.
+	acl := r.Header.Get("X-Amz-Acl")
+
+	obj := newObject(append([]byte(nil), srcObj.data...), header, acl)
+	b.objects[key] = obj
+
+	writeXML(w, http.StatusOK, copyObjectResult{
+		ETag:         obj.etag,
+		LastModified: obj.lastModified.Format(time.RFC3339),
+	})
+}
+
+// copySource returns the object named by the X-Amz-Copy-Source header of
+// a copy, if it still matches X-Amz-Copy-Source-If-Match.
+func (s *Server) copySource(w http.ResponseWriter, r *http.Request) (*object, bool) {
+	// Split off the ?versionId query before unescaping, so an escaped "?"
+	// in the key is not taken for it. Versions are not kept; the query is
+	// ignored.
+	src := r.Header.Get("X-Amz-Copy-Source")
+	if i := strings.Index(src, "?"); i >= 0 {
+		src = src[:i]
+	}
+	src, err := url.PathUnescape(src)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+		return nil, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(src, "/"), "/", 2)
+	if len(parts) != 2 {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+		return nil, false
+	}
+
+	srcBucket, ok := s.buckets[parts[0]]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return nil, false
+	}
+	srcObj, ok := srcBucket.objects[parts[1]]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return nil, false
+	}
+
+	if v := r.Header.Get("X-Amz-Copy-Source-If-Match"); v != "" && strings.Trim(v, `"`) != strings.Trim(srcObj.etag, `"`) {
+		writeError(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return nil, false
+	}
+	return srcObj, true
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, b *bucket) {
+	var req deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	res := deleteResult{Xmlns: xmlns}
+	for _, o := range req.Objects {
+		delete(b.objects, o.Key)
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, deletedObject{Key: o.Key})
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request, name string, b *bucket, q url.Values) {
+	prefix := q.Get("prefix")
+	delimiter := q.Get("delimiter")
+	maxKeys := 1000
+	if v := q.Get("max-keys"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid continuation token")
+			return
+		}
+		after = string(b)
+	}
+
+	res := listResult{
+		Xmlns:             xmlns,
+		Name:              name,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           maxKeys,
+		ContinuationToken: q.Get("continuation-token"),
+	}
+
+	seen := map[string]bool{}
+	last := ""
+	for _, k := range b.sortedKeys() {
+		if !strings.HasPrefix(k, prefix) || k <= after {
+			continue
+		}
+		if res.KeyCount >= maxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+			break
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				cp := k[:len(prefix)+i+len(delimiter)]
+				if !seen[cp] {
+					seen[cp] = true
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: cp})
+					res.KeyCount++
+				}
+				// Skip past every key under the prefix on the next page.
+				last = cp + "\xff"
+				continue
+			}
+		}
+
+		obj := b.objects[k]
+		res.Contents = append(res.Contents, listEntry{
+			Key:          k,
+			LastModified: obj.lastModified.Format(time.RFC3339),
+			ETag:         obj.etag,
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		})
+		res.KeyCount++
+		last = k
+	}
+
+	writeXML(w, http.StatusOK, res)
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	id := s.newUploadID()
+	s.uploads[id] = &upload{
+		bucket: bucketName,
+		key:    key,
+		header: storedHeader(r.Header),
+		acl:    r.Header.Get("X-Amz-Acl"),
+		parts:  map[int][]byte{},
+	}
+	writeXML(w, http.StatusOK, initiateResult{Xmlns: xmlns, Bucket: bucketName, Key: key, UploadID: id})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, q url.Values) {
+	u, ok := s.uploads[q.Get("uploadId")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+	n, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || n < 1 || n > 10000 {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		s.uploadPartCopy(w, r, u, n)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if !checkContentMD5(w, r, data) {
+		return
+	}
+
+	u.parts[n] = data
+	sum := md5.Sum(data)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadPartCopy stores the X-Amz-Copy-Source-Range of the copy source,
+// or all of it, as part n of u.
+func (s *Server) uploadPartCopy(w http.ResponseWriter, r *http.Request, u *upload, n int) {
+	srcObj, ok := s.copySource(w, r)
+	if !ok {
+		return
+	}
+
+	data := srcObj.data
+	if rng := r.Header.Get("X-Amz-Copy-Source-Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(data)))
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid copy source range")
+			return
+		}
+		data = data[start : end+1]
+	}
+
+	u.parts[n] = append([]byte(nil), data...)
+	sum := md5.Sum(data)
+	writeXML(w, http.StatusOK, copyPartResult{
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, b *bucket, key, id string) {
+	u, ok := s.uploads[id]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+
+	var req completeRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	if !sort.SliceIsSorted(req.Parts, func(i, j int) bool { return req.Parts[i].PartNumber < req.Parts[j].PartNumber }) {
+		writeError(w, r, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order")
+		return
+	}
+
+	var (
+		data  bytes.Buffer
+		sums  []byte
+		sizes []int
+	)
+	for _, p := range req.Parts {
+		part, ok := u.parts[p.PartNumber]
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+			return
+		}
+		sum := md5.Sum(part)
+		if strings.Trim(p.ETag, `"`) != hex.EncodeToString(sum[:]) {
+			writeError(w, r, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+			return
+		}
+		data.Write(part)
+		sums = append(sums, sum[:]...)
+		sizes = append(sizes, len(part))
+	}
+
+	if !checkConditions(w, r, b.objects[key]) {
+		return
+	}
+
+	obj := newObject(data.Bytes(), u.header, u.acl)
+	total := md5.Sum(sums)
+	obj.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(total[:]), len(req.Parts))
+	obj.parts = sizes
+	b.objects[key] = obj
+	delete(s.uploads, id)
+
+	writeXML(w, http.StatusOK, completeResult{Xmlns: xmlns, Bucket: u.bucket, Key: key, ETag: obj.etag})
+}
+
+func (s *Server) putObjectACL(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj, ok := b.objects[key]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	acl := r.Header.Get("X-Amz-Acl")
+	if acl == "" && r.ContentLength != 0 {
+		// Explicit grants: only the public read grant of getObjectACL is kept.
+		var req aclRequest
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "MalformedACLError", err.Error())
+			return
+		}
+		acl = "private"
+		for _, g := range req.Grants {
+			if g.URI == "http://acs.amazonaws.com/groups/global/AllUsers" && g.Permission == "READ" {
+				acl = "public-read"
+			}
+		}
+	}
+	obj.acl = acl
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getObjectACL(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj, ok := b.objects[key]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	res := aclResult{Xmlns: xmlns, Owner: owner{ID: "s3test", DisplayName: "s3test"}}
+	res.Grants = append(res.Grants, grant{
+		Grantee:    grantee{XMLNSXSI: "http://www.w3.org/2001/XMLSchema-instance", Type: "CanonicalUser", ID: "s3test", DisplayName: "s3test"},
+		Permission: "FULL_CONTROL",
+	})
+	if obj.acl == "public-read" || obj.acl == "public-read-write" {
+		res.Grants = append(res.Grants, grant{
+			Grantee:    grantee{XMLNSXSI: "http://www.w3.org/2001/XMLSchema-instance", Type: "Group", URI: "http://acs.amazonaws.com/groups/global/AllUsers"},
+			Permission: "READ",
+		})
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, errorResponse{Code: code, Message: message, Resource: r.URL.Path})
+}
+
+func has(q url.Values, name string) bool {
+	_, ok := q[name]
+	return ok
+}
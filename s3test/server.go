@@ -0,0 +1,164 @@
+// Package s3test provides an in-process server speaking the subset of the S3
+// REST protocol used by the s3 package, so tests can exercise the real
+// aws-sdk-go code path against NewS3Client.
+//
+//	srv := s3test.NewServer()
+//	defer srv.Close()
+//	srv.CreateBucket("test")
+//	opt := srv.Options("test")
+//	i := s3.New(s3.NewS3Client(opt), opt)
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+// Server is an S3-compatible HTTP stand-in that keeps objects in memory.
+// Requests are not authenticated; any SigV4 Authorization header is accepted.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	uploads map[string]*upload
+	nextID  int
+}
+
+type bucket struct {
+	objects map[string]*object
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	header       http.Header
+	acl          string
+	// parts are the part sizes of a multipart upload.
+	parts []int
+}
+
+type upload struct {
+	bucket string
+	key    string
+	header http.Header
+	acl    string
+	parts  map[int][]byte
+}
+
+// NewServer starts a server with no buckets.
+func NewServer() *Server {
+	s := &Server{
+		buckets: map[string]*bucket{},
+		uploads: map[string]*upload{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// CreateBucket creates an empty bucket if it does not exist.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[name]; !ok {
+		s.buckets[name] = &bucket{objects: map[string]*object{}}
+	}
+}
+
+// Options returns s3.Options that point NewS3Client at the server in path style.
+func (s *Server) Options(bucketName string) s3.Options {
+	return s3.Options{
+		Key:            "s3test",
+		Secret:         "s3test",
+		Endpoint:       s.URL,
+		Region:         "us-east-1",
+		Bucket:         bucketName,
+		ForcePathStyle: true,
+		DisableSSL:     true,
+	}
+}
+
+// Keys returns the keys stored in a bucket in lexical order.
+func (s *Server) Keys(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil
+	}
+	return b.sortedKeys()
+}
+
+// Uploads returns the number of multipart uploads neither completed nor aborted.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.uploads)
+}
+
+func (b *bucket) sortedKeys() []string {
+	keys := make([]string, 0, len(b.objects))
+	for k := range b.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// objectHeaders are the request headers stored with an object and returned on reads.
+var objectHeaders = []string{
+	"Content-Type",
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Language",
+	"Content-Encoding",
+	"X-Amz-Storage-Class",
+	"X-Amz-Tagging",
+}
+
+func storedHeader(r http.Header) http.Header {
+	h := http.Header{}
+	for _, name := range objectHeaders {
+		if v := r.Get(name); v != "" {
+			h.Set(name, v)
+		}
+	}
+	for name, v := range r {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			h[name] = v
+		}
+	}
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "binary/octet-stream")
+	}
+	return h
+}
+
+func newObject(data []byte, header http.Header, acl string) *object {
+	sum := md5.Sum(data)
+	return &object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		header:       header,
+		acl:          acl,
+	}
+}
+
+func (s *Server) newUploadID() string {
+	s.nextID++
+	return fmt.Sprintf("upload-%d", s.nextID)
+}
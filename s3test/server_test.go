@@ -0,0 +1,446 @@
+package s3test_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/s3test"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func TestServer_Conformance(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	storagetest.TestS3Interactor(t, func(t *testing.T) *s3.Interactor {
+		opt := srv.Options("test")
+		return s3.New(s3.NewS3Client(opt), opt)
+	})
+}
+
+func TestServer_VirtualHost(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	// Resolve every host to the server so bucket.s3.test reaches it.
+	addr := srv.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("s3test", "s3test", ""),
+		Endpoint:    aws.String("http://s3.test:" + port),
+		Region:      aws.String("us-east-1"),
+		DisableSSL:  aws.Bool(true),
+		HTTPClient:  client,
+	}))
+
+	i := s3.New(awss3.New(sess), s3.Options{Bucket: "test"})
+	if err := i.Upload(strings.NewReader("hello"), "a/b.txt", s3.Private, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := srv.Keys("test"), []string{"a/b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestServer_Multipart(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	opt := srv.Options("test")
+	client := s3.NewS3Client(opt)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 12<<16)
+
+	up := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		u.PartSize = s3manager.MinUploadPartSize
+	})
+	out, err := up.Upload(&s3manager.UploadInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String("big"),
+		Body:   bytes.NewReader(body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.UploadID == "" {
+		t.Error("upload was not multipart")
+	}
+
+	r, _, err := s3.New(client, opt).Download("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("downloaded %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func TestServer_UploadPartCopy(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	opt := srv.Options("test")
+	client := s3.NewS3Client(opt)
+	i := s3.New(client, opt)
+	if err := i.Upload(strings.NewReader("0123456789"), "src", s3.Public, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := client.CreateMultipartUploadWithContext(context.Background(), &awss3.CreateMultipartUploadInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String("dst"),
+		ACL:    aws.String("public-read"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []*awss3.CompletedPart
+	for n, rng := range []string{"bytes=6-9", "bytes=0-5"} {
+		out, err := client.UploadPartCopyWithContext(context.Background(), &awss3.UploadPartCopyInput{
+			Bucket:          aws.String("test"),
+			Key:             aws.String("dst"),
+			UploadId:        up.UploadId,
+			PartNumber:      aws.Int64(int64(n + 1)),
+			CopySource:      aws.String("test/src"),
+			CopySourceRange: aws.String(rng),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, &awss3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: aws.Int64(int64(n + 1))})
+	}
+
+	_, err = client.UploadPartCopyWithContext(context.Background(), &awss3.UploadPartCopyInput{
+		Bucket:            aws.String("test"),
+		Key:               aws.String("dst"),
+		UploadId:          up.UploadId,
+		PartNumber:        aws.Int64(3),
+		CopySource:        aws.String("test/src"),
+		CopySourceIfMatch: aws.String(`"stale"`),
+	})
+	if !s3.IsPreconditionFailed(err) {
+		t.Errorf("UploadPartCopy() of a changed source error = %v, want precondition failed", err)
+	}
+
+	if _, err := client.CompleteMultipartUploadWithContext(context.Background(), &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("test"),
+		Key:             aws.String("dst"),
+		UploadId:        up.UploadId,
+		MultipartUpload: &awss3.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _, err := i.Download("dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "6789012345" {
+		t.Errorf("dst = %q, want %q", got, "6789012345")
+	}
+	if !isPublic(t, i, "dst") {
+		t.Error("completed upload is private, want the ACL it was created with")
+	}
+}
+
+func TestServer_UploadStream(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+	i := s3.New(s3.NewS3Client(srv.Options("test")), srv.Options("test"))
+
+	body := bytes.Repeat([]byte("0123456789abcdef"), 9<<16)
+	if err := i.UploadStream(bytes.NewReader(body), "big", s3.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := i.Stat("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Size != int64(len(body)) || !strings.HasSuffix(strings.Trim(attrs.ETag, `"`), "-2") {
+		t.Errorf("Stat() = %d bytes, ETag %s, want %d bytes in 2 parts", attrs.Size, attrs.ETag, len(body))
+	}
+
+	// The multipart ETag is checked against the part sizes.
+	dir, err := ioutil.TempDir("", "s3test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "big")
+	if err := i.DownloadToFile(context.Background(), "big", path, s3.DownloadOptions{ChunkSize: 1 << 20}); err != nil {
+		t.Fatalf("DownloadToFile() error = %v", err)
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, body) {
+		t.Errorf("DownloadToFile() wrote %d bytes, want %d", len(got), len(body))
+	}
+
+	if err := i.UploadStream(bytes.NewReader(body), "big", s3.UploadOptions{IfNotExist: true}); !s3.IsPreconditionFailed(err) {
+		t.Errorf("UploadStream(IfNotExist) error = %v, want precondition failed", err)
+	}
+
+	r := io.MultiReader(bytes.NewReader(body), iotest.TimeoutReader(strings.NewReader("x")))
+	if err := i.UploadStream(r, "broken", s3.UploadOptions{}); err == nil {
+		t.Error("UploadStream() error = nil, want the read error")
+	}
+	if got, want := srv.Keys("test"), []string{"big"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if n := srv.Uploads(); n != 0 {
+		t.Errorf("Uploads() = %d, want the failed upload aborted", n)
+	}
+}
+
+func TestServer_Range(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	opt := srv.Options("test")
+	client := s3.NewS3Client(opt)
+	if err := s3.New(client, opt).Upload(strings.NewReader("0123456789"), "k", s3.Private, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rng  string
+		want string
+	}{
+		{"bytes=2-4", "234"},
+		{"bytes=7-", "789"},
+		{"bytes=-2", "89"},
+		{"bytes=8-100", "89"},
+	}
+	for _, tt := range tests {
+		out, err := client.GetObject(&awss3.GetObjectInput{
+			Bucket: aws.String("test"),
+			Key:    aws.String("k"),
+			Range:  aws.String(tt.rng),
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.rng, err)
+		}
+		got, _ := ioutil.ReadAll(out.Body)
+		out.Body.Close()
+		if string(got) != tt.want {
+			t.Errorf("%s = %q, want %q", tt.rng, got, tt.want)
+		}
+	}
+}
+
+func TestServer_ListDelimiter(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	opt := srv.Options("test")
+	client := s3.NewS3Client(opt)
+	i := s3.New(client, opt)
+	for _, k := range []string{"a/1", "a/2", "b/1", "c"} {
+		if err := i.Upload(strings.NewReader(k), k, s3.Private, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := client.ListObjectsV2(&awss3.ListObjectsV2Input{
+		Bucket:    aws.String("test"),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefixes, keys []string
+	for _, p := range out.CommonPrefixes {
+		prefixes = append(prefixes, aws.StringValue(p.Prefix))
+	}
+	for _, o := range out.Contents {
+		keys = append(keys, aws.StringValue(o.Key))
+	}
+	if want := []string{"a/", "b/"}; !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("CommonPrefixes = %v, want %v", prefixes, want)
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Contents = %v, want %v", keys, want)
+	}
+
+	out, err = client.ListObjectsV2(&awss3.ListObjectsV2Input{
+		Bucket:  aws.String("test"),
+		MaxKeys: aws.Int64(3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !aws.BoolValue(out.IsTruncated) || len(out.Contents) != 3 {
+		t.Errorf("first page: truncated=%v len=%d", aws.BoolValue(out.IsTruncated), len(out.Contents))
+	}
+}
+
+func TestServer_NoSuchBucket(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+
+	opt := srv.Options("missing")
+	_, _, err := s3.New(s3.NewS3Client(opt), opt).Download("k")
+	if err == nil || !strings.Contains(err.Error(), "NoSuchBucket") {
+		t.Errorf("Download() err = %v, want NoSuchBucket", err)
+	}
+}
+
+func TestServer_UpdateMetadataKeepsACL(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+	opt := srv.Options("test")
+	i := s3.New(s3.NewS3Client(opt), opt)
+
+	if err := i.Upload(strings.NewReader("hello"), "a.txt", s3.Public, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.UpdateMetadata("a.txt", s3.UploadOptions{CacheControl: "no-cache"}); err != nil {
+		t.Fatalf("UpdateMetadata() error = %v", err)
+	}
+	if !isPublic(t, i, "a.txt") {
+		t.Error("object is private after UpdateMetadata(), want public read")
+	}
+}
+
+// replacingClient replaces the object after each HEAD request, as a
+// concurrent writer would between a stat and the request that relies on it.
+type replacingClient struct {
+	*awss3.S3
+}
+
+func (c replacingClient) HeadObjectWithContext(ctx aws.Context, input *awss3.HeadObjectInput, opts ...request.Option) (*awss3.HeadObjectOutput, error) {
+	out, err := c.S3.HeadObjectWithContext(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.S3.PutObjectWithContext(ctx, &awss3.PutObjectInput{
+		Bucket: input.Bucket,
+		Key:    input.Key,
+		Body:   strings.NewReader("replaced"),
+	})
+	return out, err
+}
+
+func TestServer_UpdateMetadataReplaced(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+	opt := srv.Options("test")
+	i := s3.New(s3.NewS3Client(opt), opt)
+	if err := i.Upload(strings.NewReader("hello"), "a.txt", s3.Private, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	replacing := s3.New(replacingClient{s3.NewS3Client(opt)}, opt)
+	err := replacing.UpdateMetadata("a.txt", s3.UploadOptions{ContentType: "text/html"})
+	if !s3.IsPreconditionFailed(err) {
+		t.Errorf("UpdateMetadata() of a replaced object error = %v, want precondition failed", err)
+	}
+}
+
+func TestServer_CopyResetsACL(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+	opt := srv.Options("test")
+	i := s3.New(s3.NewS3Client(opt), opt)
+
+	if err := i.Upload(strings.NewReader("hello"), "a.txt", s3.Public, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Copy("a.txt", "", "b.txt", s3.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if isPublic(t, i, "b.txt") {
+		t.Error("copy of a public object is public, want private")
+	}
+	if err := i.Copy("a.txt", "", "c.txt", s3.UploadOptions{KeepACL: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !isPublic(t, i, "c.txt") {
+		t.Error("copy with KeepACL is private, want public read")
+	}
+
+	// RestoreVersion copies the object onto itself and keeps its grants.
+	if err := i.RestoreVersion("a.txt", "v1"); err != nil {
+		t.Fatalf("RestoreVersion() error = %v", err)
+	}
+	if !isPublic(t, i, "a.txt") {
+		t.Error("object is private after RestoreVersion(), want public read")
+	}
+}
+
+func isPublic(t *testing.T, i *s3.Interactor, key string) bool {
+	t.Helper()
+	grants, err := i.GetACL(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range grants {
+		if g.URI == "http://acs.amazonaws.com/groups/global/AllUsers" && g.Permission == "READ" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServer_CopySource(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+
+	opt := srv.Options("test")
+	client := s3.NewS3Client(opt)
+	if err := s3.New(client, opt).Upload(strings.NewReader("v"), "a?b.txt", s3.Private, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []string{"test/a%3Fb.txt", "test/a%3Fb.txt?versionId=v1"} {
+		_, err := client.CopyObject(&awss3.CopyObjectInput{
+			Bucket:     aws.String("test"),
+			Key:        aws.String("copy.txt"),
+			CopySource: aws.String(src),
+		})
+		if err != nil {
+			t.Errorf("CopyObject(%s) error = %v", src, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package storage is the backend-neutral view of a gcs or s3 bucket that
+// migrate, archive and the stores of cas, lock, manifest and trash build on.
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+// Object describes a stored object and the attributes copied with it.
+type Object struct {
+	Key  string
+	Size int64
+	// MD5 is the content digest reported by the backend, nil when unknown.
+	MD5                []byte
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentLanguage    string
+	Metadata           map[string]string
+	Updated            time.Time
+}
+
+// Store is the minimal view of a bucket: enough to list, read and write objects.
+type Store interface {
+	List(ctx context.Context, prefix string) ([]string, error)
+	Stat(ctx context.Context, key string) (*Object, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Write stores the bytes of r under key. It must not leave a partial
+	// object behind when reading r fails.
+	Write(ctx context.Context, key string, r io.Reader, obj *Object) error
+	// Delete removes key.
+	Delete(ctx context.Context, key string) error
+}
+
+type gcsStore struct {
+	client gcs.Client
+}
+
+// FromGCS adapts a gcs.Client to a Store.
+func FromGCS(c gcs.Client) Store {
+	return &gcsStore{client: c}
+}
+
+func (g *gcsStore) List(ctx context.Context, prefix string) ([]string, error) {
+	return g.client.List(ctx, prefix)
+}
+
+func (g *gcsStore) Stat(ctx context.Context, key string) (*Object, error) {
+	attrs, err := g.client.Attrs(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Key:                key,
+		Size:               attrs.Size,
+		MD5:                attrs.MD5,
+		ContentType:        attrs.ContentType,
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentLanguage:    attrs.ContentLanguage,
+		Metadata:           attrs.Metadata,
+		Updated:            attrs.Updated,
+	}, nil
+}
+
+func (g *gcsStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return g.client.NewReader(ctx, key)
+}
+
+// Write cancels the upload when reading r fails, so nothing is committed.
+func (g *gcsStore) Write(ctx context.Context, key string, r io.Reader, obj *Object) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := g.client.NewWriter(ctx, key, gcs.PutOptions{
+		ContentType:        obj.ContentType,
+		CacheControl:       obj.CacheControl,
+		ContentDisposition: obj.ContentDisposition,
+		ContentLanguage:    obj.ContentLanguage,
+		Metadata:           obj.Metadata,
+	})
+
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+func (g *gcsStore) Delete(ctx context.Context, key string) error {
+	return g.client.Delete(ctx, key)
+}
+
+type s3Store struct {
+	interactor *s3.Interactor
+}
+
+// FromS3 adapts an s3.Interactor to a Store.
+func FromS3(i *s3.Interactor) Store {
+	return &s3Store{interactor: i}
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	return s.interactor.ListContext(ctx, prefix)
+}
+
+func (s *s3Store) Stat(ctx context.Context, key string) (*Object, error) {
+	attrs, err := s.interactor.StatContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Key:                key,
+		Size:               attrs.Size,
+		MD5:                attrs.ContentMD5(),
+		ContentType:        attrs.ContentType,
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentLanguage:    attrs.ContentLanguage,
+		Metadata:           attrs.Metadata,
+		Updated:            attrs.LastModified,
+	}, nil
+}
+
+func (s *s3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, _, err := s.interactor.DownloadContext(ctx, key)
+	return body, err
+}
+
+// Write streams r as a multipart upload, which is aborted if reading r fails.
+func (s *s3Store) Write(ctx context.Context, key string, r io.Reader, obj *Object) error {
+	return s.interactor.UploadStreamContext(ctx, r, key, s3.UploadOptions{
+		ContentType:        obj.ContentType,
+		CacheControl:       obj.CacheControl,
+		ContentDisposition: obj.ContentDisposition,
+		ContentLanguage:    obj.ContentLanguage,
+		Metadata:           obj.Metadata,
+	})
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	return s.interactor.RemoveContext(ctx, key)
+}
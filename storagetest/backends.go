@@ -0,0 +1,68 @@
+package storagetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/gcs/fake"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/s3test"
+)
+
+// Backend is an empty bucket of one backend, for tests of packages that
+// adapt both a gcs.Client and an s3.Interactor. Exactly one field is set.
+type Backend struct {
+	GCS gcs.Client
+	S3  *s3.Interactor
+}
+
+// RunBackends runs fn as a subtest named "gcs" against a gcs/fake bucket,
+// and as one named "s3" against a bucket of an s3test server.
+//
+//	storagetest.RunBackends(t, func(t *testing.T, b storagetest.Backend) {
+//		store := FromS3(b.S3)
+//		if b.GCS != nil {
+//			store = FromGCS(b.GCS)
+//		}
+//		...
+//	})
+func RunBackends(t *testing.T, fn func(t *testing.T, b Backend)) {
+	t.Run("gcs", func(t *testing.T) {
+		fn(t, Backend{GCS: fake.New("test")})
+	})
+	t.Run("s3", func(t *testing.T) {
+		srv := s3test.NewServer()
+		defer srv.Close()
+		srv.CreateBucket("test")
+		opt := srv.Options("test")
+		fn(t, Backend{S3: s3.New(s3.NewS3Client(opt), opt)})
+	})
+}
+
+// Clock is a manually advanced time source for code that reads the time
+// through a func() time.Time.
+type Clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewClock returns a Clock set to t.
+func NewClock(t time.Time) *Clock {
+	return &Clock{t: t}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
@@ -0,0 +1,383 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hayashiki/go-pkg/gcs"
+)
+
+// TestGCSClient runs the conformance tests against clients returned by newClient.
+// Each test writes under its own prefix, so clients may share a bucket.
+func TestGCSClient(t *testing.T, newClient func(t *testing.T) gcs.Client, opts ...Options) {
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	opt = opt.withDefaults()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, c gcs.Client, opt Options)
+	}{
+		{"RoundTrip", gcsRoundTrip},
+		{"Overwrite", gcsOverwrite},
+		{"NotFound", gcsNotFound},
+		{"ListOrderAndPrefix", gcsList},
+		{"DeleteIdempotence", gcsDelete},
+		{"Metadata", gcsMetadata},
+		{"Conditions", gcsConditions},
+		{"Copy", gcsCopy},
+		{"LargeBody", gcsLarge},
+		{"RangeRead", gcsRange},
+		{"DownloadToFile", gcsDownloadToFile},
+		{"Concurrency", gcsConcurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newClient(t), opt)
+		})
+	}
+}
+
+func gcsRoundTrip(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	for _, data := range [][]byte{[]byte("hello"), {}} {
+		if err := c.Put(ctx, key, data); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		got, err := c.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		equalBytes(t, "Get()", got, data)
+	}
+}
+
+func gcsOverwrite(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	if err := c.Put(ctx, key, []byte("first")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := c.Put(ctx, key, []byte("second")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	got, err := c.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	equalBytes(t, "Get()", got, []byte("second"))
+}
+
+func gcsNotFound(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "missing"
+
+	if _, err := c.Get(ctx, key); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Errorf("Get() error = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+	if _, err := c.Attrs(ctx, key); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Errorf("Attrs() error = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+	if r, err := c.NewReader(ctx, key); !errors.Is(err, gcs.ErrObjectNotExist) {
+		if r != nil {
+			r.Close()
+		}
+		t.Errorf("NewReader() error = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+}
+
+func gcsList(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	p := prefix(t)
+
+	for _, k := range []string{"b", "a/2", "a/1", "ab", "a/10"} {
+		if err := c.Put(ctx, p+k, []byte(k)); err != nil {
+			t.Fatalf("Put(%s) error = %v", k, err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"a/1", "a/10", "a/2", "ab", "b"}},
+		{"a/", []string{"a/1", "a/10", "a/2"}},
+		{"a", []string{"a/1", "a/10", "a/2", "ab"}},
+		{"c", nil},
+	}
+	for _, tt := range tests {
+		got, err := c.List(ctx, p+tt.prefix)
+		if err != nil {
+			t.Fatalf("List(%q) error = %v", tt.prefix, err)
+		}
+		var want []string
+		for _, k := range tt.want {
+			want = append(want, p+k)
+		}
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("List(%q) = %v, want %v", tt.prefix, got, want)
+		}
+	}
+}
+
+func gcsDelete(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	if err := c.Put(ctx, key, []byte("a")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := c.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := c.Get(ctx, key); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+	// GCS reports deleting a missing object; bulk deletes treat it as done.
+	if err := c.Delete(ctx, key); !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Errorf("second Delete() error = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+	if err := c.DeleteMany(ctx, []string{key}); err != nil {
+		t.Errorf("DeleteMany() of missing object error = %v", err)
+	}
+}
+
+func gcsMetadata(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.json"
+
+	opts := gcs.PutOptions{
+		ContentType:  "application/json",
+		CacheControl: "max-age=60",
+		Metadata:     map[string]string{"owner": "storagetest"},
+	}
+	if err := c.PutWithOptions(ctx, key, []byte(`{}`), opts); err != nil {
+		t.Fatalf("PutWithOptions() error = %v", err)
+	}
+
+	attrs, err := c.Attrs(ctx, key)
+	if err != nil {
+		t.Fatalf("Attrs() error = %v", err)
+	}
+	if attrs.Size != 2 || attrs.ContentType != opts.ContentType || attrs.CacheControl != opts.CacheControl ||
+		!reflect.DeepEqual(attrs.Metadata, opts.Metadata) {
+		t.Errorf("Attrs() = %+v, want size 2 and %+v", attrs, opts)
+	}
+
+	if err := c.UpdateMetadata(ctx, key, gcs.PutOptions{Metadata: map[string]string{"owner": "updated"}}); err != nil {
+		t.Fatalf("UpdateMetadata() error = %v", err)
+	}
+	attrs, err = c.Attrs(ctx, key)
+	if err != nil {
+		t.Fatalf("Attrs() error = %v", err)
+	}
+	if attrs.Metadata["owner"] != "updated" || attrs.ContentType != opts.ContentType {
+		t.Errorf("Attrs() after UpdateMetadata() = %+v", attrs)
+	}
+}
+
+func gcsConditions(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "lock"
+
+	if err := c.PutWithOptions(ctx, key, []byte("1"), gcs.PutOptions{IfNotExist: true}); err != nil {
+		t.Fatalf("PutWithOptions(IfNotExist) error = %v", err)
+	}
+	if err := c.PutWithOptions(ctx, key, []byte("2"), gcs.PutOptions{IfNotExist: true}); !gcs.IsPreconditionFailed(err) {
+		t.Errorf("second PutWithOptions(IfNotExist) error = %v, want precondition failed", err)
+	}
+
+	attrs, err := c.Attrs(ctx, key)
+	if err != nil {
+		t.Fatalf("Attrs() error = %v", err)
+	}
+	if err := c.PutWithOptions(ctx, key, []byte("3"), gcs.PutOptions{IfGenerationMatch: attrs.Generation}); err != nil {
+		t.Fatalf("PutWithOptions(IfGenerationMatch) error = %v", err)
+	}
+	if err := c.PutWithOptions(ctx, key, []byte("4"), gcs.PutOptions{IfGenerationMatch: attrs.Generation}); !gcs.IsPreconditionFailed(err) {
+		t.Errorf("stale PutWithOptions(IfGenerationMatch) error = %v, want precondition failed", err)
+	}
+
+	got, err := c.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	equalBytes(t, "Get()", got, []byte("3"))
+}
+
+func gcsCopy(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	src, dst := prefix(t)+"src", prefix(t)+"dst"
+
+	if err := c.PutWithOptions(ctx, src, []byte("a"), gcs.PutOptions{ContentType: "text/plain", Metadata: map[string]string{"k": "v"}}); err != nil {
+		t.Fatalf("PutWithOptions() error = %v", err)
+	}
+	attrs, err := c.Attrs(ctx, src)
+	if err != nil {
+		t.Fatalf("Attrs() error = %v", err)
+	}
+
+	opts := gcs.PutOptions{Metadata: map[string]string{"k": "w"}, IfNotExist: true}
+	if err := c.Copy(ctx, src, attrs.Generation, dst, opts); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if err := c.Copy(ctx, src, attrs.Generation, dst, opts); !gcs.IsPreconditionFailed(err) {
+		t.Errorf("second Copy(IfNotExist) error = %v, want precondition failed", err)
+	}
+	got, err := c.Get(ctx, dst)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	equalBytes(t, "Get()", got, []byte("a"))
+	copied, err := c.Attrs(ctx, dst)
+	if err != nil {
+		t.Fatalf("Attrs() error = %v", err)
+	}
+	if copied.ContentType != "text/plain" || copied.Metadata["k"] != "w" {
+		t.Errorf("copied attrs = %s %v, want text/plain map[k:w]", copied.ContentType, copied.Metadata)
+	}
+
+	if err := c.Copy(ctx, src, 0, dst, gcs.PutOptions{Metadata: map[string]string{}}); err != nil {
+		t.Fatalf("Copy(empty metadata) error = %v", err)
+	}
+	if copied, err := c.Attrs(ctx, dst); err != nil || len(copied.Metadata) != 0 {
+		t.Errorf("Attrs() = %v, %v, want no metadata", copied.Metadata, err)
+	}
+}
+
+func gcsLarge(t *testing.T, c gcs.Client, opt Options) {
+	ctx := context.Background()
+	key := prefix(t) + "large.bin"
+	data := body(opt.LargeSize)
+
+	if err := c.Put(ctx, key, data); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	got, err := c.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	equalBytes(t, "Get()", got, data)
+}
+
+func gcsRange(t *testing.T, c gcs.Client, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	if err := c.Put(ctx, key, []byte("0123456789")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 4, "0123"},
+		{4, 3, "456"},
+		{7, -1, "789"},
+		{8, 10, "89"},
+	}
+	for _, tt := range tests {
+		r, err := c.NewRangeReader(ctx, key, tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("NewRangeReader(%d, %d) error = %v", tt.offset, tt.length, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("NewRangeReader(%d, %d) read error = %v", tt.offset, tt.length, err)
+		}
+		equalBytes(t, fmt.Sprintf("NewRangeReader(%d, %d)", tt.offset, tt.length), got, []byte(tt.want))
+	}
+
+	// A generation is read as written, or not at all once replaced.
+	attrs, err := c.Attrs(ctx, key)
+	if err != nil {
+		t.Fatalf("Attrs() error = %v", err)
+	}
+	r, err := c.NewVersionRangeReader(ctx, key, attrs.Generation, 2, 3)
+	if err != nil {
+		t.Fatalf("NewVersionRangeReader() error = %v", err)
+	}
+	got, _ := ioutil.ReadAll(r)
+	r.Close()
+	equalBytes(t, "NewVersionRangeReader()", got, []byte("234"))
+
+	if err := c.Put(ctx, key, []byte("abcdefghij")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if r, err := c.NewVersionRangeReader(ctx, key, attrs.Generation, 2, 3); err == nil {
+		got, _ := ioutil.ReadAll(r)
+		r.Close()
+		equalBytes(t, "NewVersionRangeReader() of a replaced generation", got, []byte("234"))
+	} else if !errors.Is(err, gcs.ErrObjectNotExist) {
+		t.Errorf("NewVersionRangeReader() of a replaced generation error = %v, want %v", err, gcs.ErrObjectNotExist)
+	}
+}
+
+func gcsDownloadToFile(t *testing.T, c gcs.Client, opt Options) {
+	ctx := context.Background()
+	key := prefix(t) + "large.bin"
+	data := body(opt.LargeSize)
+
+	if err := c.Put(ctx, key, data); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	downloadToFile(t, data, func(path string) error {
+		return c.DownloadToFile(ctx, key, path, gcs.DownloadOptions{ChunkSize: int64(len(data)/5 + 1), Concurrency: 3})
+	})
+}
+
+func gcsConcurrency(t *testing.T, c gcs.Client, opt Options) {
+	ctx := context.Background()
+	p := prefix(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, opt.Concurrency)
+	for n := 0; n < opt.Concurrency; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			key := fmt.Sprintf("%s%03d", p, n)
+			data := body(1024 + n)
+			if err := c.Put(ctx, key, data); err != nil {
+				errs <- err
+				return
+			}
+			got, err := c.Get(ctx, key)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(got) != len(data) {
+				errs <- errors.New("concurrent Get() returned another object's body")
+			}
+		}(n)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	keys, err := c.List(ctx, p)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(keys) != opt.Concurrency {
+		t.Errorf("List() returned %d keys, want %d", len(keys), opt.Concurrency)
+	}
+}
@@ -0,0 +1,389 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hayashiki/go-pkg/s3"
+)
+
+// TestS3Interactor runs the conformance tests against interactors returned by
+// newInteractor, which wrap the s3.Client implementation under test.
+// Each test writes under its own prefix, so interactors may share a bucket.
+func TestS3Interactor(t *testing.T, newInteractor func(t *testing.T) *s3.Interactor, opts ...Options) {
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	opt = opt.withDefaults()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, i *s3.Interactor, opt Options)
+	}{
+		{"RoundTrip", s3RoundTrip},
+		{"Overwrite", s3Overwrite},
+		{"NotFound", s3NotFound},
+		{"ListOrderAndPrefix", s3List},
+		{"DeleteIdempotence", s3Delete},
+		{"Metadata", s3Metadata},
+		{"Conditions", s3Conditions},
+		{"Copy", s3Copy},
+		{"LargeBody", s3Large},
+		{"RangeRead", s3Range},
+		{"DownloadToFile", s3DownloadToFile},
+		{"Concurrency", s3Concurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newInteractor(t), opt)
+		})
+	}
+}
+
+func s3Get(ctx context.Context, i *s3.Interactor, key string) ([]byte, string, error) {
+	r, contentType, err := i.DownloadContext(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if contentType == nil {
+		return b, "", err
+	}
+	return b, *contentType, err
+}
+
+func s3RoundTrip(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	for _, data := range [][]byte{[]byte("hello"), {}} {
+		if err := i.UploadContext(ctx, bytes.NewReader(data), key, s3.Private, "text/plain"); err != nil {
+			t.Fatalf("UploadContext() error = %v", err)
+		}
+		got, contentType, err := s3Get(ctx, i, key)
+		if err != nil {
+			t.Fatalf("DownloadContext() error = %v", err)
+		}
+		equalBytes(t, "DownloadContext()", got, data)
+		if contentType != "text/plain" {
+			t.Errorf("DownloadContext() content type = %q, want text/plain", contentType)
+		}
+	}
+}
+
+func s3Overwrite(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	for _, data := range []string{"first", "second"} {
+		if err := i.UploadContext(ctx, bytes.NewReader([]byte(data)), key, s3.Private, "text/plain"); err != nil {
+			t.Fatalf("UploadContext() error = %v", err)
+		}
+	}
+	got, _, err := s3Get(ctx, i, key)
+	if err != nil {
+		t.Fatalf("DownloadContext() error = %v", err)
+	}
+	equalBytes(t, "DownloadContext()", got, []byte("second"))
+}
+
+func s3NotFound(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "missing"
+
+	if _, _, err := i.DownloadContext(ctx, key); !s3.IsNotFound(err) {
+		t.Errorf("DownloadContext() error = %v, want not found", err)
+	}
+	if _, err := i.Stat(key); !s3.IsNotFound(err) {
+		t.Errorf("Stat() error = %v, want not found", err)
+	}
+}
+
+func s3List(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	p := prefix(t)
+
+	for _, k := range []string{"b", "a/2", "a/1", "ab", "a/10"} {
+		if err := i.UploadContext(ctx, bytes.NewReader([]byte(k)), p+k, s3.Private, "text/plain"); err != nil {
+			t.Fatalf("UploadContext(%s) error = %v", k, err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"a/1", "a/10", "a/2", "ab", "b"}},
+		{"a/", []string{"a/1", "a/10", "a/2"}},
+		{"a", []string{"a/1", "a/10", "a/2", "ab"}},
+		{"c", nil},
+	}
+	for _, tt := range tests {
+		got, err := i.List(p + tt.prefix)
+		if err != nil {
+			t.Fatalf("List(%q) error = %v", tt.prefix, err)
+		}
+		var want []string
+		for _, k := range tt.want {
+			want = append(want, p+k)
+		}
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("List(%q) = %v, want %v", tt.prefix, got, want)
+		}
+	}
+}
+
+func s3Delete(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	if err := i.UploadContext(ctx, bytes.NewReader([]byte("a")), key, s3.Private, "text/plain"); err != nil {
+		t.Fatalf("UploadContext() error = %v", err)
+	}
+	if err := i.RemoveContext(ctx, key); err != nil {
+		t.Fatalf("RemoveContext() error = %v", err)
+	}
+	if _, _, err := i.DownloadContext(ctx, key); !s3.IsNotFound(err) {
+		t.Errorf("DownloadContext() after RemoveContext() error = %v, want not found", err)
+	}
+	// S3 deletes are idempotent.
+	if err := i.RemoveContext(ctx, key); err != nil {
+		t.Errorf("second RemoveContext() error = %v", err)
+	}
+	if err := i.DeleteMany([]string{key}); err != nil {
+		t.Errorf("DeleteMany() of missing key error = %v", err)
+	}
+}
+
+func s3Metadata(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.json"
+
+	opts := s3.UploadOptions{
+		ContentType:  "application/json",
+		CacheControl: "max-age=60",
+		Metadata:     map[string]string{"Owner": "storagetest"},
+	}
+	if err := i.UploadWithOptionsContext(ctx, bytes.NewReader([]byte(`{}`)), key, opts); err != nil {
+		t.Fatalf("UploadWithOptionsContext() error = %v", err)
+	}
+
+	attrs, err := i.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if attrs.Size != 2 || attrs.ContentType != opts.ContentType || attrs.CacheControl != opts.CacheControl ||
+		!reflect.DeepEqual(attrs.Metadata, opts.Metadata) {
+		t.Errorf("Stat() = %+v, want size 2 and %+v", attrs, opts)
+	}
+
+	if err := i.UpdateMetadata(key, s3.UploadOptions{Metadata: map[string]string{"Owner": "updated"}}); err != nil {
+		t.Fatalf("UpdateMetadata() error = %v", err)
+	}
+	attrs, err = i.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if attrs.Metadata["Owner"] != "updated" || attrs.ContentType != opts.ContentType {
+		t.Errorf("Stat() after UpdateMetadata() = %+v", attrs)
+	}
+}
+
+func s3Conditions(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "lock"
+	upload := func(data string, opts s3.UploadOptions) error {
+		return i.UploadWithOptionsContext(ctx, bytes.NewReader([]byte(data)), key, opts)
+	}
+
+	if err := upload("1", s3.UploadOptions{IfNotExist: true}); err != nil {
+		t.Fatalf("UploadWithOptionsContext(IfNotExist) error = %v", err)
+	}
+	if err := upload("2", s3.UploadOptions{IfNotExist: true}); !s3.IsPreconditionFailed(err) {
+		t.Errorf("second UploadWithOptionsContext(IfNotExist) error = %v, want precondition failed", err)
+	}
+
+	attrs, err := i.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if err := upload("3", s3.UploadOptions{IfMatch: attrs.ETag}); err != nil {
+		t.Fatalf("UploadWithOptionsContext(IfMatch) error = %v", err)
+	}
+	if err := upload("4", s3.UploadOptions{IfMatch: attrs.ETag}); !s3.IsPreconditionFailed(err) {
+		t.Errorf("stale UploadWithOptionsContext(IfMatch) error = %v, want precondition failed", err)
+	}
+	if err := i.RemoveIfMatchContext(ctx, key, attrs.ETag); !s3.IsPreconditionFailed(err) {
+		t.Errorf("stale RemoveIfMatchContext() error = %v, want precondition failed", err)
+	}
+
+	got, _, err := s3Get(ctx, i, key)
+	if err != nil {
+		t.Fatalf("DownloadContext() error = %v", err)
+	}
+	equalBytes(t, "DownloadContext()", got, []byte("3"))
+
+	if attrs, err = i.Stat(key); err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if err := i.RemoveIfMatchContext(ctx, key, attrs.ETag); err != nil {
+		t.Errorf("RemoveIfMatchContext() error = %v", err)
+	}
+}
+
+func s3Copy(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	src, dst := prefix(t)+"src", prefix(t)+"dst"
+
+	err := i.UploadWithOptionsContext(ctx, bytes.NewReader([]byte("a")), src, s3.UploadOptions{ContentType: "text/plain", Metadata: map[string]string{"Owner": "a"}})
+	if err != nil {
+		t.Fatalf("UploadWithOptionsContext() error = %v", err)
+	}
+	attrs, err := i.Stat(src)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+
+	opts := s3.UploadOptions{Metadata: map[string]string{"Owner": "b"}, IfNotExist: true}
+	if err := i.CopyContext(ctx, src, attrs.ETag, dst, opts); err != nil {
+		t.Fatalf("CopyContext() error = %v", err)
+	}
+	if err := i.CopyContext(ctx, src, attrs.ETag, dst, opts); !s3.IsPreconditionFailed(err) {
+		t.Errorf("second CopyContext(IfNotExist) error = %v, want precondition failed", err)
+	}
+	got, contentType, err := s3Get(ctx, i, dst)
+	if err != nil {
+		t.Fatalf("DownloadContext() error = %v", err)
+	}
+	equalBytes(t, "DownloadContext()", got, []byte("a"))
+	copied, err := i.Stat(dst)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if contentType != "text/plain" || copied.Metadata["Owner"] != "b" {
+		t.Errorf("copied attrs = %s %v, want text/plain Owner=b", contentType, copied.Metadata)
+	}
+
+	if err := i.UploadWithOptionsContext(ctx, bytes.NewReader([]byte("b")), src, s3.UploadOptions{}); err != nil {
+		t.Fatalf("UploadWithOptionsContext() error = %v", err)
+	}
+	if err := i.CopyContext(ctx, src, attrs.ETag, dst, s3.UploadOptions{}); !s3.IsPreconditionFailed(err) {
+		t.Errorf("CopyContext() of a replaced source error = %v, want precondition failed", err)
+	}
+}
+
+func s3Large(t *testing.T, i *s3.Interactor, opt Options) {
+	ctx := context.Background()
+	key := prefix(t) + "large.bin"
+	data := body(opt.LargeSize)
+
+	if err := i.UploadContext(ctx, bytes.NewReader(data), key, s3.Private, "application/octet-stream"); err != nil {
+		t.Fatalf("UploadContext() error = %v", err)
+	}
+	got, _, err := s3Get(ctx, i, key)
+	if err != nil {
+		t.Fatalf("DownloadContext() error = %v", err)
+	}
+	equalBytes(t, "DownloadContext()", got, data)
+}
+
+func s3Range(t *testing.T, i *s3.Interactor, _ Options) {
+	ctx := context.Background()
+	key := prefix(t) + "a.txt"
+
+	if err := i.UploadContext(ctx, bytes.NewReader([]byte("0123456789")), key, s3.Private, "text/plain"); err != nil {
+		t.Fatalf("UploadContext() error = %v", err)
+	}
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 4, "0123"},
+		{4, 3, "456"},
+		{7, -1, "789"},
+		{8, 10, "89"},
+	}
+	for _, tt := range tests {
+		r, err := i.DownloadRangeContext(ctx, key, tt.offset, tt.length, "")
+		if err != nil {
+			t.Fatalf("DownloadRangeContext(%d, %d) error = %v", tt.offset, tt.length, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("DownloadRangeContext(%d, %d) read error = %v", tt.offset, tt.length, err)
+		}
+		equalBytes(t, fmt.Sprintf("DownloadRangeContext(%d, %d)", tt.offset, tt.length), got, []byte(tt.want))
+	}
+
+	if _, err := i.DownloadRangeContext(ctx, key, 0, 1, `"stale"`); !s3.IsPreconditionFailed(err) {
+		t.Errorf("DownloadRangeContext() with stale ETag error = %v, want a precondition failure", err)
+	}
+}
+
+func s3DownloadToFile(t *testing.T, i *s3.Interactor, opt Options) {
+	ctx := context.Background()
+	key := prefix(t) + "large.bin"
+	data := body(opt.LargeSize)
+
+	if err := i.UploadContext(ctx, bytes.NewReader(data), key, s3.Private, "application/octet-stream"); err != nil {
+		t.Fatalf("UploadContext() error = %v", err)
+	}
+	downloadToFile(t, data, func(path string) error {
+		return i.DownloadToFile(ctx, key, path, s3.DownloadOptions{ChunkSize: int64(len(data)/5 + 1), Concurrency: 3})
+	})
+}
+
+func s3Concurrency(t *testing.T, i *s3.Interactor, opt Options) {
+	ctx := context.Background()
+	p := prefix(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, opt.Concurrency)
+	for n := 0; n < opt.Concurrency; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			key := fmt.Sprintf("%s%03d", p, n)
+			data := body(1024 + n)
+			if err := i.UploadContext(ctx, bytes.NewReader(data), key, s3.Private, "application/octet-stream"); err != nil {
+				errs <- err
+				return
+			}
+			got, _, err := s3Get(ctx, i, key)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(got) != len(data) {
+				errs <- errors.New("concurrent DownloadContext() returned another object's body")
+			}
+		}(n)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	keys, err := i.List(p)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(keys) != opt.Concurrency {
+		t.Errorf("List() returned %d keys, want %d", len(keys), opt.Concurrency)
+	}
+}
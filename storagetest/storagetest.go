@@ -0,0 +1,87 @@
+// Package storagetest provides behavioural conformance tests for
+// implementations of gcs.Client and s3.Client.
+//
+// Run it from a test of the implementation:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.TestGCSClient(t, func(t *testing.T) gcs.Client {
+//			return newFakeClient()
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Options tunes the suites for slow or size-limited backends.
+type Options struct {
+	// LargeSize is the body size of the large object test. Defaults to 8 MiB.
+	LargeSize int
+	// Concurrency is the number of goroutines of the concurrency test. Defaults to 16.
+	Concurrency int
+}
+
+func (o Options) withDefaults() Options {
+	if o.LargeSize == 0 {
+		o.LargeSize = 8 << 20
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = 16
+	}
+	return o
+}
+
+// prefix returns a per-test key prefix so tests sharing a bucket do not see each other's objects.
+func prefix(t *testing.T) string {
+	return fmt.Sprintf("storagetest/%s-%d/", t.Name(), rand.Int63())
+}
+
+// body returns n bytes of deterministic pseudo-random data.
+func body(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func equalBytes(t *testing.T, op string, got, want []byte) {
+	t.Helper()
+	if !bytes.Equal(got, want) {
+		if len(got) > 64 || len(want) > 64 {
+			t.Errorf("%s returned %d bytes, want %d matching bytes", op, len(got), len(want))
+			return
+		}
+		t.Errorf("%s = %q, want %q", op, got, want)
+	}
+}
+
+// downloadToFile runs download into a temporary directory and checks that it
+// leaves exactly want at the destination path.
+func downloadToFile(t *testing.T, want []byte, download func(path string) error) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "storagetest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.bin")
+	if err := download(path); err != nil {
+		t.Fatalf("DownloadToFile() error = %v", err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, "DownloadToFile()", got, want)
+
+	if names, _ := filepath.Glob(path + ".part*"); len(names) != 0 {
+		t.Errorf("DownloadToFile() left %v", names)
+	}
+}
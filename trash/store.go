@@ -0,0 +1,43 @@
+package trash
+
+import (
+	"context"
+
+	"github.com/hayashiki/go-pkg/gcs"
+	"github.com/hayashiki/go-pkg/internal/versioned"
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/storage"
+)
+
+// Store is the view of a bucket a Trash moves objects in. Objects are
+// copied server-side, and a source is only deleted while it is still the
+// version that was copied.
+type Store interface {
+	storage.Store
+	// StatVersion is Stat that also returns the version of key, its GCS
+	// generation or S3 ETag. It returns ErrNotExist for a missing key.
+	StatVersion(ctx context.Context, key string) (*storage.Object, string, error)
+	// Copy copies version of src to obj.Key with the attributes of obj. It
+	// fails with ErrConflict when obj.Key exists or src is no longer at
+	// version.
+	Copy(ctx context.Context, src, version string, obj *storage.Object) error
+	// DeleteVersion removes key only while it is still at version, and fails
+	// with ErrConflict otherwise.
+	DeleteVersion(ctx context.Context, key, version string) error
+}
+
+// ErrConflict is returned by a Store when a version or existence condition
+// does not hold.
+var ErrConflict = versioned.ErrConflict
+
+// FromGCS moves objects of a GCS bucket to and from its trash.
+func FromGCS(c gcs.Client) Store {
+	return versioned.FromGCS(c)
+}
+
+// FromS3 moves objects of an S3 bucket to and from its trash. Moved
+// objects keep their grants. Objects above 5 GB are moved with a multipart
+// copy, which does not keep their tags.
+func FromS3(i *s3.Interactor) Store {
+	return versioned.FromS3(i)
+}
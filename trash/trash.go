@@ -0,0 +1,220 @@
+// Package trash soft-deletes objects by moving them under a trash prefix,
+// from where they can be restored until a purge removes them for good.
+//
+//	t := trash.New(trash.FromGCS(c), trash.Options{Retention: 30 * 24 * time.Hour})
+//	item, err := t.Delete(ctx, "users/42/avatar.png")
+//	...
+//	key, err := t.Restore(ctx, item.ID)
+//
+// A trashed object is stored as <Prefix><deletion time>/<key>, with its
+// attributes and the trash metadata keys below, so items list in deletion
+// order and the trash can be inspected with any bucket browser.
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hayashiki/go-pkg/internal/versioned"
+)
+
+// Metadata keys added to a trashed object.
+const (
+	MetaDeletedAt   = "trash-deleted-at"
+	MetaOriginalKey = "trash-original-key"
+)
+
+// timeFormat is the deletion time in trash keys. It has a fixed width, so
+// keys sort by deletion time.
+const timeFormat = "20060102T150405.000000000Z"
+
+var (
+	// ErrNotExist is returned when the object to move does not exist.
+	ErrNotExist = versioned.ErrNotExist
+	// ErrNotTrash is returned for an ID that is not a trash key.
+	ErrNotTrash = errors.New("trash: not an item in the trash")
+	// ErrExists is returned by Restore when the original key has been
+	// written again since the object was deleted.
+	ErrExists = errors.New("trash: original key exists")
+	// ErrChanged is returned when an object was replaced while it was being
+	// moved. The replacement is left in place and nothing is trashed.
+	ErrChanged = errors.New("trash: object changed during the move")
+)
+
+// Options configures a Trash.
+type Options struct {
+	// Prefix holds the trashed objects. Defaults to ".trash/".
+	Prefix string
+	// Retention is how long an item stays in the trash before Purge removes
+	// it. Defaults to 30 days.
+	Retention time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Prefix == "" {
+		o.Prefix = ".trash/"
+	}
+	if o.Retention <= 0 {
+		o.Retention = 30 * 24 * time.Hour
+	}
+	return o
+}
+
+// Item is an object in the trash.
+type Item struct {
+	// ID is the key of the trashed object.
+	ID string
+	// Key is the key the object was deleted from.
+	Key       string
+	DeletedAt time.Time
+}
+
+// Trash moves deleted objects under a prefix of the same bucket.
+type Trash struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+}
+
+// New returns a Trash for store.
+func New(store Store, opts Options) *Trash {
+	return &Trash{store: store, opts: opts.withDefaults(), now: time.Now}
+}
+
+// Delete moves key to the trash and returns the trashed item.
+func (t *Trash) Delete(ctx context.Context, key string) (Item, error) {
+	if strings.HasPrefix(key, t.opts.Prefix) {
+		return Item{}, fmt.Errorf("trash: %s is already in the trash", key)
+	}
+
+	deletedAt := t.now().UTC()
+	item := Item{ID: t.opts.Prefix + deletedAt.Format(timeFormat) + "/" + key, Key: key, DeletedAt: deletedAt}
+	err := t.move(ctx, key, item.ID, ErrChanged, func(meta map[string]string) {
+		meta[MetaDeletedAt] = deletedAt.Format(time.RFC3339Nano)
+		meta[MetaOriginalKey] = key
+	})
+	if err != nil {
+		return Item{}, fmt.Errorf("trash: delete %s: %w", key, err)
+	}
+	return item, nil
+}
+
+// Restore moves the item id back to its original key and returns that key.
+// It fails with ErrExists rather than overwrite a newer object.
+func (t *Trash) Restore(ctx context.Context, id string) (string, error) {
+	item, err := t.parse(id)
+	if err != nil {
+		return "", err
+	}
+
+	err = t.move(ctx, id, item.Key, ErrExists, func(meta map[string]string) {
+		// S3 returns metadata keys in canonical header case.
+		for k := range meta {
+			if strings.EqualFold(k, MetaDeletedAt) || strings.EqualFold(k, MetaOriginalKey) {
+				delete(meta, k)
+			}
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("trash: restore %s: %w", item.Key, err)
+	}
+	return item.Key, nil
+}
+
+// move copies src to dst server-side with the metadata changed by edit,
+// then deletes src. Only the version of src that was copied is deleted; if
+// src was replaced meanwhile, the copy is removed again and move fails with
+// ErrChanged. A failed copy condition is reported as conflict.
+func (t *Trash) move(ctx context.Context, src, dst string, conflict error, edit func(map[string]string)) error {
+	obj, version, err := t.store.StatVersion(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	meta := make(map[string]string, len(obj.Metadata)+2)
+	for k, v := range obj.Metadata {
+		meta[k] = v
+	}
+	edit(meta)
+
+	copied := *obj
+	copied.Key = dst
+	copied.Metadata = meta
+	if err := t.store.Copy(ctx, src, version, &copied); err != nil {
+		if errors.Is(err, ErrConflict) {
+			return conflict
+		}
+		return err
+	}
+
+	if err := t.store.DeleteVersion(ctx, src, version); err != nil {
+		if derr := t.store.Delete(ctx, dst); derr != nil {
+			return fmt.Errorf("%v; remove copy %s: %w", err, dst, derr)
+		}
+		if errors.Is(err, ErrConflict) {
+			return ErrChanged
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns the items whose original key starts with prefix, oldest
+// deletion first.
+func (t *Trash) List(ctx context.Context, prefix string) ([]Item, error) {
+	ids, err := t.store.List(ctx, t.opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("trash: list: %w", err)
+	}
+
+	var items []Item
+	for _, id := range ids {
+		item, err := t.parse(id)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(item.Key, prefix) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// Purge permanently removes the items deleted more than Retention ago and
+// returns them.
+func (t *Trash) Purge(ctx context.Context) ([]Item, error) {
+	items, err := t.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := t.now().Add(-t.opts.Retention)
+	var purged []Item
+	for _, item := range items {
+		if !item.DeletedAt.Before(cutoff) {
+			break
+		}
+		if err := t.store.Delete(ctx, item.ID); err != nil {
+			return purged, fmt.Errorf("trash: purge %s: %w", item.ID, err)
+		}
+		purged = append(purged, item)
+	}
+	return purged, nil
+}
+
+// parse reads the item of a trash key.
+func (t *Trash) parse(id string) (Item, error) {
+	rest := strings.TrimPrefix(id, t.opts.Prefix)
+	i := strings.IndexByte(rest, '/')
+	if rest == id || i < 0 || i == len(rest)-1 {
+		return Item{}, fmt.Errorf("%w: %s", ErrNotTrash, id)
+	}
+	deletedAt, err := time.Parse(timeFormat, rest[:i])
+	if err != nil {
+		return Item{}, fmt.Errorf("%w: %s", ErrNotTrash, id)
+	}
+	return Item{ID: id, Key: rest[i+1:], DeletedAt: deletedAt}, nil
+}
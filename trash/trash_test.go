@@ -0,0 +1,225 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hayashiki/go-pkg/s3"
+	"github.com/hayashiki/go-pkg/s3test"
+	"github.com/hayashiki/go-pkg/storage"
+	"github.com/hayashiki/go-pkg/storagetest"
+)
+
+func newStore(b storagetest.Backend) Store {
+	if b.GCS != nil {
+		return FromGCS(b.GCS)
+	}
+	return FromS3(b.S3)
+}
+
+func TestTrash(t *testing.T) {
+	storagetest.RunBackends(t, func(t *testing.T, backend storagetest.Backend) {
+		store := newStore(backend)
+		ctx := context.Background()
+		now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+		tr := New(store, Options{Retention: 24 * time.Hour})
+		tr.now = func() time.Time { return now }
+
+		write := func(key, body string) {
+			t.Helper()
+			obj := &storage.Object{Key: key, ContentType: "text/plain", Metadata: map[string]string{"owner": "42"}}
+			if err := store.Write(ctx, key, strings.NewReader(body), obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		read := func(key string) string {
+			t.Helper()
+			r, err := store.Open(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			data, _ := ioutil.ReadAll(r)
+			return string(data)
+		}
+
+		write("users/42/a.txt", "a")
+		write("users/43/b.txt", "b")
+
+		if _, err := tr.Delete(ctx, "users/42/missing.txt"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Delete() of missing key error = %v, want %v", err, ErrNotExist)
+		}
+
+		a, err := tr.Delete(ctx, "users/42/a.txt")
+		if err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if want := ".trash/20200901T120000.000000000Z/users/42/a.txt"; a.ID != want {
+			t.Errorf("Delete() ID = %q, want %q", a.ID, want)
+		}
+		if _, err := store.Stat(ctx, "users/42/a.txt"); err == nil {
+			t.Error("deleted object still exists")
+		}
+		obj, err := store.Stat(ctx, a.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.ContentType != "text/plain" || meta(obj.Metadata, "owner") != "42" || meta(obj.Metadata, MetaOriginalKey) != "users/42/a.txt" {
+			t.Errorf("trashed object = %+v", obj)
+		}
+
+		now = now.Add(12 * time.Hour)
+		b, err := tr.Delete(ctx, "users/43/b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		items, err := tr.List(ctx, "users/")
+		if err != nil || !reflect.DeepEqual(items, []Item{a, b}) {
+			t.Errorf("List() = %+v, %v, want %+v", items, err, []Item{a, b})
+		}
+		if items, _ := tr.List(ctx, "users/43/"); !reflect.DeepEqual(items, []Item{b}) {
+			t.Errorf("List(users/43/) = %+v, want %+v", items, []Item{b})
+		}
+
+		// A newer object is not overwritten by a restore.
+		write("users/43/b.txt", "new")
+		if _, err := tr.Restore(ctx, b.ID); !errors.Is(err, ErrExists) {
+			t.Errorf("Restore() over newer object error = %v, want %v", err, ErrExists)
+		}
+		if _, err := tr.Restore(ctx, "users/43/b.txt"); !errors.Is(err, ErrNotTrash) {
+			t.Errorf("Restore() of live key error = %v, want %v", err, ErrNotTrash)
+		}
+
+		key, err := tr.Restore(ctx, a.ID)
+		if err != nil || key != "users/42/a.txt" {
+			t.Fatalf("Restore() = %q, %v", key, err)
+		}
+		if got := read(key); got != "a" {
+			t.Errorf("restored body = %q, want %q", got, "a")
+		}
+		obj, err = store.Stat(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta(obj.Metadata, "owner") != "42" || meta(obj.Metadata, MetaDeletedAt) != "" {
+			t.Errorf("restored metadata = %v", obj.Metadata)
+		}
+
+		// b is kept for the 24h retention.
+		if purged, err := tr.Purge(ctx); err != nil || len(purged) != 0 {
+			t.Errorf("Purge() = %+v, %v, want nothing", purged, err)
+		}
+		now = now.Add(25 * time.Hour)
+		if purged, err := tr.Purge(ctx); err != nil || !reflect.DeepEqual(purged, []Item{b}) {
+			t.Errorf("Purge() = %+v, %v, want %+v", purged, err, []Item{b})
+		}
+		if items, _ := tr.List(ctx, ""); len(items) != 0 {
+			t.Errorf("List() after Purge() = %+v", items)
+		}
+	})
+}
+
+// racingStore writes over key once it has been copied, as a concurrent
+// writer between the copy and the delete of a move would.
+type racingStore struct {
+	Store
+	key  string
+	body string
+}
+
+func (s *racingStore) Copy(ctx context.Context, src, version string, obj *storage.Object) error {
+	if err := s.Store.Copy(ctx, src, version, obj); err != nil {
+		return err
+	}
+	if src != s.key {
+		return nil
+	}
+	return s.Store.Write(ctx, src, strings.NewReader(s.body), &storage.Object{Key: src, ContentType: "text/plain"})
+}
+
+func TestTrash_Changed(t *testing.T) {
+	storagetest.RunBackends(t, func(t *testing.T, backend storagetest.Backend) {
+		store := newStore(backend)
+		ctx := context.Background()
+		key := "users/42/a.txt"
+		if err := store.Write(ctx, key, strings.NewReader("old"), &storage.Object{Key: key, ContentType: "text/plain"}); err != nil {
+			t.Fatal(err)
+		}
+
+		tr := New(&racingStore{Store: store, key: key, body: "new"}, Options{})
+		if _, err := tr.Delete(ctx, key); !errors.Is(err, ErrChanged) {
+			t.Fatalf("Delete() error = %v, want %v", err, ErrChanged)
+		}
+
+		r, err := store.Open(ctx, key)
+		if err != nil {
+			t.Fatalf("replaced object was deleted: %v", err)
+		}
+		defer r.Close()
+		if data, _ := ioutil.ReadAll(r); string(data) != "new" {
+			t.Errorf("body = %q, want %q", data, "new")
+		}
+		if items, err := tr.List(ctx, ""); err != nil || len(items) != 0 {
+			t.Errorf("List() = %+v, %v, want nothing", items, err)
+		}
+	})
+}
+
+func TestTrash_KeepsACL(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("test")
+	opt := srv.Options("test")
+	i := s3.New(s3.NewS3Client(opt), opt)
+
+	key := "users/42/avatar.png"
+	if err := i.Upload(strings.NewReader("png"), key, s3.Public, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tr := New(FromS3(i), Options{})
+	item, err := tr.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPublic(t, i, item.ID) {
+		t.Errorf("trashed %s is private, want public read", item.ID)
+	}
+	if _, err := tr.Restore(ctx, item.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !isPublic(t, i, key) {
+		t.Errorf("restored %s is private, want public read", key)
+	}
+}
+
+func isPublic(t *testing.T, i *s3.Interactor, key string) bool {
+	t.Helper()
+	grants, err := i.GetACL(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range grants {
+		if g.URI == "http://acs.amazonaws.com/groups/global/AllUsers" && g.Permission == "READ" {
+			return true
+		}
+	}
+	return false
+}
+
+// meta looks up a metadata key case-insensitively, as S3 canonicalizes it.
+func meta(m map[string]string, key string) string {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
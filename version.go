@@ -1,6 +0,0 @@
-package main
-
-const (
-	version = "0.0.2"
-	revision = "HEAD"
-)